@@ -0,0 +1,60 @@
+// Package broker connects the services to MQTT: the broker they use is MQTT_BROKER_URL, or
+// tcp://MQTT_BROKER_HOST:1883, and mem:// is a broker embedded in the process.
+package broker
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MemURL is the broker embedded in the process
+const MemURL = "mem://"
+
+// URL returns the broker the service connects to:
+//   - MQTT_BROKER_URL, as tcp://host:port or mem://
+//   - tcp://MQTT_BROKER_HOST:1883
+//   - mem:// when only MQTT_EMBEDDED_LISTEN is set, the process hosts the broker of the others
+func URL() (string, error) {
+	if brokerURL := os.Getenv("MQTT_BROKER_URL"); brokerURL != "" {
+		return brokerURL, nil
+	}
+	if host := os.Getenv("MQTT_BROKER_HOST"); host != "" {
+		return fmt.Sprintf("tcp://%s:1883", host), nil
+	}
+	if os.Getenv("MQTT_EMBEDDED_LISTEN") != "" {
+		return MemURL, nil
+	}
+	return "", fmt.Errorf("MQTT_BROKER_HOST environment variable not set (or MQTT_BROKER_URL, mem:// for an embedded broker)")
+}
+
+// IsMem tells whether a broker URL is the embedded broker
+func IsMem(brokerURL string) bool {
+	return strings.HasPrefix(brokerURL, "mem:")
+}
+
+// NewClientOptions returns the client options with the broker of brokerURL. For mem:// the
+// embedded broker is started, on first use, and the client connects to it in memory.
+func NewClientOptions(brokerURL string) (*mqtt.ClientOptions, error) {
+	if brokerURL == "" {
+		return nil, fmt.Errorf("broker URL cannot be empty")
+	}
+	opts := mqtt.NewClientOptions()
+	if !IsMem(brokerURL) {
+		opts.AddBroker(brokerURL)
+		return opts, nil
+	}
+	embedded, err := Default()
+	if err != nil {
+		return nil, fmt.Errorf("starting the embedded broker: %v", err)
+	}
+	opts.AddBroker(MemURL)
+	opts.SetCustomOpenConnectionFn(func(*url.URL, mqtt.ClientOptions) (net.Conn, error) {
+		return embedded.Dial()
+	})
+	return opts, nil
+}
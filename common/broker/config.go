@@ -0,0 +1,323 @@
+package broker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultQoS is the QoS of the publishes of a topic without its own, the one the services
+// subscribe with
+const DefaultQoS = 1
+
+// Config is the connection of a service to the broker and how it publishes on each topic. It is
+// read from the YAML file of MQTT_CONFIG, then the environment, then the command line flags.
+type Config struct {
+	URL         string           `yaml:"url"` // tcp://, ssl://, ws://, wss:// or mem://
+	Username    string           `yaml:"username"`
+	Password    string           `yaml:"password"`
+	CAFile      string           `yaml:"ca_file"`   // PEM certificates trusted besides the system ones
+	CertFile    string           `yaml:"cert_file"` // Client certificate, for brokers requiring mTLS
+	KeyFile     string           `yaml:"key_file"`
+	Insecure    bool             `yaml:"insecure"`     // Skips the verification of the broker certificate
+	TopicPrefix string           `yaml:"topic_prefix"` // Namespace of the topics, like "tenant-a" or "staging"
+	QoS         byte             `yaml:"qos"`          // Of the topics not in Topics
+	Topics      map[string]Topic `yaml:"topics"`       // By topic name, without the prefix
+	SharedGroup string           `yaml:"shared_group"` // Replicas of a service in the same group split its subscriptions
+}
+
+// Topic is how a topic is published and subscribed to
+type Topic struct {
+	QoS    byte `yaml:"qos"`
+	Retain bool `yaml:"retain"`
+}
+
+// Flags are the command line flags of the connection, they override the file and the environment
+type Flags struct {
+	set *flag.FlagSet
+
+	config, url, username, password *string
+	caFile, certFile, keyFile       *string
+	insecure                        *bool
+	topicPrefix, topics             *string
+	sharedGroup                     *string
+	qos                             *int
+}
+
+// RegisterFlags adds the -mqtt-* flags to set, to read with Load once it is parsed
+func RegisterFlags(set *flag.FlagSet) *Flags {
+	return &Flags{
+		set:         set,
+		config:      set.String("mqtt-config", "", "YAML file of the MQTT connection (MQTT_CONFIG)"),
+		url:         set.String("mqtt-url", "", "MQTT broker URL, tcp://, ssl://, ws://, wss:// or mem:// (MQTT_BROKER_URL)"),
+		username:    set.String("mqtt-username", "", "MQTT username (MQTT_USERNAME)"),
+		password:    set.String("mqtt-password", "", "MQTT password (MQTT_PASSWORD)"),
+		caFile:      set.String("mqtt-ca-file", "", "PEM CA bundle of the broker (MQTT_CA_FILE)"),
+		certFile:    set.String("mqtt-cert-file", "", "PEM client certificate (MQTT_CERT_FILE)"),
+		keyFile:     set.String("mqtt-key-file", "", "PEM client key (MQTT_KEY_FILE)"),
+		insecure:    set.Bool("mqtt-insecure", false, "Skip the verification of the broker certificate (MQTT_INSECURE)"),
+		topicPrefix: set.String("mqtt-topic-prefix", "", "Namespace of the topics (MQTT_TOPIC_PREFIX)"),
+		topics:      set.String("mqtt-topics", "", "QoS and retain by topic, as topic=qos[:retain],... (MQTT_TOPICS)"),
+		qos:         set.Int("mqtt-qos", DefaultQoS, "QoS of the topics not in -mqtt-topics (MQTT_QOS)"),
+		sharedGroup: set.String("mqtt-shared-group", "", "Shared subscription group of the replicas of the service (MQTT_SHARED_GROUP)"),
+	}
+}
+
+// LoadConfig reads the configuration from MQTT_CONFIG and the environment
+func LoadConfig() (*Config, error) {
+	return (*Flags)(nil).Load()
+}
+
+// Load reads the configuration from the file, the environment and the flags that were set
+func (f *Flags) Load() (*Config, error) {
+	set := map[string]bool{}
+	if f != nil {
+		f.set.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	}
+
+	config := &Config{QoS: DefaultQoS}
+	path := os.Getenv("MQTT_CONFIG")
+	if set["mqtt-config"] {
+		path = *f.config
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading MQTT config: %v", err)
+		}
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("error parsing MQTT config %s: %v", path, err)
+		}
+	}
+
+	// MQTT_EMBEDDED_LISTEN alone is mem:// only when the file has no URL
+	if config.URL == "" || os.Getenv("MQTT_BROKER_URL") != "" || os.Getenv("MQTT_BROKER_HOST") != "" {
+		if url, err := URL(); err == nil {
+			config.URL = url
+		}
+	}
+	env := func(field *string, name string) {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+	env(&config.Username, "MQTT_USERNAME")
+	env(&config.Password, "MQTT_PASSWORD")
+	env(&config.CAFile, "MQTT_CA_FILE")
+	env(&config.CertFile, "MQTT_CERT_FILE")
+	env(&config.KeyFile, "MQTT_KEY_FILE")
+	env(&config.TopicPrefix, "MQTT_TOPIC_PREFIX")
+	env(&config.SharedGroup, "MQTT_SHARED_GROUP")
+	if value := os.Getenv("MQTT_INSECURE"); value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("MQTT_INSECURE: invalid boolean %q", value)
+		}
+		config.Insecure = insecure
+	}
+	if value := os.Getenv("MQTT_QOS"); value != "" {
+		qos, err := parseQoS(value)
+		if err != nil {
+			return nil, fmt.Errorf("MQTT_QOS: %v", err)
+		}
+		config.QoS = qos
+	}
+	if err := config.addTopics(os.Getenv("MQTT_TOPICS")); err != nil {
+		return nil, fmt.Errorf("MQTT_TOPICS: %v", err)
+	}
+
+	if f != nil {
+		flagged := func(field *string, name string, value *string) {
+			if set[name] {
+				*field = *value
+			}
+		}
+		flagged(&config.URL, "mqtt-url", f.url)
+		flagged(&config.Username, "mqtt-username", f.username)
+		flagged(&config.Password, "mqtt-password", f.password)
+		flagged(&config.CAFile, "mqtt-ca-file", f.caFile)
+		flagged(&config.CertFile, "mqtt-cert-file", f.certFile)
+		flagged(&config.KeyFile, "mqtt-key-file", f.keyFile)
+		flagged(&config.TopicPrefix, "mqtt-topic-prefix", f.topicPrefix)
+		flagged(&config.SharedGroup, "mqtt-shared-group", f.sharedGroup)
+		if set["mqtt-insecure"] {
+			config.Insecure = *f.insecure
+		}
+		if set["mqtt-qos"] {
+			qos, err := parseQoS(strconv.Itoa(*f.qos))
+			if err != nil {
+				return nil, fmt.Errorf("-mqtt-qos: %v", err)
+			}
+			config.QoS = qos
+		}
+		if err := config.addTopics(*f.topics); err != nil {
+			return nil, fmt.Errorf("-mqtt-topics: %v", err)
+		}
+	}
+
+	if config.URL == "" {
+		return nil, fmt.Errorf("MQTT_BROKER_HOST environment variable not set (or MQTT_BROKER_URL, -mqtt-url, url in MQTT_CONFIG)")
+	}
+	if strings.ContainsAny(config.SharedGroup, "/+#") {
+		return nil, fmt.Errorf("invalid MQTT shared group %q", config.SharedGroup)
+	}
+	if config.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d", config.QoS)
+	}
+	for name, topic := range config.Topics {
+		if topic.QoS > 2 {
+			return nil, fmt.Errorf("invalid MQTT QoS %d for %s", topic.QoS, name)
+		}
+	}
+	return config, nil
+}
+
+// addTopics adds the topics of a "topic=qos[:retain],..." list
+func (c *Config) addTopics(list string) error {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, options, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("expected topic=qos[:retain], got %q", entry)
+		}
+		qos, retain, _ := strings.Cut(options, ":")
+		var topic Topic
+		var err error
+		if topic.QoS, err = parseQoS(qos); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		switch retain {
+		case "":
+		case "retain":
+			topic.Retain = true
+		default:
+			return fmt.Errorf("%s: expected retain, got %q", name, retain)
+		}
+		if c.Topics == nil {
+			c.Topics = make(map[string]Topic)
+		}
+		c.Topics[name] = topic
+	}
+	return nil
+}
+
+func parseQoS(value string) (byte, error) {
+	qos, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || qos < 0 || qos > 2 {
+		return 0, fmt.Errorf("invalid QoS %q, expected 0, 1 or 2", value)
+	}
+	return byte(qos), nil
+}
+
+// ClientOptions returns the paho options to connect to the broker, with the credentials and the
+// TLS configuration
+func (c *Config) ClientOptions() (*mqtt.ClientOptions, error) {
+	opts, err := NewClientOptions(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	if c.Username != "" {
+		opts.SetUsername(c.Username)
+		opts.SetPassword(c.Password)
+	}
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts, nil
+}
+
+// TLSConfig returns the TLS configuration of ssl:// and wss:// brokers, nil to use the defaults
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && !c.Insecure {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.Insecure}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// Topic returns the topic of name on the broker, in the namespace of TopicPrefix
+func (c *Config) Topic(name string) string {
+	prefix := strings.Trim(c.TopicPrefix, "/")
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// TopicName returns the name of a topic received from the broker, without TopicPrefix
+func (c *Config) TopicName(topic string) string {
+	prefix := strings.Trim(c.TopicPrefix, "/")
+	if prefix == "" {
+		return topic
+	}
+	return strings.TrimPrefix(topic, prefix+"/")
+}
+
+// TopicOptions returns the QoS and retain flag of a topic
+func (c *Config) TopicOptions(name string) Topic {
+	if topic, ok := c.Topics[name]; ok {
+		return topic
+	}
+	return Topic{QoS: c.QoS}
+}
+
+// Publish publishes payload on the topic of name with its QoS and retain flag
+func (c *Config) Publish(client mqtt.Client, name string, payload interface{}) mqtt.Token {
+	topic := c.TopicOptions(name)
+	return client.Publish(c.Topic(name), topic.QoS, topic.Retain, payload)
+}
+
+// Shared tells whether the subscriptions are shared with the other replicas of the service. Their
+// sessions are then clean, the broker would keep queueing the share of a replica that is gone.
+func (c *Config) Shared() bool {
+	return c.SharedGroup != ""
+}
+
+// Subscribe subscribes to the topic of name, with the QoS configured for it or else qos. With a
+// SharedGroup it is the shared subscription $share/<group>/<topic>, every message goes to one of
+// the replicas subscribed.
+func (c *Config) Subscribe(client mqtt.Client, name string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	if topic, ok := c.Topics[name]; ok {
+		qos = topic.QoS
+	}
+	filter := c.Topic(name)
+	if c.Shared() {
+		filter = "$share/" + c.SharedGroup + "/" + filter
+	}
+	return client.Subscribe(filter, qos, callback)
+}
@@ -0,0 +1,193 @@
+package broker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clearEnv unsets the MQTT_* variables of the environment for the test
+func clearEnv(t *testing.T) {
+	for _, name := range []string{"MQTT_CONFIG", "MQTT_BROKER_URL", "MQTT_BROKER_HOST", "MQTT_EMBEDDED_LISTEN",
+		"MQTT_USERNAME", "MQTT_PASSWORD", "MQTT_CA_FILE", "MQTT_CERT_FILE", "MQTT_KEY_FILE", "MQTT_INSECURE",
+		"MQTT_TOPIC_PREFIX", "MQTT_SHARED_GROUP", "MQTT_QOS", "MQTT_TOPICS"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestFlagsLoad(t *testing.T) {
+	clearEnv(t)
+	path := filepath.Join(t.TempDir(), "mqtt.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+url: ssl://file:8883
+username: file-user
+password: file-password
+insecure: true
+topic_prefix: file
+qos: 0
+topics:
+  tracker/jonoprotocol: {qos: 2, retain: true}
+`), 0644))
+
+	// The file alone
+	t.Setenv("MQTT_CONFIG", path)
+	config, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		URL: "ssl://file:8883", Username: "file-user", Password: "file-password", Insecure: true, TopicPrefix: "file",
+		QoS: 0, Topics: map[string]Topic{"tracker/jonoprotocol": {QoS: 2, Retain: true}},
+	}, config)
+
+	// The environment overrides the file
+	t.Setenv("MQTT_BROKER_HOST", "env")
+	t.Setenv("MQTT_USERNAME", "env-user")
+	t.Setenv("MQTT_INSECURE", "false")
+	t.Setenv("MQTT_QOS", "1")
+	t.Setenv("MQTT_TOPICS", "tracker/jonoprotocol=1,tracker/from-tcp=2:retain")
+	config, err = LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		URL: "tcp://env:1883", Username: "env-user", Password: "file-password", TopicPrefix: "file", QoS: 1,
+		Topics: map[string]Topic{"tracker/jonoprotocol": {QoS: 1}, "tracker/from-tcp": {QoS: 2, Retain: true}},
+	}, config)
+
+	// The flags that were set override both
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(set)
+	assert.NoError(t, set.Parse([]string{"-mqtt-url", "wss://flag:443", "-mqtt-insecure", "-mqtt-qos", "2",
+		"-mqtt-topics", "tracker/from-tcp=0", "-mqtt-shared-group", "queclink"}))
+	config, err = flags.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		URL: "wss://flag:443", Username: "env-user", Password: "file-password", Insecure: true, TopicPrefix: "file",
+		QoS: 2, SharedGroup: "queclink",
+		Topics: map[string]Topic{"tracker/jonoprotocol": {QoS: 1}, "tracker/from-tcp": {QoS: 0}},
+	}, config)
+
+	// -mqtt-config replaces MQTT_CONFIG
+	set = flag.NewFlagSet("test", flag.ContinueOnError)
+	flags = RegisterFlags(set)
+	assert.NoError(t, set.Parse([]string{"-mqtt-config", filepath.Join(t.TempDir(), "missing.yaml")}))
+	_, err = flags.Load()
+	assert.ErrorContains(t, err, "error reading MQTT config")
+}
+
+func TestFlagsLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        string
+	}{
+		{"MQTT_INSECURE", "maybe", `MQTT_INSECURE: invalid boolean "maybe"`},
+		{"MQTT_QOS", "3", `MQTT_QOS: invalid QoS "3", expected 0, 1 or 2`},
+		{"MQTT_TOPICS", "tracker/from-tcp", `MQTT_TOPICS: expected topic=qos[:retain], got "tracker/from-tcp"`},
+		{"MQTT_SHARED_GROUP", "a/b", `invalid MQTT shared group "a/b"`},
+		{"MQTT_BROKER_URL", "", "MQTT_BROKER_HOST environment variable not set (or MQTT_BROKER_URL, -mqtt-url, url in MQTT_CONFIG)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv("MQTT_BROKER_URL", "tcp://localhost:1883")
+			t.Setenv(test.name, test.value)
+			_, err := LoadConfig()
+			assert.EqualError(t, err, test.want)
+		})
+	}
+}
+
+func TestAddTopics(t *testing.T) {
+	tests := []struct {
+		list string
+		want map[string]Topic
+		err  string
+	}{
+		{"", nil, ""},
+		{" tracker/from-tcp=0 , ,tracker/jonoprotocol=2:retain", map[string]Topic{
+			"tracker/from-tcp": {QoS: 0}, "tracker/jonoprotocol": {QoS: 2, Retain: true}}, ""},
+		{"=1", nil, `expected topic=qos[:retain], got "=1"`},
+		{"tracker/from-tcp=x", nil, `tracker/from-tcp: invalid QoS "x", expected 0, 1 or 2`},
+		{"tracker/from-tcp=1:keep", nil, `tracker/from-tcp: expected retain, got "keep"`},
+	}
+	for _, test := range tests {
+		var config Config
+		err := config.addTopics(test.list)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.list)
+			continue
+		}
+		assert.NoError(t, err, test.list)
+		assert.Equal(t, test.want, config.Topics, test.list)
+	}
+}
+
+// writeCertificate writes a self-signed certificate and its key as PEM files in dir
+func writeCertificate(t *testing.T, dir string, name string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := writeCertificate(t, dir, "ca")
+	certFile, keyFile := writeCertificate(t, dir, "client")
+	emptyFile := filepath.Join(dir, "empty.pem")
+	assert.NoError(t, os.WriteFile(emptyFile, nil, 0644))
+
+	// Without files the defaults are used
+	tlsConfig, err := (&Config{URL: "ssl://broker:8883"}).TLSConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	tlsConfig, err = (&Config{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}).TLSConfig()
+	assert.NoError(t, err)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+
+	tlsConfig, err = (&Config{Insecure: true}).TLSConfig()
+	assert.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.RootCAs)
+
+	failures := []struct {
+		config Config
+		want   string
+	}{
+		{Config{CAFile: filepath.Join(dir, "missing.pem")}, "error reading CA file"},
+		{Config{CAFile: emptyFile}, "no certificates in CA file " + emptyFile},
+		{Config{CertFile: certFile}, "error loading client certificate"},
+		{Config{CertFile: certFile, KeyFile: caFile}, "error loading client certificate"},
+	}
+	for _, test := range failures {
+		_, err := test.config.TLSConfig()
+		assert.ErrorContains(t, err, test.want)
+	}
+}
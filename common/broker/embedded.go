@@ -0,0 +1,153 @@
+package broker
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// Embedded is an MQTT broker running in the process. The clients of the process reach it through
+// in-memory pipes; with an address it also listens on TCP for the other processes, like the
+// listener of the devices.
+type Embedded struct {
+	server *mochi.Server
+	pipes  *pipeListener
+}
+
+// StartEmbedded starts a broker in the process, listening on address ("host:port") too when it is
+// not empty
+func StartEmbedded(address string) (*Embedded, error) {
+	// Only warnings, the broker logs every client connection at info level
+	server := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		return nil, err
+	}
+
+	embedded := &Embedded{server: server, pipes: newPipeListener()}
+	if err := server.AddListener(listeners.NewNet("mem", embedded.pipes)); err != nil {
+		return nil, err
+	}
+	if address != "" {
+		if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: address})); err != nil {
+			return nil, fmt.Errorf("embedded broker on %s: %v", address, err)
+		}
+	}
+	if err := server.Serve(); err != nil {
+		return nil, err
+	}
+	return embedded, nil
+}
+
+// Dial opens a connection to the broker for a client of the process
+func (e *Embedded) Dial() (net.Conn, error) {
+	return e.pipes.dial()
+}
+
+// Close disconnects the clients and stops the broker
+func (e *Embedded) Close() error {
+	return e.server.Close()
+}
+
+var (
+	defaultEmbedded *Embedded
+	defaultErr      error
+	defaultOnce     sync.Once
+)
+
+// Default returns the broker of mem:// URLs, started on first use and shared by every client of the
+// process. It listens on MQTT_EMBEDDED_LISTEN when set.
+func Default() (*Embedded, error) {
+	defaultOnce.Do(func() {
+		defaultEmbedded, defaultErr = StartEmbedded(os.Getenv("MQTT_EMBEDDED_LISTEN"))
+	})
+	return defaultEmbedded, defaultErr
+}
+
+// pipeListener is a net.Listener whose connections are the server ends of in-memory pipes
+type pipeListener struct {
+	conns  chan net.Conn
+	done   chan struct{}
+	closer sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) dial() (net.Conn, error) {
+	server, client := bufferedPipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, fmt.Errorf("embedded broker closed")
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closer.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "mem" }
+func (pipeAddr) String() string  { return "mem://" }
+
+// bufferedPipe is a net.Pipe with a buffer in each direction, like the ones of a socket. Without
+// them the broker and a client writing to each other at the same time would wait for each other.
+func bufferedPipe() (net.Conn, net.Conn) {
+	server, serverRelay := net.Pipe()
+	clientRelay, client := net.Pipe()
+	go relay(serverRelay, clientRelay)
+	go relay(clientRelay, serverRelay)
+	return server, client
+}
+
+// relay copies what is written on from to to, closing both once either of them is closed
+func relay(from net.Conn, to net.Conn) {
+	chunks := make(chan []byte, 1024)
+	go func() {
+		defer close(chunks)
+		for {
+			buffer := make([]byte, 32*1024)
+			n, err := from.Read(buffer)
+			if n > 0 {
+				chunks <- buffer[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for chunk := range chunks {
+		if _, err := to.Write(chunk); err != nil {
+			break
+		}
+	}
+	from.Close()
+	to.Close()
+	for range chunks {
+	}
+}
@@ -0,0 +1,97 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+)
+
+// KeyedPool runs jobs on a fixed number of workers. The jobs of a key, like the remote address or
+// the IMEI of a device, always run on the same worker and in the order they were submitted; jobs of
+// different keys run in parallel.
+type KeyedPool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewKeyedPool starts workers workers, each with a queue of queueSize jobs
+func NewKeyedPool(workers int, queueSize int) *KeyedPool {
+	if workers < 1 {
+		workers = 1
+	}
+	pool := &KeyedPool{queues: make([]chan func(), workers)}
+	for i := range pool.queues {
+		queue := make(chan func(), queueSize)
+		pool.queues[i] = queue
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	return pool
+}
+
+// Submit queues job on the worker of key, waiting while its queue is full. It returns false when
+// ctx is done first or the pool is closed.
+func (p *KeyedPool) Submit(ctx context.Context, key string, job func()) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.queue(key) <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// queue returns the queue of the worker of key
+func (p *KeyedPool) queue(key string) chan func() {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return p.queues[hash.Sum32()%uint32(len(p.queues))]
+}
+
+// Close stops accepting jobs and waits for the queued ones to finish or ctx to be done
+func (p *KeyedPool) Close(ctx context.Context) error {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, queue := range p.queues {
+			close(queue)
+		}
+	}
+	p.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RemoteAddr returns the remote address of a message of tracker/from-tcp, "" when it is not a
+// {"payload","remoteaddr"} message
+func RemoteAddr(payload []byte) string {
+	var message struct {
+		RemoteAddr string `json:"remoteaddr"`
+	}
+	if json.Unmarshal(payload, &message) != nil {
+		return ""
+	}
+	return message.RemoteAddr
+}
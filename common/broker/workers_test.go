@@ -0,0 +1,96 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyedPoolOrder(t *testing.T) {
+	pool := NewKeyedPool(4, 8)
+	var mutex sync.Mutex
+	got := make(map[string][]int)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("10.0.0.%d:5000", i%7)
+		i := i
+		assert.True(t, pool.Submit(context.Background(), key, func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			got[key] = append(got[key], i)
+		}))
+	}
+	assert.NoError(t, pool.Close(context.Background()))
+
+	// Every job ran, those of a key in the order they were submitted
+	assert.Len(t, got, 7)
+	total := 0
+	for key, jobs := range got {
+		assert.IsIncreasing(t, jobs, key)
+		total += len(jobs)
+	}
+	assert.Equal(t, 100, total)
+
+	// A closed pool takes no more jobs, closing again does nothing
+	assert.False(t, pool.Submit(context.Background(), "10.0.0.1:5000", func() {}))
+	assert.NoError(t, pool.Close(context.Background()))
+}
+
+func TestKeyedPoolParallel(t *testing.T) {
+	pool := NewKeyedPool(2, 1)
+	release := make(chan struct{})
+	started := make(chan string, 2)
+
+	// Keys on different workers run at the same time
+	keys := []string{"a"}
+	for i := 0; len(keys) < 2; i++ {
+		if key := fmt.Sprint(i); pool.queue(key) != pool.queue(keys[0]) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		key := key
+		assert.True(t, pool.Submit(context.Background(), key, func() {
+			started <- key
+			<-release
+		}))
+	}
+	for range keys {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("the jobs of different workers did not run in parallel")
+		}
+	}
+
+	// With the worker busy and its queue full, Submit waits until ctx is done
+	assert.True(t, pool.Submit(context.Background(), keys[0], func() {}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, pool.Submit(ctx, keys[0], func() {}))
+
+	// Close gives up on the running jobs when ctx is done first
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, pool.Close(ctx), context.DeadlineExceeded)
+	close(release)
+	assert.NoError(t, pool.Close(context.Background()))
+}
+
+func TestRemoteAddr(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{`{"payload":"2424","remoteaddr":"10.0.0.1:5000"}`, "10.0.0.1:5000"},
+		{`{"payload":"2424"}`, ""},
+		{`2424`, ""},
+		{`+RESP:GTFRI,8020040200,864696060004173$`, ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, RemoteAddr([]byte(test.payload)), test.payload)
+	}
+}
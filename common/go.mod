@@ -0,0 +1,19 @@
+module github.com/MaddSystems/jonobridge/common
+
+go 1.23.2
+
+require (
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/mochi-mqtt/server/v2 v2.7.9
+	github.com/stretchr/testify v1.9.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+)
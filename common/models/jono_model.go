@@ -7,6 +7,17 @@ type JonoModel struct {
 	Message     *string               `json:"Message"`
 	DataPackets int                   `json:"DataPackets"`
 	ListPackets map[string]DataPacket `json:"ListPackets"`
+	Vehicle     *Vehicle              `json:"Vehicle,omitempty"`
+}
+
+// Vehicle is the vehicle a device is installed in, added to the Jono messages by the
+// vehicle enrichment (utils.EnrichJono)
+type Vehicle struct {
+	Plates string `json:"Plates"`
+	Eco    string `json:"Eco"`
+	VIN    string `json:"VIN"`
+	Client string `json:"Client"`
+	URL    string `json:"URL"`
 }
 
 type DataPacket struct {
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a temporary file next to fileName and renames it, so readers see
+// either the old content or the new one, never a partial file
+func WriteFileAtomic(fileName string, data []byte, perm os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), fileName)
+}
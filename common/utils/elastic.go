@@ -4,11 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
-	"crypto/tls"
 	"sync"
 )
 
@@ -50,25 +49,43 @@ func cacheIndex(indexName string) {
 	indexCache[indexName] = true
 }
 
-// SendToElastic sends log data to Elasticsearch with proper indexing
+// elasticClient is shared by every SendToElastic call, so the connections are reused
+var (
+	elasticClient     *http.Client
+	elasticConfig     ElasticConfig
+	elasticClientErr  error
+	elasticClientOnce sync.Once
+)
+
+// sharedElasticClient creates the client from the environment, see ElasticConfigFromEnv
+func sharedElasticClient() (*http.Client, ElasticConfig, error) {
+	elasticClientOnce.Do(func() {
+		elasticConfig = ElasticConfigFromEnv()
+		if elasticConfig.URL == "" {
+			elasticClientErr = fmt.Errorf("ELASTIC_URL environment variable not set")
+			return
+		}
+		elasticClient, elasticClientErr = elasticConfig.HTTPClient()
+	})
+	return elasticClient, elasticConfig, elasticClientErr
+}
+
+// SendToElastic sends one document to the customer's index, creating it when missing.
+// Services indexing a stream of documents use an ElasticSink instead.
 func SendToElastic(logData ElasticLogData, customerName string) error {
-	// Obtener la URL base de Elasticsearch
-	elasticBaseURL := os.Getenv("ELASTIC_URL")
-	if elasticBaseURL == "" {
-		elasticBaseURL = "https://opensearch.madd.com.mx:9200"
+	client, config, err := sharedElasticClient()
+	if err != nil {
+		return err
 	}
 
 	// Convertir customerName a snake_case en minúsculas
-	customerName = ToSnakeCase(customerName)
-
-	// Construir la URL dinámica del índice
-	indexName := customerName // Just use the customer name as the index
-	elasticURL := fmt.Sprintf("%s/%s/_doc", elasticBaseURL, indexName)
+	indexName := ElasticIndexName(customerName) // Just use the customer name as the index
+	elasticURL := fmt.Sprintf("%s/%s/_doc", config.URL, indexName)
 
 	// Check cache first to avoid unnecessary requests
 	if !isIndexCached(indexName) {
 		// Check if index exists, create if it doesn't
-		exists, err := checkIndexExists(indexName)
+		exists, err := checkIndexExists(client, config, indexName)
 		if err != nil {
 			VPrint("Error checking index existence: %v", err)
 			return fmt.Errorf("error checking index existence: %v", err)
@@ -76,20 +93,16 @@ func SendToElastic(logData ElasticLogData, customerName string) error {
 
 		if !exists {
 			VPrint("Index '%s' does not exist, creating it...", indexName)
-			if err := createIndex(indexName); err != nil {
+			if err := createIndex(client, config, indexName); err != nil {
 				VPrint("Error creating index: %v", err)
 				return fmt.Errorf("error creating index: %v", err)
 			}
 		}
-		
+
 		// Cache the index as existing
 		cacheIndex(indexName)
 	}
 
-	// Debug: Verificar datos antes de enviar
-	//VPrint("Elastic URL: %s", elasticURL)
-	//VPrint("Log Data: %+v", logData)
-
 	// Convertir los datos a JSON
 	jsonData, err := json.Marshal(logData)
 	if err != nil {
@@ -97,38 +110,14 @@ func SendToElastic(logData ElasticLogData, customerName string) error {
 		return fmt.Errorf("error marshaling log data: %v", err)
 	}
 
-	// Debug: Ver JSON generado
-	//VPrint("JSON Data to send: %s", string(jsonData))
-
 	// Crear la solicitud HTTP
 	req, err := http.NewRequest("POST", elasticURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		VPrint("Error creating elastic request: %v", err)
 		return fmt.Errorf("error creating elastic request: %v", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
-
-	// Add authentication if available
-	username := os.Getenv("ELASTIC_USER")
-	password := os.Getenv("ELASTIC_PASSWORD")
-		if username == "" {
-		username = "admin"
-	}
-	if password == "" {
-		password = "GPSc0ntr0l1"
-	}
-	
-	if username != "" && password != "" {
-		req.SetBasicAuth(username, password)
-	}
-
-	// Create HTTP client with TLS config for HTTPS
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	config.authorize(req)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -136,6 +125,7 @@ func SendToElastic(logData ElasticLogData, customerName string) error {
 		return fmt.Errorf("error sending to elastic: %v", err)
 	}
 	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
 
 	// Verificar el código de respuesta
 	if resp.StatusCode >= 400 {
@@ -158,36 +148,12 @@ func ToSnakeCase(input string) string {
 }
 
 // checkIndexExists checks if an index exists in Elasticsearch
-func checkIndexExists(indexName string) (bool, error) {
-	elasticBaseURL := os.Getenv("ELASTIC_URL")
-	if elasticBaseURL == "" {
-		elasticBaseURL = "https://opensearch.madd.com.mx:9200"
-	}
-
-	checkURL := fmt.Sprintf("%s/%s", elasticBaseURL, indexName)
-	
-	req, err := http.NewRequest("HEAD", checkURL, nil)
+func checkIndexExists(client *http.Client, config ElasticConfig, indexName string) (bool, error) {
+	req, err := http.NewRequest("HEAD", fmt.Sprintf("%s/%s", config.URL, indexName), nil)
 	if err != nil {
 		return false, fmt.Errorf("error creating index check request: %v", err)
 	}
-
-	// Add authentication - use default credentials if env vars not set
-	username := os.Getenv("ELASTIC_USER")
-	password := os.Getenv("ELASTIC_PASSWORD")
-	if username == "" {
-		username = "admin"
-	}
-	if password == "" {
-		password = "GPSc0ntr0l1"
-	}
-	req.SetBasicAuth(username, password)
-
-	// Create HTTP client with TLS config for HTTPS
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	config.authorize(req)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -199,17 +165,7 @@ func checkIndexExists(indexName string) (bool, error) {
 }
 
 // createIndex creates a new index with replicas=0
-func createIndex(indexName string) error {
-	elasticBaseURL := os.Getenv("ELASTIC_URL")
-	if elasticBaseURL == "" {
-		elasticBaseURL = "https://opensearch.madd.com.mx:9200"
-	}
-
-	createURL := fmt.Sprintf("%s/%s", elasticBaseURL, indexName)
-	
-	// Debug: Print the URL being used
-	//VPrint("Creating index at URL: %s", createURL)
-
+func createIndex(client *http.Client, config ElasticConfig, indexName string) error {
 	// Create index settings with shards=1 and replicas=0
 	indexSettings := IndexSettings{}
 	indexSettings.Settings.NumberOfShards = 1
@@ -220,34 +176,12 @@ func createIndex(indexName string) error {
 		return fmt.Errorf("error marshaling index settings: %v", err)
 	}
 
-	// Debug: Print the JSON being sent
-	//VPrint("Index settings JSON: %s", string(jsonData))
-
-	req, err := http.NewRequest("PUT", createURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/%s", config.URL, indexName), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("error creating index creation request: %v", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
-
-	// Add authentication - use default credentials if env vars not set
-	username := os.Getenv("ELASTIC_USER")
-	password := os.Getenv("ELASTIC_PASSWORD")
-	if username == "" {
-		username = "admin"
-	}
-	if password == "" {
-		password = "GPSc0ntr0l1"
-	}
-	req.SetBasicAuth(username, password)
-	//VPrint("Using authentication with username: %s", username)
-
-	// Create HTTP client with TLS config for HTTPS
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	config.authorize(req)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -255,16 +189,11 @@ func createIndex(indexName string) error {
 	}
 	defer resp.Body.Close()
 
-	// Debug: Read and print the response body
 	var responseBody bytes.Buffer
 	responseBody.ReadFrom(resp.Body)
-	//VPrint("Index creation response status: %d", resp.StatusCode)
-	//VPrint("Index creation response body: %s", responseBody.String())
 
 	if resp.StatusCode >= 400 {
 		return fmt.Errorf("error creating index: status code %d, response: %s", resp.StatusCode, responseBody.String())
 	}
-
-	//VPrint("Index '%s' created successfully with replicas=0", indexName)
 	return nil
 }
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"time"
+)
+
+// ElasticIndexNamer names the index of a customer's documents. Daily indices are
+// <prefix>-<customer>-YYYY.MM.DD by the UTC date of the document; with Rollover the name is the
+// <prefix>-<customer> write alias, rolled over by the cluster's ILM or ISM policy.
+type ElasticIndexNamer struct {
+	Prefix          string
+	Rollover        bool
+	DefaultCustomer string // Documents without a customer
+}
+
+// Index returns the index of a customer's document taken at a time
+func (n ElasticIndexNamer) Index(customer string, at time.Time) string {
+	customer = ElasticIndexName(customer)
+	if customer == "" {
+		customer = ElasticIndexName(n.DefaultCustomer)
+	}
+	if customer == "" {
+		customer = "default"
+	}
+	name := ElasticIndexName(n.Prefix) + "-" + customer
+	if n.Rollover {
+		return name
+	}
+	return name + "-" + at.UTC().Format("2006.01.02")
+}
+
+// Pattern returns the pattern matching every index of the namer, for the index template
+func (n ElasticIndexNamer) Pattern() string {
+	return ElasticIndexName(n.Prefix) + "-*"
+}
+
+// ElasticIndexName converts a name to a valid index name part: snake_case in lowercase, without
+// the characters Elasticsearch refuses and without leading -, _ or +
+func ElasticIndexName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '\\', '/', '*', '?', '"', '<', '>', '|', ',', '#', ':':
+			return -1
+		}
+		return r
+	}, ToSnakeCase(name))
+	return strings.TrimLeft(name, "-_+.")
+}
@@ -0,0 +1,535 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Elastic sink defaults
+const (
+	DefaultElasticQueueSize     = 10000
+	DefaultElasticBatchSize     = 500
+	DefaultElasticBatchBytes    = 5 << 20
+	DefaultElasticFlushInterval = time.Second
+	DefaultElasticMaxRetries    = 5
+	DefaultElasticRetryDelay    = time.Second
+)
+
+// ElasticConfig is the connection to an Elasticsearch or OpenSearch cluster
+type ElasticConfig struct {
+	URL                string
+	Username           string
+	Password           string
+	APIKey             string // Sent as "Authorization: ApiKey", instead of the user and password
+	CAFile             string // PEM certificates trusted besides the system ones
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// ElasticConfigFromEnv reads ELASTIC_URL, ELASTIC_USER, ELASTIC_PASSWORD, ELASTIC_API_KEY,
+// ELASTIC_CA_FILE and ELASTIC_INSECURE
+func ElasticConfigFromEnv() ElasticConfig {
+	insecure, _ := strconv.ParseBool(os.Getenv("ELASTIC_INSECURE"))
+	return ElasticConfig{
+		URL:                strings.TrimSuffix(os.Getenv("ELASTIC_URL"), "/"),
+		Username:           os.Getenv("ELASTIC_USER"),
+		Password:           os.Getenv("ELASTIC_PASSWORD"),
+		APIKey:             os.Getenv("ELASTIC_API_KEY"),
+		CAFile:             os.Getenv("ELASTIC_CA_FILE"),
+		InsecureSkipVerify: insecure,
+		Timeout:            30 * time.Second,
+	}
+}
+
+// HTTPClient creates the client for the cluster, one per sink so the connections are reused
+func (c ElasticConfig) HTTPClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.MaxIdleConnsPerHost = 16
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// authorize adds the credentials to a request
+func (c ElasticConfig) authorize(request *http.Request) {
+	switch {
+	case c.APIKey != "":
+		request.Header.Set("Authorization", "ApiKey "+c.APIKey)
+	case c.Username != "":
+		request.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// ElasticDocument is a document to index
+type ElasticDocument struct {
+	Index  string          `json:"index"`
+	ID     string          `json:"id,omitempty"` // Indexing the same document twice replaces it
+	Source json.RawMessage `json:"source"`
+}
+
+// ElasticSink indexes documents with the _bulk API. Documents are sent in batches of up to
+// BatchSize documents or BatchBytes, or what arrived within FlushInterval. Network errors, 429
+// and 5xx answers, for the whole batch or single documents, are retried with backoff; batches
+// still failing are spilled to SpillDir and sent again once the cluster answers.
+type ElasticSink struct {
+	Config        ElasticConfig
+	BatchSize     int
+	BatchBytes    int
+	FlushInterval time.Duration
+	MaxRetries    int
+	RetryDelay    time.Duration // Doubled after every retry
+	SpillDir      string        // Batches that could not be sent, nothing is spilled when empty
+	Rollover      bool          // Document indices are write aliases, bootstrapped when missing
+
+	client  *http.Client
+	queue   chan ElasticDocument
+	aliases sync.Map
+
+	indexed int64
+	failed  int64
+	spilled int64
+	dropped int64
+}
+
+// ElasticSinkOption configures an ElasticSink
+type ElasticSinkOption func(*ElasticSink)
+
+// WithElasticBatchSize sets the most documents sent in one bulk request
+func WithElasticBatchSize(size int) ElasticSinkOption {
+	return func(s *ElasticSink) { s.BatchSize = size }
+}
+
+// WithElasticFlushInterval sets how long a batch waits for more documents
+func WithElasticFlushInterval(interval time.Duration) ElasticSinkOption {
+	return func(s *ElasticSink) { s.FlushInterval = interval }
+}
+
+// WithElasticRetries sets the retries of a batch and the delay before the first one
+func WithElasticRetries(max int, delay time.Duration) ElasticSinkOption {
+	return func(s *ElasticSink) { s.MaxRetries, s.RetryDelay = max, delay }
+}
+
+// WithElasticSpillDir sets the directory of the batches that could not be sent
+func WithElasticSpillDir(dir string) ElasticSinkOption {
+	return func(s *ElasticSink) { s.SpillDir = dir }
+}
+
+// WithElasticRollover makes the document indices write aliases
+func WithElasticRollover(rollover bool) ElasticSinkOption {
+	return func(s *ElasticSink) { s.Rollover = rollover }
+}
+
+// NewElasticSink creates a sink with the defaults
+func NewElasticSink(config ElasticConfig, queueSize int, options ...ElasticSinkOption) (*ElasticSink, error) {
+	if config.URL == "" {
+		return nil, errors.New("no Elasticsearch URL")
+	}
+	client, err := config.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultElasticQueueSize
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	sink := &ElasticSink{
+		Config:        config,
+		BatchSize:     DefaultElasticBatchSize,
+		BatchBytes:    DefaultElasticBatchBytes,
+		FlushInterval: DefaultElasticFlushInterval,
+		MaxRetries:    DefaultElasticMaxRetries,
+		RetryDelay:    DefaultElasticRetryDelay,
+		client:        client,
+		queue:         make(chan ElasticDocument, queueSize),
+	}
+	for _, option := range options {
+		option(sink)
+	}
+	return sink, nil
+}
+
+// Send queues a document without blocking, it returns false and drops it when the queue is full
+func (s *ElasticSink) Send(document ElasticDocument) bool {
+	select {
+	case s.queue <- document:
+		return true
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+		return false
+	}
+}
+
+// Stats returns the documents indexed, refused by the cluster, spilled to disk and dropped from a
+// full queue
+func (s *ElasticSink) Stats() (indexed int64, failed int64, spilled int64, dropped int64) {
+	return atomic.LoadInt64(&s.indexed), atomic.LoadInt64(&s.failed), atomic.LoadInt64(&s.spilled), atomic.LoadInt64(&s.dropped)
+}
+
+// Run sends the queued documents until ctx is done, spilled batches are sent again after every
+// batch the cluster takes
+func (s *ElasticSink) Run(ctx context.Context) {
+	for {
+		batch := s.nextBatch(ctx)
+		if ctx.Err() != nil {
+			s.drain(batch)
+			return
+		}
+		if s.Flush(ctx, batch) {
+			s.replaySpill(ctx)
+		}
+	}
+}
+
+// drain sends the documents left on shutdown, they are spilled when the cluster does not take them in time
+func (s *ElasticSink) drain(batch []ElasticDocument) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for len(s.queue) > 0 {
+		batch = append(batch, <-s.queue)
+	}
+	for len(batch) > 0 {
+		size := min(len(batch), max(s.BatchSize, 1))
+		s.Flush(ctx, batch[:size])
+		batch = batch[size:]
+	}
+}
+
+// nextBatch waits for a document and collects the ones following it, it returns nil when ctx is done
+func (s *ElasticSink) nextBatch(ctx context.Context) []ElasticDocument {
+	var batch []ElasticDocument
+	size := 0
+	select {
+	case <-ctx.Done():
+		return nil
+	case document := <-s.queue:
+		batch = append(batch, document)
+		size += len(document.Source)
+	}
+	timer := time.NewTimer(s.FlushInterval)
+	defer timer.Stop()
+	for len(batch) < max(s.BatchSize, 1) && size < s.BatchBytes {
+		select {
+		case document := <-s.queue:
+			batch = append(batch, document)
+			size += len(document.Source)
+		case <-timer.C:
+			return batch
+		case <-ctx.Done():
+			return batch
+		}
+	}
+	return batch
+}
+
+// Flush indexes a batch, it reports whether the cluster took it. Batches it did not take are spilled.
+func (s *ElasticSink) Flush(ctx context.Context, batch []ElasticDocument) bool {
+	if s.Rollover {
+		for _, document := range batch {
+			if err := s.ensureWriteAlias(ctx, document.Index); err != nil {
+				VPrint("Error bootstrapping alias %s: %v", document.Index, err)
+			}
+		}
+	}
+	return s.send(ctx, encodeBulk(batch), len(batch))
+}
+
+// send posts a bulk body with retries. Documents refused for good are counted as failed, the ones
+// still failing after the retries are spilled.
+func (s *ElasticSink) send(ctx context.Context, body []byte, count int) bool {
+	delay := s.RetryDelay
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				s.spill(body, count)
+				return false
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		retry, failed, err := s.bulk(ctx, body)
+		switch {
+		case err != nil:
+			VPrint("Error sending %d documents to Elasticsearch: %v", count, err)
+		case retry == nil:
+			atomic.AddInt64(&s.indexed, int64(count-failed))
+			atomic.AddInt64(&s.failed, int64(failed))
+			return true
+		default:
+			// Part of the batch was taken, the rest is retried
+			retried := bytes.Count(retry, []byte("\n")) / 2
+			atomic.AddInt64(&s.indexed, int64(count-failed-retried))
+			atomic.AddInt64(&s.failed, int64(failed))
+			body, count = retry, retried
+		}
+		if attempt >= s.MaxRetries {
+			s.spill(body, count)
+			return err == nil
+		}
+	}
+}
+
+// bulk posts a bulk body. It returns the actions to retry, nil when there are none, and the
+// number of documents refused for good.
+func (s *ElasticSink) bulk(ctx context.Context, body []byte) ([]byte, int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Config.URL+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	s.Config.authorize(request)
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+	answer, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return nil, 0, fmt.Errorf("response with status code %d", response.StatusCode)
+	}
+	if response.StatusCode >= 300 {
+		// The whole request was refused, retrying it would not change the answer
+		VPrint("Elasticsearch refused bulk request: status code %d: %s", response.StatusCode, answer)
+		return nil, bytes.Count(body, []byte("\n")) / 2, nil
+	}
+
+	var result struct {
+		Errors bool                         `json:"errors"`
+		Items  []map[string]bulkItemOutcome `json:"items"`
+	}
+	if err := json.Unmarshal(answer, &result); err != nil {
+		return nil, 0, fmt.Errorf("error decoding bulk response: %v", err)
+	}
+	if !result.Errors {
+		return nil, 0, nil
+	}
+
+	lines := bytes.SplitAfter(body, []byte("\n"))
+	var retry bytes.Buffer
+	failed := 0
+	for i, item := range result.Items {
+		for _, outcome := range item {
+			switch {
+			case outcome.Status < 300:
+			case outcome.Status == http.StatusTooManyRequests || outcome.Status >= 500:
+				if 2*i+1 < len(lines) {
+					retry.Write(lines[2*i])
+					retry.Write(lines[2*i+1])
+				}
+			default:
+				failed++
+				VPrint("Elasticsearch refused document: status code %d: %s", outcome.Status, outcome.Error)
+			}
+		}
+	}
+	if retry.Len() == 0 {
+		return nil, failed, nil
+	}
+	return retry.Bytes(), failed, nil
+}
+
+// bulkItemOutcome is the answer for one action of a _bulk request
+type bulkItemOutcome struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// encodeBulk builds the body of a _bulk request, an index action and a source line per document
+func encodeBulk(batch []ElasticDocument) []byte {
+	var body bytes.Buffer
+	for _, document := range batch {
+		action := map[string]map[string]string{"index": {"_index": document.Index}}
+		if document.ID != "" {
+			action["index"]["_id"] = document.ID
+		}
+		line, _ := json.Marshal(action)
+		body.Write(line)
+		body.WriteByte('\n')
+		// The source must fit in one line
+		var source bytes.Buffer
+		if err := json.Compact(&source, document.Source); err != nil {
+			source.Reset()
+			source.WriteString("{}")
+		}
+		body.Write(source.Bytes())
+		body.WriteByte('\n')
+	}
+	return body.Bytes()
+}
+
+// spill writes a bulk body to SpillDir, or drops it when there is none
+func (s *ElasticSink) spill(body []byte, count int) {
+	if s.SpillDir == "" {
+		atomic.AddInt64(&s.dropped, int64(count))
+		VPrint("Dropped %d documents, no spill directory", count)
+		return
+	}
+	if err := os.MkdirAll(s.SpillDir, 0755); err != nil {
+		atomic.AddInt64(&s.dropped, int64(count))
+		VPrint("Error creating spill directory: %v", err)
+		return
+	}
+	fileName := filepath.Join(s.SpillDir, fmt.Sprintf("bulk-%020d.ndjson", time.Now().UnixNano()))
+	if err := WriteFileAtomic(fileName, body, 0644); err != nil {
+		atomic.AddInt64(&s.dropped, int64(count))
+		VPrint("Error spilling %d documents: %v", count, err)
+		return
+	}
+	atomic.AddInt64(&s.spilled, int64(count))
+	VPrint("Spilled %d documents to %s", count, fileName)
+}
+
+// SpillFiles returns the spilled batches, oldest first
+func (s *ElasticSink) SpillFiles() []string {
+	if s.SpillDir == "" {
+		return nil
+	}
+	files, _ := filepath.Glob(filepath.Join(s.SpillDir, "bulk-*.ndjson"))
+	sort.Strings(files)
+	return files
+}
+
+// replaySpill sends the spilled batches again, oldest first, stopping at the first one the
+// cluster does not take
+func (s *ElasticSink) replaySpill(ctx context.Context) {
+	for _, fileName := range s.SpillFiles() {
+		body, err := readBulkFile(fileName)
+		if err != nil {
+			VPrint("Error reading spilled batch %s: %v", fileName, err)
+			continue
+		}
+		count := bytes.Count(body, []byte("\n")) / 2
+		retry, failed, err := s.bulk(ctx, body)
+		if err != nil {
+			return
+		}
+		if retry != nil {
+			// Written again as a new batch, the ones taken must not be sent twice
+			if err := WriteFileAtomic(fileName, retry, 0644); err != nil {
+				VPrint("Error rewriting spilled batch %s: %v", fileName, err)
+			}
+			atomic.AddInt64(&s.indexed, int64(count-failed-bytes.Count(retry, []byte("\n"))/2))
+			atomic.AddInt64(&s.failed, int64(failed))
+			return
+		}
+		os.Remove(fileName)
+		atomic.AddInt64(&s.indexed, int64(count-failed))
+		atomic.AddInt64(&s.failed, int64(failed))
+		VPrint("Sent %d spilled documents from %s", count, fileName)
+	}
+}
+
+// readBulkFile reads a spilled batch, dropping a partial last action
+func readBulkFile(fileName string) ([]byte, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), DefaultElasticBatchBytes*2)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, append(append([]byte(nil), line...), '\n'))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return bytes.Join(lines[:len(lines)/2*2], nil), nil
+}
+
+// EnsureTemplate creates or updates a composable index template
+func (s *ElasticSink) EnsureTemplate(ctx context.Context, name string, template json.RawMessage) error {
+	status, answer, err := s.do(ctx, http.MethodPut, "/_index_template/"+name, template)
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		return fmt.Errorf("error putting index template %s: status code %d: %s", name, status, answer)
+	}
+	return nil
+}
+
+// ensureWriteAlias bootstraps a write alias with its first index, <alias>-000001, for rollover
+func (s *ElasticSink) ensureWriteAlias(ctx context.Context, alias string) error {
+	if _, ok := s.aliases.Load(alias); ok {
+		return nil
+	}
+	status, _, err := s.do(ctx, http.MethodHead, "/_alias/"+alias, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound {
+		body := fmt.Sprintf(`{"aliases":{%q:{"is_write_index":true}}}`, alias)
+		status, answer, err := s.do(ctx, http.MethodPut, "/"+alias+"-000001", []byte(body))
+		if err != nil {
+			return err
+		}
+		// Another instance may have created it first
+		if status >= 300 && !bytes.Contains(answer, []byte("resource_already_exists_exception")) {
+			return fmt.Errorf("status code %d: %s", status, answer)
+		}
+	} else if status >= 300 {
+		return fmt.Errorf("status code %d", status)
+	}
+	s.aliases.Store(alias, true)
+	return nil
+}
+
+func (s *ElasticSink) do(ctx context.Context, method string, path string, body []byte) (int, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, s.Config.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	s.Config.authorize(request)
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer response.Body.Close()
+	answer, err := io.ReadAll(response.Body)
+	return response.StatusCode, answer, err
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCluster answers the _bulk, _index_template and alias requests of an ElasticSink
+type fakeCluster struct {
+	mutex     sync.Mutex
+	down      bool
+	reject    map[string]int // Status of the documents with these IDs, once
+	documents map[string]string
+	bulks     int
+	requests  []string
+	auth      string
+}
+
+func newFakeCluster(t *testing.T) (*fakeCluster, *httptest.Server) {
+	cluster := &fakeCluster{reject: make(map[string]int), documents: make(map[string]string)}
+	server := httptest.NewServer(http.HandlerFunc(cluster.serve))
+	t.Cleanup(server.Close)
+	return cluster, server
+}
+
+func (c *fakeCluster) serve(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.Path)
+	c.auth = r.Header.Get("Authorization")
+	if c.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if r.URL.Path != "/_bulk" {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	c.bulks++
+	scanner := bufio.NewScanner(r.Body)
+	var items []map[string]map[string]interface{}
+	errors := false
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		json.Unmarshal(scanner.Bytes(), &action)
+		scanner.Scan()
+		id := action["index"]["_id"]
+		status := http.StatusCreated
+		if rejected, ok := c.reject[id]; ok {
+			status = rejected
+			delete(c.reject, id)
+			errors = true
+		} else {
+			c.documents[action["index"]["_index"]+"/"+id] = scanner.Text()
+		}
+		items = append(items, map[string]map[string]interface{}{"index": {"_id": id, "status": status}})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": errors, "items": items})
+}
+
+func testDocument(id string) ElasticDocument {
+	return ElasticDocument{Index: "jono-acme-2025.03.05", ID: id, Source: json.RawMessage(fmt.Sprintf("{\n  \"imei\": %q\n}", id))}
+}
+
+func TestElasticSinkFlush(t *testing.T) {
+	cluster, server := newFakeCluster(t)
+	sink, err := NewElasticSink(ElasticConfig{URL: server.URL + "/", Username: "elastic", Password: "secret"}, 100,
+		WithElasticRetries(2, time.Millisecond), WithElasticFlushInterval(10*time.Millisecond),
+		WithElasticSpillDir(filepath.Join(t.TempDir(), "spill")))
+	assert.NoError(t, err)
+
+	// Retryable documents are sent again, the refused ones are not
+	cluster.reject["2"] = http.StatusTooManyRequests
+	cluster.reject["3"] = http.StatusBadRequest
+	assert.True(t, sink.Flush(context.Background(), []ElasticDocument{testDocument("1"), testDocument("2"), testDocument("3")}))
+	assert.Equal(t, 2, cluster.bulks)
+	assert.Equal(t, `{"imei":"1"}`, cluster.documents["jono-acme-2025.03.05/1"])
+	assert.Contains(t, cluster.documents, "jono-acme-2025.03.05/2")
+	assert.NotContains(t, cluster.documents, "jono-acme-2025.03.05/3")
+	assert.Equal(t, "Basic ZWxhc3RpYzpzZWNyZXQ=", cluster.auth)
+
+	indexed, failed, spilled, dropped := sink.Stats()
+	assert.Equal(t, []int64{2, 1, 0, 0}, []int64{indexed, failed, spilled, dropped})
+}
+
+func TestElasticSinkSpill(t *testing.T) {
+	cluster, server := newFakeCluster(t)
+	sink, err := NewElasticSink(ElasticConfig{URL: server.URL + "/", Username: "elastic", Password: "secret"}, 100,
+		WithElasticRetries(2, time.Millisecond), WithElasticFlushInterval(10*time.Millisecond),
+		WithElasticSpillDir(filepath.Join(t.TempDir(), "spill")))
+	assert.NoError(t, err)
+
+	// Spilled after the retries while the cluster is down
+	cluster.down = true
+	assert.False(t, sink.Flush(context.Background(), []ElasticDocument{testDocument("1"), testDocument("2")}))
+	assert.Equal(t, 3, len(cluster.requests))
+	files := sink.SpillFiles()
+	assert.Len(t, files, 1)
+	_, _, spilled, _ := sink.Stats()
+	assert.Equal(t, int64(2), spilled)
+
+	// A partial last action, from a crash while spilling, is skipped
+	data, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(files[0], append(data, []byte(`{"index":{"_index":"jono","_id":"9"}}`+"\n")...), 0644))
+
+	// Replayed once the cluster takes a batch again
+	cluster.mutex.Lock()
+	cluster.down = false
+	cluster.mutex.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		sink.Run(ctx)
+		close(stopped)
+	}()
+	assert.True(t, sink.Send(testDocument("3")))
+	assert.Eventually(t, func() bool { return len(sink.SpillFiles()) == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// Documents queued on shutdown are still sent
+	cluster.mutex.Lock()
+	assert.True(t, sink.Send(testDocument("4")))
+	cancel()
+	cluster.mutex.Unlock()
+	<-stopped
+
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		assert.Contains(t, cluster.documents, "jono-acme-2025.03.05/"+id)
+	}
+	assert.Len(t, cluster.documents, 4)
+	indexed, _, _, _ := sink.Stats()
+	assert.Equal(t, int64(4), indexed)
+}
+
+func TestElasticSinkWithoutSpillDir(t *testing.T) {
+	cluster, server := newFakeCluster(t)
+	sink, err := NewElasticSink(ElasticConfig{URL: server.URL}, 100, WithElasticRetries(2, time.Millisecond))
+	assert.NoError(t, err)
+	cluster.down = true
+	assert.False(t, sink.Flush(context.Background(), []ElasticDocument{testDocument("1")}))
+	_, _, spilled, dropped := sink.Stats()
+	assert.Equal(t, []int64{0, 1}, []int64{spilled, dropped})
+
+	// The queue is bounded
+	for i := 0; i < 100; i++ {
+		assert.True(t, sink.Send(testDocument("1")))
+	}
+	assert.False(t, sink.Send(testDocument("1")))
+}
+
+func TestElasticSinkTemplateAndRollover(t *testing.T) {
+	cluster, server := newFakeCluster(t)
+	sink, err := NewElasticSink(ElasticConfig{URL: server.URL, APIKey: "key"}, 100,
+		WithElasticRetries(2, time.Millisecond), WithElasticRollover(true))
+	assert.NoError(t, err)
+	template := json.RawMessage(`{"index_patterns":["jono-*"]}`)
+
+	assert.NoError(t, sink.EnsureTemplate(context.Background(), "jono", template))
+	document := testDocument("1")
+	document.Index = "jono-acme"
+	assert.True(t, sink.Flush(context.Background(), []ElasticDocument{document, document}))
+	assert.Equal(t, []string{
+		"PUT /_index_template/jono",
+		"HEAD /_alias/jono-acme",
+		"PUT /jono-acme-000001",
+		"POST /_bulk",
+	}, cluster.requests)
+	assert.Equal(t, "ApiKey key", cluster.auth)
+
+	cluster.down = true
+	assert.Error(t, sink.EnsureTemplate(context.Background(), "jono", template))
+}
+
+func TestElasticConfig(t *testing.T) {
+	t.Setenv("ELASTIC_URL", "https://elastic.example.com:9200/")
+	t.Setenv("ELASTIC_INSECURE", "true")
+	config := ElasticConfigFromEnv()
+	assert.Equal(t, "https://elastic.example.com:9200", config.URL)
+	assert.True(t, config.InsecureSkipVerify)
+
+	// The cluster's certificate is trusted with the CA file
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "{}")
+	}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, ca, 0644))
+
+	client, err := ElasticConfig{CAFile: caFile}.HTTPClient()
+	assert.NoError(t, err)
+	response, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+
+	client, err = ElasticConfig{}.HTTPClient()
+	assert.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	_, err = ElasticConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}.HTTPClient()
+	assert.Error(t, err)
+	_, err = NewElasticSink(ElasticConfig{}, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvString reads an environment variable, fallback when unset
+func EnvString(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// EnvInt reads an integer environment variable of at least min, fallback when unset
+func EnvInt(name string, fallback int, min int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return number, nil
+}
+
+// EnvDuration reads a positive duration environment variable, fallback when unset
+func EnvDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return duration, nil
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// ParseIMEIs parses a comma separated IMEI list, like the *_FORWARD_IMEIS variables of the forwarders
+func ParseIMEIs(value string) map[string]bool {
+	imeis := make(map[string]bool)
+	for _, imei := range strings.Split(value, ",") {
+		if imei = strings.TrimSpace(imei); imei != "" {
+			imeis[imei] = true
+		}
+	}
+	return imeis
+}
+
+// PacketKeys returns the keys of the packets of a Jono message in the order they were reported,
+// Packet2 before Packet10
+func PacketKeys(packets map[string]models.DataPacket) []string {
+	keys := make([]string, 0, len(packets))
+	for key := range packets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,449 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Frame archive defaults
+const (
+	DefaultArchiveQueueSize     = 10000
+	DefaultArchiveFlushInterval = 5 * time.Second
+	archiveHourLayout           = "2006-01-02/15"
+)
+
+// ArchivedFrame is an inbound message of an interpreter with what came out of it. Payload and
+// RemoteAddr keep the TrackerData keys, so an archive reads as TrackerData JSONL too.
+type ArchivedFrame struct {
+	Time        time.Time         `json:"time"`
+	Interpreter string            `json:"interpreter"`
+	Payload     string            `json:"payload"`
+	RemoteAddr  string            `json:"remoteaddr,omitempty"`
+	IMEI        string            `json:"imei,omitempty"`
+	Jono        []json.RawMessage `json:"jono,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// archiveIndex is written next to each closed archive file, so queries skip the files without the IMEI
+type archiveIndex struct {
+	From  time.Time      `json:"from"`
+	To    time.Time      `json:"to"`
+	IMEIs map[string]int `json:"imeis"`
+}
+
+// FrameArchive writes the frames of an interpreter to gzip compressed JSONL files partitioned by
+// hour, <Dir>/YYYY-MM-DD/HH/<interpreter>-<start>.jsonl.gz, each with a .idx of its IMEIs once
+// closed. Frames are queued and written in the background; day directories older than Retention
+// are removed.
+type FrameArchive struct {
+	Dir           string
+	Interpreter   string
+	Retention     time.Duration // Keep everything when zero
+	FlushInterval time.Duration // Written frames become readable at least this often
+
+	queue chan ArchivedFrame
+	done  chan struct{}
+	once  sync.Once
+
+	devices sync.Map // Last IMEI of each remote address, for the frames that fail before the IMEI is known
+
+	// Writer state, only used by the writer goroutine
+	file   *os.File
+	gzip   *gzip.Writer
+	hour   string
+	index  archiveIndex
+	closed chan struct{}
+
+	archived int64
+	dropped  int64
+	failed   int64
+}
+
+// FrameArchiveOption configures a FrameArchive
+type FrameArchiveOption func(*FrameArchive)
+
+// WithArchiveRetention sets how long the day directories are kept
+func WithArchiveRetention(retention time.Duration) FrameArchiveOption {
+	return func(a *FrameArchive) { a.Retention = retention }
+}
+
+// WithArchiveFlushInterval sets how often the written frames become readable
+func WithArchiveFlushInterval(interval time.Duration) FrameArchiveOption {
+	return func(a *FrameArchive) { a.FlushInterval = interval }
+}
+
+// NewFrameArchive creates an archive for an interpreter, Start begins writing
+func NewFrameArchive(dir string, interpreter string, options ...FrameArchiveOption) *FrameArchive {
+	archive := &FrameArchive{
+		Dir:           dir,
+		Interpreter:   interpreter,
+		FlushInterval: DefaultArchiveFlushInterval,
+		queue:         make(chan ArchivedFrame, DefaultArchiveQueueSize),
+		done:          make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+	for _, option := range options {
+		option(archive)
+	}
+	return archive
+}
+
+// DefaultFrameArchive creates and starts the archive configured by FRAME_ARCHIVE_DIR and
+// FRAME_ARCHIVE_RETENTION (days), nil when FRAME_ARCHIVE_DIR is not set
+func DefaultFrameArchive(interpreter string) *FrameArchive {
+	dir := os.Getenv("FRAME_ARCHIVE_DIR")
+	if dir == "" {
+		return nil
+	}
+	days, err := EnvInt("FRAME_ARCHIVE_RETENTION", 0, 0)
+	if err != nil {
+		log.Printf("%v, keeping every frame", err)
+	}
+	archive := NewFrameArchive(dir, interpreter, WithArchiveRetention(time.Duration(days)*24*time.Hour))
+	archive.Start()
+	VPrint("Archiving %s frames to %s", interpreter, dir)
+	return archive
+}
+
+// Start writes the queued frames in the background until Close
+func (a *FrameArchive) Start() {
+	go a.run()
+}
+
+// Close writes the queued frames and closes the current file
+func (a *FrameArchive) Close() {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() { close(a.done) })
+	<-a.closed
+}
+
+// Stats returns the frames written, dropped from a full queue and lost to write errors
+func (a *FrameArchive) Stats() (archived int64, dropped int64, failed int64) {
+	return atomic.LoadInt64(&a.archived), atomic.LoadInt64(&a.dropped), atomic.LoadInt64(&a.failed)
+}
+
+// Begin starts the record of an inbound message, payload as in TrackerData. It returns nil, and
+// the record methods do nothing, when a is nil.
+func (a *FrameArchive) Begin(payload string, remoteAddr string) *FrameRecord {
+	if a == nil {
+		return nil
+	}
+	return &FrameRecord{archive: a, frame: ArchivedFrame{
+		Time:        time.Now().UTC(),
+		Interpreter: a.Interpreter,
+		Payload:     payload,
+		RemoteAddr:  remoteAddr,
+	}}
+}
+
+// FrameRecord collects the output of one inbound message until End
+type FrameRecord struct {
+	archive *FrameArchive
+	mutex   sync.Mutex
+	frame   ArchivedFrame
+	ended   bool
+}
+
+// Jono adds a Jono message published for the frame, the frame takes its IMEI when it has none
+func (r *FrameRecord) Jono(jono string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	message := json.RawMessage(jono)
+	if !json.Valid(message) {
+		// Kept as a string, the frame must still encode
+		message, _ = json.Marshal(jono)
+	}
+	r.frame.Jono = append(r.frame.Jono, message)
+	if r.frame.IMEI == "" {
+		var decoded struct {
+			IMEI string `json:"IMEI"`
+		}
+		if json.Unmarshal(message, &decoded) == nil {
+			r.frame.IMEI = decoded.IMEI
+		}
+	}
+}
+
+// SetIMEI sets the IMEI of the device that sent the frame
+func (r *FrameRecord) SetIMEI(imei string) {
+	if r == nil || imei == "" {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.frame.IMEI = imei
+}
+
+// Fail records why the frame, or one of its reports, could not be decoded
+func (r *FrameRecord) Fail(err error) {
+	if r == nil || err == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.frame.Error != "" {
+		r.frame.Error += "; "
+	}
+	r.frame.Error += err.Error()
+}
+
+// End queues the record, without blocking; later calls do nothing
+func (r *FrameRecord) End() {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	if r.ended {
+		r.mutex.Unlock()
+		return
+	}
+	r.ended = true
+	frame := r.frame
+	r.mutex.Unlock()
+
+	a := r.archive
+	if frame.RemoteAddr != "" {
+		if frame.IMEI != "" {
+			a.devices.Store(frame.RemoteAddr, frame.IMEI)
+		} else if imei, ok := a.devices.Load(frame.RemoteAddr); ok {
+			frame.IMEI = imei.(string)
+		}
+	}
+	select {
+	case a.queue <- frame:
+	default:
+		atomic.AddInt64(&a.dropped, 1)
+	}
+}
+
+func (a *FrameArchive) run() {
+	defer close(a.closed)
+	flush := a.FlushInterval
+	if flush <= 0 {
+		flush = DefaultArchiveFlushInterval
+	}
+	ticker := time.NewTicker(flush)
+	defer ticker.Stop()
+	for {
+		select {
+		case frame := <-a.queue:
+			a.write(frame)
+		case <-ticker.C:
+			if a.gzip != nil {
+				if err := a.gzip.Flush(); err != nil {
+					VPrint("Error flushing frame archive: %v", err)
+				}
+			}
+		case <-a.done:
+			for len(a.queue) > 0 {
+				a.write(<-a.queue)
+			}
+			a.closeFile()
+			return
+		}
+	}
+}
+
+// write appends a frame to the file of its hour
+func (a *FrameArchive) write(frame ArchivedFrame) {
+	hour := frame.Time.UTC().Format(archiveHourLayout)
+	if hour != a.hour || a.gzip == nil {
+		a.closeFile()
+		if err := a.openFile(hour); err != nil {
+			atomic.AddInt64(&a.failed, 1)
+			VPrint("Error opening frame archive: %v", err)
+			return
+		}
+		a.removeExpired(frame.Time)
+	}
+	line, err := json.Marshal(frame)
+	if err == nil {
+		_, err = a.gzip.Write(append(line, '\n'))
+	}
+	if err != nil {
+		atomic.AddInt64(&a.failed, 1)
+		VPrint("Error writing frame archive: %v", err)
+		return
+	}
+	if a.index.From.IsZero() || frame.Time.Before(a.index.From) {
+		a.index.From = frame.Time
+	}
+	if frame.Time.After(a.index.To) {
+		a.index.To = frame.Time
+	}
+	if frame.IMEI != "" {
+		a.index.IMEIs[frame.IMEI]++
+	}
+	atomic.AddInt64(&a.archived, 1)
+}
+
+func (a *FrameArchive) openFile(hour string) error {
+	dir := filepath.Join(a.Dir, filepath.FromSlash(hour))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.jsonl.gz", a.Interpreter, time.Now().UnixNano())
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	a.file = file
+	a.gzip = gzip.NewWriter(file)
+	a.hour = hour
+	a.index = archiveIndex{IMEIs: make(map[string]int)}
+	return nil
+}
+
+// closeFile finishes the current file and writes its index
+func (a *FrameArchive) closeFile() {
+	if a.file == nil {
+		return
+	}
+	err := a.gzip.Close()
+	if syncErr := a.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		VPrint("Error closing frame archive %s: %v", a.file.Name(), err)
+	} else if data, err := json.Marshal(a.index); err == nil {
+		if err := WriteFileAtomic(archiveIndexName(a.file.Name()), data, 0644); err != nil {
+			VPrint("Error writing frame archive index: %v", err)
+		}
+	}
+	a.file, a.gzip, a.hour = nil, nil, ""
+}
+
+// removeExpired removes the day directories older than Retention
+func (a *FrameArchive) removeExpired(now time.Time) {
+	if a.Retention <= 0 {
+		return
+	}
+	days, _ := filepath.Glob(filepath.Join(a.Dir, "????-??-??"))
+	for _, dir := range days {
+		day, err := time.Parse("2006-01-02", filepath.Base(dir))
+		if err == nil && now.Sub(day.Add(24*time.Hour)) > a.Retention {
+			if err := os.RemoveAll(dir); err != nil {
+				VPrint("Error removing expired frame archive %s: %v", dir, err)
+			}
+		}
+	}
+}
+
+func archiveIndexName(fileName string) string {
+	return strings.TrimSuffix(fileName, ".jsonl.gz") + ".idx"
+}
+
+// ArchiveQuery selects archived frames. Empty fields match everything.
+type ArchiveQuery struct {
+	IMEI        string
+	From        time.Time
+	To          time.Time // Exclusive
+	Interpreter string
+}
+
+// Matches reports whether a frame is selected by the query
+func (q ArchiveQuery) Matches(frame ArchivedFrame) bool {
+	return (q.IMEI == "" || frame.IMEI == q.IMEI) &&
+		(q.Interpreter == "" || frame.Interpreter == q.Interpreter) &&
+		(q.From.IsZero() || !frame.Time.Before(q.From)) &&
+		(q.To.IsZero() || frame.Time.Before(q.To))
+}
+
+// ReadArchive returns the archived frames selected by a query, oldest first. Only the hour
+// partitions between From and To are read, and files whose index does not have the IMEI are
+// skipped. The file being written and files cut by a crash are read up to their last complete frame.
+func ReadArchive(dir string, query ArchiveQuery) ([]ArchivedFrame, error) {
+	hours, err := filepath.Glob(filepath.Join(dir, "????-??-??", "??"))
+	if err != nil {
+		return nil, err
+	}
+	var frames []ArchivedFrame
+	for _, hourDir := range hours {
+		rel, _ := filepath.Rel(dir, hourDir)
+		hour, err := time.Parse(archiveHourLayout, filepath.ToSlash(rel))
+		if err != nil {
+			continue
+		}
+		if (!query.From.IsZero() && !hour.Add(time.Hour).After(query.From)) || (!query.To.IsZero() && !hour.Before(query.To)) {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(hourDir, "*.jsonl.gz"))
+		for _, fileName := range files {
+			if query.IMEI != "" && !archiveIndexHas(fileName, query.IMEI) {
+				continue
+			}
+			read, err := readArchiveFile(fileName, query)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", fileName, err)
+			}
+			frames = append(frames, read...)
+		}
+	}
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].Time.Before(frames[j].Time) })
+	return frames, nil
+}
+
+// archiveIndexHas reports whether a file may have frames of an IMEI, true when it has no index
+func archiveIndexHas(fileName string, imei string) bool {
+	data, err := os.ReadFile(archiveIndexName(fileName))
+	if err != nil {
+		return true
+	}
+	var index archiveIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return true
+	}
+	return index.IMEIs[imei] > 0
+}
+
+func readArchiveFile(fileName string, query ArchiveQuery) ([]ArchivedFrame, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var frames []ArchivedFrame
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var frame ArchivedFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			// A line cut by the end of a flushed block
+			continue
+		}
+		if query.Matches(frame) {
+			frames = append(frames, frame)
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return frames, err
+	}
+	return frames, nil
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameArchiveRotation(t *testing.T) {
+	dir := t.TempDir()
+	archive := NewFrameArchive(dir, "queclink")
+	hour := time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC)
+
+	// One file per hour, each closed with the index of its IMEIs
+	archive.write(ArchivedFrame{Time: hour.Add(59 * time.Minute), Interpreter: "queclink", IMEI: "1"})
+	archive.write(ArchivedFrame{Time: hour.Add(59*time.Minute + time.Second), Interpreter: "queclink", IMEI: "1"})
+	archive.write(ArchivedFrame{Time: hour.Add(61 * time.Minute), Interpreter: "queclink", IMEI: "2"})
+	archive.write(ArchivedFrame{Time: hour.Add(62 * time.Minute), Interpreter: "queclink", Error: "invalid hex"})
+	archive.closeFile()
+
+	for _, tt := range []struct {
+		hour  string
+		imeis map[string]int
+	}{
+		{"2025-03-05/10", map[string]int{"1": 2}},
+		{"2025-03-05/11", map[string]int{"2": 1}},
+	} {
+		files, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(tt.hour), "queclink-*.jsonl.gz"))
+		if !assert.Len(t, files, 1, tt.hour) {
+			continue
+		}
+		data, err := os.ReadFile(archiveIndexName(files[0]))
+		assert.NoError(t, err)
+		var index archiveIndex
+		assert.NoError(t, json.Unmarshal(data, &index))
+		assert.Equal(t, tt.imeis, index.IMEIs, tt.hour)
+	}
+
+	// Queries only read the hours in range and the files with the IMEI
+	for _, tt := range []struct {
+		query ArchiveQuery
+		count int
+	}{
+		{ArchiveQuery{}, 4},
+		{ArchiveQuery{IMEI: "1"}, 2},
+		{ArchiveQuery{IMEI: "2", To: hour.Add(time.Hour)}, 0},
+		{ArchiveQuery{From: hour.Add(time.Hour)}, 2},
+		{ArchiveQuery{Interpreter: "ruptela"}, 0},
+	} {
+		frames, err := ReadArchive(dir, tt.query)
+		assert.NoError(t, err)
+		assert.Len(t, frames, tt.count, "%+v", tt.query)
+	}
+}
+
+func TestFrameArchiveRetention(t *testing.T) {
+	dir := t.TempDir()
+	for _, day := range []string{"2025-03-01", "2025-03-02", "2025-03-03", "2025-03-04", "notaday"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, day, "00"), 0755))
+	}
+
+	// Day directories are removed once their last hour is older than the retention
+	archive := NewFrameArchive(dir, "queclink", WithArchiveRetention(48*time.Hour))
+	archive.write(ArchivedFrame{Time: time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC), IMEI: "1"})
+	archive.closeFile()
+	days, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for i := range days {
+		days[i] = filepath.Base(days[i])
+	}
+	assert.Equal(t, []string{"2025-03-03", "2025-03-04", "2025-03-05", "notaday"}, days)
+
+	// Everything is kept without retention
+	archive = NewFrameArchive(dir, "queclink")
+	archive.write(ArchivedFrame{Time: time.Date(2025, 4, 5, 10, 0, 0, 0, time.UTC), IMEI: "1"})
+	archive.closeFile()
+	days, _ = filepath.Glob(filepath.Join(dir, "????-??-??"))
+	assert.Len(t, days, 4)
+}
+
+func TestFrameRecord(t *testing.T) {
+	archive := NewFrameArchive(t.TempDir(), "queclink")
+
+	// The IMEI comes from the Jono message, frames without one take the last of their address
+	record := archive.Begin("frame", "10.0.0.1:5000")
+	record.Jono(`{"IMEI":"864352045580768"}`)
+	record.Jono("not json")
+	record.End()
+	record.End()
+	record = archive.Begin("zz", "10.0.0.1:5000")
+	record.Fail(os.ErrInvalid)
+	record.Fail(os.ErrClosed)
+	record.End()
+
+	first, second := <-archive.queue, <-archive.queue
+	assert.Empty(t, archive.queue)
+	assert.Equal(t, "864352045580768", first.IMEI)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`{"IMEI":"864352045580768"}`), json.RawMessage(`"not json"`)}, first.Jono)
+	assert.Equal(t, "864352045580768", second.IMEI)
+	assert.Equal(t, "invalid argument; file already closed", second.Error)
+
+	// A nil archive records nothing
+	var disabled *FrameArchive
+	record = disabled.Begin("frame", "")
+	record.Jono("{}")
+	record.SetIMEI("1")
+	record.End()
+	disabled.Close()
+}
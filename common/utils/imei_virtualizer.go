@@ -0,0 +1,416 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IMEI virtualizer defaults
+const (
+	DefaultImeiSpoofURL      = "https://pluto.dudewhereismy.com.mx/virtualimeis?appId=244"
+	DefaultImeiSpoofTTL      = 10 * time.Minute
+	DefaultImeiReloadCheck   = 10 * time.Second
+	DefaultImeiRetryInterval = time.Minute
+)
+
+// ImeiVirtualizer maps the IMEIs of the devices to the virtual IMEIs customers see, and back. The
+// mappings live in one file, {"imeis":[{"original":"...","spoofed":"..."}]}, reloaded when it
+// changes on disk and rewritten from the URL every TTL.
+type ImeiVirtualizer struct {
+	URL            string // SPOOF_IMEI_URL, nothing is downloaded when empty
+	FileName       string
+	TTL            time.Duration
+	ReloadInterval time.Duration // Between the checks of the file for changes
+	RetryInterval  time.Duration // Between downloads after a failure
+	HTTPClient     *http.Client
+
+	loadOnce    sync.Once
+	mutex       sync.RWMutex
+	virtual     map[string]string // Original to virtual
+	original    map[string]string // Virtual to original
+	modTime     time.Time
+	size        int64
+	lastCheck   time.Time
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	fetching    bool
+}
+
+// ImeiVirtualizerOption configures an ImeiVirtualizer
+type ImeiVirtualizerOption func(*ImeiVirtualizer)
+
+// WithReloadInterval sets the time between the checks of the mappings file for changes
+func WithReloadInterval(interval time.Duration) ImeiVirtualizerOption {
+	return func(v *ImeiVirtualizer) { v.ReloadInterval = interval }
+}
+
+// NewImeiVirtualizer creates a virtualizer of the mappings at url, kept in fileName
+func NewImeiVirtualizer(url string, fileName string, options ...ImeiVirtualizerOption) *ImeiVirtualizer {
+	virtualizer := &ImeiVirtualizer{
+		URL:            url,
+		FileName:       fileName,
+		TTL:            DefaultImeiSpoofTTL,
+		ReloadInterval: DefaultImeiReloadCheck,
+		RetryInterval:  DefaultImeiRetryInterval,
+		HTTPClient:     &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, option := range options {
+		option(virtualizer)
+	}
+	return virtualizer
+}
+
+// Virtual returns the virtual IMEI of a device, the IMEI itself when it has none
+func (v *ImeiVirtualizer) Virtual(imei string) string {
+	if virtual, ok := v.lookup(imei, false); ok {
+		return virtual
+	}
+	return imei
+}
+
+// Original returns the device IMEI behind a virtual IMEI, the IMEI itself when it is not virtual
+func (v *ImeiVirtualizer) Original(imei string) string {
+	if original, ok := v.lookup(imei, true); ok {
+		return original
+	}
+	return imei
+}
+
+// VirtualizeJSON replaces the IMEI in the top-level field key of a JSON object by its virtual
+// IMEI. The rest of the payload is kept as it is; it reports whether the IMEI was replaced.
+func (v *ImeiVirtualizer) VirtualizeJSON(payload []byte, key string) ([]byte, bool, error) {
+	return replaceJSONString(payload, key, v.Virtual)
+}
+
+// DevirtualizeJSON replaces a virtual IMEI in the top-level field key of a JSON object by the
+// device IMEI, for the commands addressed to virtual IMEIs
+func (v *ImeiVirtualizer) DevirtualizeJSON(payload []byte, key string) ([]byte, bool, error) {
+	return replaceJSONString(payload, key, v.Original)
+}
+
+func (v *ImeiVirtualizer) lookup(imei string, reverse bool) (string, bool) {
+	imei = strings.TrimSpace(imei)
+	v.loadOnce.Do(v.load)
+	v.checkFile()
+	v.checkTTL()
+
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	if reverse {
+		original, ok := v.original[imei]
+		return original, ok
+	}
+	virtual, ok := v.virtual[imei]
+	return virtual, ok
+}
+
+// load reads the file, the mappings are downloaded when there is none
+func (v *ImeiVirtualizer) load() {
+	if err := v.reload(); err == nil {
+		return
+	} else if !os.IsNotExist(err) {
+		VPrint("Error loading IMEI mappings from %s: %v", v.FileName, err)
+	}
+	if err := v.Refresh(); err != nil {
+		VPrint("Error downloading IMEI mappings: %v", err)
+	}
+}
+
+// checkFile reloads the file when it changed since it was read, at most every ReloadInterval
+func (v *ImeiVirtualizer) checkFile() {
+	v.mutex.Lock()
+	if time.Since(v.lastCheck) < v.ReloadInterval {
+		v.mutex.Unlock()
+		return
+	}
+	v.lastCheck = time.Now()
+	modTime, size := v.modTime, v.size
+	v.mutex.Unlock()
+
+	info, err := os.Stat(v.FileName)
+	if err != nil || (info.ModTime().Equal(modTime) && info.Size() == size) {
+		return
+	}
+	if err := v.reload(); err != nil {
+		VPrint("Error reloading IMEI mappings from %s: %v", v.FileName, err)
+		return
+	}
+	VPrint("Reloaded IMEI mappings from %s", v.FileName)
+}
+
+// checkTTL starts a background download once the mappings are older than TTL
+func (v *ImeiVirtualizer) checkTTL() {
+	if v.URL == "" {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.fetching || time.Since(v.fetchedAt) < v.TTL || time.Since(v.lastAttempt) < v.RetryInterval {
+		return
+	}
+	v.fetching = true
+	go func() {
+		if err := v.Refresh(); err != nil {
+			VPrint("Error downloading IMEI mappings: %v", err)
+		}
+		v.mutex.Lock()
+		v.fetching = false
+		v.mutex.Unlock()
+	}()
+}
+
+// reload reads the mappings from the file
+func (v *ImeiVirtualizer) reload() error {
+	info, err := os.Stat(v.FileName)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(v.FileName)
+	if err != nil {
+		return err
+	}
+	mappings, err := ParseImeiMappings(data)
+	if err != nil {
+		return err
+	}
+	v.set(mappings)
+	v.mutex.Lock()
+	v.modTime, v.size = info.ModTime(), info.Size()
+	if v.fetchedAt.IsZero() {
+		v.fetchedAt = info.ModTime()
+	}
+	v.mutex.Unlock()
+	return nil
+}
+
+// Refresh downloads the mappings, saves them to the file and applies them
+func (v *ImeiVirtualizer) Refresh() error {
+	v.mutex.Lock()
+	v.lastAttempt = time.Now()
+	v.mutex.Unlock()
+	if v.URL == "" {
+		return errors.New("no IMEI mappings URL")
+	}
+
+	response, err := v.HTTPClient.Get(v.URL)
+	if err != nil {
+		return fmt.Errorf("API fetch error: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned non-OK status: %d", response.StatusCode)
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(response.Body); err != nil {
+		return fmt.Errorf("API fetch error: %w", err)
+	}
+	mappings, err := ParseImeiMappings(body.Bytes())
+	if err != nil {
+		return fmt.Errorf("API response parsing error: %w", err)
+	}
+
+	v.set(mappings)
+	v.mutex.Lock()
+	v.fetchedAt = time.Now()
+	v.mutex.Unlock()
+	if err := SaveImeiMappings(mappings, v.FileName); err != nil {
+		return fmt.Errorf("error saving IMEI mappings to %s: %w", v.FileName, err)
+	}
+	// The file written is the one applied, it is not reloaded
+	if info, err := os.Stat(v.FileName); err == nil {
+		v.mutex.Lock()
+		v.modTime, v.size = info.ModTime(), info.Size()
+		v.mutex.Unlock()
+	}
+	return nil
+}
+
+func (v *ImeiVirtualizer) set(mappings ImeiSpoofData) {
+	virtual := make(map[string]string, len(mappings.Imeis))
+	original := make(map[string]string, len(mappings.Imeis))
+	for _, mapping := range mappings.Imeis {
+		virtual[mapping.Original] = mapping.Spoofed
+		original[mapping.Spoofed] = mapping.Original
+	}
+	v.mutex.Lock()
+	v.virtual = virtual
+	v.original = original
+	v.mutex.Unlock()
+	VPrint("Loaded %d IMEI mappings", len(virtual))
+}
+
+// ParseImeiMappings reads IMEI mappings in the file format, {"imeis":[{"original","spoofed"}]}, or
+// the {"original":"spoofed"} map the endpoint answers
+func ParseImeiMappings(data []byte) (ImeiSpoofData, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ImeiSpoofData{}, fmt.Errorf("error unmarshalling IMEI mappings: %v", err)
+	}
+
+	var mappings ImeiSpoofData
+	if list, ok := fields["imeis"]; ok && len(fields) == 1 {
+		if err := json.Unmarshal(list, &mappings.Imeis); err != nil {
+			return ImeiSpoofData{}, fmt.Errorf("error unmarshalling IMEI mappings: %v", err)
+		}
+	} else {
+		var legacy map[string]string
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return ImeiSpoofData{}, fmt.Errorf("error unmarshalling IMEI mappings: %v", err)
+		}
+		for original, spoofed := range legacy {
+			mappings.Imeis = append(mappings.Imeis, ImeiSpoofMapping{Original: original, Spoofed: spoofed})
+		}
+	}
+
+	valid := mappings.Imeis[:0]
+	for _, mapping := range mappings.Imeis {
+		mapping.Original = strings.TrimSpace(mapping.Original)
+		mapping.Spoofed = strings.TrimSpace(mapping.Spoofed)
+		if mapping.Original != "" && mapping.Spoofed != "" {
+			valid = append(valid, mapping)
+		}
+	}
+	mappings.Imeis = valid
+	sort.Slice(mappings.Imeis, func(i, j int) bool {
+		return mappings.Imeis[i].Original < mappings.Imeis[j].Original
+	})
+	return mappings, nil
+}
+
+// SaveImeiMappings writes IMEI mappings in the file format
+func SaveImeiMappings(mappings ImeiSpoofData, fileName string) error {
+	if mappings.Imeis == nil {
+		mappings.Imeis = []ImeiSpoofMapping{}
+	}
+	jsonData, err := json.MarshalIndent(mappings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(fileName, jsonData, 0644)
+}
+
+// replaceJSONString rewrites the string in the top-level field key of a JSON object with replace,
+// keeping the rest of the payload byte for byte. It reports whether the value changed, objects
+// without the field are returned as they are.
+func replaceJSONString(payload []byte, key string, replace func(string) string) ([]byte, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	token, err := decoder.Token()
+	if err != nil {
+		return payload, false, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return payload, false, errors.New("not a JSON object")
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return payload, false, err
+		}
+		keyEnd := int(decoder.InputOffset())
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return payload, false, err
+		}
+		if token != key {
+			continue
+		}
+
+		var current string
+		if err := json.Unmarshal(value, &current); err != nil {
+			return payload, false, fmt.Errorf("%s is not a string", key)
+		}
+		replaced := replace(current)
+		if replaced == current {
+			return payload, false, nil
+		}
+		encoded, err := json.Marshal(replaced)
+		if err != nil {
+			return payload, false, err
+		}
+		valueEnd := int(decoder.InputOffset())
+		valueStart := keyEnd + bytes.IndexFunc(payload[keyEnd:valueEnd], func(r rune) bool {
+			return r != ':' && r != ' ' && r != '\t' && r != '\r' && r != '\n'
+		})
+		result := make([]byte, 0, len(payload)+len(encoded)-len(value))
+		result = append(result, payload[:valueStart]...)
+		result = append(result, encoded...)
+		result = append(result, payload[valueEnd:]...)
+		return result, true, nil
+	}
+	return payload, false, nil
+}
+
+// ImeiVirtualizeEnabled reports whether IMEI_VIRTUALIZE enables the virtual IMEIs in the published
+// messages and the commands
+func ImeiVirtualizeEnabled() bool {
+	switch strings.ToLower(os.Getenv("IMEI_VIRTUALIZE")) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+var (
+	defaultVirtualizerOnce sync.Once
+	defaultVirtualizer     *ImeiVirtualizer
+)
+
+// DefaultImeiVirtualizer returns the virtualizer of SPOOF_IMEI_URL, kept in IMEI_SPOOF_FILE
+// (default data_imei_spoof.json)
+func DefaultImeiVirtualizer() *ImeiVirtualizer {
+	defaultVirtualizerOnce.Do(func() {
+		url := os.Getenv("SPOOF_IMEI_URL")
+		if url == "" {
+			url = DefaultImeiSpoofURL
+		}
+		fileName := os.Getenv("IMEI_SPOOF_FILE")
+		if fileName == "" {
+			fileName = imei_spoofFileName
+		}
+		defaultVirtualizer = NewImeiVirtualizer(url, fileName)
+	})
+	return defaultVirtualizer
+}
+
+// VirtualizePayload replaces the IMEI in the field key of a message about to be published by its
+// virtual IMEI, with DefaultImeiVirtualizer. Other payloads, or all when IMEI_VIRTUALIZE is not
+// enabled, are returned as they are.
+func VirtualizePayload(payload interface{}, key string) interface{} {
+	if !ImeiVirtualizeEnabled() {
+		return payload
+	}
+	switch message := payload.(type) {
+	case string:
+		virtualized, _, err := DefaultImeiVirtualizer().VirtualizeJSON([]byte(message), key)
+		if err != nil {
+			VPrint("Error virtualizing IMEI: %v", err)
+			return payload
+		}
+		return string(virtualized)
+	case []byte:
+		virtualized, _, err := DefaultImeiVirtualizer().VirtualizeJSON(message, key)
+		if err != nil {
+			VPrint("Error virtualizing IMEI: %v", err)
+			return payload
+		}
+		return virtualized
+	}
+	return payload
+}
+
+// OriginalImei returns the device IMEI behind a virtual IMEI a command is addressed to, with
+// DefaultImeiVirtualizer. The IMEI is returned as it is when IMEI_VIRTUALIZE is not enabled.
+func OriginalImei(imei string) string {
+	if !ImeiVirtualizeEnabled() {
+		return imei
+	}
+	return DefaultImeiVirtualizer().Original(imei)
+}
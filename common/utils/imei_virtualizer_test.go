@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImeiVirtualizer(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data_imei_spoof.json")
+	assert.NoError(t, os.WriteFile(fileName, []byte(`{"imeis":[{"original":"864352045580768","spoofed":"900000000000001"}]}`), 0644))
+	virtualizer := NewImeiVirtualizer("", fileName, WithReloadInterval(0))
+	assert.Equal(t, "900000000000001", virtualizer.Virtual("864352045580768"))
+	assert.Equal(t, "864352045580768", virtualizer.Original("900000000000001"))
+	assert.Equal(t, "1", virtualizer.Virtual("1"))
+	assert.Equal(t, "864352045580768", virtualizer.Original("864352045580768"))
+
+	// The file is reloaded when it changes, in the legacy map format too
+	assert.NoError(t, os.WriteFile(virtualizer.FileName, []byte(`{"864352045580768":"900000000000002","1":"900000000000003"}`), 0644))
+	future := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(virtualizer.FileName, future, future))
+	assert.Equal(t, "900000000000002", virtualizer.Virtual("864352045580768"))
+	assert.Equal(t, "1", virtualizer.Original("900000000000003"))
+	assert.Equal(t, "900000000000001", virtualizer.Original("900000000000001"))
+}
+
+func TestImeiVirtualizerRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"864352045580768":"900000000000001"}`))
+	}))
+	defer server.Close()
+
+	fileName := filepath.Join(t.TempDir(), "data_imei_spoof.json")
+	virtualizer := NewImeiVirtualizer(server.URL, fileName)
+	assert.Equal(t, "900000000000001", virtualizer.Virtual("864352045580768"))
+
+	// Saved in the file format
+	data, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"imeis":[{"original":"864352045580768","spoofed":"900000000000001"}]}`, string(data))
+}
+
+func TestParseImeiMappings(t *testing.T) {
+	mappings, err := ParseImeiMappings([]byte(`{"imeis":[{"original":" 2 ","spoofed":"b"},{"original":"1","spoofed":"a"},{"original":"3","spoofed":""}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []ImeiSpoofMapping{{Original: "1", Spoofed: "a"}, {Original: "2", Spoofed: "b"}}, mappings.Imeis)
+
+	_, err = ParseImeiMappings([]byte(`{"imeis":"1"}`))
+	assert.Error(t, err)
+	_, err = ParseImeiMappings([]byte(`[]`))
+	assert.Error(t, err)
+}
+
+func TestReplaceJSONString(t *testing.T) {
+	upper := func(value string) string { return strings.ToUpper(value) }
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+		changed bool
+		err     string
+	}{
+		{"replaced", `{"imei":"abc","n":1}`, `{"imei":"ABC","n":1}`, true, ""},
+		{"spacing kept", "{ \"n\" : [1, {\"imei\":\"x\"}] ,\n\t\"imei\" :\t\"abc\" }", "{ \"n\" : [1, {\"imei\":\"x\"}] ,\n\t\"imei\" :\t\"ABC\" }", true, ""},
+		{"nested fields untouched", `{"Vehicle":{"imei":"abc"}}`, `{"Vehicle":{"imei":"abc"}}`, false, ""},
+		{"escaped value", `{"imei":"a\u0062c"}`, `{"imei":"ABC"}`, true, ""},
+		{"unchanged", `{"imei":"ABC"}`, `{"imei":"ABC"}`, false, ""},
+		{"not a string", `{"imei":1}`, `{"imei":1}`, false, "imei is not a string"},
+		{"not an object", `["imei"]`, `["imei"]`, false, "not a JSON object"},
+		{"invalid", `{"imei":`, `{"imei":`, false, "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, changed, err := replaceJSONString([]byte(tt.payload), "imei", upper)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, string(result))
+			assert.Equal(t, tt.changed, changed)
+		})
+	}
+}
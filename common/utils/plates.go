@@ -2,74 +2,19 @@ package utils
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
-	"strings"
 
 	"github.com/MaddSystems/jonobridge/common/models"
 )
 
 const platesFileName = "data_plates.json"
 
-// GetPlates retrieves plates information for a given IMEI
-// First tries from local file, then from API if needed
+// GetPlates retrieves the plates of a given IMEI from the device registry, which reads the local
+// file and falls back to PLATES_URL
 func GetPlates(imei string) (string, error) {
-	imei = strings.TrimSpace(imei)
-
-	// Try from file first
-	if plates, err := getPlatesFromFile(imei); err == nil {
-		return plates, nil
-	}
-
-	// Fall back to API
-	return getPlatesFromAPI(imei)
-}
-
-// Helper to get plates from file
-func getPlatesFromFile(imei string) (string, error) {
-	data, err := LoadFromFile(platesFileName)
-	if err != nil {
-		return "", err
-	}
-
-	return searchImeiInData(data, imei)
-}
-
-// Helper to get plates from API
-func getPlatesFromAPI(imei string) (string, error) {
-	apiURL := os.Getenv("PLATES_URL")
-	// VPrint("Plates URL: %s", apiURL)
-
-	// Fetch API data
-	apiResponse, err := fetchFromURL(apiURL)
-	if err != nil {
-		return "", fmt.Errorf("API fetch error: %w", err)
-	}
-
-	// Parse response
-	data, err := LoadFromString(apiResponse)
-	if err != nil {
-		return "", fmt.Errorf("API response parsing error: %w", err)
-	}
-
-	// Save for future use
-	SaveToFile(data, platesFileName)
-
-	// Search for the IMEI
-	return searchImeiInData(data, imei)
-}
-
-// Search for IMEI in the data model
-func searchImeiInData(data *models.PlatesModel, imei string) (string, error) {
-	for _, item := range data.Imeis {
-		if strings.TrimSpace(item.Imei) == imei {
-			return item.Plates, nil
-		}
-	}
-	return "", errors.New("IMEI no encontrado")
+	return registry().Plates(imei)
 }
 
 // LoadFromFile loads plates data from a file
@@ -93,14 +38,15 @@ func LoadFromFile(fileName string) (*models.PlatesModel, error) {
 	return &plates, nil
 }
 
-// SaveToFile saves plates data to a file
+// SaveToFile saves plates data to a file. It is written to a temporary file first and renamed,
+// so readers never see a partial catalog.
 func SaveToFile(plates *models.PlatesModel, fileName string) error {
 	jsonData, err := json.MarshalIndent(plates, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(fileName, jsonData, 0644)
+	return WriteFileAtomic(fileName, jsonData, 0644)
 }
 
 // LoadFromString creates a PlatesModel from a JSON string
@@ -112,19 +58,3 @@ func LoadFromString(jsonData string) (*models.PlatesModel, error) {
 	}
 	return &plates, nil
 }
-
-// fetchFromURL retrieves data from an external API
-func fetchFromURL(url string) (string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(body), nil
-}
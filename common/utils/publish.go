@@ -0,0 +1,15 @@
+package utils
+
+// PublishPayload prepares a message an interpreter is about to publish on topic. Jono messages
+// carry the vehicle when VEHICLE_ENRICH is enabled (EnrichPayload), looked up with the device IMEI,
+// and the virtual IMEI of the device when IMEI_VIRTUALIZE is (VirtualizePayload), like the
+// tracker/assign-imei2remoteaddr messages. Other topics are returned as they are.
+func PublishPayload(topic string, payload interface{}) interface{} {
+	switch topic {
+	case "tracker/jonoprotocol":
+		return VirtualizePayload(EnrichPayload(payload), "IMEI")
+	case "tracker/assign-imei2remoteaddr":
+		return VirtualizePayload(payload, "imei")
+	}
+	return payload
+}
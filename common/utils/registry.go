@@ -0,0 +1,408 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// Device registry defaults
+const (
+	DefaultRegistryTTL        = 10 * time.Minute
+	DefaultMinRefreshInterval = time.Minute
+	DefaultNegativeTTL        = 5 * time.Minute
+)
+
+// ErrDeviceNotFound is returned for the IMEIs that are not in the catalog
+var ErrDeviceNotFound = errors.New("IMEI no encontrado")
+
+// Devices is the device catalog: the DeviceRegistry, a DeviceMap or a mock in tests
+type Devices interface {
+	VehicleLookup
+	Device(imei string) (models.Imei, error)
+	Plates(imei string) (string, error)
+	Eco(imei string) (string, error)
+	Vin(imei string) (string, error)
+	Url(imei string) (string, error)
+	Client(imei string) (string, error)
+}
+
+// DeviceRegistry keeps the plates catalog in memory, indexed by IMEI. It starts from the local
+// file and refreshes from the URL in the background once older than TTL, with the ETag and
+// Last-Modified of the last download so an unchanged catalog is not downloaded again. An unknown IMEI refreshes it
+// right away, the lookups missing at the same time waiting for the same download; IMEIs still
+// unknown afterwards are not looked up again for NegativeTTL.
+type DeviceRegistry struct {
+	URL                string // Plates catalog, PLATES_URL
+	FileName           string // Local copy of the catalog, read on start and rewritten on refresh
+	TTL                time.Duration
+	MinRefreshInterval time.Duration // Between the downloads started by lookups, also after a failure
+	NegativeTTL        time.Duration
+	HTTPClient         *http.Client
+
+	loadOnce     sync.Once
+	mutex        sync.RWMutex
+	devices      map[string]models.Imei
+	misses       map[string]time.Time
+	loadedAt     time.Time
+	lastAttempt  time.Time
+	etag         string
+	lastModified string
+	inflight     *refreshCall
+}
+
+// refreshCall is a download in flight, shared by everyone waiting for it
+type refreshCall struct {
+	done chan struct{}
+	err  error
+}
+
+// DeviceRegistryOption configures a DeviceRegistry
+type DeviceRegistryOption func(*DeviceRegistry)
+
+// WithMinRefreshInterval sets the time between the downloads started by lookups
+func WithMinRefreshInterval(interval time.Duration) DeviceRegistryOption {
+	return func(r *DeviceRegistry) { r.MinRefreshInterval = interval }
+}
+
+// WithNegativeTTL sets how long an unknown IMEI is not looked up again
+func WithNegativeTTL(ttl time.Duration) DeviceRegistryOption {
+	return func(r *DeviceRegistry) { r.NegativeTTL = ttl }
+}
+
+// NewDeviceRegistry creates a registry of the catalog at url, saved to fileName
+func NewDeviceRegistry(url string, fileName string, ttl time.Duration, options ...DeviceRegistryOption) *DeviceRegistry {
+	if ttl <= 0 {
+		ttl = DefaultRegistryTTL
+	}
+	registry := &DeviceRegistry{
+		URL:                url,
+		FileName:           fileName,
+		TTL:                ttl,
+		MinRefreshInterval: DefaultMinRefreshInterval,
+		NegativeTTL:        DefaultNegativeTTL,
+		HTTPClient:         &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, option := range options {
+		option(registry)
+	}
+	return registry
+}
+
+// Device returns the catalog entry of an IMEI, ErrDeviceNotFound when there is none
+func (r *DeviceRegistry) Device(imei string) (models.Imei, error) {
+	imei = strings.TrimSpace(imei)
+	r.loadOnce.Do(r.load)
+
+	if device, ok := r.lookup(imei); ok {
+		return device, nil
+	}
+	call := r.missRefresh(imei)
+	if call == nil {
+		return models.Imei{}, ErrDeviceNotFound
+	}
+	<-call.done
+	if call.err != nil {
+		VPrint("Error refreshing devices for %s: %v", imei, call.err)
+	}
+	if device, ok := r.lookup(imei); ok {
+		return device, nil
+	}
+	r.mutex.Lock()
+	r.misses[imei] = time.Now()
+	r.mutex.Unlock()
+	return models.Imei{}, ErrDeviceNotFound
+}
+
+// Plates returns the plates of an IMEI
+func (r *DeviceRegistry) Plates(imei string) (string, error) {
+	device, err := r.Device(imei)
+	return device.Plates, err
+}
+
+// Eco returns the economic number of an IMEI
+func (r *DeviceRegistry) Eco(imei string) (string, error) {
+	device, err := r.Device(imei)
+	return device.Eco, err
+}
+
+// Vin returns the VIN of an IMEI
+func (r *DeviceRegistry) Vin(imei string) (string, error) {
+	device, err := r.Device(imei)
+	return device.Vin, err
+}
+
+// Url returns the destination URL of an IMEI
+func (r *DeviceRegistry) Url(imei string) (string, error) {
+	device, err := r.Device(imei)
+	return device.Url, err
+}
+
+// Client returns the client of an IMEI
+func (r *DeviceRegistry) Client(imei string) (string, error) {
+	device, err := r.Device(imei)
+	return device.Client, err
+}
+
+// Vehicle returns the vehicle of an IMEI
+func (r *DeviceRegistry) Vehicle(imei string) (*models.Vehicle, bool) {
+	device, err := r.Device(imei)
+	if err != nil {
+		return nil, false
+	}
+	return deviceVehicle(device), true
+}
+
+// lookup finds an IMEI in the index, starting a background refresh when the index is stale
+func (r *DeviceRegistry) lookup(imei string) (models.Imei, bool) {
+	r.mutex.RLock()
+	device, ok := r.devices[imei]
+	stale := time.Since(r.loadedAt) > r.TTL
+	r.mutex.RUnlock()
+
+	if stale {
+		r.mutex.Lock()
+		if r.inflight == nil && time.Since(r.loadedAt) > r.TTL && time.Since(r.lastAttempt) >= r.MinRefreshInterval {
+			r.startRefreshLocked()
+		}
+		r.mutex.Unlock()
+	}
+	return device, ok
+}
+
+// missRefresh returns the download an unknown IMEI waits for: the one in flight, or a new one
+// unless the IMEI was just missed or the last download was too recent. It returns nil when there
+// is nothing to wait for.
+func (r *DeviceRegistry) missRefresh(imei string) *refreshCall {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.inflight != nil {
+		return r.inflight
+	}
+	if missed, ok := r.misses[imei]; ok && time.Since(missed) < r.NegativeTTL {
+		return nil
+	}
+	if time.Since(r.lastAttempt) < r.MinRefreshInterval {
+		r.misses[imei] = time.Now()
+		return nil
+	}
+	return r.startRefreshLocked()
+}
+
+// Refresh downloads the catalog and replaces the index, joining the download in flight if any
+func (r *DeviceRegistry) Refresh() error {
+	r.mutex.Lock()
+	call := r.startRefreshLocked()
+	r.mutex.Unlock()
+	<-call.done
+	return call.err
+}
+
+// startRefreshLocked starts a download unless one is in flight, r.mutex must be held
+func (r *DeviceRegistry) startRefreshLocked() *refreshCall {
+	if r.inflight != nil {
+		return r.inflight
+	}
+	if r.misses == nil {
+		r.misses = make(map[string]time.Time)
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	r.inflight = call
+	r.lastAttempt = time.Now()
+	go func() {
+		call.err = r.fetch()
+		r.mutex.Lock()
+		r.inflight = nil
+		r.mutex.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// load reads the local file, the catalog is downloaded when there is none. The file has no
+// validators, the first download is not conditional.
+func (r *DeviceRegistry) load() {
+	r.mutex.Lock()
+	r.misses = make(map[string]time.Time)
+	r.mutex.Unlock()
+
+	if r.FileName != "" {
+		if data, err := LoadFromFile(r.FileName); err == nil {
+			loadedAt := time.Now()
+			if info, err := os.Stat(r.FileName); err == nil {
+				loadedAt = info.ModTime()
+			}
+			r.set(data, loadedAt, "", "")
+			return
+		}
+	}
+	if err := r.Refresh(); err != nil {
+		VPrint("Error loading devices: %v", err)
+	}
+}
+
+// fetch downloads the catalog, a 304 answer keeps the index and resets its age
+func (r *DeviceRegistry) fetch() error {
+	if r.URL == "" {
+		return errors.New("no plates URL")
+	}
+	request, err := http.NewRequest(http.MethodGet, r.URL, nil)
+	if err != nil {
+		return err
+	}
+	r.mutex.RLock()
+	if r.etag != "" {
+		request.Header.Set("If-None-Match", r.etag)
+	}
+	if r.lastModified != "" {
+		request.Header.Set("If-Modified-Since", r.lastModified)
+	}
+	r.mutex.RUnlock()
+
+	response, err := r.HTTPClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("API fetch error: %w", err)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		r.mutex.Lock()
+		r.loadedAt = time.Now()
+		r.mutex.Unlock()
+		VPrint("Devices not modified")
+		return nil
+	default:
+		return fmt.Errorf("API fetch error: status code %d", response.StatusCode)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("API fetch error: %w", err)
+	}
+	data, err := LoadFromString(string(body))
+	if err != nil {
+		return fmt.Errorf("API response parsing error: %w", err)
+	}
+
+	r.set(data, time.Now(), response.Header.Get("ETag"), response.Header.Get("Last-Modified"))
+	if r.FileName != "" {
+		if err := SaveToFile(data, r.FileName); err != nil {
+			VPrint("Error saving devices to %s: %v", r.FileName, err)
+		}
+	}
+	return nil
+}
+
+// set replaces the index, forgetting the IMEIs missed so far
+func (r *DeviceRegistry) set(data *models.PlatesModel, loadedAt time.Time, etag string, lastModified string) {
+	devices := make(map[string]models.Imei, len(data.Imeis))
+	for _, item := range data.Imeis {
+		devices[strings.TrimSpace(item.Imei)] = item
+	}
+	r.mutex.Lock()
+	r.devices = devices
+	r.misses = make(map[string]time.Time)
+	r.loadedAt = loadedAt
+	r.etag = etag
+	r.lastModified = lastModified
+	r.mutex.Unlock()
+	VPrint("Loaded %d devices", len(devices))
+}
+
+// DeviceMap is a fixed catalog indexed by IMEI, for tests and tools without a PLATES_URL
+type DeviceMap map[string]models.Imei
+
+// Device returns the catalog entry of an IMEI, ErrDeviceNotFound when there is none
+func (m DeviceMap) Device(imei string) (models.Imei, error) {
+	device, ok := m[strings.TrimSpace(imei)]
+	if !ok {
+		return models.Imei{}, ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+// Plates returns the plates of an IMEI
+func (m DeviceMap) Plates(imei string) (string, error) {
+	device, err := m.Device(imei)
+	return device.Plates, err
+}
+
+// Eco returns the economic number of an IMEI
+func (m DeviceMap) Eco(imei string) (string, error) {
+	device, err := m.Device(imei)
+	return device.Eco, err
+}
+
+// Vin returns the VIN of an IMEI
+func (m DeviceMap) Vin(imei string) (string, error) {
+	device, err := m.Device(imei)
+	return device.Vin, err
+}
+
+// Url returns the destination URL of an IMEI
+func (m DeviceMap) Url(imei string) (string, error) {
+	device, err := m.Device(imei)
+	return device.Url, err
+}
+
+// Client returns the client of an IMEI
+func (m DeviceMap) Client(imei string) (string, error) {
+	device, err := m.Device(imei)
+	return device.Client, err
+}
+
+// Vehicle returns the vehicle of an IMEI
+func (m DeviceMap) Vehicle(imei string) (*models.Vehicle, bool) {
+	device, err := m.Device(imei)
+	if err != nil {
+		return nil, false
+	}
+	return deviceVehicle(device), true
+}
+
+func deviceVehicle(device models.Imei) *models.Vehicle {
+	return &models.Vehicle{
+		Plates: device.Plates,
+		Eco:    device.Eco,
+		VIN:    device.Vin,
+		Client: device.Client,
+		URL:    device.Url,
+	}
+}
+
+// Registry is the catalog behind GetPlates, GetEco, GetVin, GetUrl, GetClient and EnrichPayload,
+// DefaultDeviceRegistry when nil. Tests replace it with a DeviceMap or a mock.
+var Registry Devices
+
+var (
+	defaultRegistryOnce sync.Once
+	defaultRegistry     *DeviceRegistry
+)
+
+// DefaultDeviceRegistry returns the registry of the PLATES_URL catalog, saved to data_plates.json.
+// PLATES_TTL sets the refresh interval, e.g. 10m.
+func DefaultDeviceRegistry() *DeviceRegistry {
+	defaultRegistryOnce.Do(func() {
+		ttl, err := EnvDuration("PLATES_TTL", DefaultRegistryTTL)
+		if err != nil {
+			log.Printf("%v, refreshing every %s", err, DefaultRegistryTTL)
+		}
+		defaultRegistry = NewDeviceRegistry(os.Getenv("PLATES_URL"), platesFileName, ttl)
+	})
+	return defaultRegistry
+}
+
+func registry() Devices {
+	if Registry != nil {
+		return Registry
+	}
+	return DefaultDeviceRegistry()
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const catalog = `{"imeis":[{"plates":"ABC-123","eco":"ECO-7","vin":"3N1AB7AP5KY000001","imei":" 864352045580768 ","url":"https://client.example.com","client":"ACME"}]}`
+
+// fakeCatalog serves the plates catalog with an ETag, counting the downloads
+type fakeCatalog struct {
+	mutex       sync.Mutex
+	body        string
+	etag        string
+	delay       time.Duration
+	requests    int
+	modified    int      // Answers with the catalog, the others were 304
+	conditional []string // If-None-Match and If-Modified-Since of every request
+}
+
+func (f *fakeCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.delay)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests++
+	f.conditional = append(f.conditional, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+	if r.Header.Get("If-None-Match") == f.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	f.modified++
+	w.Header().Set("ETag", f.etag)
+	w.Write([]byte(f.body))
+}
+
+func (f *fakeCatalog) set(body string, etag string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.body = body
+	f.etag = etag
+}
+
+func (f *fakeCatalog) counts() (int, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.requests, f.modified
+}
+
+func TestDeviceRegistryGetters(t *testing.T) {
+	fake := &fakeCatalog{body: catalog, etag: `"1"`}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	registry := NewDeviceRegistry(server.URL, filepath.Join(t.TempDir(), "data_plates.json"), time.Hour)
+
+	// Every getter returns its own field
+	for _, getter := range []struct {
+		get  func(string) (string, error)
+		want string
+	}{
+		{registry.Plates, "ABC-123"},
+		{registry.Eco, "ECO-7"},
+		{registry.Vin, "3N1AB7AP5KY000001"},
+		{registry.Url, "https://client.example.com"},
+		{registry.Client, "ACME"},
+	} {
+		value, err := getter.get("864352045580768")
+		assert.NoError(t, err)
+		assert.Equal(t, getter.want, value)
+	}
+	vehicle, ok := registry.Vehicle("864352045580768")
+	assert.True(t, ok)
+	assert.Equal(t, "ECO-7", vehicle.Eco)
+
+	requests, _ := fake.counts()
+	assert.Equal(t, 1, requests)
+	assert.FileExists(t, registry.FileName)
+	files, _ := os.ReadDir(filepath.Dir(registry.FileName))
+	assert.Len(t, files, 1, "no temporary files left behind")
+}
+
+func TestDeviceRegistryMisses(t *testing.T) {
+	fake := &fakeCatalog{body: catalog, etag: `"1"`, delay: 20 * time.Millisecond}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	registry := NewDeviceRegistry(server.URL, filepath.Join(t.TempDir(), "data_plates.json"), time.Hour, WithMinRefreshInterval(0))
+	_, err := registry.Device("864352045580768")
+	assert.NoError(t, err)
+
+	// Concurrent misses share one download
+	fake.set(`{"imeis":[{"plates":"XYZ-9","imei":"1"}]}`, `"2"`)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plates, err := registry.Plates("1")
+			assert.NoError(t, err)
+			assert.Equal(t, "XYZ-9", plates)
+		}()
+	}
+	wg.Wait()
+	requests, modified := fake.counts()
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 2, modified)
+
+	// A miss is answered from the negative cache until NegativeTTL, the catalog not being modified
+	_, err = registry.Device("2")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	_, err = registry.Device("2")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	requests, modified = fake.counts()
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, modified)
+}
+
+func TestDeviceRegistryNegativeTTL(t *testing.T) {
+	fake := &fakeCatalog{body: catalog, etag: `"1"`}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	// Without a negative cache every miss asks the server again
+	registry := NewDeviceRegistry(server.URL, filepath.Join(t.TempDir(), "data_plates.json"), time.Hour,
+		WithMinRefreshInterval(0), WithNegativeTTL(0))
+	for i := 0; i < 3; i++ {
+		_, err := registry.Device("2")
+		assert.ErrorIs(t, err, ErrDeviceNotFound)
+	}
+	requests, modified := fake.counts()
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, 1, modified)
+	assert.Equal(t, []string{"|", `"1"|`, `"1"|`, `"1"|`}, fake.conditional)
+}
+
+func TestDeviceRegistryFromFile(t *testing.T) {
+	fake := &fakeCatalog{body: `{"imeis":[]}`, etag: `"2"`}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	fileName := filepath.Join(t.TempDir(), "data_plates.json")
+	assert.NoError(t, os.WriteFile(fileName, []byte(catalog), 0644))
+
+	registry := NewDeviceRegistry(server.URL, fileName, time.Hour, WithMinRefreshInterval(0))
+	_, ok := registry.Vehicle("864352045580768")
+	assert.True(t, ok)
+	requests, _ := fake.counts()
+	assert.Equal(t, 0, requests)
+
+	// Once older than the TTL the catalog is refreshed in the background, without validators
+	// as the file has none
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(fileName, old, old))
+	registry = NewDeviceRegistry(server.URL, fileName, time.Hour, WithMinRefreshInterval(0))
+	_, ok = registry.Vehicle("864352045580768")
+	assert.True(t, ok)
+	assert.Eventually(t, func() bool {
+		_, modified := fake.counts()
+		return modified == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, ok := registry.Vehicle("864352045580768")
+		return !ok
+	}, 5*time.Second, 5*time.Millisecond)
+	fake.mutex.Lock()
+	assert.Equal(t, "|", fake.conditional[0])
+	fake.mutex.Unlock()
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// VehicleLookup finds the vehicle a device is installed in
+type VehicleLookup interface {
+	Vehicle(imei string) (*models.Vehicle, bool)
+}
+
+// EnrichJono adds the Vehicle block to a Jono message, it reports whether the IMEI has a vehicle.
+// The payload is returned unchanged when it has none.
+func EnrichJono(payload []byte, lookup VehicleLookup) ([]byte, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload, false, fmt.Errorf("error decoding Jono message: %v", err)
+	}
+	var imei string
+	if err := json.Unmarshal(fields["IMEI"], &imei); err != nil || imei == "" {
+		return payload, false, errors.New("Jono message without IMEI")
+	}
+	vehicle, ok := lookup.Vehicle(imei)
+	if !ok {
+		return payload, false, nil
+	}
+	block, err := json.Marshal(vehicle)
+	if err != nil {
+		return payload, false, err
+	}
+
+	if _, ok := fields["Vehicle"]; ok {
+		fields["Vehicle"] = block
+		enriched, err := json.Marshal(fields)
+		if err != nil {
+			return payload, false, err
+		}
+		return enriched, true, nil
+	}
+	// Spliced before the closing brace so the message keeps its field order, there is at least
+	// the IMEI before it
+	trimmed := bytes.TrimRight(payload, " \t\r\n")
+	var enriched bytes.Buffer
+	enriched.Write(trimmed[:len(trimmed)-1])
+	enriched.WriteString(`,"Vehicle":`)
+	enriched.Write(block)
+	enriched.WriteByte('}')
+	return enriched.Bytes(), true, nil
+}
+
+// VehicleEnrichEnabled reports whether VEHICLE_ENRICH enables the enrichment of the published
+// Jono messages
+func VehicleEnrichEnabled() bool {
+	switch strings.ToLower(os.Getenv("VEHICLE_ENRICH")) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// EnrichPayload adds the Vehicle block to a Jono message about to be published, with the
+// Registry catalog. Other payloads, or all when VEHICLE_ENRICH is not enabled, are returned as
+// they are.
+func EnrichPayload(payload interface{}) interface{} {
+	if !VehicleEnrichEnabled() {
+		return payload
+	}
+	vehicles := registry()
+	switch message := payload.(type) {
+	case string:
+		enriched, _, err := EnrichJono([]byte(message), vehicles)
+		if err != nil {
+			VPrint("Error enriching Jono message: %v", err)
+			return payload
+		}
+		return string(enriched)
+	case []byte:
+		enriched, _, err := EnrichJono(message, vehicles)
+		if err != nil {
+			VPrint("Error enriching Jono message: %v", err)
+			return payload
+		}
+		return enriched
+	}
+	return payload
+}
@@ -0,0 +1,77 @@
+package usecases
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Route republishes the messages of Input to Output with the IMEI in Key replaced
+type Route struct {
+	Input   string
+	Output  string
+	Key     string
+	Reverse bool // Virtual to device IMEI, for the commands
+}
+
+// Stage applies the virtual IMEIs to the routes
+type Stage struct {
+	Virtualizer *utils.ImeiVirtualizer
+	Routes      []Route
+
+	rewritten int64
+	unchanged int64
+	failed    int64
+}
+
+// ParseRoute parses an "input>output" route, empty when value is
+func ParseRoute(value string, key string, reverse bool) (*Route, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	input, output, ok := strings.Cut(value, ">")
+	input, output = strings.TrimSpace(input), strings.TrimSpace(output)
+	if !ok || input == "" || output == "" {
+		return nil, fmt.Errorf("invalid route %q, expected input>output", value)
+	}
+	if input == output {
+		return nil, fmt.Errorf("invalid route %q, the output topic must be different", value)
+	}
+	return &Route{Input: input, Output: output, Key: key, Reverse: reverse}, nil
+}
+
+// Route returns the route of a topic
+func (s *Stage) Route(topic string) (Route, bool) {
+	for _, route := range s.Routes {
+		if route.Input == topic {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// Rewrite replaces the IMEI of a message. Messages without a mapping are returned as they are.
+func (s *Stage) Rewrite(route Route, payload []byte) ([]byte, error) {
+	rewrite := s.Virtualizer.VirtualizeJSON
+	if route.Reverse {
+		rewrite = s.Virtualizer.DevirtualizeJSON
+	}
+	rewritten, changed, err := rewrite(payload, route.Key)
+	switch {
+	case err != nil:
+		atomic.AddInt64(&s.failed, 1)
+		return nil, fmt.Errorf("error rewriting %s of %s message: %v", route.Key, route.Input, err)
+	case changed:
+		atomic.AddInt64(&s.rewritten, 1)
+	default:
+		atomic.AddInt64(&s.unchanged, 1)
+	}
+	return rewritten, nil
+}
+
+// Stats returns the messages with their IMEI replaced, without a mapping and undecodable
+func (s *Stage) Stats() (rewritten int64, unchanged int64, failed int64) {
+	return atomic.LoadInt64(&s.rewritten), atomic.LoadInt64(&s.unchanged), atomic.LoadInt64(&s.failed)
+}
@@ -0,0 +1,62 @@
+package usecases
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStage(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data_imei_spoof.json")
+	assert.NoError(t, os.WriteFile(fileName, []byte(`{"imeis":[{"original":"864352045580768","spoofed":"900000000000001"}]}`), 0644))
+	stage := &Stage{Virtualizer: utils.NewImeiVirtualizer("", fileName)}
+	jono, err := ParseRoute("tracker/jonoprotocol>tracker/jonoprotocol/virtual", "IMEI", false)
+	assert.NoError(t, err)
+	commands, err := ParseRoute(" virtual/commands > skywave/commands ", "imei", true)
+	assert.NoError(t, err)
+	stage.Routes = []Route{*jono, *commands}
+
+	route, ok := stage.Route("tracker/jonoprotocol")
+	assert.True(t, ok)
+	rewritten, err := stage.Rewrite(route, []byte(`{"IMEI" : "864352045580768","Message":null,"Vehicle":{"IMEI":"x"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"IMEI" : "900000000000001","Message":null,"Vehicle":{"IMEI":"x"}}`, string(rewritten))
+
+	// Commands addressed to the virtual IMEI reach the device
+	route, ok = stage.Route("virtual/commands")
+	assert.True(t, ok)
+	assert.Equal(t, "skywave/commands", route.Output)
+	rewritten, err = stage.Rewrite(route, []byte(`{"id":"cmd-1","imei":"900000000000001","command":"poll_position"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"cmd-1","imei":"864352045580768","command":"poll_position"}`, string(rewritten))
+
+	unchanged := []byte(`{"command":"cancel","params":{"id":"cmd-1"}}`)
+	rewritten, err = stage.Rewrite(route, unchanged)
+	assert.NoError(t, err)
+	assert.Equal(t, unchanged, rewritten)
+
+	_, err = stage.Rewrite(route, []byte(`{"imei":1}`))
+	assert.ErrorContains(t, err, "imei is not a string")
+	_, err = stage.Rewrite(route, []byte(`["imei"]`))
+	assert.Error(t, err)
+
+	_, ok = stage.Route("other")
+	assert.False(t, ok)
+	rewrittenCount, unchangedCount, failed := stage.Stats()
+	assert.Equal(t, int64(2), rewrittenCount)
+	assert.Equal(t, int64(1), unchangedCount)
+	assert.Equal(t, int64(2), failed)
+}
+
+func TestParseRoute(t *testing.T) {
+	route, err := ParseRoute("", "IMEI", false)
+	assert.NoError(t, err)
+	assert.Nil(t, route)
+	for _, value := range []string{"a", "a>", ">b", "a>a"} {
+		_, err := ParseRoute(value, "IMEI", false)
+		assert.Error(t, err, value)
+	}
+}
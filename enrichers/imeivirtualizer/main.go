@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"imeivirtualizer/features/imei_virtualizer/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func main() {
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	utils.VPrint("Starting IMEI virtualizer")
+
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stage := &usecases.Stage{Virtualizer: utils.DefaultImeiVirtualizer()}
+	for _, setting := range []struct {
+		name     string
+		fallback string
+		key      string
+		reverse  bool
+	}{
+		{"IMEI_VIRTUALIZE_ROUTE", "tracker/jonoprotocol>tracker/jonoprotocol/virtual", "IMEI", false},
+		{"IMEI_VIRTUALIZE_COMMANDS", "", "imei", true},
+		{"IMEI_VIRTUALIZE_RESULTS", "", "imei", false},
+	} {
+		route, err := usecases.ParseRoute(utils.EnvString(setting.name, setting.fallback), setting.key, setting.reverse)
+		if err != nil {
+			log.Fatalf("invalid %s: %v", setting.name, err)
+		}
+		if route != nil {
+			stage.Routes = append(stage.Routes, *route)
+		}
+	}
+
+	opts, err := mqttConfig.ClientOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientID := fmt.Sprintf("imeivirtualizer_%s_%d", os.Getenv("HOSTNAME"), time.Now().UnixNano()%100000)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(mqttConfig.Shared()) // Persistent session, unless the replicas share the subscriptions
+	opts.SetAutoReconnect(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetOrderMatters(true) // Messages keep their order on the output topics
+	opts.SetResumeSubs(true)
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		route, ok := stage.Route(mqttConfig.TopicName(msg.Topic()))
+		if !ok {
+			return
+		}
+		rewritten, err := stage.Rewrite(route, msg.Payload())
+		if err != nil {
+			log.Printf("Error virtualizing message: %v", err)
+			return
+		}
+		token := mqttConfig.Publish(client, route.Output, rewritten)
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Error publishing to %s: %v", route.Output, token.Error())
+		}
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		utils.VPrint("MQTT connection lost: %v. Will attempt to reconnect...", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		utils.VPrint("MQTT connection established/re-established")
+		for _, route := range stage.Routes {
+			if token := mqttConfig.Subscribe(client, route.Input, 1, nil); token.Wait() && token.Error() != nil {
+				log.Printf("Error subscribing to %s: %v", route.Input, token.Error())
+				continue
+			}
+			utils.VPrint("Subscribed to topic: %s", route.Input)
+		}
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatalf("Error connecting to MQTT broker: %v", token.Error())
+	}
+	for _, route := range stage.Routes {
+		log.Printf("IMEI virtualizer started, publishing %s to %s", route.Input, route.Output)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rewritten, unchanged, failed := stage.Stats()
+				log.Printf("Stats - rewritten %d, unchanged %d, failed %d", rewritten, unchanged, failed)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	close(done)
+	client.Disconnect(1000)
+}
@@ -0,0 +1,37 @@
+package usecases
+
+import (
+	"sync/atomic"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Enricher adds the Vehicle block to the Jono messages
+type Enricher struct {
+	Vehicles utils.VehicleLookup
+
+	enriched int64
+	unknown  int64
+	failed   int64
+}
+
+// Enrich returns the message with its vehicle. Messages of unknown devices are returned as they
+// are, so they still reach the consumers of the enriched topic; only undecodable ones are not.
+func (e *Enricher) Enrich(payload []byte) ([]byte, error) {
+	enriched, found, err := utils.EnrichJono(payload, e.Vehicles)
+	switch {
+	case err != nil:
+		atomic.AddInt64(&e.failed, 1)
+		return nil, err
+	case found:
+		atomic.AddInt64(&e.enriched, 1)
+	default:
+		atomic.AddInt64(&e.unknown, 1)
+	}
+	return enriched, nil
+}
+
+// Stats returns the messages enriched, of devices without a vehicle and undecodable
+func (e *Enricher) Stats() (enriched int64, unknown int64, failed int64) {
+	return atomic.LoadInt64(&e.enriched), atomic.LoadInt64(&e.unknown), atomic.LoadInt64(&e.failed)
+}
@@ -0,0 +1,70 @@
+package usecases
+
+import (
+	"testing"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDevices = utils.DeviceMap{
+	"864352045580768": models.Imei{
+		Plates: "ABC-123",
+		Eco:    "ECO-7",
+		Vin:    "3N1AB7AP5KY000001",
+		Imei:   "864352045580768",
+		Url:    "https://client.example.com",
+		Client: "ACME",
+	},
+}
+
+func TestEnrich(t *testing.T) {
+	enricher := &Enricher{Vehicles: testDevices}
+
+	enriched, err := enricher.Enrich([]byte(`{"IMEI":"864352045580768","Message":null,"DataPackets":0,"ListPackets":{}}` + "\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"IMEI":"864352045580768","Message":null,"DataPackets":0,"ListPackets":{},"Vehicle":`+
+		`{"Plates":"ABC-123","Eco":"ECO-7","VIN":"3N1AB7AP5KY000001","Client":"ACME","URL":"https://client.example.com"}}`,
+		string(enriched))
+
+	// An existing block is replaced
+	enriched, err = enricher.Enrich([]byte(`{"Vehicle":{"Plates":"old"},"IMEI":"864352045580768"}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"IMEI":"864352045580768","Vehicle":`+
+		`{"Plates":"ABC-123","Eco":"ECO-7","VIN":"3N1AB7AP5KY000001","Client":"ACME","URL":"https://client.example.com"}}`,
+		string(enriched))
+
+	unknown := []byte(`{"IMEI":"1","ListPackets":{}}`)
+	enriched, err = enricher.Enrich(unknown)
+	assert.NoError(t, err)
+	assert.Equal(t, unknown, enriched)
+
+	_, err = enricher.Enrich([]byte(`{"ListPackets":{}}`))
+	assert.ErrorContains(t, err, "without IMEI")
+	_, err = enricher.Enrich([]byte(`not json`))
+	assert.Error(t, err)
+
+	count, unknownCount, failed := enricher.Stats()
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(1), unknownCount)
+	assert.Equal(t, int64(2), failed)
+}
+
+func TestEnrichPayload(t *testing.T) {
+	utils.Registry = testDevices
+	defer func() { utils.Registry = nil }()
+	message := `{"IMEI":"864352045580768"}`
+
+	t.Setenv("VEHICLE_ENRICH", "")
+	assert.Equal(t, message, utils.EnrichPayload(message))
+
+	t.Setenv("VEHICLE_ENRICH", "true")
+	assert.Contains(t, utils.EnrichPayload(message), `"Plates":"ABC-123"`)
+	assert.Contains(t, string(utils.EnrichPayload([]byte(message)).([]byte)), `"Plates":"ABC-123"`)
+	assert.Equal(t, 42, utils.EnrichPayload(42))
+
+	plates, err := utils.GetPlates("864352045580768")
+	assert.NoError(t, err)
+	assert.Equal(t, "ABC-123", plates)
+}
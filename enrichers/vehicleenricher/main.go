@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"vehicleenricher/features/vehicle_enricher/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func main() {
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	utils.VPrint("Starting vehicle enricher")
+
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	platesURL := os.Getenv("PLATES_URL")
+	if platesURL == "" {
+		log.Fatal("PLATES_URL environment variable not set")
+	}
+	ttl, err := utils.EnvDuration("PLATES_TTL", utils.DefaultRegistryTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	inputTopic := utils.EnvString("VEHICLE_ENRICH_INPUT", "tracker/jonoprotocol")
+	outputTopic := utils.EnvString("VEHICLE_ENRICH_TOPIC", "tracker/jonoprotocol/enriched")
+	if inputTopic == outputTopic {
+		log.Fatal("VEHICLE_ENRICH_INPUT and VEHICLE_ENRICH_TOPIC must be different topics")
+	}
+
+	enricher := &usecases.Enricher{
+		Vehicles: utils.NewDeviceRegistry(platesURL, utils.EnvString("PLATES_FILE", "data_plates.json"), ttl),
+	}
+
+	opts, err := mqttConfig.ClientOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientID := fmt.Sprintf("vehicleenricher_%s_%d", os.Getenv("HOSTNAME"), time.Now().UnixNano()%100000)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(mqttConfig.Shared()) // Persistent session, unless the replicas share the subscriptions
+	opts.SetAutoReconnect(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetOrderMatters(true) // Messages keep their order on the enriched topic
+	opts.SetResumeSubs(true)
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		enriched, err := enricher.Enrich(msg.Payload())
+		if err != nil {
+			log.Printf("Error enriching message: %v", err)
+			return
+		}
+		token := mqttConfig.Publish(client, outputTopic, enriched)
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Error publishing to %s: %v", outputTopic, token.Error())
+		}
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		utils.VPrint("MQTT connection lost: %v. Will attempt to reconnect...", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		utils.VPrint("MQTT connection established/re-established")
+		if token := mqttConfig.Subscribe(client, inputTopic, 1, nil); token.Wait() && token.Error() != nil {
+			log.Printf("Error subscribing to %s: %v", inputTopic, token.Error())
+			return
+		}
+		utils.VPrint("Subscribed to topic: %s", inputTopic)
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatalf("Error connecting to MQTT broker: %v", token.Error())
+	}
+	log.Printf("Vehicle enricher started, publishing %s to %s", inputTopic, outputTopic)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				enriched, unknown, failed := enricher.Stats()
+				log.Printf("Stats - enriched %d, unknown %d, failed %d", enriched, unknown, failed)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	close(done)
+	client.Disconnect(1000)
+}
@@ -0,0 +1,127 @@
+package usecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// GeoPoint is a position for a geo_point field
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// JonoDocument is the document of one Jono packet. The packet as reported is kept in Packet,
+// stored but not indexed so new Jono fields never conflict with the mappings.
+type JonoDocument struct {
+	Timestamp         time.Time         `json:"@timestamp"`
+	ReceivedAt        time.Time         `json:"received_at"`
+	IMEI              string            `json:"imei"`
+	Customer          string            `json:"customer"`
+	Key               string            `json:"packet_key"`
+	Location          *GeoPoint         `json:"location,omitempty"`
+	EventCode         int               `json:"event_code"`
+	EventName         string            `json:"event_name"`
+	Speed             int               `json:"speed"`
+	Direction         int               `json:"direction"`
+	Altitude          int               `json:"altitude"`
+	HDOP              float64           `json:"hdop"`
+	Satellites        int               `json:"satellites"`
+	Mileage           int               `json:"mileage"`
+	RunTime           int               `json:"run_time"`
+	PositioningStatus string            `json:"positioning_status"`
+	GSMSignalStrength *int              `json:"gsm_signal_strength,omitempty"`
+	Vehicle           *models.Vehicle   `json:"vehicle,omitempty"`
+	Packet            models.DataPacket `json:"packet"`
+}
+
+// NewJonoDocument creates the document of a packet
+func NewJonoDocument(imei string, key string, packet models.DataPacket, vehicle *models.Vehicle, customer string, receivedAt time.Time) JonoDocument {
+	document := JonoDocument{
+		Timestamp:         packet.Datetime.UTC(),
+		ReceivedAt:        receivedAt.UTC(),
+		IMEI:              imei,
+		Customer:          customer,
+		Key:               key,
+		EventCode:         packet.EventCode.Code,
+		EventName:         packet.EventCode.Name,
+		Speed:             packet.Speed,
+		Direction:         packet.Direction,
+		Altitude:          packet.Altitude,
+		HDOP:              packet.HDOP,
+		Satellites:        packet.NumberOfSatellites,
+		Mileage:           packet.Mileage,
+		RunTime:           packet.RunTime,
+		PositioningStatus: packet.PositioningStatus,
+		GSMSignalStrength: packet.GSMSignalStrength,
+		Vehicle:           vehicle,
+		Packet:            packet,
+	}
+	if ValidPosition(packet.Latitude, packet.Longitude) {
+		document.Location = &GeoPoint{Lat: packet.Latitude, Lon: packet.Longitude}
+	}
+	return document
+}
+
+// ValidPosition reports whether a position can be indexed, 0,0 is a device without a fix
+func ValidPosition(lat float64, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 && (lat != 0 || lon != 0)
+}
+
+// ID returns the document ID, the same packet sent twice replaces the document instead of
+// indexing it again
+func (d JonoDocument) ID() string {
+	return fmt.Sprintf("%s-%d-%d", d.IMEI, d.Timestamp.UnixMilli(), d.EventCode)
+}
+
+// Template returns the index template of the Jono documents for the indices matching pattern
+func Template(pattern string, shards int, replicas int) json.RawMessage {
+	keyword := map[string]string{"type": "keyword"}
+	template := map[string]interface{}{
+		"index_patterns": []string{pattern},
+		"priority":       100,
+		"template": map[string]interface{}{
+			"settings": map[string]int{
+				"number_of_shards":   shards,
+				"number_of_replicas": replicas,
+			},
+			"mappings": map[string]interface{}{
+				"dynamic": false,
+				"properties": map[string]interface{}{
+					"@timestamp":          map[string]string{"type": "date"},
+					"received_at":         map[string]string{"type": "date"},
+					"imei":                keyword,
+					"customer":            keyword,
+					"packet_key":          keyword,
+					"location":            map[string]string{"type": "geo_point"},
+					"event_code":          map[string]string{"type": "integer"},
+					"event_name":          keyword,
+					"speed":               map[string]string{"type": "integer"},
+					"direction":           map[string]string{"type": "integer"},
+					"altitude":            map[string]string{"type": "integer"},
+					"hdop":                map[string]string{"type": "float"},
+					"satellites":          map[string]string{"type": "integer"},
+					"mileage":             map[string]string{"type": "long"},
+					"run_time":            map[string]string{"type": "long"},
+					"positioning_status":  keyword,
+					"gsm_signal_strength": map[string]string{"type": "integer"},
+					"vehicle": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"Plates": keyword,
+							"Eco":    keyword,
+							"VIN":    keyword,
+							"Client": keyword,
+							"URL":    map[string]interface{}{"type": "keyword", "index": false},
+						},
+					},
+					"packet": map[string]interface{}{"type": "object", "enabled": false},
+				},
+			},
+		},
+	}
+	data, _ := json.Marshal(template)
+	return data
+}
@@ -0,0 +1,76 @@
+package usecases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Sink queues documents for indexing, utils.ElasticSink
+type Sink interface {
+	Send(document utils.ElasticDocument) bool
+}
+
+// Forwarder indexes every packet of the Jono messages in the index of its customer
+type Forwarder struct {
+	Sink     Sink
+	Namer    utils.ElasticIndexNamer
+	Vehicles utils.VehicleLookup // Vehicle of the messages not enriched, none when nil
+	Now      func() time.Time
+}
+
+// Forward queues the documents of a Jono message. It returns the number of documents queued,
+// packets without a datetime are reported in the error.
+func (f *Forwarder) Forward(payload []byte) (int, error) {
+	var jono models.JonoModel
+	if err := json.Unmarshal(payload, &jono); err != nil {
+		return 0, fmt.Errorf("error decoding Jono message: %v", err)
+	}
+	if jono.IMEI == "" {
+		return 0, fmt.Errorf("Jono message without IMEI")
+	}
+
+	vehicle := jono.Vehicle
+	if vehicle == nil && f.Vehicles != nil {
+		vehicle, _ = f.Vehicles.Vehicle(jono.IMEI)
+	}
+	customer := f.Namer.DefaultCustomer
+	if vehicle != nil && vehicle.Client != "" {
+		customer = vehicle.Client
+	}
+	now := time.Now
+	if f.Now != nil {
+		now = f.Now
+	}
+	receivedAt := now()
+
+	var errs []error
+	queued := 0
+	for _, key := range utils.PacketKeys(jono.ListPackets) {
+		packet := jono.ListPackets[key]
+		if packet.Datetime.IsZero() {
+			errs = append(errs, fmt.Errorf("%s: packet of %s has no datetime", key, jono.IMEI))
+			continue
+		}
+		document := NewJonoDocument(jono.IMEI, key, packet, vehicle, customer, receivedAt)
+		source, err := json.Marshal(document)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+			continue
+		}
+		if !f.Sink.Send(utils.ElasticDocument{
+			Index:  f.Namer.Index(customer, document.Timestamp),
+			ID:     document.ID(),
+			Source: source,
+		}) {
+			errs = append(errs, fmt.Errorf("%s: queue is full, document dropped", key))
+			continue
+		}
+		queued++
+	}
+	return queued, errors.Join(errs...)
+}
@@ -0,0 +1,126 @@
+package usecases
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSink struct {
+	documents []utils.ElasticDocument
+	full      bool
+}
+
+func (s *fakeSink) Send(document utils.ElasticDocument) bool {
+	if s.full {
+		return false
+	}
+	s.documents = append(s.documents, document)
+	return true
+}
+
+const jonoMessage = `{"IMEI":"864352045580768","Message":null,"DataPackets":2,"ListPackets":{
+	"packet_10":{"Datetime":"2025-03-05T23:59:54Z","Latitude":0,"Longitude":0,"EventCode":{"Code":35,"Name":"Track By Time Interval"}},
+	"packet_2":{"Datetime":"2025-03-05T22:59:54Z","Latitude":19.611106,"Longitude":-99.028335,"Speed":100,"EventCode":{"Code":1,"Name":"Input 1 Active"}},
+	"packet_3":{"Latitude":19.6}}}`
+
+func TestForward(t *testing.T) {
+	sink := &fakeSink{}
+	forwarder := &Forwarder{
+		Sink:     sink,
+		Namer:    utils.ElasticIndexNamer{Prefix: "jono", DefaultCustomer: "default"},
+		Vehicles: utils.DeviceMap{"864352045580768": {Imei: "864352045580768", Plates: "ABC123", Client: "Transportes Díaz"}},
+		Now:      func() time.Time { return time.Date(2025, 3, 6, 0, 0, 0, 0, time.UTC) },
+	}
+
+	queued, err := forwarder.Forward([]byte(jonoMessage))
+	assert.Equal(t, 2, queued)
+	assert.ErrorContains(t, err, "packet_3: packet of 864352045580768 has no datetime")
+	assert.Len(t, sink.documents, 2)
+
+	first := sink.documents[0]
+	assert.Equal(t, "jono-transportes_díaz-2025.03.05", first.Index)
+	assert.Equal(t, "864352045580768-1741215594000-1", first.ID)
+	var document map[string]interface{}
+	assert.NoError(t, json.Unmarshal(first.Source, &document))
+	assert.Equal(t, "2025-03-05T22:59:54Z", document["@timestamp"])
+	assert.Equal(t, "2025-03-06T00:00:00Z", document["received_at"])
+	assert.Equal(t, "packet_2", document["packet_key"])
+	assert.Equal(t, "Transportes Díaz", document["customer"])
+	assert.Equal(t, map[string]interface{}{"lat": 19.611106, "lon": -99.028335}, document["location"])
+	assert.Equal(t, float64(100), document["speed"])
+	assert.Equal(t, "ABC123", document["vehicle"].(map[string]interface{})["Plates"])
+	assert.Equal(t, float64(1), document["packet"].(map[string]interface{})["EventCode"].(map[string]interface{})["Code"])
+
+	// Without a fix there is no location
+	document = nil
+	assert.NoError(t, json.Unmarshal(sink.documents[1].Source, &document))
+	assert.NotContains(t, document, "location")
+
+	// The vehicle of an enriched message wins over the registry
+	sink.documents = nil
+	_, err = forwarder.Forward([]byte(`{"IMEI":"1","ListPackets":{"packet_1":{"Datetime":"2025-03-05T22:59:54Z"}},"Vehicle":{"Client":"Acme"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "jono-acme-2025.03.05", sink.documents[0].Index)
+
+	// Unknown devices go to the default customer, and rollover indexes to the write alias
+	sink.documents = nil
+	forwarder.Namer.Rollover = true
+	_, err = forwarder.Forward([]byte(`{"IMEI":"2","ListPackets":{"packet_1":{"Datetime":"2025-03-05T22:59:54Z"}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "jono-default", sink.documents[0].Index)
+
+	sink.full = true
+	queued, err = forwarder.Forward([]byte(`{"IMEI":"2","ListPackets":{"packet_1":{"Datetime":"2025-03-05T22:59:54Z"}}}`))
+	assert.Equal(t, 0, queued)
+	assert.ErrorContains(t, err, "queue is full")
+
+	_, err = forwarder.Forward([]byte(`{"ListPackets":{}}`))
+	assert.ErrorContains(t, err, "without IMEI")
+	_, err = forwarder.Forward([]byte(`[`))
+	assert.Error(t, err)
+}
+
+func TestNewJonoDocument(t *testing.T) {
+	packet := models.DataPacket{Datetime: time.Date(2025, 3, 5, 16, 59, 54, 0, time.FixedZone("CST", -6*3600)), Latitude: 91, Longitude: 10}
+	document := NewJonoDocument("1", "packet_1", packet, nil, "c", time.Now())
+	assert.Nil(t, document.Location)
+	assert.Equal(t, time.UTC, document.Timestamp.Location())
+	assert.Equal(t, "1-1741215594000-0", document.ID())
+
+	assert.True(t, ValidPosition(-90, 180))
+	assert.False(t, ValidPosition(0, 0))
+	assert.False(t, ValidPosition(10, -181))
+}
+
+func TestTemplate(t *testing.T) {
+	var template struct {
+		IndexPatterns []string `json:"index_patterns"`
+		Template      struct {
+			Settings map[string]int `json:"settings"`
+			Mappings struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"mappings"`
+		} `json:"template"`
+	}
+	assert.NoError(t, json.Unmarshal(Template("jono-*", 2, 1), &template))
+	assert.Equal(t, []string{"jono-*"}, template.IndexPatterns)
+	assert.Equal(t, map[string]int{"number_of_shards": 2, "number_of_replicas": 1}, template.Template.Settings)
+	assert.Equal(t, "geo_point", template.Template.Mappings.Properties["location"]["type"])
+	assert.Equal(t, "date", template.Template.Mappings.Properties["@timestamp"]["type"])
+	assert.Equal(t, false, template.Template.Mappings.Properties["packet"]["enabled"])
+}
+
+func TestElasticIndexNamer(t *testing.T) {
+	namer := utils.ElasticIndexNamer{Prefix: "Jono"}
+	at := time.Date(2025, 3, 5, 23, 0, 0, 0, time.FixedZone("CST", -6*3600))
+	assert.Equal(t, "jono-default-2025.03.06", namer.Index("", at))
+	assert.Equal(t, "jono-a_bc-2025.03.06", namer.Index(` _A  B/c*? `, at))
+	assert.Equal(t, "jono-*", namer.Pattern())
+	namer.Rollover = true
+	assert.Equal(t, "jono-acme", namer.Index("ACME", at))
+}
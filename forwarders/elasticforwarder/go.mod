@@ -0,0 +1,23 @@
+module elasticforwarder
+
+go 1.23.2
+
+require (
+	github.com/MaddSystems/jonobridge/common v0.0.0-00010101000000-000000000000
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/stretchr/testify v1.9.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/mochi-mqtt/server/v2 v2.7.9 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// Replace directive pointing to the local common module
+replace github.com/MaddSystems/jonobridge/common => ../../common
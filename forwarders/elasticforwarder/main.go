@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"elasticforwarder/features/elastic_forwarder/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func main() {
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	utils.VPrint("Starting Elasticsearch forwarder")
+
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := utils.ElasticConfigFromEnv()
+	if config.URL == "" {
+		log.Fatal("ELASTIC_URL environment variable not set")
+	}
+	topic := utils.EnvString("ELASTIC_TOPIC", "tracker/jonoprotocol")
+
+	var rollover bool
+	switch mode := utils.EnvString("ELASTIC_INDEX_MODE", "daily"); mode {
+	case "daily":
+	case "rollover":
+		rollover = true
+	default:
+		log.Fatalf("invalid ELASTIC_INDEX_MODE %q, expected daily or rollover", mode)
+	}
+	namer := utils.ElasticIndexNamer{
+		Prefix:          utils.EnvString("ELASTIC_INDEX_PREFIX", "jono"),
+		Rollover:        rollover,
+		DefaultCustomer: utils.EnvString("ELASTIC_DEFAULT_CUSTOMER", "default"),
+	}
+
+	queueSize, err := utils.EnvInt("ELASTIC_QUEUE", utils.DefaultElasticQueueSize, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	batchSize, err := utils.EnvInt("ELASTIC_BATCH_SIZE", utils.DefaultElasticBatchSize, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	flushInterval, err := utils.EnvDuration("ELASTIC_FLUSH_INTERVAL", utils.DefaultElasticFlushInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	retries, err := utils.EnvInt("ELASTIC_RETRIES", utils.DefaultElasticMaxRetries, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sink, err := utils.NewElasticSink(config, queueSize,
+		utils.WithElasticBatchSize(batchSize),
+		utils.WithElasticFlushInterval(flushInterval),
+		utils.WithElasticRetries(retries, utils.DefaultElasticRetryDelay),
+		utils.WithElasticSpillDir(utils.EnvString("ELASTIC_SPILL_DIR", "elastic_spill")),
+		utils.WithElasticRollover(rollover))
+	if err != nil {
+		log.Fatalf("Error creating Elasticsearch sink: %v", err)
+	}
+
+	forwarder := &usecases.Forwarder{Sink: sink, Namer: namer}
+	if platesURL := os.Getenv("PLATES_URL"); platesURL != "" {
+		ttl, err := utils.EnvDuration("PLATES_TTL", utils.DefaultRegistryTTL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registry := utils.NewDeviceRegistry(platesURL, utils.EnvString("PLATES_FILE", "data_plates.json"), ttl)
+		forwarder.Vehicles = registry
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	shards, err := utils.EnvInt("ELASTIC_SHARDS", 1, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	replicas, err := utils.EnvInt("ELASTIC_REPLICAS", 0, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	template := usecases.Template(namer.Pattern(), shards, replicas)
+	if err := sink.EnsureTemplate(ctx, utils.ElasticIndexName(namer.Prefix), template); err != nil {
+		// Documents are still indexed, with the cluster's dynamic mappings
+		log.Printf("Error creating index template: %v", err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		sink.Run(ctx)
+		close(stopped)
+	}()
+
+	opts, err := mqttConfig.ClientOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientID := fmt.Sprintf("elasticforwarder_%s_%d", os.Getenv("HOSTNAME"), time.Now().UnixNano()%100000)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(mqttConfig.Shared()) // Persistent session, unless the replicas share the subscriptions
+	opts.SetAutoReconnect(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetOrderMatters(true)
+	opts.SetResumeSubs(true)
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		queued, err := forwarder.Forward(msg.Payload())
+		if err != nil {
+			log.Printf("Error indexing message: %v", err)
+		}
+		utils.VPrint("Queued %d documents from %s", queued, msg.Topic())
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		utils.VPrint("MQTT connection lost: %v. Will attempt to reconnect...", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		utils.VPrint("MQTT connection established/re-established")
+		if token := mqttConfig.Subscribe(client, topic, 1, nil); token.Wait() && token.Error() != nil {
+			log.Printf("Error subscribing to %s: %v", topic, token.Error())
+			return
+		}
+		utils.VPrint("Subscribed to topic: %s", topic)
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatalf("Error connecting to MQTT broker: %v", token.Error())
+	}
+	log.Printf("Elasticsearch forwarder started, indexing %s to %s", topic, namer.Pattern())
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				indexed, failed, spilled, dropped := sink.Stats()
+				log.Printf("Stats - indexed %d, failed %d, spilled %d, dropped %d", indexed, failed, spilled, dropped)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	client.Disconnect(1000)
+	// The queued documents are sent, or spilled, before exiting
+	cancel()
+	<-stopped
+}
@@ -0,0 +1,199 @@
+package usecases
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// TrackEvent is the event of packets without one, Track By Time Interval
+const TrackEvent = 35
+
+// AAAProtocolVersion is the version of the AAA layout EncodeAAA writes (field 18)
+const AAAProtocolVersion = "3"
+
+// EncodeAAA builds the Meitrack AAA frame of a Jono packet:
+//
+//	$$<flag><length>,<IMEI>,AAA,<event>,<lat>,<lon>,<yymmddHHMMSS>,<A|V>,<satellites>,<GSM>,<speed>,
+//	<direction>,<HDOP>,<altitude>,<mileage>,<runtime>,<MCC|MNC|LAC|CI>,<IO>,<AD1|...|AD5>,
+//	<assisted event>,<customized data>,<protocol version>,<fuel>,<temperature>,<max acc>,<max dec>*<checksum>\r\n
+//
+// The fields are written the way the meitrackprotocol interpreter reads them, so a frame
+// parsed back gives the same Jono packet.
+func EncodeAAA(imei string, packet models.DataPacket) (string, error) {
+	if imei == "" || strings.ContainsAny(imei, ",*") {
+		return "", fmt.Errorf("invalid IMEI %q", imei)
+	}
+	if packet.Datetime.IsZero() {
+		return "", fmt.Errorf("packet of %s has no datetime", imei)
+	}
+
+	event := packet.EventCode.Code
+	if event == 0 {
+		event = TrackEvent
+	}
+	status := "A"
+	if strings.EqualFold(packet.PositioningStatus, "V") {
+		status = "V"
+	}
+	gsm := 0
+	if packet.GSMSignalStrength != nil {
+		gsm = *packet.GSMSignalStrength
+	}
+
+	fields := []string{
+		strconv.Itoa(event),
+		strconv.FormatFloat(packet.Latitude, 'f', 6, 64),
+		strconv.FormatFloat(packet.Longitude, 'f', 6, 64),
+		packet.Datetime.UTC().Format("060102150405"),
+		status,
+		strconv.Itoa(packet.NumberOfSatellites),
+		strconv.Itoa(gsm),
+		strconv.Itoa(packet.Speed),
+		strconv.Itoa(packet.Direction),
+		strconv.FormatFloat(packet.HDOP, 'f', 1, 64),
+		strconv.Itoa(packet.Altitude),
+		strconv.Itoa(packet.Mileage),
+		strconv.Itoa(packet.RunTime),
+		baseStation(packet.BaseStationInfo),
+		ioStatus(packet),
+		analogInputs(packet.AnalogInputs),
+		"00000000",
+		"",
+		AAAProtocolVersion,
+		fuelPercentage(packet.FuelPercentage),
+		temperature(packet.TemperatureSensor),
+		"0",
+		"0",
+	}
+
+	body := "," + imei + ",AAA," + strings.Join(fields, ",") + "*"
+	// The length counts from the first comma to the final \r\n, checksum included
+	header := "$$A" + strconv.Itoa(len(body)+4)
+	return header + body + Checksum(header+body) + "\r\n", nil
+}
+
+// Checksum is the sum of the bytes modulo 256, in upper case hex
+func Checksum(source string) string {
+	sum := 0
+	for i := 0; i < len(source); i++ {
+		sum += int(source[i])
+	}
+	return fmt.Sprintf("%02X", sum%256)
+}
+
+// baseStation is MCC|MNC|LAC|CI, LAC and CI in hex. Jono carries them in decimal.
+func baseStation(info *models.BaseStationInfo) string {
+	if info == nil {
+		return "0|0|0|0"
+	}
+	return strings.Join([]string{
+		stringValue(info.MCC, "0"),
+		stringValue(info.MNC, "0"),
+		decimalToHex(stringValue(info.LAC, "0")),
+		decimalToHex(stringValue(info.CellID, "0")),
+	}, "|")
+}
+
+// ioStatus is the IO port status in 4 hex digits, outputs 1-8 in the low byte and inputs
+// 1-8 in the high byte. Outputs come from OutputPortStatus, or IoPortStatus when missing.
+func ioStatus(packet models.DataPacket) string {
+	var outputs, inputs int
+	if ports := packet.OutputPortStatus; ports != nil {
+		for i, port := range []*string{ports.Output1, ports.Output2, ports.Output3, ports.Output4,
+			ports.Output5, ports.Output6, ports.Output7, ports.Output8} {
+			if isActive(port) {
+				outputs |= 1 << i
+			}
+		}
+	} else if ports := packet.IoPortStatus; ports != nil {
+		for i, port := range []int{ports.Port1, ports.Port2, ports.Port3, ports.Port4,
+			ports.Port5, ports.Port6, ports.Port7, ports.Port8} {
+			if port != 0 {
+				outputs |= 1 << i
+			}
+		}
+	}
+	if ports := packet.InputPortStatus; ports != nil {
+		for i, port := range []*string{ports.Input1, ports.Input2, ports.Input3, ports.Input4,
+			ports.Input5, ports.Input6, ports.Input7, ports.Input8} {
+			if isActive(port) {
+				inputs |= 1 << i
+			}
+		}
+	}
+	return fmt.Sprintf("%04X", inputs<<8|outputs)
+}
+
+// analogInputs is AD1|AD2|AD3|AD4|AD5 in hundredths of volt, in hex
+func analogInputs(inputs *models.AnalogInputs) string {
+	values := []string{"0000", "0000", "0000", "0000", "0000"}
+	if inputs == nil {
+		return strings.Join(values, "|")
+	}
+	for i, input := range []*string{inputs.AD1, inputs.AD2, inputs.AD3, inputs.AD4, inputs.AD5} {
+		if input == nil {
+			continue
+		}
+		volts, err := strconv.ParseFloat(strings.TrimSpace(*input), 64)
+		if err != nil || volts <= 0 {
+			continue
+		}
+		values[i] = fmt.Sprintf("%04X", min(int(math.Round(volts*100)), 0xFFFF))
+	}
+	return strings.Join(values, "|")
+}
+
+// fuelPercentage is the percentage in hundredths, in hex, empty when unknown
+func fuelPercentage(percentage int) string {
+	if percentage <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04X", min(percentage, 100)*100)
+}
+
+// temperature is the sensor number (2 hex digits) followed by the value in hundredths of
+// degree (4 hex digits, two's complement), empty when unknown
+func temperature(sensor *models.TemperatureSensor) string {
+	if sensor == nil || sensor.Value == nil {
+		return ""
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(*sensor.Value), 64)
+	if err != nil {
+		return ""
+	}
+	number, err := strconv.Atoi(stringValue(sensor.SensorNumber, "1"))
+	if err != nil {
+		number = 1
+	}
+	return fmt.Sprintf("%02X%04X", number&0xFF, uint16(int16(math.Round(value*100))))
+}
+
+func isActive(port *string) bool {
+	if port == nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(*port)) {
+	case "1", "true", "on":
+		return true
+	}
+	return false
+}
+
+func decimalToHex(value string) string {
+	decimal, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return fmt.Sprintf("%X", decimal)
+}
+
+func stringValue(value *string, fallback string) string {
+	if value == nil || *value == "" {
+		return fallback
+	}
+	return *value
+}
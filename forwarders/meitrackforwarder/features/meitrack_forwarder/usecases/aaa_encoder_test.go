@@ -0,0 +1,136 @@
+package usecases
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+// splitFrame checks the length and checksum of a frame and returns its IMEI, command and fields
+func splitFrame(t *testing.T, frame string) (string, string, []string) {
+	assert.True(t, strings.HasPrefix(frame, "$$A"))
+	assert.True(t, strings.HasSuffix(frame, "\r\n"))
+	star := strings.LastIndex(frame, "*")
+	assert.Equal(t, Checksum(frame[:star+1]), frame[star+1:len(frame)-2])
+
+	comma := strings.Index(frame, ",")
+	length, err := strconv.Atoi(frame[3:comma])
+	assert.NoError(t, err)
+	assert.Equal(t, len(frame)-comma, length)
+
+	parts := strings.Split(frame[comma+1:star], ",")
+	return parts[0], parts[1], parts[2:]
+}
+
+func TestEncodeAAA(t *testing.T) {
+	gsm := 21
+	packet := models.DataPacket{
+		Altitude:           2240,
+		Datetime:           time.Date(2025, 3, 5, 22, 59, 54, 0, time.FixedZone("CST", -6*3600)),
+		EventCode:          models.EventCode{Code: 2, Name: "Input 2 Active"},
+		Latitude:           19.611106,
+		Longitude:          -99.028335,
+		Speed:              54,
+		Direction:          270,
+		HDOP:               0.9,
+		Mileage:            19655620,
+		RunTime:            3600,
+		FuelPercentage:     60,
+		PositioningStatus:  "A",
+		NumberOfSatellites: 9,
+		GSMSignalStrength:  &gsm,
+		BaseStationInfo: &models.BaseStationInfo{
+			MCC: stringPointer("334"), MNC: stringPointer("020"), LAC: stringPointer("4660"), CellID: stringPointer("41853"),
+		},
+		OutputPortStatus: &models.OutputPortStatus{Output1: stringPointer("1"), Output3: stringPointer("1"), Output4: stringPointer("0")},
+		InputPortStatus:  &models.InputPortStatus{Input2: stringPointer("1")},
+		AnalogInputs:     &models.AnalogInputs{AD1: stringPointer("12.34"), AD4: stringPointer("4.10"), AD5: stringPointer("n/a")},
+		TemperatureSensor: &models.TemperatureSensor{
+			SensorNumber: stringPointer("1"), Value: stringPointer("-5.5"),
+		},
+	}
+
+	frame, err := EncodeAAA("864352045580768", packet)
+	assert.NoError(t, err)
+	imei, command, fields := splitFrame(t, frame)
+	assert.Equal(t, "864352045580768", imei)
+	assert.Equal(t, "AAA", command)
+	assert.Equal(t, []string{
+		"2", "19.611106", "-99.028335", "250306045954", "A", "9", "21", "54", "270", "0.9", "2240", "19655620", "3600",
+		"334|020|1234|A37D", "0205", "04D2|0000|0000|019A|0000", "00000000", "", "3", "1770", "01FDDA", "0", "0",
+	}, fields)
+}
+
+func TestEncodeAAADefaults(t *testing.T) {
+	// A packet with position only, as SPOT or Skywave report them
+	packet := models.DataPacket{
+		Datetime:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Latitude:     19.4326,
+		Longitude:    -99.1332,
+		IoPortStatus: &models.IoPortsStatus{Port2: 1},
+	}
+	frame, err := EncodeAAA("202400002502211", packet)
+	assert.NoError(t, err)
+	_, _, fields := splitFrame(t, frame)
+	assert.Equal(t, []string{
+		"35", "19.432600", "-99.133200", "240101120000", "A", "0", "0", "0", "0", "0.0", "0", "0", "0",
+		"0|0|0|0", "0002", "0000|0000|0000|0000|0000", "00000000", "", "3", "", "", "0", "0",
+	}, fields)
+
+	packet.PositioningStatus = "v"
+	frame, err = EncodeAAA("202400002502211", packet)
+	assert.NoError(t, err)
+	_, _, fields = splitFrame(t, frame)
+	assert.Equal(t, "V", fields[4])
+
+	_, err = EncodeAAA("", packet)
+	assert.Error(t, err)
+	_, err = EncodeAAA("202400002502211", models.DataPacket{})
+	assert.Error(t, err)
+}
+
+func TestForwarder(t *testing.T) {
+	destination := NewDestination("127.0.0.1:0", 2)
+	forwarder := &Forwarder{Destinations: []*Destination{destination}, IMEIs: utils.ParseIMEIs(" 864352045580768,,")}
+
+	payload := `{"IMEI":"864352045580768","DataPackets":3,"ListPackets":{
+		"Packet10":{"Datetime":"2025-03-05T23:00:10Z","EventCode":{"Code":35}},
+		"Packet2":{"Datetime":"2025-03-05T23:00:02Z","EventCode":{"Code":35}},
+		"Packet3":{"EventCode":{"Code":35}}}}`
+	frames, err := forwarder.Forward([]byte(payload))
+	assert.Equal(t, 2, frames)
+	assert.ErrorContains(t, err, "Packet3")
+
+	first, second := <-destination.queue, <-destination.queue
+	_, _, fields := splitFrame(t, first)
+	assert.Equal(t, "250305230002", fields[3])
+	_, _, fields = splitFrame(t, second)
+	assert.Equal(t, "250305230010", fields[3])
+
+	// Other devices are skipped
+	frames, err = forwarder.Forward([]byte(`{"IMEI":"1","ListPackets":{"Packet1":{"Datetime":"2025-03-05T23:00:02Z"}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, frames)
+
+	// A full queue drops the frame
+	forwarder.IMEIs = nil
+	for i := 0; i < 3; i++ {
+		_, err = forwarder.Forward([]byte(`{"IMEI":"1","ListPackets":{"Packet1":{"Datetime":"2025-03-05T23:00:02Z"}}}`))
+	}
+	assert.ErrorContains(t, err, "queue of 127.0.0.1:0 is full")
+	_, dropped, queued := destination.Stats()
+	assert.Equal(t, int64(1), dropped)
+	assert.Equal(t, 2, queued)
+
+	_, err = forwarder.Forward([]byte("not json"))
+	assert.Error(t, err)
+}
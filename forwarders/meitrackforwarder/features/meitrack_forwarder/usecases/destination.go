@@ -0,0 +1,154 @@
+package usecases
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Destination defaults
+const (
+	DefaultQueueSize    = 1000
+	DefaultDialTimeout  = 10 * time.Second
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultMinBackoff   = time.Second
+	DefaultMaxBackoff   = time.Minute
+)
+
+// Destination keeps a persistent TCP connection to a legacy server and writes the queued
+// frames to it. A lost connection is dialed again with exponential backoff, the frame that
+// failed is written first once reconnected.
+type Destination struct {
+	Address      string
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+
+	queue   chan string
+	sent    int64
+	dropped int64
+}
+
+// DestinationOption configures a Destination
+type DestinationOption func(*Destination)
+
+// WithBackoff sets the first and the longest wait between failed dials
+func WithBackoff(min, max time.Duration) DestinationOption {
+	return func(d *Destination) { d.MinBackoff, d.MaxBackoff = min, max }
+}
+
+// WithDialTimeout sets the timeout of each dial
+func WithDialTimeout(timeout time.Duration) DestinationOption {
+	return func(d *Destination) { d.DialTimeout = timeout }
+}
+
+// NewDestination creates a destination with a queue of queueSize frames (DefaultQueueSize if 0)
+func NewDestination(address string, queueSize int, options ...DestinationOption) *Destination {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	destination := &Destination{
+		Address:      address,
+		DialTimeout:  DefaultDialTimeout,
+		WriteTimeout: DefaultWriteTimeout,
+		MinBackoff:   DefaultMinBackoff,
+		MaxBackoff:   DefaultMaxBackoff,
+		queue:        make(chan string, queueSize),
+	}
+	for _, option := range options {
+		option(destination)
+	}
+	return destination
+}
+
+// Send queues a frame without blocking, it returns false and drops the frame when the queue is full
+func (d *Destination) Send(frame string) bool {
+	select {
+	case d.queue <- frame:
+		return true
+	default:
+		atomic.AddInt64(&d.dropped, 1)
+		return false
+	}
+}
+
+// Stats returns the frames written and dropped so far
+func (d *Destination) Stats() (sent int64, dropped int64, queued int) {
+	return atomic.LoadInt64(&d.sent), atomic.LoadInt64(&d.dropped), len(d.queue)
+}
+
+// Run writes the queued frames until ctx is done
+func (d *Destination) Run(ctx context.Context) {
+	var pending string
+	for {
+		conn := d.connect(ctx)
+		if conn == nil {
+			return
+		}
+		// The servers answer some frames, the replies are read and discarded. A failed read
+		// is how a connection closed by the server shows up.
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, conn)
+			close(closed)
+		}()
+
+		pending = d.write(ctx, conn, closed, pending)
+		conn.Close()
+		<-closed
+		if ctx.Err() != nil {
+			return
+		}
+		utils.VPrint("Connection to %s lost, reconnecting", d.Address)
+	}
+}
+
+// write writes the pending frame and then the queued ones until the connection fails or ctx is
+// done. It returns the frame that could not be written.
+func (d *Destination) write(ctx context.Context, conn net.Conn, closed chan struct{}, pending string) string {
+	for {
+		if pending == "" {
+			select {
+			case <-ctx.Done():
+				return ""
+			case <-closed:
+				return ""
+			case pending = <-d.queue:
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(d.WriteTimeout))
+		if _, err := conn.Write([]byte(pending)); err != nil {
+			utils.VPrint("Error sending data to %s: %v", d.Address, err)
+			return pending
+		}
+		utils.VPrint("Sent data to %s: %s", d.Address, pending)
+		atomic.AddInt64(&d.sent, 1)
+		pending = ""
+	}
+}
+
+// connect dials until it succeeds, waiting MinBackoff after the first failure and twice as
+// long after each one up to MaxBackoff. It returns nil when ctx is done.
+func (d *Destination) connect(ctx context.Context) net.Conn {
+	backoff := d.MinBackoff
+	dialer := net.Dialer{Timeout: d.DialTimeout}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", d.Address)
+		if err == nil {
+			utils.VPrint("Connected to %s", d.Address)
+			return conn
+		}
+		utils.VPrint("Error connecting to %s: %v, retrying in %v", d.Address, err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, d.MaxBackoff)
+	}
+}
@@ -0,0 +1,91 @@
+package usecases
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readLine(t *testing.T, conn net.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	return line
+}
+
+func TestDestinationReconnects(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	destination := NewDestination(listener.Addr().String(), 10, WithBackoff(10*time.Millisecond, 40*time.Millisecond), WithDialTimeout(time.Second))
+	go destination.Run(ctx)
+
+	// Frames share one connection
+	destination.Send("frame 1\r\n")
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "frame 1\r\n", line)
+	destination.Send("frame 2\r\n")
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "frame 2\r\n", line)
+
+	// The server closes the connection, the destination dials again
+	conn.Close()
+	conn, err = listener.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	destination.Send("frame 3\r\n")
+	assert.Equal(t, "frame 3\r\n", readLine(t, conn))
+
+	sent, dropped, queued := destination.Stats()
+	assert.Equal(t, int64(3), sent)
+	assert.Equal(t, int64(0), dropped)
+	assert.Equal(t, 0, queued)
+}
+
+func TestDestinationWaitsForServer(t *testing.T) {
+	// Take a free port and close it, the first dials fail
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	destination := NewDestination(address, 10, WithBackoff(10*time.Millisecond, 40*time.Millisecond), WithDialTimeout(time.Second))
+	done := make(chan struct{})
+	go func() {
+		destination.Run(ctx)
+		close(done)
+	}()
+	destination.Send("queued while down\r\n")
+	time.Sleep(100 * time.Millisecond)
+
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("port %s taken again: %v", address, err)
+	}
+	defer listener.Close()
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "queued while down\r\n", readLine(t, conn))
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -0,0 +1,46 @@
+package usecases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Forwarder re-encodes Jono messages as Meitrack AAA frames and queues them to every destination
+type Forwarder struct {
+	Destinations []*Destination
+	IMEIs        map[string]bool // Only these devices are forwarded, all when empty
+}
+
+// Forward encodes the packets of a Jono message in order and queues the frames. It returns the
+// number of frames encoded, packets that cannot be encoded are reported in the error.
+func (f *Forwarder) Forward(payload []byte) (int, error) {
+	var jono models.JonoModel
+	if err := json.Unmarshal(payload, &jono); err != nil {
+		return 0, fmt.Errorf("error decoding Jono message: %v", err)
+	}
+	if len(f.IMEIs) > 0 && !f.IMEIs[jono.IMEI] {
+		utils.VPrint("IMEI %s is not forwarded", jono.IMEI)
+		return 0, nil
+	}
+
+	var errs []error
+	frames := 0
+	for _, key := range utils.PacketKeys(jono.ListPackets) {
+		frame, err := EncodeAAA(jono.IMEI, jono.ListPackets[key])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		frames++
+		for _, destination := range f.Destinations {
+			if !destination.Send(frame) {
+				errs = append(errs, fmt.Errorf("%s: queue of %s is full, frame dropped", key, destination.Address))
+			}
+		}
+	}
+	return frames, errors.Join(errs...)
+}
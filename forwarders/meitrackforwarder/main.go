@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"meitrackforwarder/features/meitrack_forwarder/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// newDestinations reads MEITRACK_FORWARD_HOSTS (host:port list) and MEITRACK_FORWARD_QUEUE
+func newDestinations() ([]*usecases.Destination, error) {
+	queueSize, err := utils.EnvInt("MEITRACK_FORWARD_QUEUE", usecases.DefaultQueueSize, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var destinations []*usecases.Destination
+	for _, host := range strings.Split(os.Getenv("MEITRACK_FORWARD_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host == "" {
+			continue
+		}
+		destinations = append(destinations, usecases.NewDestination(host, queueSize))
+	}
+	if len(destinations) == 0 {
+		return nil, fmt.Errorf("MEITRACK_FORWARD_HOSTS environment variable not set")
+	}
+	return destinations, nil
+}
+
+func main() {
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	utils.VPrint("Starting Meitrack forwarder")
+
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	destinations, err := newDestinations()
+	if err != nil {
+		log.Fatal(err)
+	}
+	forwarder := &usecases.Forwarder{
+		Destinations: destinations,
+		IMEIs:        utils.ParseIMEIs(os.Getenv("MEITRACK_FORWARD_IMEIS")),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, destination := range destinations {
+		go destination.Run(ctx)
+	}
+
+	opts, err := mqttConfig.ClientOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientID := fmt.Sprintf("meitrackforwarder_%s_%d", os.Getenv("HOSTNAME"), time.Now().UnixNano()%100000)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(mqttConfig.Shared()) // Persistent session, unless the replicas share the subscriptions
+	opts.SetAutoReconnect(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetOrderMatters(true) // Frames keep the order of the packets
+	opts.SetResumeSubs(true)
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		frames, err := forwarder.Forward(msg.Payload())
+		if err != nil {
+			log.Printf("Error forwarding message: %v", err)
+		}
+		utils.VPrint("Queued %d frames from %s", frames, msg.Topic())
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		utils.VPrint("MQTT connection lost: %v. Will attempt to reconnect...", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		utils.VPrint("MQTT connection established/re-established")
+		if token := mqttConfig.Subscribe(client, "tracker/jonoprotocol", 1, nil); token.Wait() && token.Error() != nil {
+			log.Printf("Error subscribing to tracker/jonoprotocol: %v", token.Error())
+			return
+		}
+		utils.VPrint("Subscribed to topic: tracker/jonoprotocol")
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatalf("Error connecting to MQTT broker: %v", token.Error())
+	}
+	log.Printf("Meitrack forwarder started, forwarding to %s", os.Getenv("MEITRACK_FORWARD_HOSTS"))
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, destination := range destinations {
+					sent, dropped, queued := destination.Stats()
+					log.Printf("Stats - %s: sent %d, dropped %d, queued %d", destination.Address, sent, dropped, queued)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	client.Disconnect(1000)
+	cancel()
+}
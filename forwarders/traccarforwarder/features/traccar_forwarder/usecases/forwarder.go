@@ -0,0 +1,48 @@
+package usecases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Forwarder converts the packets of the Jono messages to OsmAnd positions and queues them
+type Forwarder struct {
+	Sender *Sender
+	IMEIs  map[string]bool // Only these devices are forwarded, all when empty
+}
+
+// Forward queues the packets of a Jono message in order. It returns the number of positions
+// queued, packets without a datetime are reported in the error.
+func (f *Forwarder) Forward(payload []byte) (int, error) {
+	var jono models.JonoModel
+	if err := json.Unmarshal(payload, &jono); err != nil {
+		return 0, fmt.Errorf("error decoding Jono message: %v", err)
+	}
+	if jono.IMEI == "" {
+		return 0, fmt.Errorf("Jono message without IMEI")
+	}
+	if len(f.IMEIs) > 0 && !f.IMEIs[jono.IMEI] {
+		utils.VPrint("IMEI %s is not forwarded", jono.IMEI)
+		return 0, nil
+	}
+
+	var errs []error
+	queued := 0
+	for _, key := range utils.PacketKeys(jono.ListPackets) {
+		packet := jono.ListPackets[key]
+		if packet.Datetime.IsZero() {
+			errs = append(errs, fmt.Errorf("%s: packet of %s has no datetime", key, jono.IMEI))
+			continue
+		}
+		if !f.Sender.Send(OsmAndValues(jono.IMEI, packet)) {
+			errs = append(errs, fmt.Errorf("%s: queue is full, position dropped", key))
+			continue
+		}
+		queued++
+	}
+	return queued, errors.Join(errs...)
+}
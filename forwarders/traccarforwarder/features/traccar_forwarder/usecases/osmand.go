@@ -0,0 +1,165 @@
+package usecases
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// KnotsPerKmh converts the Jono speed (km/h) to the OsmAnd one (knots)
+const KnotsPerKmh = 1 / 1.852
+
+// Alarms maps the Jono event codes (the Meitrack ones) to the Traccar alarm keys
+var Alarms = map[int]string{
+	1:   "sos",
+	17:  "lowBattery",
+	18:  "lowPower",
+	19:  "overspeed",
+	20:  "geofenceEnter",
+	21:  "geofenceExit",
+	22:  "powerRestored",
+	23:  "powerCut",
+	28:  "gpsAntennaCut",
+	32:  "hardCornering",
+	36:  "tow",
+	40:  "powerOff",
+	44:  "jamming",
+	50:  "temperature",
+	51:  "temperature",
+	54:  "fuelLeak",
+	78:  "accident",
+	90:  "hardCornering",
+	91:  "hardCornering",
+	129: "hardBraking",
+	130: "hardAcceleration",
+	133: "idle",
+	135: "fatigueDriving",
+}
+
+// Event codes that set ignition and motion when the packet has no flag for them
+var (
+	IgnitionEvents = map[int]bool{2: true, 10: false}
+	MotionEvents   = map[int]bool{42: true, 41: false}
+)
+
+// OsmAndValues are the OsmAnd parameters of a Jono packet: the position fields Traccar knows
+// (id, lat, lon, timestamp, speed, bearing, altitude, hdop, valid, batt) and the rest as attributes
+func OsmAndValues(imei string, packet models.DataPacket) url.Values {
+	values := url.Values{}
+	values.Set("id", imei)
+	values.Set("lat", strconv.FormatFloat(packet.Latitude, 'f', 6, 64))
+	values.Set("lon", strconv.FormatFloat(packet.Longitude, 'f', 6, 64))
+	values.Set("timestamp", strconv.FormatInt(packet.Datetime.Unix(), 10))
+	values.Set("speed", strconv.FormatFloat(float64(packet.Speed)*KnotsPerKmh, 'f', 2, 64))
+	values.Set("bearing", strconv.Itoa(packet.Direction))
+	values.Set("altitude", strconv.Itoa(packet.Altitude))
+	values.Set("valid", strconv.FormatBool(!strings.EqualFold(packet.PositioningStatus, "V")))
+	if packet.HDOP != 0 {
+		values.Set("hdop", strconv.FormatFloat(packet.HDOP, 'f', -1, 64))
+	}
+
+	code := packet.EventCode.Code
+	if code != 0 {
+		values.Set("event", strconv.Itoa(code))
+	}
+	if alarm, ok := Alarms[code]; ok {
+		values.Set("alarm", alarm)
+	}
+	if flags := packet.SystemFlag; flags != nil && flags.ACC != nil {
+		values.Set("ignition", strconv.FormatBool(isActive(flags.ACC)))
+	} else if ignition, ok := IgnitionEvents[code]; ok {
+		values.Set("ignition", strconv.FormatBool(ignition))
+	}
+	if flags := packet.SystemFlag; flags != nil {
+		setNumber(values, "power", flags.ExternalPowerSupply)
+	}
+	if flags := packet.SystemFlag; flags != nil && flags.MovingFlag != nil {
+		values.Set("motion", strconv.FormatBool(isActive(flags.MovingFlag)))
+	} else if motion, ok := MotionEvents[code]; ok {
+		values.Set("motion", strconv.FormatBool(motion))
+	}
+
+	if packet.NumberOfSatellites != 0 {
+		values.Set("sat", strconv.Itoa(packet.NumberOfSatellites))
+	}
+	if packet.GSMSignalStrength != nil {
+		values.Set("rssi", strconv.Itoa(*packet.GSMSignalStrength))
+	}
+	if packet.Mileage != 0 {
+		values.Set("odometer", strconv.Itoa(packet.Mileage))
+	}
+	if packet.RunTime != 0 {
+		// Traccar keeps engine hours in milliseconds
+		values.Set("hours", strconv.FormatInt(int64(packet.RunTime)*1000, 10))
+	}
+	if packet.FuelPercentage != 0 {
+		values.Set("fuel", strconv.Itoa(packet.FuelPercentage))
+	}
+
+	if ports := packet.InputPortStatus; ports != nil {
+		setPorts(values, "in", []*string{ports.Input1, ports.Input2, ports.Input3, ports.Input4,
+			ports.Input5, ports.Input6, ports.Input7, ports.Input8})
+	}
+	if ports := packet.OutputPortStatus; ports != nil {
+		setPorts(values, "out", []*string{ports.Output1, ports.Output2, ports.Output3, ports.Output4,
+			ports.Output5, ports.Output6, ports.Output7, ports.Output8})
+	}
+	if ports := packet.IoPortStatus; ports != nil {
+		for i, port := range []int{ports.Port1, ports.Port2, ports.Port3, ports.Port4,
+			ports.Port5, ports.Port6, ports.Port7, ports.Port8} {
+			values.Set("io"+strconv.Itoa(i+1), strconv.Itoa(port))
+		}
+	}
+	if inputs := packet.AnalogInputs; inputs != nil {
+		for i, input := range []*string{inputs.AD1, inputs.AD2, inputs.AD3, inputs.AD4, inputs.AD5,
+			inputs.AD6, inputs.AD7, inputs.AD8, inputs.AD9, inputs.AD10} {
+			setNumber(values, "adc"+strconv.Itoa(i+1), input)
+		}
+		// The interpreters report the backup battery voltage in AD4
+		setNumber(values, "batt", inputs.AD4)
+	}
+	if sensor := packet.TemperatureSensor; sensor != nil {
+		number := "1"
+		if sensor.SensorNumber != nil && *sensor.SensorNumber != "" {
+			number = *sensor.SensorNumber
+		}
+		setNumber(values, "temp"+number, sensor.Value)
+	}
+	if sensor := packet.TemperatureAndHumiditySensor; sensor != nil {
+		setNumber(values, "deviceTemp", sensor.Temperature)
+		setNumber(values, "humidity", sensor.Humidity)
+	}
+	return values
+}
+
+// setPorts sets prefix1...prefix8 to true or false for the ports reported
+func setPorts(values url.Values, prefix string, ports []*string) {
+	for i, port := range ports {
+		if port != nil {
+			values.Set(prefix+strconv.Itoa(i+1), strconv.FormatBool(isActive(port)))
+		}
+	}
+}
+
+// setNumber sets a key when the value is a number, Traccar keeps text attributes as text
+func setNumber(values url.Values, key string, value *string) {
+	if value == nil {
+		return
+	}
+	if number, err := strconv.ParseFloat(strings.TrimSpace(*value), 64); err == nil {
+		values.Set(key, strconv.FormatFloat(number, 'f', -1, 64))
+	}
+}
+
+func isActive(port *string) bool {
+	if port == nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(*port)) {
+	case "1", "true", "on":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package usecases
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func TestOsmAndValues(t *testing.T) {
+	gsm := 21
+	packet := models.DataPacket{
+		Altitude:           2240,
+		Datetime:           time.Date(2025, 3, 5, 22, 59, 54, 0, time.UTC),
+		EventCode:          models.EventCode{Code: 1, Name: "Input 1 Active"},
+		Latitude:           19.611106,
+		Longitude:          -99.028335,
+		Speed:              100,
+		Direction:          270,
+		HDOP:               0.9,
+		Mileage:            19655620,
+		RunTime:            3600,
+		PositioningStatus:  "A",
+		NumberOfSatellites: 9,
+		GSMSignalStrength:  &gsm,
+		SystemFlag:         &models.SystemFlag{ACC: stringPointer("1"), ExternalPowerSupply: stringPointer("1")},
+		InputPortStatus:    &models.InputPortStatus{Input1: stringPointer("1"), Input2: stringPointer("0")},
+		OutputPortStatus:   &models.OutputPortStatus{Output1: stringPointer("1")},
+		AnalogInputs:       &models.AnalogInputs{AD1: stringPointer("12.34"), AD2: stringPointer("n/a"), AD4: stringPointer("4.1")},
+		TemperatureSensor:  &models.TemperatureSensor{SensorNumber: stringPointer("2"), Value: stringPointer("-5.5")},
+	}
+
+	assert.Equal(t, url.Values{
+		"id":        {"864352045580768"},
+		"lat":       {"19.611106"},
+		"lon":       {"-99.028335"},
+		"timestamp": {"1741215594"},
+		"speed":     {"54.00"},
+		"bearing":   {"270"},
+		"altitude":  {"2240"},
+		"valid":     {"true"},
+		"hdop":      {"0.9"},
+		"event":     {"1"},
+		"alarm":     {"sos"},
+		"ignition":  {"true"},
+		"power":     {"1"},
+		"sat":       {"9"},
+		"rssi":      {"21"},
+		"odometer":  {"19655620"},
+		"hours":     {"3600000"},
+		"in1":       {"true"},
+		"in2":       {"false"},
+		"out1":      {"true"},
+		"adc1":      {"12.34"},
+		"adc4":      {"4.1"},
+		"batt":      {"4.1"},
+		"temp2":     {"-5.5"},
+	}, OsmAndValues("864352045580768", packet))
+}
+
+func TestOsmAndEvents(t *testing.T) {
+	packet := models.DataPacket{
+		Datetime:          time.Date(2025, 3, 5, 22, 59, 54, 0, time.UTC),
+		EventCode:         models.EventCode{Code: 10},
+		PositioningStatus: "V",
+		IoPortStatus:      &models.IoPortsStatus{Port3: 1},
+	}
+	values := OsmAndValues("1", packet)
+	assert.Equal(t, "false", values.Get("ignition"))
+	assert.Equal(t, "false", values.Get("valid"))
+	assert.Equal(t, "", values.Get("alarm"))
+	assert.Equal(t, "1", values.Get("io3"))
+	assert.Equal(t, "", values.Get("batt"))
+	assert.Equal(t, "", values.Get("power"))
+	assert.Equal(t, "0", values.Get("io1"))
+
+	packet.EventCode.Code = 42
+	values = OsmAndValues("1", packet)
+	assert.Equal(t, "true", values.Get("motion"))
+	assert.Equal(t, "", values.Get("ignition"))
+
+	packet.EventCode.Code = 23
+	assert.Equal(t, "powerCut", OsmAndValues("1", packet).Get("alarm"))
+}
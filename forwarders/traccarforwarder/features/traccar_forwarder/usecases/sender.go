@@ -0,0 +1,223 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Sender defaults
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 50
+	DefaultBatchInterval = time.Second
+	DefaultWorkers       = 4
+	DefaultMaxRetries    = 5
+	DefaultRetryDelay    = time.Second
+)
+
+// Sender posts the queued positions to a Traccar OsmAnd endpoint. Positions are taken in
+// batches of up to BatchSize, or what arrived within BatchInterval; the devices of a batch are
+// sent by Workers in parallel, the positions of a device one after the other, in order.
+type Sender struct {
+	URL           string // OsmAnd endpoint, e.g. http://traccar:5055
+	Client        *http.Client
+	BatchSize     int
+	BatchInterval time.Duration
+	Workers       int
+	MaxRetries    int           // Retries of a position after a network error or a 5xx answer
+	RetryDelay    time.Duration // Doubled after every retry
+
+	queue   chan url.Values
+	sent    int64
+	failed  int64
+	dropped int64
+}
+
+// SenderOption configures a Sender
+type SenderOption func(*Sender)
+
+// WithBatchSize sets the most positions taken in one batch
+func WithBatchSize(size int) SenderOption {
+	return func(s *Sender) { s.BatchSize = size }
+}
+
+// WithBatchInterval sets how long a batch waits for more positions
+func WithBatchInterval(interval time.Duration) SenderOption {
+	return func(s *Sender) { s.BatchInterval = interval }
+}
+
+// WithWorkers sets how many devices of a batch are sent in parallel
+func WithWorkers(workers int) SenderOption {
+	return func(s *Sender) { s.Workers = workers }
+}
+
+// WithRetries sets the retries of a position and the delay before the first one
+func WithRetries(max int, delay time.Duration) SenderOption {
+	return func(s *Sender) { s.MaxRetries, s.RetryDelay = max, delay }
+}
+
+// NewSender creates a sender with the defaults
+func NewSender(endpoint string, queueSize int, options ...SenderOption) *Sender {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	sender := &Sender{
+		URL:           endpoint,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+		BatchSize:     DefaultBatchSize,
+		BatchInterval: DefaultBatchInterval,
+		Workers:       DefaultWorkers,
+		MaxRetries:    DefaultMaxRetries,
+		RetryDelay:    DefaultRetryDelay,
+		queue:         make(chan url.Values, queueSize),
+	}
+	for _, option := range options {
+		option(sender)
+	}
+	return sender
+}
+
+// Send queues a position without blocking, it returns false and drops it when the queue is full
+func (s *Sender) Send(values url.Values) bool {
+	select {
+	case s.queue <- values:
+		return true
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+		return false
+	}
+}
+
+// Stats returns the positions accepted by Traccar, refused or given up, and dropped from a full queue
+func (s *Sender) Stats() (sent int64, failed int64, dropped int64) {
+	return atomic.LoadInt64(&s.sent), atomic.LoadInt64(&s.failed), atomic.LoadInt64(&s.dropped)
+}
+
+// Run sends the queued positions until ctx is done
+func (s *Sender) Run(ctx context.Context) {
+	for {
+		batch := s.nextBatch(ctx)
+		if batch == nil {
+			return
+		}
+		s.sendBatch(ctx, batch)
+	}
+}
+
+// nextBatch waits for a position and collects the ones following it, it returns nil when ctx is done
+func (s *Sender) nextBatch(ctx context.Context) []url.Values {
+	var batch []url.Values
+	select {
+	case <-ctx.Done():
+		return nil
+	case values := <-s.queue:
+		batch = append(batch, values)
+	}
+	timer := time.NewTimer(s.BatchInterval)
+	defer timer.Stop()
+	for len(batch) < max(s.BatchSize, 1) {
+		select {
+		case values := <-s.queue:
+			batch = append(batch, values)
+		case <-timer.C:
+			return batch
+		case <-ctx.Done():
+			return batch
+		}
+	}
+	return batch
+}
+
+// sendBatch groups a batch by device and sends the devices in parallel
+func (s *Sender) sendBatch(ctx context.Context, batch []url.Values) {
+	var order []string
+	devices := make(map[string][]url.Values)
+	for _, values := range batch {
+		id := values.Get("id")
+		if _, ok := devices[id]; !ok {
+			order = append(order, id)
+		}
+		devices[id] = append(devices[id], values)
+	}
+
+	work := make(chan []url.Values)
+	var wg sync.WaitGroup
+	for i := 0; i < min(max(s.Workers, 1), len(order)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for positions := range work {
+				for _, values := range positions {
+					if err := s.post(ctx, values); err != nil {
+						utils.VPrint("Error sending position of %s to Traccar: %v", values.Get("id"), err)
+						atomic.AddInt64(&s.failed, 1)
+						continue
+					}
+					atomic.AddInt64(&s.sent, 1)
+				}
+			}
+		}()
+	}
+	for _, id := range order {
+		work <- devices[id]
+	}
+	close(work)
+	wg.Wait()
+}
+
+// post sends a position, retrying network errors and 5xx answers with backoff. 4xx answers,
+// like an unknown device, are not retried.
+func (s *Sender) post(ctx context.Context, values url.Values) error {
+	endpoint := strings.TrimSuffix(s.URL, "/") + "/?" + values.Encode()
+	delay := s.RetryDelay
+	var err error
+	for attempt := 0; attempt <= s.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		var retry bool
+		retry, err = s.postOnce(ctx, endpoint)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("giving up after %d retries: %w", s.MaxRetries, err)
+}
+
+func (s *Sender) postOnce(ctx context.Context, endpoint string) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	// Drained so the connection is reused
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return true, fmt.Errorf("response with status code %d", response.StatusCode)
+	default:
+		return false, fmt.Errorf("response with status code %d", response.StatusCode)
+	}
+}
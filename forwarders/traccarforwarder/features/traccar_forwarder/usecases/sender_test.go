@@ -0,0 +1,121 @@
+package usecases
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTraccar records the positions it accepts, answering the configured status codes first
+type fakeTraccar struct {
+	mutex    sync.Mutex
+	failures map[string][]int // Status codes to answer, by device id
+	received map[string][]string
+	requests int
+}
+
+func (f *fakeTraccar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests++
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if codes := f.failures[id]; len(codes) > 0 {
+		f.failures[id] = codes[1:]
+		w.WriteHeader(codes[0])
+		return
+	}
+	f.received[id] = append(f.received[id], r.URL.Query().Get("timestamp"))
+}
+
+func (f *fakeTraccar) positions(id string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.received[id]
+}
+
+func TestSenderBatches(t *testing.T) {
+	traccar := &fakeTraccar{
+		failures: map[string][]int{"A": {500, 503}, "B": {400}, "C": {500, 500, 500}},
+		received: make(map[string][]string),
+	}
+	server := httptest.NewServer(traccar)
+	t.Cleanup(server.Close)
+	sender := NewSender(server.URL, 100, WithBatchInterval(10*time.Millisecond), WithRetries(2, time.Millisecond))
+	for _, position := range []struct{ id, timestamp string }{
+		{"A", "1"}, {"B", "1"}, {"A", "2"}, {"C", "1"}, {"A", "3"}, {"B", "2"},
+	} {
+		assert.True(t, sender.Send(map[string][]string{"id": {position.id}, "timestamp": {position.timestamp}}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sender.sendBatch(ctx, sender.nextBatch(ctx))
+
+	// A is retried and keeps its order, B is refused once and not retried, C gives up
+	assert.Equal(t, []string{"1", "2", "3"}, traccar.positions("A"))
+	assert.Equal(t, []string{"2"}, traccar.positions("B"))
+	assert.Empty(t, traccar.positions("C"))
+	sent, failed, dropped := sender.Stats()
+	assert.Equal(t, int64(4), sent)
+	assert.Equal(t, int64(2), failed)
+	assert.Equal(t, int64(0), dropped)
+	assert.Equal(t, 5+2+3, traccar.requests)
+}
+
+func TestSenderRun(t *testing.T) {
+	traccar := &fakeTraccar{failures: map[string][]int{}, received: make(map[string][]string)}
+	server := httptest.NewServer(traccar)
+	t.Cleanup(server.Close)
+	sender := NewSender(server.URL, 100, WithBatchSize(2), WithBatchInterval(10*time.Millisecond), WithRetries(2, time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sender.Run(ctx)
+		close(done)
+	}()
+	for _, timestamp := range []string{"1", "2", "3"} {
+		sender.Send(map[string][]string{"id": {"A"}, "timestamp": {timestamp}})
+	}
+	assert.Eventually(t, func() bool { return len(traccar.positions("A")) == 3 }, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"1", "2", "3"}, traccar.positions("A"))
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	// A full queue drops
+	full := NewSender("http://127.0.0.1:1", 1)
+	assert.True(t, full.Send(map[string][]string{"id": {"A"}}))
+	assert.False(t, full.Send(map[string][]string{"id": {"A"}}))
+}
+
+func TestForwarder(t *testing.T) {
+	sender := NewSender("http://127.0.0.1:1", 10)
+	forwarder := &Forwarder{Sender: sender, IMEIs: utils.ParseIMEIs("864352045580768")}
+	queued, err := forwarder.Forward([]byte(`{"IMEI":"864352045580768","ListPackets":{
+		"Packet10":{"Datetime":"2025-03-05T23:00:10Z"},
+		"Packet2":{"Datetime":"2025-03-05T23:00:02Z"},
+		"Packet3":{}}}`))
+	assert.Equal(t, 2, queued)
+	assert.ErrorContains(t, err, "Packet3")
+	assert.Equal(t, "1741215602", (<-sender.queue).Get("timestamp"))
+	assert.Equal(t, "1741215610", (<-sender.queue).Get("timestamp"))
+
+	queued, err = forwarder.Forward([]byte(`{"IMEI":"1","ListPackets":{"Packet1":{"Datetime":"2025-03-05T23:00:02Z"}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queued)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"traccarforwarder/features/traccar_forwarder/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func main() {
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	utils.VPrint("Starting Traccar forwarder")
+
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	traccarURL := os.Getenv("TRACCAR_URL")
+	if traccarURL == "" {
+		log.Fatal("TRACCAR_URL environment variable not set")
+	}
+
+	queueSize, err := utils.EnvInt("TRACCAR_QUEUE", usecases.DefaultQueueSize, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	batchSize, err := utils.EnvInt("TRACCAR_BATCH_SIZE", usecases.DefaultBatchSize, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	workers, err := utils.EnvInt("TRACCAR_WORKERS", usecases.DefaultWorkers, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	retries, err := utils.EnvInt("TRACCAR_RETRIES", usecases.DefaultMaxRetries, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sender := usecases.NewSender(traccarURL, queueSize, usecases.WithBatchSize(batchSize), usecases.WithWorkers(workers),
+		usecases.WithRetries(retries, usecases.DefaultRetryDelay))
+	forwarder := &usecases.Forwarder{
+		Sender: sender,
+		IMEIs:  utils.ParseIMEIs(os.Getenv("TRACCAR_FORWARD_IMEIS")),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sender.Run(ctx)
+
+	opts, err := mqttConfig.ClientOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientID := fmt.Sprintf("traccarforwarder_%s_%d", os.Getenv("HOSTNAME"), time.Now().UnixNano()%100000)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(mqttConfig.Shared()) // Persistent session, unless the replicas share the subscriptions
+	opts.SetAutoReconnect(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetOrderMatters(true) // Positions keep the order of the packets
+	opts.SetResumeSubs(true)
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		queued, err := forwarder.Forward(msg.Payload())
+		if err != nil {
+			log.Printf("Error forwarding message: %v", err)
+		}
+		utils.VPrint("Queued %d positions from %s", queued, msg.Topic())
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		utils.VPrint("MQTT connection lost: %v. Will attempt to reconnect...", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		utils.VPrint("MQTT connection established/re-established")
+		if token := mqttConfig.Subscribe(client, "tracker/jonoprotocol", 1, nil); token.Wait() && token.Error() != nil {
+			log.Printf("Error subscribing to tracker/jonoprotocol: %v", token.Error())
+			return
+		}
+		utils.VPrint("Subscribed to topic: tracker/jonoprotocol")
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatalf("Error connecting to MQTT broker: %v", token.Error())
+	}
+	log.Printf("Traccar forwarder started, forwarding to %s", traccarURL)
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sent, failed, dropped := sender.Stats()
+				log.Printf("Stats - sent %d, failed %d, dropped %d", sent, failed, dropped)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	client.Disconnect(1000)
+}
@@ -0,0 +1,320 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Destination defaults
+const (
+	DefaultQueueSize   = 1000
+	DefaultDialTimeout = 10 * time.Second
+	DefaultAckTimeout  = 30 * time.Second
+	DefaultIdleTimeout = 5 * time.Minute
+	DefaultMinBackoff  = time.Second
+	DefaultMaxBackoff  = time.Minute
+)
+
+// errIdle ends a connection without traffic for IdleTimeout
+var errIdle = errors.New("idle connection")
+
+// Destination sends records to a Wialon server. Every connection key (the IMEI for PerDevice
+// protocols) has a session with its own connection and queue. While the server cannot be
+// reached the records go to the Spool, and they are sent first once connected again.
+type Destination struct {
+	Address     string
+	Protocol    Protocol
+	Spool       *Spool
+	QueueSize   int
+	DialTimeout time.Duration
+	AckTimeout  time.Duration
+	IdleTimeout time.Duration
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+
+	ctx      context.Context
+	mutex    sync.Mutex
+	sessions map[string]*session
+	wg       sync.WaitGroup
+
+	sent     int64
+	buffered int64
+	dropped  int64
+}
+
+// DestinationOption configures a Destination
+type DestinationOption func(*Destination)
+
+// WithQueueSize sets the size of the queue of each session
+func WithQueueSize(size int) DestinationOption {
+	return func(d *Destination) { d.QueueSize = size }
+}
+
+// WithBackoff sets the first and the longest wait between failed connections
+func WithBackoff(min, max time.Duration) DestinationOption {
+	return func(d *Destination) { d.MinBackoff, d.MaxBackoff = min, max }
+}
+
+// WithAckTimeout sets how long the server has to acknowledge a packet
+func WithAckTimeout(timeout time.Duration) DestinationOption {
+	return func(d *Destination) { d.AckTimeout = timeout }
+}
+
+// NewDestination creates a destination with the default timeouts
+func NewDestination(address string, protocol Protocol, spool *Spool, options ...DestinationOption) *Destination {
+	destination := &Destination{
+		Address:     address,
+		Protocol:    protocol,
+		Spool:       spool,
+		QueueSize:   DefaultQueueSize,
+		DialTimeout: DefaultDialTimeout,
+		AckTimeout:  DefaultAckTimeout,
+		IdleTimeout: DefaultIdleTimeout,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		sessions:    make(map[string]*session),
+	}
+	for _, option := range options {
+		option(destination)
+	}
+	return destination
+}
+
+// Start runs the sessions until ctx is done, beginning with the ones that have buffered records
+func (d *Destination) Start(ctx context.Context) error {
+	d.mutex.Lock()
+	d.ctx = ctx
+	d.mutex.Unlock()
+
+	keys, err := d.Spool.Keys()
+	if err != nil {
+		return err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, key := range keys {
+		if d.Protocol.PerDevice() == (key != "") {
+			d.session(key)
+		}
+	}
+	return nil
+}
+
+// Send queues a record in the session of its device. It drops the record when the queue is full.
+func (d *Destination) Send(record Record) bool {
+	key := ""
+	if d.Protocol.PerDevice() {
+		key = record.IMEI
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	s := d.session(key)
+	if s == nil {
+		// Stopped and no session left to write the spool file, keep it for the next start
+		if err := d.Spool.Append(key, record); err != nil {
+			utils.VPrint("Error buffering record of %s for %s: %v", record.IMEI, d.Address, err)
+			atomic.AddInt64(&d.dropped, 1)
+			return false
+		}
+		atomic.AddInt64(&d.buffered, 1)
+		return true
+	}
+	select {
+	case s.records <- record:
+		return true
+	default:
+		atomic.AddInt64(&d.dropped, 1)
+		return false
+	}
+}
+
+// Wait waits for the sessions to end after the Start context is done
+func (d *Destination) Wait() {
+	d.wg.Wait()
+}
+
+// Stats returns the records acknowledged, buffered to disk and dropped so far
+func (d *Destination) Stats() (sent int64, buffered int64, dropped int64) {
+	return atomic.LoadInt64(&d.sent), atomic.LoadInt64(&d.buffered), atomic.LoadInt64(&d.dropped)
+}
+
+// session returns the session of a key, starting it when needed. Once stopped it returns the
+// sessions that have not ended yet, their records are buffered when they end, and nil for the
+// rest. The caller holds d.mutex.
+func (d *Destination) session(key string) *session {
+	s, ok := d.sessions[key]
+	if !ok && d.ctx != nil && d.ctx.Err() == nil {
+		queueSize := d.QueueSize
+		if queueSize <= 0 {
+			queueSize = DefaultQueueSize
+		}
+		s = &session{destination: d, key: key, records: make(chan Record, queueSize)}
+		d.sessions[key] = s
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			s.run(d.ctx)
+		}()
+	}
+	return s
+}
+
+// session is the connection of a key and its queue. Only the session writes the spool file of
+// its key.
+type session struct {
+	destination *Destination
+	key         string
+	records     chan Record
+}
+
+func (s *session) run(ctx context.Context) {
+	defer s.stop()
+	d := s.destination
+	backoff := d.MinBackoff
+	for {
+		link, err := s.connect(ctx)
+		if err == nil {
+			backoff = d.MinBackoff
+			err = s.serve(ctx, link)
+			link.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errIdle) {
+			// Connect again with the next record
+			select {
+			case <-ctx.Done():
+				return
+			case record := <-s.records:
+				s.buffer(record)
+			}
+			continue
+		}
+
+		utils.VPrint("Wialon %s %s (%s): %v, retrying in %v", d.Protocol.Name(), d.Address, s.key, err, backoff)
+		if !s.wait(ctx, backoff) {
+			return
+		}
+		backoff = min(backoff*2, d.MaxBackoff)
+	}
+}
+
+// connect dials the server and logs the device in
+func (s *session) connect(ctx context.Context) (*Link, error) {
+	d := s.destination
+	dialer := net.Dialer{Timeout: d.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", d.Address)
+	if err != nil {
+		return nil, err
+	}
+	link := NewLink(conn, d.AckTimeout)
+	if d.Protocol.PerDevice() {
+		if err := d.Protocol.Login(link, s.key); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	utils.VPrint("Connected to Wialon %s %s (%s)", d.Protocol.Name(), d.Address, s.key)
+	return link, nil
+}
+
+// serve sends the buffered records and then the queued ones, until the link fails, stays idle
+// for IdleTimeout or ctx is done
+func (s *session) serve(ctx context.Context, link *Link) error {
+	d := s.destination
+	if err := s.drain(link); err != nil {
+		return err
+	}
+	idle := time.NewTimer(d.IdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-idle.C:
+			return errIdle
+		case record := <-s.records:
+			if err := d.Protocol.Send(link, []Record{record}); err != nil {
+				s.buffer(record)
+				return err
+			}
+			atomic.AddInt64(&d.sent, 1)
+			idle.Reset(d.IdleTimeout)
+		}
+	}
+}
+
+// drain sends the buffered records in batches, removing each batch from the spool once acknowledged
+func (s *session) drain(link *Link) error {
+	d := s.destination
+	records, err := d.Spool.Load(s.key)
+	if err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		utils.VPrint("Sending %d buffered records to %s (%s)", len(records), d.Address, s.key)
+	}
+	batchSize := max(d.Protocol.BatchSize(), 1)
+	for len(records) > 0 {
+		batch := records[:min(len(records), batchSize)]
+		if err := d.Protocol.Send(link, batch); err != nil {
+			return err
+		}
+		atomic.AddInt64(&d.sent, int64(len(batch)))
+		records = records[len(batch):]
+		if err := d.Spool.Replace(s.key, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait buffers the queued records for a while, it returns false when ctx is done
+func (s *session) wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case record := <-s.records:
+			s.buffer(record)
+		}
+	}
+}
+
+func (s *session) buffer(record Record) {
+	d := s.destination
+	if err := d.Spool.Append(s.key, record); err != nil {
+		utils.VPrint("Error buffering record of %s for %s: %v", record.IMEI, d.Address, err)
+		atomic.AddInt64(&d.dropped, 1)
+		return
+	}
+	atomic.AddInt64(&d.buffered, 1)
+}
+
+// stop ends the session, what is left in the queue is buffered. A record sent while the session
+// was still draining the spool is in the queue, it is not overwritten by the drain.
+func (s *session) stop() {
+	d := s.destination
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.sessions, s.key)
+	for {
+		select {
+		case record := <-s.records:
+			s.buffer(record)
+		default:
+			return
+		}
+	}
+}
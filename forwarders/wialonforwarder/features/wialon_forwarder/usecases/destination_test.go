@@ -0,0 +1,220 @@
+package usecases
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeIPS is a Wialon IPS server that acknowledges everything and reports the packets it gets.
+// With hold set, the black box packets are acknowledged once hold is closed.
+type fakeIPS struct {
+	t        *testing.T
+	listener net.Listener
+	packets  chan string
+	mutex    sync.Mutex
+	conns    []net.Conn
+	hold     chan struct{}
+}
+
+func startFakeIPS(t *testing.T, address string) *fakeIPS {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", address, err)
+	}
+	server := &fakeIPS{t: t, listener: listener, packets: make(chan string, 100)}
+	go server.accept()
+	t.Cleanup(server.stop)
+	return server
+}
+
+func (s *fakeIPS) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *fakeIPS) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		s.packets <- line
+		switch {
+		case strings.HasPrefix(line, "#L#"):
+			conn.Write([]byte("#AL#1\r\n"))
+		case strings.HasPrefix(line, "#D#"):
+			conn.Write([]byte("#AD#1\r\n"))
+		case strings.HasPrefix(line, "#B#"):
+			s.mutex.Lock()
+			hold := s.hold
+			s.mutex.Unlock()
+			if hold != nil {
+				<-hold
+			}
+			conn.Write([]byte("#AB#" + strconv.Itoa(strings.Count(line, "|")) + "\r\n"))
+		}
+	}
+}
+
+func (s *fakeIPS) stop() {
+	s.listener.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeIPS) next() string {
+	select {
+	case packet := <-s.packets:
+		return packet
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("no packet received")
+		return ""
+	}
+}
+
+func TestDestinationBuffersWhileDown(t *testing.T) {
+	server := startFakeIPS(t, "127.0.0.1:0")
+	address := server.listener.Addr().String()
+	spool, err := NewSpool(t.TempDir())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	destination := NewDestination(address, &IPS{}, spool, WithBackoff(10*time.Millisecond, 20*time.Millisecond), WithAckTimeout(time.Second))
+	assert.NoError(t, destination.Start(ctx))
+
+	// Login per device, then the message
+	packet := testPacket()
+	assert.True(t, destination.Send(Record{IMEI: "864352045580768", Packet: packet}))
+	assert.Equal(t, "#L#2.0;864352045580768;NA;0310", server.next())
+	assert.True(t, strings.HasPrefix(server.next(), "#D#050325;225954;"))
+
+	// The server goes down, the records go to disk
+	server.stop()
+	for i := 1; i <= 3; i++ {
+		packet.Datetime = packet.Datetime.Add(time.Minute)
+		destination.Send(Record{IMEI: "864352045580768", Packet: packet})
+	}
+	assert.Eventually(t, func() bool {
+		records, _ := spool.Load("864352045580768")
+		return len(records) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Back up, they are sent in one black box packet and removed
+	server = startFakeIPS(t, address)
+	assert.True(t, strings.HasPrefix(server.next(), "#L#2.0;864352045580768;"))
+	blackBox := server.next()
+	assert.True(t, strings.HasPrefix(blackBox, "#B#050325;230054;"))
+	assert.Equal(t, 3, strings.Count(blackBox, "|"))
+	assert.Eventually(t, func() bool {
+		keys, _ := spool.Keys()
+		return len(keys) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sent, buffered, dropped := destination.Stats()
+	assert.Equal(t, int64(4), sent)
+	assert.Equal(t, int64(3), buffered)
+	assert.Equal(t, int64(0), dropped)
+}
+
+func TestDestinationRestart(t *testing.T) {
+	spool, err := NewSpool(t.TempDir())
+	assert.NoError(t, err)
+
+	// Records sent after stopping are kept for the next start
+	ctx, cancel := context.WithCancel(context.Background())
+	destination := NewDestination("127.0.0.1:1", &IPS{}, spool, WithBackoff(10*time.Millisecond, 20*time.Millisecond), WithAckTimeout(time.Second))
+	assert.NoError(t, destination.Start(ctx))
+	cancel()
+	destination.Wait()
+	assert.True(t, destination.Send(Record{IMEI: "1", Packet: testPacket()}))
+	assert.True(t, destination.Send(Record{IMEI: "2", Packet: testPacket()}))
+	keys, err := spool.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, keys)
+
+	// A new start sends them without waiting for new data, one record is a #D# message
+	server := startFakeIPS(t, "127.0.0.1:0")
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	destination = NewDestination(server.listener.Addr().String(), &IPS{}, spool, WithBackoff(10*time.Millisecond, 20*time.Millisecond), WithAckTimeout(time.Second))
+	assert.NoError(t, destination.Start(ctx))
+	var logins []string
+	for i := 0; i < 4; i++ {
+		if packet := server.next(); strings.HasPrefix(packet, "#L#") {
+			logins = append(logins, strings.Split(packet, ";")[1])
+		} else {
+			assert.True(t, strings.HasPrefix(packet, "#D#"))
+		}
+	}
+	assert.ElementsMatch(t, []string{"1", "2"}, logins)
+}
+
+func TestDestinationSendWhileDraining(t *testing.T) {
+	spool, err := NewSpool(t.TempDir())
+	assert.NoError(t, err)
+	packet := testPacket()
+	for i := 0; i < 2; i++ {
+		packet.Datetime = packet.Datetime.Add(time.Minute)
+		assert.NoError(t, spool.Append("864352045580768", Record{IMEI: "864352045580768", Packet: packet}))
+	}
+	server := startFakeIPS(t, "127.0.0.1:0")
+	hold := make(chan struct{})
+	server.mutex.Lock()
+	server.hold = hold
+	server.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	destination := NewDestination(server.listener.Addr().String(), &IPS{}, spool, WithBackoff(10*time.Millisecond, 20*time.Millisecond), WithAckTimeout(5*time.Second))
+	assert.NoError(t, destination.Start(ctx))
+	assert.True(t, strings.HasPrefix(server.next(), "#L#2.0;864352045580768;"))
+	assert.True(t, strings.HasPrefix(server.next(), "#B#"))
+
+	// Stopped while the buffered records wait for their acknowledgement, the new record is either
+	// sent on the open connection or buffered, the drain does not remove it from the spool
+	cancel()
+	assert.True(t, destination.Send(Record{IMEI: "864352045580768", Packet: testPacket()}))
+	close(hold)
+	destination.Wait()
+	records, err := spool.Load("864352045580768")
+	assert.NoError(t, err)
+	sent, buffered, dropped := destination.Stats()
+	assert.Equal(t, int64(3), sent+int64(len(records)))
+	assert.Equal(t, int64(len(records)), buffered)
+	assert.Equal(t, int64(0), dropped)
+}
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets("wialon.example.com:20332, retranslator://10.0.0.1:20163,,ips://b:1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{
+		{Protocol: "ips", Address: "wialon.example.com:20332"},
+		{Protocol: "retranslator", Address: "10.0.0.1:20163"},
+		{Protocol: "ips", Address: "b:1"},
+	}, targets)
+
+	_, err = ParseTargets("egts://a:1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package usecases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Forwarder queues the packets of the Jono messages to every destination
+type Forwarder struct {
+	Destinations []*Destination
+	IMEIs        map[string]bool // Only these devices are forwarded, all when empty
+}
+
+// Target is a configured Wialon server
+type Target struct {
+	Protocol string // ips or retranslator
+	Address  string
+}
+
+// ParseTargets parses "[ips|retranslator://]host:port[,...]", ips when there is no scheme
+func ParseTargets(value string) ([]Target, error) {
+	var targets []Target
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target := Target{Protocol: "ips", Address: entry}
+		if strings.Contains(entry, "://") {
+			parsed, err := url.Parse(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Wialon host %q: %v", entry, err)
+			}
+			target = Target{Protocol: parsed.Scheme, Address: parsed.Host}
+		}
+		if target.Protocol != "ips" && target.Protocol != "retranslator" {
+			return nil, fmt.Errorf("unknown Wialon protocol %q in %q", target.Protocol, entry)
+		}
+		if target.Address == "" {
+			return nil, fmt.Errorf("no address in Wialon host %q", entry)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// Forward queues the packets of a Jono message in order. It returns the number of packets
+// queued, packets without a datetime are reported in the error.
+func (f *Forwarder) Forward(payload []byte) (int, error) {
+	var jono models.JonoModel
+	if err := json.Unmarshal(payload, &jono); err != nil {
+		return 0, fmt.Errorf("error decoding Jono message: %v", err)
+	}
+	if jono.IMEI == "" {
+		return 0, fmt.Errorf("Jono message without IMEI")
+	}
+	if len(f.IMEIs) > 0 && !f.IMEIs[jono.IMEI] {
+		utils.VPrint("IMEI %s is not forwarded", jono.IMEI)
+		return 0, nil
+	}
+
+	var errs []error
+	queued := 0
+	for _, key := range utils.PacketKeys(jono.ListPackets) {
+		packet := jono.ListPackets[key]
+		if packet.Datetime.IsZero() {
+			errs = append(errs, fmt.Errorf("%s: packet of %s has no datetime", key, jono.IMEI))
+			continue
+		}
+		queued++
+		for _, destination := range f.Destinations {
+			if !destination.Send(Record{IMEI: jono.IMEI, Packet: packet}) {
+				errs = append(errs, fmt.Errorf("%s: queue of %s is full, record dropped", key, destination.Address))
+			}
+		}
+	}
+	return queued, errors.Join(errs...)
+}
@@ -0,0 +1,244 @@
+package usecases
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// Link is an open connection to a Wialon server
+type Link struct {
+	net.Conn
+	Reader     *bufio.Reader
+	AckTimeout time.Duration
+}
+
+// NewLink wraps a connection, answers are waited for ackTimeout
+func NewLink(conn net.Conn, ackTimeout time.Duration) *Link {
+	return &Link{Conn: conn, Reader: bufio.NewReader(conn), AckTimeout: ackTimeout}
+}
+
+// Protocol is a Wialon protocol
+type Protocol interface {
+	Name() string
+	// PerDevice tells whether each device needs its own connection
+	PerDevice() bool
+	// Login identifies the device of a PerDevice connection
+	Login(link *Link, imei string) error
+	// Send writes records and waits for their acknowledgement. Records the server refuses are
+	// dropped, an error means the link failed and none of the records can be taken as received.
+	Send(link *Link, records []Record) error
+	// BatchSize is the number of buffered records sent at once
+	BatchSize() int
+}
+
+// IPSVersion is the Wialon IPS version sent in the login packet
+const IPSVersion = "2.0"
+
+// IPS is the Wialon IPS 2.0 protocol: a #L# login per device, then #D# messages and #B# black
+// box packets for the buffered ones
+type IPS struct {
+	Password string // NA when empty
+}
+
+func (p *IPS) Name() string {
+	return "ips"
+}
+
+func (p *IPS) PerDevice() bool {
+	return true
+}
+
+func (p *IPS) BatchSize() int {
+	return 100
+}
+
+// Login sends #L# and checks #AL#
+func (p *IPS) Login(link *Link, imei string) error {
+	password := p.Password
+	if password == "" {
+		password = "NA"
+	}
+	answer, err := exchange(link, LoginPacket(imei, password), "#AL#")
+	if err != nil {
+		return err
+	}
+	switch answer {
+	case "1":
+		return nil
+	case "01":
+		return fmt.Errorf("login of %s rejected: wrong password", imei)
+	case "10":
+		return fmt.Errorf("login of %s rejected: checksum error", imei)
+	default:
+		return fmt.Errorf("login of %s rejected (#AL#%s)", imei, answer)
+	}
+}
+
+// Send sends a single record as #D# and several as #B#
+func (p *IPS) Send(link *Link, records []Record) error {
+	if len(records) == 1 {
+		answer, err := exchange(link, DataPacket(records[0].Packet), "#AD#")
+		if err != nil {
+			return err
+		}
+		if answer != "1" {
+			utils.VPrint("Wialon refused message of %s at %s (#AD#%s), dropped",
+				records[0].IMEI, records[0].Packet.Datetime.Format(time.RFC3339), answer)
+		}
+		return nil
+	}
+
+	packets := make([]models.DataPacket, len(records))
+	for i, record := range records {
+		packets[i] = record.Packet
+	}
+	answer, err := exchange(link, BlackBoxPacket(packets), "#AB#")
+	if err != nil {
+		return err
+	}
+	if accepted, err := strconv.Atoi(answer); err != nil || accepted != len(records) {
+		utils.VPrint("Wialon accepted %s of %d black box messages of %s, the rest dropped", answer, len(records), records[0].IMEI)
+	}
+	return nil
+}
+
+// exchange writes a packet and reads the answer line, returning what follows prefix
+func exchange(link *Link, packet string, prefix string) (string, error) {
+	link.SetDeadline(time.Now().Add(link.AckTimeout))
+	defer link.SetDeadline(time.Time{})
+	if _, err := link.Write([]byte(packet)); err != nil {
+		return "", err
+	}
+	line, err := link.Reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("waiting for %s: %v", prefix, err)
+	}
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, prefix) {
+		return "", fmt.Errorf("unexpected answer %q, waiting for %s", line, prefix)
+	}
+	return strings.TrimPrefix(line, prefix), nil
+}
+
+// CRC16 is the CRC-16/ARC of the IPS 2.0 packets
+func CRC16(data string) uint16 {
+	var crc uint16
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i])
+		for bit := 0; bit < 8; bit++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// withCRC ends a packet body with its CRC16, computed over everything after the packet type
+func withCRC(packetType string, body string) string {
+	return packetType + body + fmt.Sprintf("%04X", CRC16(body)) + "\r\n"
+}
+
+// LoginPacket is #L#2.0;imei;password;crc16
+func LoginPacket(imei string, password string) string {
+	return withCRC("#L#", IPSVersion+";"+imei+";"+password+";")
+}
+
+// DataPacket is #D#<message>;crc16
+func DataPacket(packet models.DataPacket) string {
+	return withCRC("#D#", DataMessage(packet)+";")
+}
+
+// BlackBoxPacket is #B#<message>|<message>|...|crc16
+func BlackBoxPacket(packets []models.DataPacket) string {
+	var body strings.Builder
+	for _, packet := range packets {
+		body.WriteString(DataMessage(packet))
+		body.WriteString("|")
+	}
+	return withCRC("#B#", body.String())
+}
+
+// DataMessage is the message of a packet:
+//
+//	Date;Time;LatDeg;LatSign;LonDeg;LonSign;Speed;Course;Alt;Sats;HDOP;Inputs;Outputs;ADC;Ibutton;Params
+//
+// Date and time in UTC, NA for what is unknown
+func DataMessage(packet models.DataPacket) string {
+	fields := []string{"NA", "NA", "NA", "NA", "NA", "NA"}
+	if !packet.Datetime.IsZero() {
+		moment := packet.Datetime.UTC()
+		fields[0], fields[1] = moment.Format("020106"), moment.Format("150405")
+	}
+	if hasPosition(packet) {
+		fields[2], fields[3] = coordinate(packet.Latitude, 2, "N", "S")
+		fields[4], fields[5] = coordinate(packet.Longitude, 3, "E", "W")
+	}
+
+	adc := "NA"
+	if values := AnalogInputs(packet.AnalogInputs); len(values) > 0 {
+		formatted := make([]string, len(values))
+		for i, value := range values {
+			formatted[i] = formatFloat(value)
+		}
+		adc = strings.Join(formatted, ",")
+	}
+	params := "NA"
+	if list := Params(packet); len(list) > 0 {
+		formatted := make([]string, len(list))
+		for i, param := range list {
+			formatted[i] = ipsParam(param)
+		}
+		params = strings.Join(formatted, ",")
+	}
+
+	fields = append(fields,
+		strconv.Itoa(packet.Speed),
+		strconv.Itoa(packet.Direction),
+		strconv.Itoa(packet.Altitude),
+		strconv.Itoa(packet.NumberOfSatellites),
+		formatFloat(packet.HDOP),
+		strconv.Itoa(Inputs(packet)),
+		strconv.Itoa(Outputs(packet)),
+		adc,
+		"NA",
+		params,
+	)
+	return strings.Join(fields, ";")
+}
+
+// coordinate is DDMM.MMMM (DDDMM.MMMM for longitudes) and its hemisphere
+func coordinate(value float64, degreeDigits int, positive string, negative string) (string, string) {
+	sign := positive
+	if value < 0 {
+		sign = negative
+	}
+	// In ten thousandths of minute, so rounding never gives 60 minutes
+	total := int64(math.Round(math.Abs(value) * 60 * 10000))
+	degrees, minutes := total/600000, total%600000
+	return fmt.Sprintf("%0*d%02d.%04d", degreeDigits, degrees, minutes/10000, minutes%10000), sign
+}
+
+// ipsParam is name:type:value, type 1 for integers, 2 for doubles and 3 for strings
+func ipsParam(param Param) string {
+	switch value := param.Value.(type) {
+	case int:
+		return param.Name + ":1:" + strconv.Itoa(value)
+	case float64:
+		return param.Name + ":2:" + formatFloat(value)
+	default:
+		// Separators would break the message
+		text := strings.NewReplacer(",", " ", ";", " ", "|", " ", "\r", " ", "\n", " ").Replace(fmt.Sprint(value))
+		return param.Name + ":3:" + text
+	}
+}
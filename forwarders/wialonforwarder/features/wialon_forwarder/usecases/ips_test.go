@@ -0,0 +1,75 @@
+package usecases
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func testPacket() models.DataPacket {
+	gsm := 21
+	return models.DataPacket{
+		Altitude:           2240,
+		Datetime:           time.Date(2025, 3, 5, 16, 59, 54, 0, time.FixedZone("CST", -6*3600)),
+		EventCode:          models.EventCode{Code: 2, Name: "Input 2 Active"},
+		Latitude:           19.611106,
+		Longitude:          -99.028335,
+		Speed:              54,
+		Direction:          270,
+		HDOP:               0.9,
+		Mileage:            19655620,
+		PositioningStatus:  "A",
+		NumberOfSatellites: 9,
+		GSMSignalStrength:  &gsm,
+		BaseStationInfo: &models.BaseStationInfo{
+			MCC: stringPointer("334"), MNC: stringPointer("020"), LAC: stringPointer("4660"), CellID: stringPointer("41853"),
+		},
+		OutputPortStatus:  &models.OutputPortStatus{Output1: stringPointer("1"), Output3: stringPointer("1")},
+		InputPortStatus:   &models.InputPortStatus{Input2: stringPointer("1")},
+		AnalogInputs:      &models.AnalogInputs{AD1: stringPointer("12.34"), AD3: stringPointer("4.10")},
+		TemperatureSensor: &models.TemperatureSensor{SensorNumber: stringPointer("1"), Value: stringPointer("-5.5")},
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	assert.Equal(t, uint16(0xBB3D), CRC16("123456789"))
+	assert.Equal(t, "#L#2.0;864352045580768;NA;0310\r\n", LoginPacket("864352045580768", "NA"))
+}
+
+func TestDataMessage(t *testing.T) {
+	packet := testPacket()
+	assert.Equal(t, "050325;225954;1936.6664;N;09901.7001;W;54;270;2240;9;0.9;2;5;12.34,0,4.1;NA;"+
+		"event_code:1:2,event:3:Input 2 Active,gsm:1:21,mileage:1:19655620,mcc:1:334,mnc:1:20,lac:1:4660,cell_id:1:41853,temp1:2:-5.5",
+		DataMessage(packet))
+
+	// Without a fix or data
+	assert.Equal(t, "NA;NA;NA;NA;NA;NA;0;0;0;0;0;0;0;NA;NA;NA", DataMessage(models.DataPacket{PositioningStatus: "V", Latitude: 1}))
+
+	// Separators in text params are replaced
+	packet = models.DataPacket{Datetime: packet.Datetime, EventCode: models.EventCode{Name: "a;b|c,d"}}
+	assert.True(t, strings.HasSuffix(DataMessage(packet), ";event:3:a b c d"))
+
+	// Minutes never round up to 60
+	latitude, sign := coordinate(-19.99999999, 2, "N", "S")
+	assert.Equal(t, "2000.0000", latitude)
+	assert.Equal(t, "S", sign)
+}
+
+func TestIPSPackets(t *testing.T) {
+	packet := testPacket()
+	message := DataMessage(packet)
+	assert.Equal(t, fmt.Sprintf("#D#%s;%04X\r\n", message, CRC16(message+";")), DataPacket(packet))
+
+	later := packet
+	later.Datetime = later.Datetime.Add(time.Minute)
+	body := message + "|" + DataMessage(later) + "|"
+	assert.Equal(t, fmt.Sprintf("#B#%s%04X\r\n", body, CRC16(body)), BlackBoxPacket([]models.DataPacket{packet, later}))
+}
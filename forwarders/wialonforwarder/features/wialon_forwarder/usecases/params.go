@@ -0,0 +1,170 @@
+package usecases
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// Record is a Jono packet of a device, the unit queued, buffered and sent to Wialon
+type Record struct {
+	IMEI   string            `json:"imei"`
+	Packet models.DataPacket `json:"packet"`
+}
+
+// Param is a Wialon parameter, Value is an int, a float64 or a string
+type Param struct {
+	Name  string
+	Value any
+}
+
+// Params maps the Jono fields without a place of their own in the Wialon message to parameters
+func Params(packet models.DataPacket) []Param {
+	var params []Param
+	if packet.EventCode.Code != 0 {
+		params = append(params, Param{"event_code", packet.EventCode.Code})
+	}
+	if packet.EventCode.Name != "" {
+		params = append(params, Param{"event", packet.EventCode.Name})
+	}
+	if packet.GSMSignalStrength != nil {
+		params = append(params, Param{"gsm", *packet.GSMSignalStrength})
+	}
+	if packet.Mileage != 0 {
+		params = append(params, Param{"mileage", packet.Mileage})
+	}
+	if packet.RunTime != 0 {
+		params = append(params, Param{"run_time", packet.RunTime})
+	}
+	if packet.FuelPercentage != 0 {
+		params = append(params, Param{"fuel_level", packet.FuelPercentage})
+	}
+	if info := packet.BaseStationInfo; info != nil {
+		params = appendInt(params, "mcc", info.MCC)
+		params = appendInt(params, "mnc", info.MNC)
+		params = appendInt(params, "lac", info.LAC)
+		params = appendInt(params, "cell_id", info.CellID)
+	}
+	if flags := packet.SystemFlag; flags != nil {
+		params = appendInt(params, "acc", flags.ACC)
+		params = appendInt(params, "ext_power", flags.ExternalPowerSupply)
+		params = appendInt(params, "moving", flags.MovingFlag)
+	}
+	if sensor := packet.TemperatureSensor; sensor != nil {
+		name := "temp" + stringValue(sensor.SensorNumber, "1")
+		params = appendFloat(params, name, sensor.Value)
+	}
+	if sensor := packet.TemperatureAndHumiditySensor; sensor != nil {
+		params = appendFloat(params, "temperature", sensor.Temperature)
+		params = appendFloat(params, "humidity", sensor.Humidity)
+	}
+	return params
+}
+
+// AnalogInputs returns AD1 to AD10 in volts, up to the last one reported. Missing ones in
+// between are 0.
+func AnalogInputs(inputs *models.AnalogInputs) []float64 {
+	if inputs == nil {
+		return nil
+	}
+	var values []float64
+	for i, input := range []*string{inputs.AD1, inputs.AD2, inputs.AD3, inputs.AD4, inputs.AD5,
+		inputs.AD6, inputs.AD7, inputs.AD8, inputs.AD9, inputs.AD10} {
+		if input == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(*input), 64)
+		if err != nil {
+			continue
+		}
+		for len(values) < i {
+			values = append(values, 0)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// Inputs is the bit mask of the digital inputs 1-8
+func Inputs(packet models.DataPacket) int {
+	mask := 0
+	if ports := packet.InputPortStatus; ports != nil {
+		for i, port := range []*string{ports.Input1, ports.Input2, ports.Input3, ports.Input4,
+			ports.Input5, ports.Input6, ports.Input7, ports.Input8} {
+			if isActive(port) {
+				mask |= 1 << i
+			}
+		}
+	}
+	return mask
+}
+
+// Outputs is the bit mask of the digital outputs 1-8, from OutputPortStatus or IoPortStatus when missing
+func Outputs(packet models.DataPacket) int {
+	mask := 0
+	if ports := packet.OutputPortStatus; ports != nil {
+		for i, port := range []*string{ports.Output1, ports.Output2, ports.Output3, ports.Output4,
+			ports.Output5, ports.Output6, ports.Output7, ports.Output8} {
+			if isActive(port) {
+				mask |= 1 << i
+			}
+		}
+	} else if ports := packet.IoPortStatus; ports != nil {
+		for i, port := range []int{ports.Port1, ports.Port2, ports.Port3, ports.Port4,
+			ports.Port5, ports.Port6, ports.Port7, ports.Port8} {
+			if port != 0 {
+				mask |= 1 << i
+			}
+		}
+	}
+	return mask
+}
+
+// hasPosition tells whether the packet has a fix worth sending as coordinates
+func hasPosition(packet models.DataPacket) bool {
+	return !strings.EqualFold(packet.PositioningStatus, "V") && (packet.Latitude != 0 || packet.Longitude != 0)
+}
+
+func appendInt(params []Param, name string, value *string) []Param {
+	if value == nil {
+		return params
+	}
+	if number, err := strconv.Atoi(strings.TrimSpace(*value)); err == nil {
+		return append(params, Param{name, number})
+	}
+	return params
+}
+
+func appendFloat(params []Param, name string, value *string) []Param {
+	if value == nil {
+		return params
+	}
+	if number, err := strconv.ParseFloat(strings.TrimSpace(*value), 64); err == nil {
+		return append(params, Param{name, number})
+	}
+	return params
+}
+
+func isActive(port *string) bool {
+	if port == nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(*port)) {
+	case "1", "true", "on":
+		return true
+	}
+	return false
+}
+
+func stringValue(value *string, fallback string) string {
+	if value == nil || *value == "" {
+		return fallback
+	}
+	return *value
+}
+
+// formatFloat writes a double without trailing zeros
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,139 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/models"
+)
+
+// Wialon Retranslator packet flags and block data types
+const (
+	RetranslatorPositionFlag = 0x01
+
+	retranslatorBlockType = 0x0BBB
+	retranslatorText      = 1
+	retranslatorBinary    = 2
+	retranslatorInt       = 3
+	retranslatorDouble    = 4
+
+	// RetranslatorAck is the byte the server answers every packet with
+	RetranslatorAck = 0x11
+)
+
+// Retranslator is the Wialon Retranslator binary protocol. Every packet carries its device ID,
+// so one connection serves all the devices.
+type Retranslator struct{}
+
+func (p *Retranslator) Name() string {
+	return "retranslator"
+}
+
+func (p *Retranslator) PerDevice() bool {
+	return false
+}
+
+func (p *Retranslator) BatchSize() int {
+	return 100
+}
+
+func (p *Retranslator) Login(link *Link, imei string) error {
+	return nil
+}
+
+// Send writes the packets one at a time, each waiting for its acknowledgement
+func (p *Retranslator) Send(link *Link, records []Record) error {
+	for _, record := range records {
+		link.SetDeadline(time.Now().Add(link.AckTimeout))
+		if _, err := link.Write(RetranslatorPacket(record.IMEI, record.Packet)); err != nil {
+			return err
+		}
+		ack := make([]byte, 1)
+		if _, err := io.ReadFull(link.Reader, ack); err != nil {
+			return fmt.Errorf("waiting for acknowledgement: %v", err)
+		}
+		if ack[0] != RetranslatorAck {
+			return fmt.Errorf("unexpected acknowledgement 0x%02X", ack[0])
+		}
+	}
+	link.SetDeadline(time.Time{})
+	return nil
+}
+
+// RetranslatorPacket builds the packet of a record: size (little endian), device ID ended by
+// 0x00, time and flags, then the blocks. Blocks are posinfo (the position), the digital
+// inputs and outputs (din, dout), the analog inputs (adc1...) and the Params.
+func RetranslatorPacket(imei string, packet models.DataPacket) []byte {
+	var body bytes.Buffer
+	body.WriteString(imei)
+	body.WriteByte(0)
+	binary.Write(&body, binary.BigEndian, uint32(packet.Datetime.Unix()))
+
+	flags := uint32(0)
+	var blocks bytes.Buffer
+	if hasPosition(packet) {
+		flags |= RetranslatorPositionFlag
+		var position bytes.Buffer
+		binary.Write(&position, binary.LittleEndian, packet.Longitude)
+		binary.Write(&position, binary.LittleEndian, packet.Latitude)
+		binary.Write(&position, binary.LittleEndian, float64(packet.Altitude))
+		binary.Write(&position, binary.BigEndian, uint16(packet.Speed))
+		binary.Write(&position, binary.BigEndian, uint16(packet.Direction))
+		position.WriteByte(byte(packet.NumberOfSatellites))
+		writeBlock(&blocks, true, retranslatorBinary, "posinfo", position.Bytes())
+	}
+	writeParam(&blocks, Param{"din", Inputs(packet)})
+	writeParam(&blocks, Param{"dout", Outputs(packet)})
+	for i, value := range AnalogInputs(packet.AnalogInputs) {
+		writeParam(&blocks, Param{fmt.Sprintf("adc%d", i+1), value})
+	}
+	if packet.HDOP != 0 {
+		writeParam(&blocks, Param{"hdop", packet.HDOP})
+	}
+	for _, param := range Params(packet) {
+		writeParam(&blocks, param)
+	}
+	binary.Write(&body, binary.BigEndian, flags)
+	body.Write(blocks.Bytes())
+
+	packetBytes := binary.LittleEndian.AppendUint32(nil, uint32(body.Len()))
+	return append(packetBytes, body.Bytes()...)
+}
+
+// writeParam writes a parameter block: integers in 4 bytes big endian, doubles in 8 bytes
+// little endian, text ended by 0x00
+func writeParam(blocks *bytes.Buffer, param Param) {
+	var data bytes.Buffer
+	dataType := byte(retranslatorText)
+	switch value := param.Value.(type) {
+	case int:
+		dataType = retranslatorInt
+		binary.Write(&data, binary.BigEndian, int32(value))
+	case float64:
+		dataType = retranslatorDouble
+		binary.Write(&data, binary.LittleEndian, value)
+	default:
+		data.WriteString(fmt.Sprint(value))
+		data.WriteByte(0)
+	}
+	writeBlock(blocks, false, dataType, param.Name, data.Bytes())
+}
+
+// writeBlock writes type 0x0BBB, the size of the rest (big endian), the hidden attribute, the
+// data type, the name ended by 0x00 and the data
+func writeBlock(blocks *bytes.Buffer, hidden bool, dataType byte, name string, data []byte) {
+	binary.Write(blocks, binary.BigEndian, uint16(retranslatorBlockType))
+	binary.Write(blocks, binary.BigEndian, uint32(2+len(name)+1+len(data)))
+	if hidden {
+		blocks.WriteByte(1)
+	} else {
+		blocks.WriteByte(0)
+	}
+	blocks.WriteByte(dataType)
+	blocks.WriteString(name)
+	blocks.WriteByte(0)
+	blocks.Write(data)
+}
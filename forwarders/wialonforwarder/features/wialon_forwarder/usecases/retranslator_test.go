@@ -0,0 +1,72 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// retranslatorBlock is a decoded block of a Retranslator packet
+type retranslatorBlock struct {
+	hidden   bool
+	dataType byte
+	data     []byte
+}
+
+// decodeRetranslator splits a packet into its header and blocks
+func decodeRetranslator(t *testing.T, packet []byte) (string, uint32, uint32, map[string]retranslatorBlock) {
+	assert.Equal(t, len(packet)-4, int(binary.LittleEndian.Uint32(packet)))
+	body := packet[4:]
+	end := bytes.IndexByte(body, 0)
+	imei := string(body[:end])
+	body = body[end+1:]
+	unixTime, flags := binary.BigEndian.Uint32(body), binary.BigEndian.Uint32(body[4:])
+	body = body[8:]
+
+	blocks := make(map[string]retranslatorBlock)
+	for len(body) > 0 {
+		assert.Equal(t, uint16(0x0BBB), binary.BigEndian.Uint16(body))
+		size := int(binary.BigEndian.Uint32(body[2:]))
+		block := body[6 : 6+size]
+		name := block[2 : 2+bytes.IndexByte(block[2:], 0)]
+		blocks[string(name)] = retranslatorBlock{hidden: block[0] == 1, dataType: block[1], data: block[2+len(name)+1:]}
+		body = body[6+size:]
+	}
+	return imei, unixTime, flags, blocks
+}
+
+func TestRetranslatorPacket(t *testing.T) {
+	packet := testPacket()
+	imei, unixTime, flags, blocks := decodeRetranslator(t, RetranslatorPacket("864352045580768", packet))
+	assert.Equal(t, "864352045580768", imei)
+	assert.Equal(t, uint32(packet.Datetime.Unix()), unixTime)
+	assert.Equal(t, uint32(RetranslatorPositionFlag), flags)
+
+	position := blocks["posinfo"]
+	assert.True(t, position.hidden)
+	assert.Equal(t, byte(2), position.dataType)
+	assert.Len(t, position.data, 29)
+	assert.Equal(t, -99.028335, math.Float64frombits(binary.LittleEndian.Uint64(position.data)))
+	assert.Equal(t, 19.611106, math.Float64frombits(binary.LittleEndian.Uint64(position.data[8:])))
+	assert.Equal(t, 2240.0, math.Float64frombits(binary.LittleEndian.Uint64(position.data[16:])))
+	assert.Equal(t, uint16(54), binary.BigEndian.Uint16(position.data[24:]))
+	assert.Equal(t, uint16(270), binary.BigEndian.Uint16(position.data[26:]))
+	assert.Equal(t, byte(9), position.data[28])
+
+	assert.Equal(t, retranslatorBlock{dataType: 3, data: []byte{0, 0, 0, 2}}, blocks["din"])
+	assert.Equal(t, retranslatorBlock{dataType: 3, data: []byte{0, 0, 0, 5}}, blocks["dout"])
+	assert.Equal(t, byte(4), blocks["adc1"].dataType)
+	assert.Equal(t, 12.34, math.Float64frombits(binary.LittleEndian.Uint64(blocks["adc1"].data)))
+	assert.Equal(t, -5.5, math.Float64frombits(binary.LittleEndian.Uint64(blocks["temp1"].data)))
+	assert.Equal(t, retranslatorBlock{dataType: 1, data: []byte("Input 2 Active\x00")}, blocks["event"])
+	assert.Equal(t, int32(41853), int32(binary.BigEndian.Uint32(blocks["cell_id"].data)))
+
+	// No position block without a fix
+	packet.PositioningStatus = "V"
+	_, _, flags, blocks = decodeRetranslator(t, RetranslatorPacket("864352045580768", packet))
+	assert.Equal(t, uint32(0), flags)
+	assert.NotContains(t, blocks, "posinfo")
+}
@@ -0,0 +1,144 @@
+package usecases
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// sharedKey is the spool file of the records of a connection shared by every device
+const sharedKey = "_shared"
+
+var unsafeFileName = regexp.MustCompile(`[^0-9A-Za-z_.-]`)
+
+// Spool keeps the records that could not be sent on disk, one JSON lines file per connection
+// key (the IMEI, or _shared), until the server is back
+type Spool struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewSpool creates the spool directory
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating buffer directory %s: %v", dir, err)
+	}
+	return &Spool{dir: dir}, nil
+}
+
+// SpoolDir is the directory of a destination inside the buffer directory
+func SpoolDir(bufferDir string, protocol string, address string) string {
+	return filepath.Join(bufferDir, protocol+"_"+unsafeFileName.ReplaceAllString(address, "_"))
+}
+
+func (s *Spool) path(key string) string {
+	if key == "" {
+		key = sharedKey
+	}
+	return filepath.Join(s.dir, unsafeFileName.ReplaceAllString(key, "_")+".jsonl")
+}
+
+// Append adds records at the end of the file of a key
+func (s *Spool) Append(key string, records ...Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.OpenFile(s.path(key), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error buffering records: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return fmt.Errorf("error buffering records: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("error buffering records: %v", err)
+	}
+	return file.Close()
+}
+
+// Load returns the records of a key, oldest first. Lines that cannot be decoded, like the
+// last one of a crash while writing, are skipped.
+func (s *Spool) Load(key string) ([]Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading buffered records: %v", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Replace keeps only the given records of a key, replacing the file atomically. No records
+// removes the file.
+func (s *Spool) Replace(key string, records []Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(records) == 0 {
+		if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("error saving buffered records: %v", err)
+		}
+	}
+	if err := utils.WriteFileAtomic(s.path(key), buffer.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("error saving buffered records: %v", err)
+	}
+	return nil
+}
+
+// Keys returns the keys with buffered records
+func (s *Spool) Keys() ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		key := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+		if key == sharedKey {
+			key = ""
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"wialonforwarder/features/wialon_forwarder/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// newDestinations reads WIALON_FORWARD_HOSTS, WIALON_PASSWORD, WIALON_BUFFER_DIR and WIALON_FORWARD_QUEUE
+func newDestinations() ([]*usecases.Destination, error) {
+	targets, err := usecases.ParseTargets(os.Getenv("WIALON_FORWARD_HOSTS"))
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("WIALON_FORWARD_HOSTS environment variable not set")
+	}
+	bufferDir := utils.EnvString("WIALON_BUFFER_DIR", "wialon_buffer")
+	queueSize, err := utils.EnvInt("WIALON_FORWARD_QUEUE", usecases.DefaultQueueSize, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var destinations []*usecases.Destination
+	for _, target := range targets {
+		var protocol usecases.Protocol = &usecases.IPS{Password: os.Getenv("WIALON_PASSWORD")}
+		if target.Protocol == "retranslator" {
+			protocol = &usecases.Retranslator{}
+		}
+		spool, err := usecases.NewSpool(usecases.SpoolDir(bufferDir, target.Protocol, target.Address))
+		if err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, usecases.NewDestination(target.Address, protocol, spool, usecases.WithQueueSize(queueSize)))
+	}
+	return destinations, nil
+}
+
+func main() {
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	utils.VPrint("Starting Wialon forwarder")
+
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	destinations, err := newDestinations()
+	if err != nil {
+		log.Fatal(err)
+	}
+	forwarder := &usecases.Forwarder{
+		Destinations: destinations,
+		IMEIs:        utils.ParseIMEIs(os.Getenv("WIALON_FORWARD_IMEIS")),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, destination := range destinations {
+		if err := destination.Start(ctx); err != nil {
+			log.Fatalf("Error starting %s: %v", destination.Address, err)
+		}
+	}
+
+	opts, err := mqttConfig.ClientOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	clientID := fmt.Sprintf("wialonforwarder_%s_%d", os.Getenv("HOSTNAME"), time.Now().UnixNano()%100000)
+	opts.SetClientID(clientID)
+	opts.SetCleanSession(mqttConfig.Shared()) // Persistent session, unless the replicas share the subscriptions
+	opts.SetAutoReconnect(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetOrderMatters(true) // Records keep the order of the packets
+	opts.SetResumeSubs(true)
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
+		queued, err := forwarder.Forward(msg.Payload())
+		if err != nil {
+			log.Printf("Error forwarding message: %v", err)
+		}
+		utils.VPrint("Queued %d records from %s", queued, msg.Topic())
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		utils.VPrint("MQTT connection lost: %v. Will attempt to reconnect...", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		utils.VPrint("MQTT connection established/re-established")
+		if token := mqttConfig.Subscribe(client, "tracker/jonoprotocol", 1, nil); token.Wait() && token.Error() != nil {
+			log.Printf("Error subscribing to tracker/jonoprotocol: %v", token.Error())
+			return
+		}
+		utils.VPrint("Subscribed to topic: tracker/jonoprotocol")
+	})
+
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatalf("Error connecting to MQTT broker: %v", token.Error())
+	}
+	log.Printf("Wialon forwarder started, forwarding to %s", os.Getenv("WIALON_FORWARD_HOSTS"))
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, destination := range destinations {
+					sent, buffered, dropped := destination.Stats()
+					log.Printf("Stats - %s %s: sent %d, buffered %d, dropped %d",
+						destination.Protocol.Name(), destination.Address, sent, buffered, dropped)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+
+	// Stop taking messages, then let the sessions buffer what is still queued
+	client.Disconnect(1000)
+	cancel()
+	for _, destination := range destinations {
+		destination.Wait()
+	}
+	log.Println("Application shutdown complete")
+}
@@ -7,15 +7,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"huabaoprotocol/features/jono"
 	"huabaoprotocol/features/huabao_protocol"
+	"syscall"
 	"time"
 
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 var (
-	verbose = flag.Bool("v", false, "Enable verbose logging") // Verbose flag
+	// verbose is the -v flag, registered by common/utils
+	verbose = &utils.Verbose
 )
 
 // Helper function to print verbose logs if enabled
@@ -45,30 +50,33 @@ func min(a, b int) int {
 
 // MQTTClient wraps the MQTT client with additional functionality
 type MQTTClient struct {
-	client    mqtt.Client
-	brokerURL string
-	clientID  string
-	verbose   bool
+	client   mqtt.Client
+	config   *broker.Config
+	clientID string
+	verbose  bool
+	archive  *utils.FrameArchive // Inbound frames with their Jono output, nil when FRAME_ARCHIVE_DIR is not set
 }
 
 // NewMQTTClient creates a new MQTT client with the given configuration
-func NewMQTTClient(brokerHost string, clientID string, verbose bool) (*MQTTClient, error) {
-	if brokerHost == "" {
-		return nil, fmt.Errorf("broker host cannot be empty")
+func NewMQTTClient(config *broker.Config, clientID string, verbose bool) (*MQTTClient, error) {
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("broker URL cannot be empty")
 	}
 
-	brokerURL := fmt.Sprintf("tcp://%s:1883", brokerHost)
 	return &MQTTClient{
-		brokerURL: brokerURL,
-		clientID:  clientID,
-		verbose:   verbose,
+		config:   config,
+		clientID: clientID,
+		verbose:  verbose,
+		archive:  utils.DefaultFrameArchive("huabao"),
 	}, nil
 }
 
 // Connect establishes a connection to the MQTT broker
 func (m *MQTTClient) Connect() error {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(m.brokerURL)
+	opts, err := m.config.ClientOptions()
+	if err != nil {
+		return err
+	}
 
 	// Generate a unique client ID
 	subscribe_topic := "huabao" // You might want to make this configurable
@@ -78,8 +86,9 @@ func (m *MQTTClient) Connect() error {
 		time.Now().UnixNano()%100000)
 	opts.SetClientID(clientID)
 
-	// Configure settings for multiple listeners
-	opts.SetCleanSession(false) // Maintain persistent session
+	// Configure settings for multiple listeners, with a persistent session unless the replicas
+	// share the subscriptions
+	opts.SetCleanSession(m.config.Shared())
 	opts.SetAutoReconnect(true) // Auto reconnect on connection loss
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetOrderMatters(true) // Maintain message order
@@ -92,7 +101,7 @@ func (m *MQTTClient) Connect() error {
 	for {
 		if token := m.client.Connect(); token.Wait() && token.Error() != nil {
 			if m.verbose {
-				vPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.brokerURL, token.Error())
+				vPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.config.URL, token.Error())
 			}
 			time.Sleep(5 * time.Second)
 			continue
@@ -108,7 +117,7 @@ func (m *MQTTClient) Connect() error {
 
 // Subscribe subscribes to the specified topic
 func (m *MQTTClient) Subscribe(topic string, qos byte) error {
-	if token := m.client.Subscribe(topic, qos, nil); token.Wait() && token.Error() != nil {
+	if token := m.config.Subscribe(m.client, topic, qos, nil); token.Wait() && token.Error() != nil {
 		return fmt.Errorf("error subscribing to topic %s: %v", topic, token.Error())
 	}
 	if m.verbose {
@@ -119,7 +128,10 @@ func (m *MQTTClient) Subscribe(topic string, qos byte) error {
 
 // Publish publishes a message to the specified topic
 func (m *MQTTClient) Publish(topic string, payload interface{}) error {
-	token := m.client.Publish(topic, 0, false, payload)
+	// Jono messages carry the vehicle when VEHICLE_ENRICH is enabled, and the virtual IMEI of the
+	// device when IMEI_VIRTUALIZE is; the vehicle is looked up with the device IMEI
+	payload = utils.PublishPayload(topic, payload)
+	token := m.config.Publish(m.client, topic, payload)
 	token.Wait()
 	if token.Error() != nil {
 		if m.verbose {
@@ -135,13 +147,15 @@ func (m *MQTTClient) Publish(topic string, payload interface{}) error {
 
 // messageHandler handles incoming MQTT messages
 func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
-	if msg.Topic() == "tracker/from-udp" {
+	if m.config.TopicName(msg.Topic()) == "tracker/from-udp" {
 		if m.verbose {
 			tracker_bytes := []byte(msg.Payload())
 			vPrint("Data received:%v",string(tracker_bytes))
 			//vPrint("Received message on topic :\n%v", hex.Dump(tracker_bytes[:min(32, len(tracker_bytes))]))
 		}
 		trackerPayload := string(msg.Payload())
+		record := m.archive.Begin(trackerPayload, "")
+		defer record.End()
 
 		var trackerData string
 		// Check if the string looks like hex before trying to decode
@@ -163,6 +177,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 
 		dataHuabao, err := huabao_protocol.Parse(trackerData)
 		if err != nil {
+			record.Fail(err)
 			fmt.Println(err)
 			return
 		}
@@ -170,6 +185,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		// Ensure proper Jono protocol conversion
 		jonoNormalize, err := jono.Initialize(dataHuabao)
 		if err != nil {
+			record.Fail(err)
 			fmt.Println("Error converting to Jono protocol:", err)
 			return
 		}
@@ -177,9 +193,11 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		// Validate that the JSON is properly structured
 		var jsonObj interface{}
 		if err := json.Unmarshal([]byte(jonoNormalize), &jsonObj); err != nil {
+			record.Fail(err)
 			fmt.Println("Error validating JSON:", err)
 			return
 		}
+		record.Jono(jonoNormalize)
 
 		// Publish to jonoprotocol topic
 		if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
@@ -213,6 +231,8 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	remote_addr := json_data.RemoteAddr
 	
 	trackerPayload := payload
+	record := m.archive.Begin(payload, remote_addr)
+	defer record.End()
 
 	var trackerData string
 	// Check if the string looks like hex before trying to decode
@@ -240,6 +260,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	
 	dataHuabao, err := huabao_protocol.Parse(trackerData)
 	if err != nil {
+		record.Fail(err)
 		fmt.Println(err)
 		return
 	}
@@ -247,6 +268,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	// Extract IMEI from the parsed data
 	var imeiData map[string]interface{}
 	if err := json.Unmarshal([]byte(dataHuabao), &imeiData); err != nil {
+		record.Fail(err)
 		fmt.Println("Error unmarshaling Huabao data:", err)
 		return
 	}
@@ -258,9 +280,11 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	
 	jonoNormalize, err := jono.Initialize(dataHuabao)
 	if err != nil {
+		record.Fail(err)
 		fmt.Println(err)
 		return
 	}
+	record.Jono(jonoNormalize)
 
 	// Publish to jonoprotocol topic
 	if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
@@ -321,16 +345,17 @@ func looksLikeHex(s string) bool {
 
 func main() {
 	// Parse command-line flags
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	// Get MQTT broker host from environment
-	mqttBrokerHost := os.Getenv("MQTT_BROKER_HOST")
-	if mqttBrokerHost == "" {
-		log.Fatal("MQTT_BROKER_HOST environment variable not set")
+	// Get the MQTT broker from the environment
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Create and configure MQTT client
-	mqttClient, err := NewMQTTClient(mqttBrokerHost, "go_mqtt_client", *verbose)
+	mqttClient, err := NewMQTTClient(mqttConfig, "go_mqtt_client", *verbose)
 	if err != nil {
 		log.Fatal("Failed to create MQTT client:", err)
 	}
@@ -347,6 +372,10 @@ func main() {
 	if err := mqttClient.Subscribe("tracker/from-udp", 1); err != nil {
 		log.Fatal("Failed to subscribe:", err)
 	}
-	// Keep the application running
-	select {}
+	// Keep the application running until it is stopped
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	mqttClient.archive.Close()
 }
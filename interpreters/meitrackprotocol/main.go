@@ -19,11 +19,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 var (
-	verbose = flag.Bool("v", false, "Enable verbose logging") // Verbose flag
+	// verbose is the -v flag, registered by common/utils
+	verbose = &utils.Verbose
 )
 
 // CircuitBreaker implements a simple circuit breaker pattern
@@ -142,55 +145,57 @@ func min(a, b int) int {
 // MQTTClient wraps the MQTT client with additional functionality
 type MQTTClient struct {
 	client         mqtt.Client
-	brokerURL      string
+	config         *broker.Config
 	clientID       string
 	verbose        bool
 	ctx            context.Context
 	cancel         context.CancelFunc
-	wg             sync.WaitGroup
 	publishTimeout time.Duration
-	maxGoroutines  int
-	semaphore      chan struct{}
+	maxWorkers     int
+	workers        *broker.KeyedPool // The frames of a device are processed in order, by one worker
 	healthMonitor  *HealthMonitor
 	circuitBreaker *CircuitBreaker
+	archive        *utils.FrameArchive // Inbound frames with their Jono output, nil when FRAME_ARCHIVE_DIR is not set
 	lastHeartbeat  time.Time
 	heartbeatMutex sync.RWMutex
 }
 
 // NewMQTTClient creates a new MQTT client with the given configuration
-func NewMQTTClient(brokerHost string, clientID string, verbose bool) (*MQTTClient, error) {
-	if brokerHost == "" {
-		return nil, fmt.Errorf("broker host cannot be empty")
+func NewMQTTClient(config *broker.Config, clientID string, verbose bool) (*MQTTClient, error) {
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("broker URL cannot be empty")
 	}
 
-	brokerURL := fmt.Sprintf("tcp://%s:1883", brokerHost)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Limit concurrent goroutines to prevent resource exhaustion
-	maxGoroutines := runtime.NumCPU() * 2
-	if maxGoroutines < 4 {
-		maxGoroutines = 4
+	// Limit concurrent workers to prevent resource exhaustion
+	maxWorkers := runtime.NumCPU() * 2
+	if maxWorkers < 4 {
+		maxWorkers = 4
 	}
 
 	return &MQTTClient{
-		brokerURL:      brokerURL,
+		config:         config,
 		clientID:       clientID,
 		verbose:        verbose,
 		ctx:            ctx,
 		cancel:         cancel,
 		publishTimeout: 30 * time.Second,
-		maxGoroutines:  maxGoroutines,
-		semaphore:      make(chan struct{}, maxGoroutines),
+		maxWorkers:     maxWorkers,
+		workers:        broker.NewKeyedPool(maxWorkers, 1000),
 		healthMonitor:  NewHealthMonitor(),
 		circuitBreaker: NewCircuitBreaker(5, 30*time.Second), // 5 failures in 30 seconds opens circuit
+		archive:        utils.DefaultFrameArchive("meitrack"),
 		lastHeartbeat:  time.Now(),
 	}, nil
 }
 
 // Connect establishes a connection to the MQTT broker
 func (m *MQTTClient) Connect() error {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(m.brokerURL)
+	opts, err := m.config.ClientOptions()
+	if err != nil {
+		return err
+	}
 
 	// Generate a unique client ID
 	subscribe_topic := "meitrack" // You might want to make this configurable
@@ -200,8 +205,9 @@ func (m *MQTTClient) Connect() error {
 		time.Now().UnixNano()%100000)
 	opts.SetClientID(clientID)
 
-	// Configure settings for multiple listeners
-	opts.SetCleanSession(false) // Maintain persistent session
+	// Configure settings for multiple listeners, with a persistent session unless the replicas
+	// share the subscriptions
+	opts.SetCleanSession(m.config.Shared())
 	opts.SetAutoReconnect(true) // Auto reconnect on connection loss
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetOrderMatters(true) // Maintain message order
@@ -238,7 +244,7 @@ func (m *MQTTClient) Connect() error {
 		if token := m.client.Connect(); token.WaitTimeout(30*time.Second) && token.Error() != nil {
 			if m.verbose {
 				vPrint("Error connecting to MQTT broker at %s (attempt %d/%d): %v. Retrying in %v...",
-					m.brokerURL, attempt, maxRetries, token.Error(), retryDelay)
+					m.config.URL, attempt, maxRetries, token.Error(), retryDelay)
 			}
 			if attempt == maxRetries {
 				return fmt.Errorf("failed to connect after %d attempts: %v", maxRetries, token.Error())
@@ -257,7 +263,7 @@ func (m *MQTTClient) Connect() error {
 
 // Subscribe subscribes to the specified topic
 func (m *MQTTClient) Subscribe(topic string, qos byte) error {
-	if token := m.client.Subscribe(topic, qos, nil); token.Wait() && token.Error() != nil {
+	if token := m.config.Subscribe(m.client, topic, qos, nil); token.Wait() && token.Error() != nil {
 		return fmt.Errorf("error subscribing to topic %s: %v", topic, token.Error())
 	}
 	if m.verbose {
@@ -275,28 +281,22 @@ func (m *MQTTClient) Shutdown() {
 	// Cancel context to stop all goroutines
 	m.cancel()
 
-	// Wait for all goroutines to finish with timeout
-	done := make(chan struct{})
-	go func() {
-		m.wg.Wait()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-		if m.verbose {
-			vPrint("All goroutines finished")
-		}
-	case <-time.After(10 * time.Second):
+	// Wait for the workers to finish with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.workers.Close(ctx); err != nil {
 		if m.verbose {
-			vPrint("Timeout waiting for goroutines to finish")
+			vPrint("Timeout waiting for workers to finish")
 		}
+	} else if m.verbose {
+		vPrint("All workers finished")
 	}
 
 	// Disconnect MQTT client
 	if m.client.IsConnected() {
 		m.client.Disconnect(1000) // 1 second timeout
 	}
+	m.archive.Close()
 
 	if m.verbose {
 		vPrint("MQTT client shutdown complete")
@@ -329,6 +329,9 @@ func (m *MQTTClient) IsHealthy() bool {
 
 // Publish publishes a message to the specified topic with timeout and retry logic
 func (m *MQTTClient) Publish(topic string, payload interface{}) error {
+	// Jono messages carry the vehicle when VEHICLE_ENRICH is enabled, and the virtual IMEI of the
+	// device when IMEI_VIRTUALIZE is; the vehicle is looked up with the device IMEI
+	payload = utils.PublishPayload(topic, payload)
 	// Use circuit breaker to prevent cascading failures
 	return m.circuitBreaker.Call(func() error {
 		// Create a context with timeout for this publish operation
@@ -351,7 +354,7 @@ func (m *MQTTClient) Publish(topic string, payload interface{}) error {
 				}
 			}()
 
-			token := m.client.Publish(topic, 0, false, payload)
+			token := m.config.Publish(m.client, topic, payload)
 			if token.WaitTimeout(m.publishTimeout) {
 				done <- token.Error()
 			} else {
@@ -379,38 +382,51 @@ func (m *MQTTClient) Publish(topic string, payload interface{}) error {
 	})
 }
 
-// messageHandler handles incoming MQTT messages
+// messageHandler queues incoming MQTT messages on the worker of their device: the frames of a
+// device are processed in order, those of different devices in parallel
 func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	// Update heartbeat to show we're processing messages
 	m.UpdateHeartbeat()
 	m.healthMonitor.RecordMessage()
 
-	// Check if context is cancelled
-	select {
-	case <-m.ctx.Done():
-		return
-	default:
+	// Don't wait forever, the acknowledgements of the publishes of the workers arrive after this
+	// message is handled
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+	if !m.workers.Submit(ctx, messageKey(msg), func() { m.processMessage(msg) }) {
+		if m.verbose {
+			vPrint("Dropping message on topic %s, the queue of its device is full", msg.Topic())
+		}
+		m.healthMonitor.RecordError()
 	}
+}
 
-	// Acquire semaphore to limit concurrent processing
+// messageKey returns the device of a message: the remote address of its connection, or the IMEI
+// of a frame of tracker/from-udp
+func messageKey(msg mqtt.Message) string {
+	if remoteAddr := broker.RemoteAddr(msg.Payload()); remoteAddr != "" {
+		return remoteAddr
+	}
+	data := string(msg.Payload())
+	if bytes, err := hex.DecodeString(data); err == nil {
+		data = string(bytes)
+	}
+	if fields := strings.SplitN(data, ",", 3); len(fields) > 2 {
+		return fields[1]
+	}
+	return ""
+}
+
+// processMessage decodes a message of tracker/from-tcp or tracker/from-udp and publishes it
+func (m *MQTTClient) processMessage(msg mqtt.Message) {
+	// Check if context is cancelled
 	select {
-	case m.semaphore <- struct{}{}:
-		defer func() { <-m.semaphore }()
 	case <-m.ctx.Done():
 		return
-	case <-time.After(5 * time.Second): // Don't wait forever
-		if m.verbose {
-			vPrint("Dropping message due to semaphore timeout")
-		}
-		m.healthMonitor.RecordError()
-		return
+	default:
 	}
 
-	// Add to wait group for graceful shutdown
-	m.wg.Add(1)
-	defer m.wg.Done()
-
-	// Add recovery to prevent panics from crashing the handler
+	// Add recovery to prevent panics from crashing the worker
 	defer func() {
 		if r := recover(); r != nil {
 			m.healthMonitor.RecordError()
@@ -419,28 +435,10 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		}
 	}()
 
-	// Set a timeout for message processing
-	processingCtx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
-	defer cancel()
-
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		if msg.Topic() == "tracker/from-udp" {
-			m.processUDPMessage(msg)
-		} else {
-			m.processTCPMessage(msg)
-		}
-	}()
-
-	select {
-	case <-done:
-		// Processing completed normally
-	case <-processingCtx.Done():
-		m.healthMonitor.RecordError()
-		if m.verbose {
-			vPrint("Message processing timed out for topic: %s", msg.Topic())
-		}
+	if m.config.TopicName(msg.Topic()) == "tracker/from-udp" {
+		m.processUDPMessage(msg)
+	} else {
+		m.processTCPMessage(msg)
 	}
 }
 
@@ -469,6 +467,8 @@ func (m *MQTTClient) processUDPMessage(msg mqtt.Message) {
 	}
 
 	trackerPayload := string(msg.Payload())
+	record := m.archive.Begin(trackerPayload, "")
+	defer record.End()
 
 	var trackerData string
 	// Try to decode as hex, if it fails, use the original message
@@ -484,6 +484,7 @@ func (m *MQTTClient) processUDPMessage(msg mqtt.Message) {
 
 	// Preliminary check to see if the message is a valid format
 	if !strings.HasPrefix(trackerData, "$$") && !strings.HasPrefix(trackerData, "@@") {
+		record.Fail(fmt.Errorf("invalid protocol format"))
 		if m.verbose {
 			vPrint("Ignoring message with invalid protocol format: %s", trackerData)
 		}
@@ -492,15 +493,18 @@ func (m *MQTTClient) processUDPMessage(msg mqtt.Message) {
 
 	fields := strings.Split(trackerData, ",")
 	if len(fields) <= 2 {
+		record.Fail(fmt.Errorf("not enough fields: %d", len(fields)))
 		if m.verbose {
 			vPrint("Not enough fields in message: %d", len(fields))
 		}
 		return
 	}
+	record.SetIMEI(fields[1])
 
 	dataMeitrack, err := meitrack_protocol.Initialize(trackerData)
 	if err != nil {
 		m.healthMonitor.RecordError()
+		record.Fail(err)
 		if m.verbose {
 			vPrint("Error initializing Meitrack protocol: %v", err)
 		}
@@ -510,49 +514,33 @@ func (m *MQTTClient) processUDPMessage(msg mqtt.Message) {
 	jonoNormalize, err := jono.Initialize(dataMeitrack)
 	if err != nil {
 		m.healthMonitor.RecordError()
+		record.Fail(err)
 		if m.verbose {
 			vPrint("Error initializing Jono protocol: %v", err)
 		}
 		return
 	}
+	record.Jono(jonoNormalize)
 
-	// Use a separate goroutine for publishing with context cancellation
-	m.wg.Add(1)
-	go func(jonoData string) {
-		defer m.wg.Done()
-		defer func() {
-			if r := recover(); r != nil {
-				m.healthMonitor.RecordError()
-				log.Printf("Panic in UDP publish goroutine: %v", r)
-			}
-		}()
-
-		select {
-		case <-m.ctx.Done():
-			return
-		default:
-		}
-
-		// Publish to jonoprotocol topic
-		if err := m.Publish("tracker/jonoprotocol", jonoData); err != nil {
-			log.Printf("Error publishing to jonoprotocol: %v", err)
-			return
-		}
-		if m.verbose {
-			// Create a compact version of the JSON for logging
-			var jsonObj map[string]interface{}
-			if err := json.Unmarshal([]byte(jonoData), &jsonObj); err == nil {
-				// Re-marshal without indentation
-				if compactJSON, err := json.Marshal(jsonObj); err == nil {
-					vPrint("Jono Protocol: %s", string(compactJSON))
-				} else {
-					vPrint("Jono Protocol: %s", jonoData) // Fallback to pretty JSON if compact fails
-				}
+	// Publish to jonoprotocol topic
+	if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
+		log.Printf("Error publishing to jonoprotocol: %v", err)
+		return
+	}
+	if m.verbose {
+		// Create a compact version of the JSON for logging
+		var jsonObj map[string]interface{}
+		if err := json.Unmarshal([]byte(jonoNormalize), &jsonObj); err == nil {
+			// Re-marshal without indentation
+			if compactJSON, err := json.Marshal(jsonObj); err == nil {
+				vPrint("Jono Protocol: %s", string(compactJSON))
 			} else {
-				vPrint("Jono Protocol: %s", jonoData) // Fallback to pretty JSON if unmarshaling fails
+				vPrint("Jono Protocol: %s", jonoNormalize) // Fallback to pretty JSON if compact fails
 			}
+		} else {
+			vPrint("Jono Protocol: %s", jonoNormalize) // Fallback to pretty JSON if unmarshaling fails
 		}
-	}(jonoNormalize)
+	}
 }
 
 // processTCPMessage handles TCP messages
@@ -597,6 +585,8 @@ func (m *MQTTClient) processTCPMessage(msg mqtt.Message) {
 	payload := json_data.Payload
 	remote_addr := json_data.RemoteAddr
 	trackerPayload := payload
+	record := m.archive.Begin(payload, remote_addr)
+	defer record.End()
 
 	var trackerData string
 	// Try to decode as hex, if it fails, use the original message
@@ -618,6 +608,7 @@ func (m *MQTTClient) processTCPMessage(msg mqtt.Message) {
 
 	// Preliminary check to see if the message is a valid format
 	if !strings.HasPrefix(trackerData, "$$") && !strings.HasPrefix(trackerData, "@@") {
+		record.Fail(fmt.Errorf("invalid protocol format"))
 		if m.verbose {
 			vPrint("Ignoring message with invalid protocol format: %s", trackerData)
 		}
@@ -626,15 +617,18 @@ func (m *MQTTClient) processTCPMessage(msg mqtt.Message) {
 
 	fields := strings.Split(trackerData, ",")
 	if len(fields) <= 2 {
+		record.Fail(fmt.Errorf("not enough fields: %d", len(fields)))
 		if m.verbose {
 			vPrint("Not enough fields in TCP message: %d", len(fields))
 		}
 		return
 	}
+	record.SetIMEI(fields[1])
 
 	dataMeitrack, err := meitrack_protocol.Initialize(trackerData)
 	if err != nil {
 		m.healthMonitor.RecordError()
+		record.Fail(err)
 		if m.verbose {
 			vPrint("Error initializing Meitrack protocol: %v", err)
 		}
@@ -650,6 +644,7 @@ func (m *MQTTClient) processTCPMessage(msg mqtt.Message) {
 	imei := fields[1]
 
 	if len(imei) < 10 || len(imei) > 20 { // Basic IMEI validation
+		record.Fail(fmt.Errorf("invalid IMEI format: %s", imei))
 		if m.verbose {
 			vPrint("Invalid IMEI format: %s", imei)
 		}
@@ -660,11 +655,13 @@ func (m *MQTTClient) processTCPMessage(msg mqtt.Message) {
 	jonoNormalize, err := jono.Initialize(dataMeitrack)
 	if err != nil {
 		m.healthMonitor.RecordError()
+		record.Fail(err)
 		if m.verbose {
 			vPrint("Error initializing Jono protocol: %v", err)
 		}
 		return
 	}
+	record.Jono(jonoNormalize)
 
 	// Publish to jonoprotocol topic
 	if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
@@ -708,6 +705,7 @@ func (m *MQTTClient) processTCPMessage(msg mqtt.Message) {
 
 func main() {
 	// Parse command-line flags
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Set up logging with timestamps
@@ -719,14 +717,14 @@ func main() {
 	// Set max procs to prevent resource exhaustion
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	// Get MQTT broker host from environment
-	mqttBrokerHost := os.Getenv("MQTT_BROKER_HOST")
-	if mqttBrokerHost == "" {
-		log.Fatal("MQTT_BROKER_HOST environment variable not set")
+	// Get the MQTT broker from the environment
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Create and configure MQTT client
-	mqttClient, err := NewMQTTClient(mqttBrokerHost, "go_mqtt_client", *verbose)
+	mqttClient, err := NewMQTTClient(mqttConfig, "go_mqtt_client", *verbose)
 	if err != nil {
 		log.Fatal("Failed to create MQTT client:", err)
 	}
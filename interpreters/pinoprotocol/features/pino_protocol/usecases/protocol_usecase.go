@@ -2,6 +2,7 @@ package usecases
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"math"
@@ -898,6 +899,74 @@ func DecodeAlarmFrame(data []byte, imei string) (models.AlarmPacketModel, error)
 	}, nil
 }
 
+// AlarmToJSON returns the JSON of a decoded alarm packet for Jono, with the voltage of the
+// voltage level byte, the event code of the terminal information byte and the alarm type
+func AlarmToJSON(alarm models.AlarmPacketModel, data []byte) (string, error) {
+	if len(data) <= 5 {
+		return "", fmt.Errorf("alarm packet too short for the voltage level, length: %d", len(data))
+	}
+	_, _, eventCode, _, _, _ := DecodeTerminalInformationBits(data[4])
+
+	var voltageValue float64
+	switch data[5] {
+	case 0:
+		voltageValue = 0.0 // No Power
+	case 1:
+		voltageValue = math.Round((3.0 * 1024.0) / 6.0)
+	case 2:
+		voltageValue = math.Round((6.0 * 1024.0) / 6.0)
+	case 3:
+		voltageValue = math.Round((9.0 * 1024.0) / 6.0)
+	case 4:
+		voltageValue = math.Round((12.0 * 1024.0) / 6.0)
+	case 5:
+		voltageValue = math.Round((12.5 * 1024.0) / 6.0)
+	case 6:
+		voltageValue = math.Round((13.0 * 1024.0) / 6.0)
+	default:
+		voltageValue = 9.0 // Default to something reasonable
+	}
+
+	jsonData, err := alarm.ToJSON()
+	if err != nil {
+		return "", err
+	}
+
+	// Add the voltage and the alarm fields
+	var alarmMap map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonData), &alarmMap); err != nil {
+		return jsonData, nil
+	}
+	if locModel, ok := alarmMap["locationPacketModel"].(map[string]interface{}); ok {
+		locModel["VoltageValue"] = voltageValue
+	}
+	alarmMap["Message"] = "Alarm event"
+	alarmMap["EventCode"] = fmt.Sprintf("%d", eventCode)
+
+	alarmType := ""
+	switch eventCode {
+	case 1:
+		alarmType = "SOS"
+	case 23:
+		alarmType = "Power Cut Alarm"
+	case 50:
+		alarmType = "Alarm"
+	case 79:
+		alarmType = "Shock Alarm"
+	case 35:
+		alarmType = "Normal"
+	}
+	if alarmType != "" {
+		alarmMap["AlarmType"] = alarmType
+		alarmMap["Message"] = fmt.Sprintf("Alarm event: %s", alarmType)
+	}
+
+	if enhancedJSON, err := json.Marshal(alarmMap); err == nil {
+		jsonData = string(enhancedJSON)
+	}
+	return jsonData, nil
+}
+
 // DecodeStringInformationPacket decodes a GT06 string information packet (0x15)
 // The packet contains text with location information in a format like:
 // "Current position:Lat:N19.521012,Lon:W99.211767,DateTime:2025-04-30 14:10:55,..."
@@ -6,17 +6,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"pinoprotocol/features/jono"
 	"pinoprotocol/features/pino_protocol/models"
 	"pinoprotocol/features/pino_protocol/usecases"
+	"os/signal"
 	"runtime/debug"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/MaddSystems/jonobridge/common/utils"
 
+	"github.com/MaddSystems/jonobridge/common/broker"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
@@ -54,28 +56,31 @@ type TrackerAssign struct {
 
 // MQTTClient wraps the MQTT client with additional functionality
 type MQTTClient struct {
-	client    mqtt.Client
-	brokerURL string
-	clientID  string
+	client   mqtt.Client
+	config   *broker.Config
+	clientID string
+	archive  *utils.FrameArchive // Inbound frames with their Jono output, nil when FRAME_ARCHIVE_DIR is not set
 }
 
 // NewMQTTClient creates a new MQTT client with the given configuration
-func NewMQTTClient(brokerHost string, clientID string) (*MQTTClient, error) {
-	if brokerHost == "" {
-		return nil, fmt.Errorf("broker host cannot be empty")
+func NewMQTTClient(config *broker.Config, clientID string) (*MQTTClient, error) {
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("broker URL cannot be empty")
 	}
 
-	brokerURL := fmt.Sprintf("tcp://%s:1883", brokerHost)
 	return &MQTTClient{
-		brokerURL: brokerURL,
-		clientID:  clientID,
+		config:   config,
+		clientID: clientID,
+		archive:  utils.DefaultFrameArchive("pino"),
 	}, nil
 }
 
 // Connect establishes a connection to the MQTT broker
 func (m *MQTTClient) Connect() error {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(m.brokerURL)
+	opts, err := m.config.ClientOptions()
+	if err != nil {
+		return err
+	}
 
 	// Generate a unique client ID
 	subscribe_topic := "pino" // You might want to make this configurable
@@ -85,8 +90,9 @@ func (m *MQTTClient) Connect() error {
 		time.Now().UnixNano()%100000)
 	opts.SetClientID(clientID)
 
-	// Configure settings for multiple listeners
-	opts.SetCleanSession(false) // Maintain persistent session
+	// Configure settings for multiple listeners, with a persistent session unless the replicas
+	// share the subscriptions
+	opts.SetCleanSession(m.config.Shared())
 	opts.SetAutoReconnect(true) // Auto reconnect on connection loss
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetOrderMatters(true) // Maintain message order
@@ -98,7 +104,7 @@ func (m *MQTTClient) Connect() error {
 	// Try to connect with retries
 	for {
 		if token := m.client.Connect(); token.Wait() && token.Error() != nil {
-			utils.VPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.brokerURL, token.Error())
+			utils.VPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.config.URL, token.Error())
 			time.Sleep(5 * time.Second)
 			continue
 		}
@@ -111,7 +117,7 @@ func (m *MQTTClient) Connect() error {
 
 // Subscribe subscribes to the specified topic
 func (m *MQTTClient) Subscribe(topic string, qos byte) error {
-	if token := m.client.Subscribe(topic, qos, nil); token.Wait() && token.Error() != nil {
+	if token := m.config.Subscribe(m.client, topic, qos, nil); token.Wait() && token.Error() != nil {
 		return fmt.Errorf("error subscribing to topic %s: %v", topic, token.Error())
 	}
 	utils.VPrint("Subscribed to topic: %s", topic)
@@ -136,7 +142,10 @@ func (m *MQTTClient) Publish(topic string, payload interface{}) error {
 		return fmt.Errorf("MQTT client not connected")
 	}
 	
-	token := m.client.Publish(topic, 0, false, payload)
+	// Jono messages carry the vehicle when VEHICLE_ENRICH is enabled, and the virtual IMEI of the
+	// device when IMEI_VIRTUALIZE is; the vehicle is looked up with the device IMEI
+	payload = utils.PublishPayload(topic, payload)
+	token := m.config.Publish(m.client, topic, payload)
 	token.Wait()
 	if token.Error() != nil {
 		log.Printf("ERROR: Failed to publish to MQTT topic %s: %v", topic, token.Error())
@@ -179,6 +188,9 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 
+	record := m.archive.Begin(json_data.Payload, json_data.RemoteAddr)
+	defer record.End()
+
 	// Update message processing tracking
 	processingMutex.Lock()
 	lastProcessedMessage = time.Now()
@@ -192,6 +204,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	rawBytes, err := hex.DecodeString(json_data.Payload)
 	if err != nil {
 		log.Printf("ERROR: Failed to decode hex string: %v", err)
+		record.Fail(err)
 		utils.VPrint("Error decoding hex string:%v", err)
 		return
 	}
@@ -199,6 +212,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	// Validate minimum packet size
 	if len(rawBytes) < 2 {
 		log.Printf("ERROR: Packet too short, length: %d", len(rawBytes))
+		record.Fail(fmt.Errorf("packet too short, length: %d", len(rawBytes)))
 		utils.VPrint("Error: Packet too short")
 		return
 	}
@@ -208,6 +222,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	clientAddr := json_data.RemoteAddr
 	if len(rawBytes) < 1 || (rawBytes[0] != 0x7E && rawBytes[0] != 0x78) {
 		log.Printf("WARNING: Invalid frame header, first byte: 0x%02X", rawBytes[0])
+		record.Fail(fmt.Errorf("invalid frame header, first byte: 0x%02X", rawBytes[0]))
 		utils.VPrint("invalid frame: first byte is not 0x7E or 0x78")
 		return
 	}
@@ -218,6 +233,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		// Validate BSJ packet length before processing
 		if len(rawBytes) < 12 {
 			log.Printf("ERROR: BSJ packet too short, length: %d", len(rawBytes))
+			record.Fail(fmt.Errorf("BSJ packet too short, length: %d", len(rawBytes)))
 			utils.VPrint("Error: BSJ packet too short")
 			return
 		}
@@ -257,6 +273,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		utils.VPrint("Final IMEI (BSJ protocol): %s", imei)
 
 		imeiStore.Store(clientAddr, imei)
+		record.SetIMEI(imei)
 		if bytes.Equal(rawBytes[:2], []byte{0x01, 0x00}) { // Registro
 			log.Printf("Registro recibido. Teléfono: %s, Serial: %X\n", phoneNumber, serialNumber)
 
@@ -271,7 +288,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				return
 			}
 
-			client.Publish("tracker/send", 0, false, response_json)
+			m.config.Publish(client, "tracker/send", response_json)
 		} else if bytes.Equal(messageID, []byte{0x01, 0x02}) { // Autenticación
 			log.Printf("Autenticación recibida. Teléfono: %s, Serial: %X\n", phoneNumber, serialNumber)
 
@@ -289,7 +306,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				return
 			}
 
-			client.Publish("tracker/send", 0, false, response_json)
+			m.config.Publish(client, "tracker/send", response_json)
 		} else if bytes.Equal(messageID, []byte{0x00, 0x02}) { // Terminal heartbeat
 			log.Printf("Heartbeat recibido. Teléfono: %s, Trama num. Serie: %X\n", phoneNumber, serialNumber)
 
@@ -325,13 +342,14 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				return
 			}
 
-			client.Publish("tracker/send", 0, false, response_json)
+			m.config.Publish(client, "tracker/send", response_json)
 		} else if bytes.Equal(messageID, []byte{0x02, 0x00}) { // Localización BSJ
 			log.Printf("Trama de localización recibida. Teléfono: %s, Serial: %X\n", phoneNumber, serialNumber)
 			// Parsear datos de localización
 			locationData := rawBytes[12:] // Cuerpo de la trama de localización
 			imeiValue, ok := imeiStore.Load(clientAddr)
 			if !ok {
+				record.Fail(fmt.Errorf("IMEI not found for client %s", clientAddr))
 				utils.VPrint("Error: IMEI not found for client %s", clientAddr)
 				return
 			}
@@ -347,6 +365,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			// Then convert to Jono format
 			jonoNormalize, err := jono.Initialize(parsedLocationData)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("Error transforming to jono format: %v", err)
 				return
 			}
@@ -372,6 +391,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				utils.VPrint("Jono Protocol: %s", compactJSON.String())
 			}
 			// Publish to jonoprotocol topic
+			record.Jono(jonoNormalize)
 			if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
 				utils.VPrint("Error publishing to jonoprotocol: %v", err)
 			}
@@ -425,6 +445,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			}
 			// Store the IMEI in the map
 			imeiStore.Store(clientAddr, imei)
+			record.SetIMEI(imei)
 			response := hex.EncodeToString(usecases.BuildLoginResponse(rawBytes))
 			tracker_data_json := TrackerData{
 				Payload:    response,
@@ -435,13 +456,14 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				utils.VPrint("Error creating JSON:%v", err)
 				return
 			}
-			client.Publish("tracker/send", 0, false, response_json)
+			m.config.Publish(client, "tracker/send", response_json)
 
 		case usecases.IsStandardLocationPacket(rawBytes): // GT06 location packet
 			utils.VPrint("Processing GT06 location packet")
 			// Retrieve IMEI from the map
 			imeiValue, ok := imeiStore.Load(clientAddr)
 			if !ok {
+				record.Fail(fmt.Errorf("IMEI not found for client %s", clientAddr))
 				utils.VPrint("Error: IMEI not found for client %s", clientAddr)
 				return
 			}
@@ -450,8 +472,10 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				utils.VPrint("Error: Invalid IMEI type for client %s", clientAddr)
 				return
 			}
+			record.SetIMEI(imei)
 			data, err := usecases.DecodeStandardLocationData(rawBytes, imei, false)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("error decoding location data gt06, %s", err)
 				return
 			}
@@ -482,6 +506,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 							var normalizeErr error
 							jonoNormalize, normalizeErr = jono.Initialize(enhancedStr)
 							if normalizeErr != nil {
+								record.Fail(normalizeErr)
 								utils.VPrint("error decoding gt06 to jono, %s", normalizeErr)
 								return
 							}
@@ -490,6 +515,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 						// If no voltage, use the original JSON
 						jonoNormalize, err = jono.Initialize(string(jsonBytes))
 						if err != nil {
+							record.Fail(err)
 							utils.VPrint("error decoding gt06 to jono, %s", err)
 							return
 						}
@@ -499,11 +525,13 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 					var err error
 					jonoNormalize, err = jono.Initialize(string(jsonBytes))
 					if err != nil {
+						record.Fail(err)
 						utils.VPrint("error decoding gt06 to jono, %s", err)
 						return
 					}
 				}
 			} else {
+				record.Fail(err)
 				utils.VPrint("error marshalling location data, %s", err)
 				return
 			}
@@ -511,6 +539,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			utils.VPrint("Jono Protocol processed successfully (payload omitted for brevity)")
 
 			// Publish to jonoprotocol topic
+			record.Jono(jonoNormalize)
 			if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
 				utils.VPrint("Error publishing to jonoprotocol: %v", err)
 			}
@@ -535,6 +564,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		case usecases.IsStandardAlarmPacket(rawBytes):
 			imeiValue, ok := imeiStore.Load(clientAddr)
 			if !ok {
+				record.Fail(fmt.Errorf("IMEI not found for client %s", clientAddr))
 				utils.VPrint("Error: IMEI not found for client %s", clientAddr)
 				return
 			}
@@ -543,65 +573,20 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				utils.VPrint("Error: Invalid IMEI type for client %s", clientAddr)
 				return
 			}
+			record.SetIMEI(imei)
 
 			// First decode the alarm frame
 			data, err := usecases.DecodeAlarmFrame(rawBytes, imei)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("error decoding alarm data, %s", err)
 				return
 			}
 
-			// Extract terminal information byte (byte index 4)
-			terminalInfoByte := rawBytes[4]
-			oilDisconnected, gpsTrackingOn, eventCode, chargeOn, accHigh, activated := usecases.DecodeTerminalInformationBits(terminalInfoByte)
-
-			// Calculate voltage from voltageLevelByte (byte index 5)
-			if len(rawBytes) <= 5 {
-				log.Printf("ERROR: rawBytes too short for voltage level extraction, length: %d", len(rawBytes))
-				utils.VPrint("Error: rawBytes too short for voltage level extraction")
-				return
-			}
-			voltageLevelByte := rawBytes[5]
-			utils.VPrint("Voltage Level Byte: %v", voltageLevelByte)
-			var voltageValue float64
-			switch voltageLevelByte {
-			case 0:
-				voltageValue = 0.0 // No Power
-			case 1:
-				voltageCalc := (3.0 * 1024.0) / 6.0
-				voltageValue = float64(int(math.Round(voltageCalc)))
-			case 2:
-				voltageCalc := (6.0 * 1024.0) / 6.0
-				voltageValue = float64(int(math.Round(voltageCalc)))
-			case 3:
-				voltageCalc := (9.0 * 1024.0) / 6.0
-				voltageValue = float64(int(math.Round(voltageCalc)))
-			case 4:
-				voltageCalc := (12.0 * 1024.0) / 6.0
-				voltageValue = float64(int(math.Round(voltageCalc)))
-			case 5:
-				voltageCalc := (12.5 * 1024.0) / 6.0
-				voltageValue = float64(int(math.Round(voltageCalc)))
-			case 6:
-				voltageCalc := (13.0 * 1024.0) / 6.0
-				voltageValue = float64(int(math.Round(voltageCalc)))
-			default:
-				voltageValue = 9.0 // Default to something reasonable
-			}
-
 			// Log the alarm data
-			voltageLevel := data.VoltageLevel
-			gsmSignal := data.GSMSignalStrength
-
-			utils.VPrint("ALARM DETECTED - EventCode: %d", eventCode)
-			utils.VPrint("Terminal Info: Oil=%v, GPS=%v, Charge=%v, ACC=%v, Active=%v",
-				map[bool]string{true: "Disconnected", false: "Connected"}[oilDisconnected],
-				map[bool]string{true: "On", false: "Off"}[gpsTrackingOn],
-				chargeOn,
-				map[bool]string{true: "High", false: "Low"}[accHigh],
-				map[bool]string{true: "Yes", false: "No"}[activated])
-			utils.VPrint("Voltage Level: %s (%.1f V)", voltageLevel, voltageValue)
-			utils.VPrint("GSM Signal Strength: %s", gsmSignal)
+			utils.VPrint("ALARM DETECTED - %s", data.TerminalInformationContent)
+			utils.VPrint("Voltage Level: %s", data.VoltageLevel)
+			utils.VPrint("GSM Signal Strength: %s", data.GSMSignalStrength)
 
 			// Log location data
 			locModel := data.LocationPacketModel
@@ -610,53 +595,18 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 					locModel.Latitude, locModel.Longitude, locModel.DateTime)
 			}
 
-			// Convert to JSON for Jono processing
-			jsonData, err := data.ToJSON()
+			// Convert to JSON for Jono processing, with the voltage and the alarm fields
+			jsonData, err := usecases.AlarmToJSON(data, rawBytes)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("error converting alarm data to JSON: %s", err)
 				return
 			}
 
-			// Parse the JSON and add alarm specific fields including voltage
-			var alarmMap map[string]interface{}
-			if err := json.Unmarshal([]byte(jsonData), &alarmMap); err == nil {
-				// Add voltage to locationPacketModel
-				if locModel, ok := alarmMap["locationPacketModel"].(map[string]interface{}); ok {
-					locModel["VoltageValue"] = voltageValue
-				}
-
-				// Add other alarm fields
-				alarmMap["Message"] = "Alarm event"
-				alarmMap["EventCode"] = fmt.Sprintf("%d", eventCode)
-
-				// Add alarm type based on event code
-				alarmType := ""
-				switch eventCode {
-				case 1:
-					alarmType = "SOS"
-				case 23:
-					alarmType = "Power Cut Alarm"
-				case 50:
-					alarmType = "Alarm"
-				case 79:
-					alarmType = "Shock Alarm"
-				case 35:
-					alarmType = "Normal"
-				}
-
-				if alarmType != "" {
-					alarmMap["AlarmType"] = alarmType
-					alarmMap["Message"] = fmt.Sprintf("Alarm event: %s", alarmType)
-				}
-
-				if enhancedJSON, err := json.Marshal(alarmMap); err == nil {
-					jsonData = string(enhancedJSON)
-				}
-			}
-
 			// Transform to Jono format
 			jonoNormalize, err := jono.Initialize(jsonData)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("error transforming alarm to jono format: %s", err)
 				return
 			}
@@ -664,6 +614,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			utils.VPrint("Alarm Jono Protocol GT06 processed successfully")
 
 			// Publish to jonoprotocol topic
+			record.Jono(jonoNormalize)
 			if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
 				utils.VPrint("Error publishing to jonoprotocol: %v", err)
 			}
@@ -688,6 +639,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			// Retrieve IMEI from the map
 			imeiValue, ok := imeiStore.Load(clientAddr)
 			if !ok {
+				record.Fail(fmt.Errorf("IMEI not found for client %s", clientAddr))
 				utils.VPrint("Error: IMEI not found for client %s", clientAddr)
 				return
 			}
@@ -696,10 +648,12 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				utils.VPrint("Error: Invalid IMEI type for client %s", clientAddr)
 				return
 			}
+			record.SetIMEI(imei)
 
 			// Decode heartbeat packet and print debug info
 			statusData, err := usecases.DecodeHeartbeatPacket(rawBytes, imei)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("error decoding heartbeat data: %s", err)
 				return
 			}
@@ -707,6 +661,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			// Convert to JSON for further processing (for debug purposes only)
 			jsonData, err := statusData.ToJSON()
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("error converting heartbeat data to JSON: %s", err)
 				return
 			}
@@ -737,12 +692,13 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				utils.VPrint("Error creating JSON:%v", err)
 				return
 			}
-			client.Publish("tracker/send", 0, false, response_json)
+			m.config.Publish(client, "tracker/send", response_json)
 
 		case usecases.IsStringInformationPacket(rawBytes):
 			// Retrieve IMEI from the map
 			imeiValue, ok := imeiStore.Load(clientAddr)
 			if !ok {
+				record.Fail(fmt.Errorf("IMEI not found for client %s", clientAddr))
 				utils.VPrint("Error: IMEI not found for client %s", clientAddr)
 				return
 			}
@@ -751,12 +707,14 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 				utils.VPrint("Error: Invalid IMEI type for client %s", clientAddr)
 				return
 			}
+			record.SetIMEI(imei)
 
 			utils.VPrint("Processing String Information packet (0x15) from IMEI: %s", imei)
 
 			// Decode the string information packet
 			data, err := usecases.DecodeStringInformationPacket(rawBytes, imei)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("Error decoding string information data: %s", err)
 				return
 			}
@@ -774,6 +732,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			// Convert to JSON for Jono normalization
 			jsonBytes, err := json.Marshal(data)
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("Error marshalling string information data: %s", err)
 				return
 			}
@@ -781,6 +740,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			// Transform to Jono format
 			jonoNormalize, err := jono.Initialize(string(jsonBytes))
 			if err != nil {
+				record.Fail(err)
 				utils.VPrint("Error transforming string information to jono format: %s", err)
 				return
 			}
@@ -799,6 +759,7 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			}
 
 			// Publish to jonoprotocol topic
+			record.Jono(jonoNormalize)
 			if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
 				utils.VPrint("Error publishing to jonoprotocol: %v", err)
 			}
@@ -996,14 +957,14 @@ func main() {
 		}
 	}()
 	
-	// Get MQTT broker host from environment
-	mqttBrokerHost := os.Getenv("MQTT_BROKER_HOST")
-	if mqttBrokerHost == "" {
-		log.Fatal("MQTT_BROKER_HOST environment variable not set")
+	// Get the MQTT broker from the environment
+	mqttConfig, err := broker.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Create and configure MQTT client
-	mqttClient, err := NewMQTTClient(mqttBrokerHost, "go_mqtt_client")
+	mqttClient, err := NewMQTTClient(mqttConfig, "go_mqtt_client")
 	if err != nil {
 		log.Fatalf("Failed to create MQTT client: %v", err)
 	}
@@ -1021,6 +982,10 @@ func main() {
 	log.Printf("Pino Protocol service started successfully - monitoring for crashes and deadlocks")
 	utils.VPrint("Service ready - waiting for tracker messages...")
 
-	// Keep the application running
-	select {}
+	// Keep the application running until it is stopped
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	mqttClient.archive.Close()
 }
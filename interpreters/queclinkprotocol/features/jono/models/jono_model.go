@@ -127,6 +127,28 @@ type TemperatureAndHumidity struct {
 	AlertLowHumidity     *string `json:"AlertLowHumidity"`
 }
 
+// 📌 VehicleBus contiene los datos leídos del bus CAN u OBD del vehículo
+type VehicleBus struct {
+	VIN                *string  `json:"VIN,omitempty"`
+	IgnitionKey        *float64 `json:"IgnitionKey,omitempty"`
+	TotalDistance      *float64 `json:"TotalDistance,omitempty"`
+	FuelUsed           *float64 `json:"FuelUsed,omitempty"`
+	FuelLevel          *float64 `json:"FuelLevel,omitempty"`
+	FuelConsumption    *float64 `json:"FuelConsumption,omitempty"`
+	EngineRPM          *float64 `json:"EngineRPM,omitempty"`
+	EngineHours        *float64 `json:"EngineHours,omitempty"`
+	EngineLoad         *float64 `json:"EngineLoad,omitempty"`
+	VehicleSpeed       *float64 `json:"VehicleSpeed,omitempty"`
+	CoolantTemperature *float64 `json:"CoolantTemperature,omitempty"`
+	ThrottlePosition   *float64 `json:"ThrottlePosition,omitempty"`
+	AcceleratorPedal   *float64 `json:"AcceleratorPedal,omitempty"`
+	Range              *float64 `json:"Range,omitempty"`
+	PowerVoltage       *float64 `json:"PowerVoltage,omitempty"`
+	MILStatus          *float64 `json:"MILStatus,omitempty"`
+	DTCCount           *float64 `json:"DTCCount,omitempty"`
+	DTCs               *string  `json:"DTCs,omitempty"`
+}
+
 // 📌 IoPortsStatus contiene el estado de los puertos de entrada/salida con valores predeterminados en 0
 type IoPortsStatus struct {
 	Port1 int `json:"Port1"`
@@ -168,6 +190,11 @@ type Packet struct {
 	BluetoothBeaconA             *BluetoothBeacon            `json:"BluetoothBeaconA"`
 	BluetoothBeaconB             *BluetoothBeacon            `json:"BluetoothBeaconB"`
 	TemperatureAndHumiditySensor *TemperatureAndHumidity     `json:"TemperatureAndHumiditySensor"`
+	Historical                   *bool                       `json:"Historical,omitempty"` // Set for buffered (+BUFF) reports
+	FuelLevel                    *float64                    `json:"FuelLevel,omitempty"`
+	DriverID                     *string                     `json:"DriverID,omitempty"`
+	OneWireSensors               []TemperatureSensor         `json:"OneWireSensors,omitempty"`
+	VehicleBus                   *VehicleBus                 `json:"VehicleBus,omitempty"`
 }
 
 // 📌 ParsedModel representa el modelo final con paquetes
@@ -469,6 +469,11 @@ func createPacket(packetMap map[string]interface{}) models.Packet {
 		BluetoothBeaconA:             extractBluetoothBeacon(packetMap, "BluetoothBeaconA"),
 		BluetoothBeaconB:             extractBluetoothBeacon(packetMap, "BluetoothBeaconB"),
 		TemperatureAndHumiditySensor: extractTemperatureAndHumidity(packetMap),
+		Historical:                   getBoolPointer(packetMap, "Historical"),
+		FuelLevel:                    getFloatPointer(packetMap, "FuelLevel"),
+		DriverID:                     getStringPointer(packetMap, "DriverID"),
+		OneWireSensors:               extractOneWireSensors(packetMap),
+		VehicleBus:                   extractVehicleBus(packetMap),
 	}
 }
 
@@ -668,6 +673,16 @@ func getCodePointer(data map[string]interface{}, key string) int {
 	return 9999
 }
 
+// 📌 Función para obtener un puntero a un bool
+func getBoolPointer(data map[string]interface{}, key string) *bool {
+	if value, exists := data[key]; exists {
+		if boolValue, ok := value.(bool); ok {
+			return &boolValue
+		}
+	}
+	return nil
+}
+
 // 📌 Función para obtener un puntero a un float64
 func getFloatPointer(data map[string]interface{}, key string) *float64 {
 	if value, exists := data[key]; exists {
@@ -917,6 +932,54 @@ func extractAdditionalAlertInfoADASDMS(packetMap map[string]interface{}) *models
 	}
 }
 
+// 📌 Función para extraer los sensores 1-wire (temperatura)
+func extractOneWireSensors(packetMap map[string]interface{}) []models.TemperatureSensor {
+	sensors, ok := packetMap["OneWireSensors"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var result []models.TemperatureSensor
+	for _, sensor := range sensors {
+		if sensorMap, ok := sensor.(map[string]interface{}); ok {
+			result = append(result, models.TemperatureSensor{
+				SensorNumber: getStringPointer(sensorMap, "SensorNumber"),
+				Value:        getStringPointer(sensorMap, "Value"),
+			})
+		}
+	}
+	return result
+}
+
+// 📌 Función para extraer los datos del bus CAN/OBD
+func extractVehicleBus(packetMap map[string]interface{}) *models.VehicleBus {
+	bus, ok := packetMap["VehicleBus"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	return &models.VehicleBus{
+		VIN:                getStringPointer(bus, "VIN"),
+		IgnitionKey:        getFloatPointer(bus, "IgnitionKey"),
+		TotalDistance:      getFloatPointer(bus, "TotalDistance"),
+		FuelUsed:           getFloatPointer(bus, "FuelUsed"),
+		FuelLevel:          getFloatPointer(bus, "FuelLevel"),
+		FuelConsumption:    getFloatPointer(bus, "FuelConsumption"),
+		EngineRPM:          getFloatPointer(bus, "EngineRPM"),
+		EngineHours:        getFloatPointer(bus, "EngineHours"),
+		EngineLoad:         getFloatPointer(bus, "EngineLoad"),
+		VehicleSpeed:       getFloatPointer(bus, "VehicleSpeed"),
+		CoolantTemperature: getFloatPointer(bus, "CoolantTemperature"),
+		ThrottlePosition:   getFloatPointer(bus, "ThrottlePosition"),
+		AcceleratorPedal:   getFloatPointer(bus, "AcceleratorPedal"),
+		Range:              getFloatPointer(bus, "Range"),
+		PowerVoltage:       getFloatPointer(bus, "PowerVoltage"),
+		MILStatus:          getFloatPointer(bus, "MILStatus"),
+		DTCCount:           getFloatPointer(bus, "DTCCount"),
+		DTCs:               getStringPointer(bus, "DTCs"),
+	}
+}
+
 // 📌 Constructor de IoPortsStatus que asigna valores por defecto en 0 si no existen en el JSON
 func extractIoPortsStatus(packetMap map[string]interface{}) *models.IoPortsStatus {
 	return &models.IoPortsStatus{
@@ -0,0 +1,55 @@
+package config
+
+// ReportEvents maps every Queclink report to its canonical event code,
+// the same codes the Meitrack based interpreters emit
+var ReportEvents = map[string]CodeModel{
+	"GTFRI": {Code: 35, Name: "Track By Time Interval"},
+	"GTERI": {Code: 35, Name: "Track By Time Interval"},
+	"GTCAN": {Code: 35, Name: "Track By Time Interval"},
+	"GTOBD": {Code: 35, Name: "Track By Time Interval"},
+	"GTRTL": {Code: 34, Name: "Reply Current (Passive)"},
+	"GTSOS": {Code: 1, Name: "SOS Pressed"},
+	"GTIGN": {Code: 2, Name: "Input 2 Active"},
+	"GTIGF": {Code: 10, Name: "Input 2 Inactive"},
+	"GTSPD": {Code: 19, Name: "Speeding"},
+	"GTGEO": {Code: 20, Name: "Enter Geo-fence"},
+	"GTMPN": {Code: 22, Name: "External Battery On"},
+	"GTMPF": {Code: 23, Name: "External Battery Cut"},
+	"GTBPL": {Code: 17, Name: "Low Battery"},
+	"GTEPS": {Code: 18, Name: "Low External Battery"},
+	"GTPNA": {Code: 29, Name: "Device Reboot"},
+	"GTPFA": {Code: 40, Name: "Power Off"},
+	"GTTOW": {Code: 36, Name: "Tow"},
+	"GTIDA": {Code: 37, Name: "iButton/RFID"},
+	"GTTEM": {Code: 50, Name: "Temperature High"},
+	"GTHBM": {Code: 129, Name: "Harsh Braking"},
+	"GTSTT": {Code: 42, Name: "Start Moving"},
+	"GTDOG": {Code: 29, Name: "Device Reboot"},
+}
+
+// ReportTypeEvents refines ReportEvents by <ReportType> (or <State> for GTSTT)
+var ReportTypeEvents = map[string]map[string]CodeModel{
+	"GTGEO": {
+		"0": {Code: 21, Name: "Exit Geo-fence"},
+		"1": {Code: 20, Name: "Enter Geo-fence"},
+	},
+	"GTHBM": {
+		"0": {Code: 129, Name: "Harsh Braking"},
+		"1": {Code: 130, Name: "Harsh Acceleration"},
+		"2": {Code: 32, Name: "Cornering"},
+	},
+	"GTTEM": {
+		"0": {Code: 51, Name: "Temperature Low"},
+		"2": {Code: 50, Name: "Temperature High"},
+	},
+	"GTSTT": {
+		"11": {Code: 41, Name: "Stop Moving"},  // Ignition off, rest
+		"12": {Code: 42, Name: "Start Moving"}, // Ignition off, moving
+		"16": {Code: 36, Name: "Tow"},
+		"1A": {Code: 36, Name: "Tow"},          // Fake tow
+		"21": {Code: 41, Name: "Stop Moving"},  // Ignition on, rest
+		"22": {Code: 42, Name: "Start Moving"}, // Ignition on, moving
+		"41": {Code: 41, Name: "Stop Moving"},  // Sensor rest
+		"42": {Code: 42, Name: "Start Moving"}, // Sensor motion
+	},
+}
@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// frameCountNumber returns the protocol version and the trailing count number of a frame
+func frameCountNumber(frame string) (string, string, error) {
+	if IsBinaryFrame(frame) {
+		count := BinaryCountNumber(frame)
+		if count == "" {
+			return "", "", fmt.Errorf("invalid queclink binary frame: missing count number")
+		}
+		return "", count, nil
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimSpace(frame), "$"), ",")
+	if len(parts) < 3 {
+		return "", "", fmt.Errorf("invalid queclink frame: too few fields (%d)", len(parts))
+	}
+	count := parts[len(parts)-1]
+	if count == "" {
+		return "", "", fmt.Errorf("invalid queclink frame: missing count number")
+	}
+	return parts[1], count, nil
+}
+
+// HeartbeatAck builds the +SACK:GTHBD reply for a +ACK:GTHBD heartbeat.
+// Heartbeat: +ACK:GTHBD,<protocol version>,<imei>,<device name>,<send time>,<count number>$
+// Reply:     +SACK:GTHBD,<protocol version>,<count number>$
+func HeartbeatAck(frame string) (string, error) {
+	version, count, err := frameCountNumber(frame)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("+SACK:GTHBD,%s,%s$", version, count), nil
+}
+
+// ReportAck builds the optional +SACK:<count number>$ reply for a +RESP/+BUFF report
+func ReportAck(frame string) (string, error) {
+	_, count, err := frameCountNumber(frame)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("+SACK:%s$", count), nil
+}
+
+// SackPolicy decides which devices get a +SACK for every report.
+// It is configured with "all" or a comma separated list of IMEIs.
+type SackPolicy struct {
+	all   bool
+	imeis map[string]bool
+}
+
+// NewSackPolicy parses a SACK configuration value (e.g. QUECLINK_SACK_IMEIS)
+func NewSackPolicy(value string) *SackPolicy {
+	policy := &SackPolicy{imeis: make(map[string]bool)}
+	for _, imei := range strings.Split(value, ",") {
+		imei = strings.TrimSpace(imei)
+		if strings.EqualFold(imei, "all") {
+			policy.all = true
+		} else if imei != "" {
+			policy.imeis[imei] = true
+		}
+	}
+	return policy
+}
+
+// Enabled reports whether reports from the given IMEI should be acknowledged
+func (p *SackPolicy) Enabled(imei string) bool {
+	return p.all || p.imeis[imei]
+}
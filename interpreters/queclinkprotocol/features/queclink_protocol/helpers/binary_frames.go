@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+// Binary (HEX) report framing:
+// <Header>(4) <Message ID>(1) <Report Mask>(4) <Length>(2) [<Device Type>(1)] [<Protocol Version>(2)]
+// [<Firmware Version>(2)] <IMEI>(8, BCD) ... <Send Time>(7) <Count Number>(2) <Tail>(2, "\r\n")
+const (
+	BinaryFixedLength = 11 // header + message id + report mask + length
+	BinaryIMEILength  = 8
+)
+
+// BinaryHeaders are the headers of binary reports (+BSP/+BVT are buffered)
+var BinaryHeaders = []string{"+RSP", "+BSP", "+EVT", "+BVT"}
+
+// BinaryTail ends every binary frame
+const BinaryTail = "\r\n"
+
+// IsBinaryFrame reports whether data starts with a binary report header
+func IsBinaryFrame(data string) bool {
+	if len(data) < BinaryFixedLength {
+		return false
+	}
+	for _, header := range BinaryHeaders {
+		if strings.HasPrefix(data, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// BinaryFrameLength returns the <Length> of a binary frame, the whole frame including the tail
+func BinaryFrameLength(frame string) int {
+	return int(binary.BigEndian.Uint16([]byte(frame[9:11])))
+}
+
+// BinaryReportMask returns the <Report Mask> of a binary frame
+func BinaryReportMask(frame string) uint32 {
+	return binary.BigEndian.Uint32([]byte(frame[5:9]))
+}
+
+// BinaryIMEIOffset returns where the IMEI starts, after the optional device and version fields
+func BinaryIMEIOffset(mask uint32) int {
+	offset := BinaryFixedLength
+	if mask&(1<<0) != 0 {
+		offset += 1 // Device type
+	}
+	if mask&(1<<1) != 0 {
+		offset += 2 // Protocol version
+	}
+	if mask&(1<<2) != 0 {
+		offset += 2 // Firmware version
+	}
+	return offset
+}
+
+// BinaryIMEI decodes the BCD IMEI of a binary frame (16 digits, the first one is padding)
+func BinaryIMEI(frame string) string {
+	offset := BinaryIMEIOffset(BinaryReportMask(frame))
+	if offset+BinaryIMEILength > len(frame) {
+		return ""
+	}
+	return hex.EncodeToString([]byte(frame[offset : offset+BinaryIMEILength]))[1:]
+}
+
+// BinaryCountNumber returns the <Count Number> of a binary frame as the 4 hex digits ASCII reports use
+func BinaryCountNumber(frame string) string {
+	end := len(frame) - len(BinaryTail)
+	if end-2 < BinaryFixedLength {
+		return ""
+	}
+	return strings.ToUpper(hex.EncodeToString([]byte(frame[end-2 : end])))
+}
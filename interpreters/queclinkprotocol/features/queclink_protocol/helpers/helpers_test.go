@@ -46,3 +46,95 @@ func TestParseDatetime(t *testing.T) {
 		t.Fatalf("expected error for invalid input length, got nil")
 	}
 }
+
+func TestSplitFrames(t *testing.T) {
+	data := "+RESP:GTFRI,300400,860201061234567,,0,0,1,1,0.0,0,0.0,0.0,0.0,,,,,,,,20240101120000,0001$" +
+		"+BUFF:GTFRI,300400,860201061234567,,0,0,1,1,0.0,0,0.0,0.0,0.0,,,,,,,,20240101115500,0002$\r\n"
+
+	frames := SplitFrames(data)
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+	if frames[0][:11] != "+RESP:GTFRI" || frames[1][:11] != "+BUFF:GTFRI" {
+		t.Errorf("unexpected frames: %v", frames)
+	}
+	if frames[1][len(frames[1])-1] != '$' {
+		t.Errorf("expected frame to keep its trailing '$', got %s", frames[1])
+	}
+	if imei := FrameIMEI(frames[0]); imei != "860201061234567" {
+		t.Errorf("expected IMEI 860201061234567, got %s", imei)
+	}
+
+	if frames := SplitFrames("garbage"); len(frames) != 0 {
+		t.Errorf("expected no frames, got %v", frames)
+	}
+}
+
+func TestSplitBinaryFrames(t *testing.T) {
+	// +RSP GTFRI with device type, protocol version and a '$' (0x24) inside the payload
+	binaryFrame := "+RSP\x01\x00\x00\x00\x03\x00\x22\x30\x04\x00\x08\x60\x20\x10\x61\x23\x45\x67" +
+		"\x24\x07\xE8\x01\x01\x0C\x00\x00\x00\x2A\r\n"
+	data := binaryFrame + "+RESP:GTFRI,300400,860201061234567,,0,0,1,1,0.0,0,0.0,0.0,0.0,,,,,,,,20240101120000,0001$"
+
+	frames := SplitFrames(data)
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+	if frames[0] != binaryFrame {
+		t.Errorf("expected the binary frame to be cut by its length, got %q", frames[0])
+	}
+	if imei := FrameIMEI(frames[0]); imei != "860201061234567" {
+		t.Errorf("expected IMEI 860201061234567, got %s", imei)
+	}
+	ack, err := ReportAck(frames[0])
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ack != "+SACK:002A$" {
+		t.Errorf("expected +SACK:002A$, got %s", ack)
+	}
+
+	// A partial binary frame waits for the rest of the data
+	if frames := SplitFrames(binaryFrame[:20]); len(frames) != 0 {
+		t.Errorf("expected no frames, got %q", frames)
+	}
+}
+
+func TestHeartbeatAck(t *testing.T) {
+	ack, err := HeartbeatAck("+ACK:GTHBD,060100,135790246811220,,20100214093254,11F0$")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ack != "+SACK:GTHBD,060100,11F0$" {
+		t.Errorf("expected +SACK:GTHBD,060100,11F0$, got %s", ack)
+	}
+
+	if _, err := HeartbeatAck("+ACK:GTHBD$"); err == nil {
+		t.Errorf("expected error for truncated heartbeat, got nil")
+	}
+}
+
+func TestReportAck(t *testing.T) {
+	ack, err := ReportAck("+BUFF:GTFRI,300400,860201061234567,,0,0,1,1,0.0,0,0.0,0.0,0.0,,,,,,,,20240101115500,0002$")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ack != "+SACK:0002$" {
+		t.Errorf("expected +SACK:0002$, got %s", ack)
+	}
+}
+
+func TestSackPolicy(t *testing.T) {
+	if NewSackPolicy("").Enabled("860201061234567") {
+		t.Errorf("expected SACK disabled by default")
+	}
+
+	policy := NewSackPolicy("860201061234567, 860201069999999")
+	if !policy.Enabled("860201069999999") || policy.Enabled("860201060000000") {
+		t.Errorf("expected SACK only for the listed IMEIs")
+	}
+
+	if !NewSackPolicy("ALL").Enabled("860201060000000") {
+		t.Errorf("expected SACK for every IMEI with \"all\"")
+	}
+}
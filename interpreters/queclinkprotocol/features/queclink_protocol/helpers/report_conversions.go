@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversions for ASCII report fields. They return nil for empty or invalid
+// values so the field is left out of the packet.
+
+// StringValue keeps a field as reported
+func StringValue(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// NumericValue parses a decimal field, dropping unit prefixes/suffixes such as
+// "H" (distance), "L"/"P" (fuel level in litres/percent) or "L/100km"
+func NumericValue(value string) any {
+	value = strings.TrimFunc(value, func(r rune) bool {
+		return !(r >= '0' && r <= '9') && r != '-' && r != '.'
+	})
+	if value == "" {
+		return nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return number
+}
+
+// MilliVolts converts a voltage in mV to volts
+func MilliVolts(value string) any {
+	number, ok := NumericValue(value).(float64)
+	if !ok {
+		return nil
+	}
+	return number / 1000
+}
+
+// OneWireTemperature converts 1-wire sensor data (signed 16-bit hex, 1/16 °C) to °C
+func OneWireTemperature(value string) any {
+	raw, err := strconv.ParseUint(value, 16, 16)
+	if err != nil {
+		return nil
+	}
+	return float64(int16(raw)) / 16
+}
+
+// HourMeterSeconds converts an hour meter count "HHHHH:MM:SS" to seconds
+func HourMeterSeconds(value string) any {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return nil
+	}
+	seconds := 0
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		seconds = seconds*60 + number
+	}
+	return seconds
+}
+
+// ReportTime converts a report time "YYYYMMDDHHMMSS" (UTC) to RFC3339
+func ReportTime(value string) any {
+	timestamp, err := time.Parse("20060102150405", value)
+	if err != nil {
+		return nil
+	}
+	return timestamp.Format(time.RFC3339)
+}
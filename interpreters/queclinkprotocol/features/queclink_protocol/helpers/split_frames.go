@@ -0,0 +1,47 @@
+package helpers
+
+import "strings"
+
+// SplitFrames splits a TCP payload that may carry several concatenated
+// Queclink messages ("+RESP:...$+BUFF:...$") into individual frames.
+// Every returned ASCII frame keeps its trailing '$'; anything that does not
+// start with '+' (line noise, partial frames) is dropped.
+// Binary frames are cut by their <Length> field, since their payload may contain '$'.
+func SplitFrames(data string) []string {
+	var frames []string
+	for data != "" {
+		data = strings.TrimLeft(data, " \t\r\n")
+		if IsBinaryFrame(data) {
+			length := BinaryFrameLength(data)
+			if length < BinaryFixedLength || length > len(data) {
+				break // Partial binary frame
+			}
+			frames = append(frames, data[:length])
+			data = data[length:]
+			continue
+		}
+
+		part := data
+		data = ""
+		if end := strings.IndexByte(part, '$'); end >= 0 {
+			part, data = part[:end], part[end+1:]
+		}
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "+") {
+			frames = append(frames, part+"$")
+		}
+	}
+	return frames
+}
+
+// FrameIMEI returns the IMEI of a Queclink frame (third comma-separated field of an ASCII frame)
+func FrameIMEI(frame string) string {
+	if IsBinaryFrame(frame) {
+		return BinaryIMEI(frame)
+	}
+	parts := strings.Split(frame, ",")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
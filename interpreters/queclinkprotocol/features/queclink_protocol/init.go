@@ -3,8 +3,8 @@ package queclink_protocol
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
+	"queclinkprotocol/features/queclink_protocol/helpers"
 	"queclinkprotocol/features/queclink_protocol/models"
 	"queclinkprotocol/features/queclink_protocol/usecases"
 
@@ -12,104 +12,39 @@ import (
 )
 
 func Initialize(data string) (string, error) {
-	model := models.IdentifyModel(data)
-	if model != "" {
-		utils.VPrint("Identified model: %s\n", model)
-
-		switch model {
-		case "300":
-			// Handle Queclink 300 model
-			dataParsed, err := usecases.ParseQueclink300Fields(data)
-			if err != nil {
-				return "", fmt.Errorf("error: model 300 - %v - data %s", err, data)
-			}
-
-			utils.VPrint("Parsed Queclink 300 Data:\n")
-			utils.VPrint("  Device Type: %s\n", dataParsed.DeviceType)
-			utils.VPrint("  Device Version: %s\n", dataParsed.DeviceVersion)
-			utils.VPrint("  IMEI: %s\n", dataParsed.IMEI)
-			utils.VPrint("  Message Type: %s\n", dataParsed.MessageType)
-			utils.VPrint("  Event Code: %s\n", dataParsed.EventCode)
-			utils.VPrint("  Timestamp: %s\n", dataParsed.Timestamp.Format(time.RFC3339))
-			utils.VPrint("  Latitude: %.6f\n", dataParsed.Latitude)
-			utils.VPrint("  Longitude: %.6f\n", dataParsed.Longitude)
-			utils.VPrint("  Speed: %.2f km/h\n", dataParsed.Speed)
-			utils.VPrint("  Heading: %.2f degrees\n", dataParsed.Heading)
-			utils.VPrint("  Satellites: %d\n", dataParsed.Satellites)
-			utils.VPrint("  Ignition: %v\n", dataParsed.Ignition)
-			utils.VPrint("  Battery Level: %.2f V\n", dataParsed.BatteryLevel)
-			utils.VPrint("  External Power: %.2f V\n", dataParsed.ExternalPower)
-
-			dataJSON, err := json.Marshal(dataParsed)
-			if err != nil {
-				return "", fmt.Errorf("error marshaling Queclink 300 data: %v", err)
-			}
-			return string(dataJSON), nil
-
-		case "320":
-			// Handle Queclink 320 model
-			dataParsed, err := usecases.ParseQueclink320Fields(data)
-			if err != nil {
-				return "", fmt.Errorf("error: model 320 - %v - data %s", err, data)
-			}
-
-			utils.VPrint("Parsed Queclink 320 Data:\n")
-			utils.VPrint("  Device Type: %s\n", dataParsed.DeviceType)
-			utils.VPrint("  Device Version: %s\n", dataParsed.DeviceVersion)
-			utils.VPrint("  IMEI: %s\n", dataParsed.IMEI)
-			utils.VPrint("  Message Type: %s\n", dataParsed.MessageType)
-			utils.VPrint("  Event Code: %s\n", dataParsed.EventCode)
-			utils.VPrint("  Timestamp: %s\n", dataParsed.Timestamp.Format(time.RFC3339))
-			utils.VPrint("  Latitude: %.6f\n", dataParsed.Latitude)
-			utils.VPrint("  Longitude: %.6f\n", dataParsed.Longitude)
-			utils.VPrint("  Speed: %.2f km/h\n", dataParsed.Speed)
-			utils.VPrint("  Heading: %.2f degrees\n", dataParsed.Heading)
-			utils.VPrint("  Satellites: %d\n", dataParsed.Satellites)
-			utils.VPrint("  HDOP: %.2f\n", dataParsed.HDOP)
-			utils.VPrint("  Altitude: %.2f m\n", dataParsed.Altitude)
-			utils.VPrint("  Ignition: %v\n", dataParsed.Ignition)
-			utils.VPrint("  Battery Level: %.2f V\n", dataParsed.BatteryLevel)
-			utils.VPrint("  External Power: %.2f V\n", dataParsed.ExternalPower)
-			utils.VPrint("  Input Status: %d\n", dataParsed.InputStatus)
-			utils.VPrint("  Output Status: %d\n", dataParsed.OutputStatus)
-
-			dataJSON, err := json.Marshal(dataParsed)
-			if err != nil {
-				return "", fmt.Errorf("error marshaling Queclink 320 data: %v", err)
-			}
-			return string(dataJSON), nil
+	if helpers.IsBinaryFrame(data) {
+		// Binary (HEX) reports are decoded into their ASCII form, so both produce the same output
+		ascii, err := usecases.DecodeBinaryReport([]byte(data))
+		if err != nil {
+			return "", fmt.Errorf("error: binary report - %v - data %X", err, data)
+		}
+		utils.VPrint("Binary report decoded as: %s\n", ascii)
+		data = ascii
+	}
 
-		case "350":
-			// Handle Queclink 350 model
-			dataParsed, err := usecases.ParseQueclink350Fields(data)
-			if err != nil {
-				return "", fmt.Errorf("error: model 350 - %v - data %s", err, data)
-			}
+	model := models.IdentifyModel(data)
+	if model == "" {
+		fmt.Println("Could not identify model from data")
+		return "", fmt.Errorf("no valid model identified from data: %s", data)
+	}
+	utils.VPrint("Identified model: %s\n", model)
 
-			utils.VPrint("Parsed Queclink 350 Data:\n")
-			utils.VPrint("  Device Type: %s\n", dataParsed.DeviceType)
-			utils.VPrint("  Device Version: %s\n", dataParsed.DeviceVersion)
-			utils.VPrint("  IMEI: %s\n", dataParsed.IMEI)
-			utils.VPrint("  Message Type: %s\n", dataParsed.MessageType)
-			utils.VPrint("  Event Code: %s\n", dataParsed.EventCode)
-			utils.VPrint("  Timestamp: %s\n", dataParsed.Timestamp.Format(time.RFC3339))
-			utils.VPrint("  Latitude: %.6f\n", dataParsed.Latitude)
-			utils.VPrint("  Longitude: %.6f\n", dataParsed.Longitude)
-			utils.VPrint("  Speed: %.2f km/h\n", dataParsed.Speed)
-			utils.VPrint("  Heading: %.2f degrees\n", dataParsed.Heading)
-			utils.VPrint("  Satellites: %d\n", dataParsed.Satellites)
-			utils.VPrint("  Ignition: %v\n", dataParsed.Ignition)
-			utils.VPrint("  Battery Level: %.2f V\n", dataParsed.BatteryLevel)
-			utils.VPrint("  External Power: %.2f V\n", dataParsed.ExternalPower)
+	dataParsed, err := usecases.ParseReport(data)
+	if err != nil {
+		return "", fmt.Errorf("error: model %s - %v - data %s", model, err, data)
+	}
 
-			dataJSON, err := json.Marshal(dataParsed)
-			if err != nil {
-				return "", fmt.Errorf("error marshaling Queclink 350 data: %v", err)
-			}
-			return string(dataJSON), nil
-		}
-	} else {
-		fmt.Println("Could not identify model from data")
+	utils.VPrint("Parsed Queclink %s Data:\n", dataParsed.ReportName)
+	utils.VPrint("  Device: %s (%s)\n", model, dataParsed.DeviceFamily)
+	utils.VPrint("  Protocol Version: %s\n", dataParsed.ProtocolVersion)
+	utils.VPrint("  IMEI: %s\n", dataParsed.IMEI)
+	utils.VPrint("  Message Type: %s\n", dataParsed.MessageType)
+	utils.VPrint("  Send Time: %s\n", dataParsed.SendTime)
+	utils.VPrint("  Positions: %d\n", dataParsed.DataPackets)
+
+	dataJSON, err := json.Marshal(dataParsed)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling Queclink %s data: %v", dataParsed.ReportName, err)
 	}
-	return "", fmt.Errorf("no valid model identified from data: %s", data)
+	return string(dataJSON), nil
 }
@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"queclinkprotocol/features/jono"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -136,3 +138,55 @@ func TestInitializeWithBinaryFile(t *testing.T) {
 
 	assert.Equal(t, expectedData, resultMap, "El resultado no coincide con el esperado")
 }
+
+func TestInitializeMultiPositionJono(t *testing.T) {
+	testData := "+RESP:GTERI,300400,860201061234567,,00000004,12500,10,2," +
+		"1,10.5,90,2240.5,-99.211608,19.521010,20240101115900,0334,0020,025A,00ABCDEF,00," +
+		"1,20.0,180,2241.0,-99.211000,19.522000,20240101120000,0334,0020,025A,00ABCDEF,00," +
+		"1234.5,00010:30:00,,,,100,220100,0,1,00000031,1HGCM82633A004352,1500,60,20240101120001,0001$"
+
+	result, err := Initialize(testData)
+	assert.NoError(t, err)
+
+	jonoResult, err := jono.Initialize(result)
+	assert.NoError(t, err)
+
+	var parsed struct {
+		IMEI        string
+		DataPackets int
+		ListPackets map[string]map[string]interface{}
+	}
+	assert.NoError(t, json.Unmarshal([]byte(jonoResult), &parsed))
+	assert.Equal(t, "860201061234567", parsed.IMEI)
+	assert.Equal(t, 2, parsed.DataPackets)
+	assert.Len(t, parsed.ListPackets, 2)
+
+	first := parsed.ListPackets["packet_1"]
+	second := parsed.ListPackets["packet_2"]
+	assert.Equal(t, "2024-01-01T11:59:00Z", first["Datetime"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", second["Datetime"])
+	assert.Equal(t, map[string]interface{}{"Code": float64(35), "Name": "Track By Time Interval"}, second["EventCode"])
+	assert.Equal(t, float64(1234500), second["Mileage"])
+	assert.Equal(t, map[string]interface{}{"VIN": "1HGCM82633A004352", "EngineRPM": float64(1500), "VehicleSpeed": float64(60)}, second["VehicleBus"])
+}
+
+func TestInitializeBinaryMatchesASCII(t *testing.T) {
+	ascii := "+RESP:GTSTT,300400,860201061234567,,22," +
+		"1,20.0,180,2241.0,-99.211000,19.522000,20240101120000,0334,0020,025A,00ABCDEF,," +
+		"20240101120001,0001$"
+	binary := "+RSP\x07\x00\x00\x00\x0B\x00\x44\x30\x04\x00\x08\x60\x20\x10\x61\x23\x45\x67\x22" +
+		"\x01\x00\xC8\x00\xB4\x00\x00\x57\x8A\xFA\x16\x29\x08\x01\x29\xE1\xD0\x07\xE8\x01\x01\x0C\x00\x00\x01\x4E\x00\x14\x02\x5A\x00\xAB\xCD\xEF\x07\xE8\x01\x01\x0C" +
+		"\x00\x01\x00\x01\r\n"
+
+	expected, err := Initialize(ascii)
+	assert.NoError(t, err)
+	result, err := Initialize(binary)
+	assert.NoError(t, err)
+	assert.JSONEq(t, expected, result)
+
+	expectedJono, err := jono.Initialize(expected)
+	assert.NoError(t, err)
+	resultJono, err := jono.Initialize(result)
+	assert.NoError(t, err)
+	assert.JSONEq(t, expectedJono, resultJono)
+}
@@ -0,0 +1,140 @@
+package models
+
+// BinaryMessageTypes maps a binary report header to the ASCII message type it stands for
+var BinaryMessageTypes = map[string]string{
+	"+RSP": "+RESP",
+	"+EVT": "+RESP",
+	"+BSP": "+BUFF",
+	"+BVT": "+BUFF",
+}
+
+// BinaryReports maps the <Message ID> of a binary frame to its report
+var BinaryReports = map[byte]string{
+	0x01: "GTFRI",
+	0x02: "GTERI",
+	0x03: "GTCAN",
+	0x04: "GTOBD",
+	0x05: "GTTEM",
+	0x06: "GTIDA",
+	0x07: "GTSTT",
+	0x10: "GTSOS",
+	0x11: "GTSPD",
+	0x12: "GTGEO",
+	0x13: "GTRTL",
+	0x14: "GTTOW",
+	0x15: "GTHBM",
+	0x16: "GTDOG",
+	0x20: "GTIGN",
+	0x21: "GTIGF",
+	0x22: "GTMPN",
+	0x23: "GTMPF",
+	0x24: "GTBPL",
+	0x25: "GTEPS",
+	0x26: "GTPNA",
+	0x27: "GTPFA",
+}
+
+// Report mask bits of a binary frame
+const (
+	BinaryMaskDeviceType      = 0
+	BinaryMaskProtocolVersion = 1
+	BinaryMaskFirmwareVersion = 2
+	BinaryMaskCellInfo        = 3 // <MCC>,<MNC>,<LAC>,<Cell ID> in every position block
+)
+
+// BinaryOptionalFields maps report fields to the report mask bit that includes them.
+// Fields not listed here are always present.
+var BinaryOptionalFields = map[string]uint{
+	"Mileage":       4,
+	"HourMeter":     5,
+	"AD1":           6,
+	"AD2":           6,
+	"AD3":           6,
+	"BackupBattery": 7,
+	"DeviceStatus":  8,
+}
+
+// Binary field formats
+const (
+	BinaryDecimal   = "dec"       // Unsigned/signed integer, divided by 10^Scale
+	BinaryHex       = "hex"       // Bytes as upper case hex digits
+	BinaryText      = "text"      // 1 byte length + ASCII
+	BinaryHexText   = "hextext"   // 1 byte length + bytes as upper case hex digits
+	BinaryTime      = "time"      // Year(2) month day hour minute second
+	BinaryHourMeter = "hourmeter" // uint32 seconds, as "HHHHH:MM:SS"
+)
+
+// BinaryField describes how a field is encoded in a binary frame
+type BinaryField struct {
+	Size   int    // Bytes, 0 for length-prefixed formats
+	Format string // One of the Binary* formats
+	Scale  int    // Decimal places of BinaryDecimal values
+	Signed bool   // BinaryDecimal values are two's complement
+	Width  int    // Zero padding of BinaryDecimal values
+}
+
+// Common encodings
+var (
+	binaryUint8      = BinaryField{Size: 1, Format: BinaryDecimal}
+	binaryUint16     = BinaryField{Size: 2, Format: BinaryDecimal}
+	binaryUint32     = BinaryField{Size: 4, Format: BinaryDecimal}
+	binaryHundredths = BinaryField{Size: 4, Format: BinaryDecimal, Scale: 2, Signed: true}
+	binaryTextField  = BinaryField{Format: BinaryText}
+)
+
+// BinaryPositionFields gives the encoding of every field of PositionFields.
+// MCC, MNC, LAC and Cell ID are only present with BinaryMaskCellInfo; Reserved is never sent.
+var BinaryPositionFields = map[string]BinaryField{
+	"GPSAccuracy": binaryUint8,
+	"Speed":       {Size: 2, Format: BinaryDecimal, Scale: 1},
+	"Azimuth":     binaryUint16,
+	"Altitude":    {Size: 4, Format: BinaryDecimal, Scale: 1, Signed: true},
+	"Longitude":   {Size: 4, Format: BinaryDecimal, Scale: 6, Signed: true},
+	"Latitude":    {Size: 4, Format: BinaryDecimal, Scale: 6, Signed: true},
+	"GPSUTCTime":  {Size: 7, Format: BinaryTime},
+	"MCC":         {Size: 2, Format: BinaryDecimal, Width: 4},
+	"MNC":         {Size: 2, Format: BinaryDecimal, Width: 4},
+	"LAC":         {Size: 2, Format: BinaryHex},
+	"CellID":      {Size: 4, Format: BinaryHex},
+}
+
+// BinaryReportFields gives the encoding of the header, tail and trailer fields of ReportLayouts.
+// Reserved fields are never sent.
+var BinaryReportFields = map[string]BinaryField{
+	"ExternalPower":         binaryUint16, // mV
+	"ReportIDType":          {Size: 1, Format: BinaryHex},
+	"ReportID":              binaryUint8,
+	"ReportType":            binaryUint8,
+	"State":                 {Size: 1, Format: BinaryHex},
+	"ERIMask":               {Size: 4, Format: BinaryHex},
+	"DriverID":              {Format: BinaryHexText},
+	"IgnitionOffDuration":   binaryUint32,
+	"IgnitionOnDuration":    binaryUint32,
+	"BackupBatteryVoltage":  {Size: 2, Format: BinaryDecimal, Scale: 2},
+	"Mileage":               {Size: 4, Format: BinaryDecimal, Scale: 1},
+	"HourMeter":             {Size: 4, Format: BinaryHourMeter},
+	"AD1":                   binaryUint16, // mV
+	"AD2":                   binaryUint16,
+	"AD3":                   binaryUint16,
+	"BackupBattery":         binaryUint8, // %
+	"DeviceStatus":          {Size: 3, Format: BinaryHex},
+	"UARTDeviceType":        binaryUint8,
+	"TemperatureSensorID":   {Format: BinaryHexText},
+	"TemperatureSensorType": binaryUint8,
+	"Temperature":           {Size: 2, Format: BinaryHex},
+	"SendTime":              {Size: 7, Format: BinaryTime},
+	"CountNumber":           {Size: 2, Format: BinaryHex},
+}
+
+// Binary encodings of the mask-driven (ERI/CAN/OBD) data
+var (
+	BinaryFuelSensor      = BinaryField{Size: 2, Format: BinaryHex}
+	BinaryOneWireCount    = binaryUint8
+	BinaryOneWireID       = BinaryField{Format: BinaryHexText}
+	BinaryOneWireType     = binaryUint8
+	BinaryOneWireData     = BinaryField{Size: 2, Format: BinaryHex}
+	BinaryCANDeviceState  = binaryUint8
+	BinaryVehicleBusMask  = BinaryField{Size: 4, Format: BinaryHex}
+	BinaryVehicleBusValue = binaryHundredths
+	BinaryVehicleBusText  = binaryTextField
+)
@@ -2,37 +2,40 @@ package models
 
 import "strings"
 
-// IdentifyModel determines which queclink model the data is from
-
+// IdentifyModel determines which queclink device sent a +RESP/+BUFF report.
+// Device types missing from DeviceTypes are reported as "Queclink <type>".
 func IdentifyModel(data string) string {
 	if data == "" {
 		return ""
 	}
 
-	// Split data by comma as shown in the example code
 	parts := strings.Split(data, ",")
-	if len(parts) < 2 {
+	if len(parts) < 2 || len(parts[1]) < 2 {
 		return ""
 	}
 
 	// Check message type first
 	messageType := parts[0]
-	if strings.HasPrefix(messageType, "+RESP") || strings.HasPrefix(messageType, "+BUFF") {
-		// Extract device type from first 2 characters of the second part
-		if len(parts[1]) >= 2 {
-			deviceType := parts[1][:2]
+	if !strings.HasPrefix(messageType, "+RESP") && !strings.HasPrefix(messageType, "+BUFF") {
+		return ""
+	}
 
-			// Check for valid device types
-			switch deviceType {
-			case "30": // For model 300
-				return "300"
-			case "32": // For model 320
-				return "320"
-			case "35": // For model 350
-				return "350"
-			}
-		}
+	// The first byte of <ProtocolVersion> is the device type
+	deviceType := strings.ToUpper(parts[1][:2])
+	if device, exists := DeviceTypes[deviceType]; exists {
+		return device.Model
 	}
+	return "Queclink " + deviceType
+}
+
+// IsHeartbeat reports whether the data is a +ACK:GTHBD heartbeat, which the
+// device sends in TCP long-connection mode and expects a +SACK:GTHBD reply for
+func IsHeartbeat(data string) bool {
+	return strings.HasPrefix(data, "+ACK:GTHBD")
+}
 
-	return ""
+// IsBuffered reports whether the data is a +BUFF report, i.e. a historical
+// report the device stored while it had no connection
+func IsBuffered(data string) bool {
+	return strings.HasPrefix(data, "+BUFF")
 }
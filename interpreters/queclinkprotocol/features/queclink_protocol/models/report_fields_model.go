@@ -0,0 +1,18 @@
+package models
+
+// QueclinkReportModel is the parsed form of a +RESP/+BUFF report. Every position
+// carried by the report becomes one entry of ListPackets ("packet_1", "packet_2", ...)
+type QueclinkReportModel struct {
+	IMEI            string
+	Message         string
+	MessageType     string // +RESP or +BUFF
+	ReportName      string // GTFRI, GTERI, ...
+	ProtocolVersion string
+	DeviceModel     string
+	DeviceFamily    string
+	DeviceName      string
+	SendTime        string
+	CountNumber     string
+	DataPackets     int
+	ListPackets     map[string]any
+}
@@ -0,0 +1,233 @@
+package models
+
+import "queclinkprotocol/features/queclink_protocol/helpers"
+
+// Device families share the same report layouts
+const (
+	FamilyVehicle  = "GV" // GV/GB vehicle trackers: <ExternalPowerVoltage>,<ReportID/ReportType> header
+	FamilyPersonal = "GL" // GL personal/asset trackers: <ReportID>,<ReportType> header
+)
+
+// DeviceType describes a device identified by the first byte of <ProtocolVersion>
+type DeviceType struct {
+	Model  string
+	Family string
+}
+
+// DeviceTypes maps the device type prefix of <ProtocolVersion> to a device.
+// Unknown device types are still parsed, their family is detected from the report layout.
+var DeviceTypes = map[string]DeviceType{
+	"30": {Model: "GV300W", Family: FamilyVehicle},
+	"32": {Model: "GL320M", Family: FamilyPersonal},
+	"35": {Model: "GV350M", Family: FamilyVehicle},
+}
+
+// PositionFields are the fields of one position block, repeated <Number> times in multi-position reports
+var PositionFields = []string{
+	"GPSAccuracy", "Speed", "Azimuth", "Altitude", "Longitude", "Latitude",
+	"GPSUTCTime", "MCC", "MNC", "LAC", "CellID", "Reserved",
+}
+
+// Where the position blocks are found in a report
+const (
+	PositionsNone     = iota // No position data (e.g. GTPNA)
+	PositionsSingle          // One position block right after the header
+	PositionsNumbered        // <Number> followed by Number position blocks (up to MaxPositions)
+	PositionsTrailing        // One position block before the trailer, after mask-driven data
+)
+
+// MaxPositions is the largest <Number> a report may carry
+const MaxPositions = 15
+
+// ReportLayout describes the fields of a +RESP/+BUFF report between <DeviceName> and <SendTime>
+type ReportLayout struct {
+	Header         []string   // Fields after <DeviceName>
+	PersonalHeader []string   // Header used instead by personal (GL) devices, if different
+	Positions      int        // Where the position blocks are
+	Tails          [][]string // Candidate layouts after the positions, picked by field count
+	Trailer        []string   // Fields between a trailing position block and <SendTime>
+	Extension      string     // Mask-driven data: "ERI", "CAN" or "OBD"
+}
+
+// HeaderFor returns the header fields used by a device family
+func (l ReportLayout) HeaderFor(family string) []string {
+	if family == FamilyPersonal && len(l.PersonalHeader) > 0 {
+		return l.PersonalHeader
+	}
+	return l.Header
+}
+
+// TailFor returns the tail a device family sends, for frames that do not carry their field count
+func (l ReportLayout) TailFor(family string) []string {
+	if len(l.Tails) == 0 {
+		return nil
+	}
+	if family == FamilyPersonal {
+		for _, tail := range l.Tails {
+			if len(tail) == 1 && tail[0] == "BackupBattery" {
+				return tail
+			}
+		}
+	}
+	return l.Tails[0]
+}
+
+// Common tails
+var (
+	mileageTail = []string{"Mileage"}
+
+	// GV300W/GV350M GTFRI and friends
+	vehicleTail = []string{"Mileage", "HourMeter", "AD1", "AD2", "AD3", "BackupBattery", "DeviceStatus", "Reserved", "Reserved", "Reserved"}
+
+	// GV devices with two analog inputs
+	vehicleTwoAnalogTail = []string{"Mileage", "HourMeter", "AD1", "AD2", "BackupBattery", "DeviceStatus", "Reserved", "Reserved", "Reserved"}
+
+	// GL devices only report the battery
+	personalTail = []string{"BackupBattery"}
+
+	// GTERI: vehicle tail up to the device status, then the UART device type and the ERI mask data
+	eriTail = []string{"Mileage", "HourMeter", "AD1", "AD2", "AD3", "BackupBattery", "DeviceStatus", "UARTDeviceType"}
+
+	// GTTEM: vehicle tail followed by the 1-wire sensor that raised the alarm
+	temTail = append(append([]string{}, vehicleTail...), "TemperatureSensorID", "TemperatureSensorType", "Temperature")
+
+	numberedAlarm = ReportLayout{Header: []string{"Reserved", "ReportIDType"}, Positions: PositionsNumbered, Tails: [][]string{mileageTail}}
+)
+
+// ReportLayouts lists the supported reports by their name (the part after "+RESP:")
+var ReportLayouts = map[string]ReportLayout{
+	"GTFRI": {
+		Header:         []string{"ExternalPower", "ReportIDType"},
+		PersonalHeader: []string{"ReportID", "ReportType"},
+		Positions:      PositionsNumbered,
+		Tails:          [][]string{vehicleTail, vehicleTwoAnalogTail, personalTail, mileageTail},
+	},
+	"GTERI": {
+		Header:    []string{"ERIMask", "ExternalPower", "ReportIDType"},
+		Positions: PositionsNumbered,
+		Tails:     [][]string{eriTail},
+		Extension: "ERI",
+	},
+	"GTTEM": {
+		Header:    []string{"ExternalPower", "ReportIDType"},
+		Positions: PositionsNumbered,
+		Tails:     [][]string{temTail},
+	},
+	"GTIDA": {
+		Header:    []string{"Reserved", "DriverID", "ReportType"},
+		Positions: PositionsNumbered,
+		Tails:     [][]string{mileageTail},
+	},
+	"GTSTT": {Header: []string{"State"}, Positions: PositionsSingle},
+	"GTIGN": {Header: []string{"IgnitionOffDuration"}, Positions: PositionsSingle, Tails: [][]string{{"HourMeter", "Mileage"}}},
+	"GTIGF": {Header: []string{"IgnitionOnDuration"}, Positions: PositionsSingle, Tails: [][]string{{"HourMeter", "Mileage"}}},
+	"GTCAN": {Header: []string{"ReportType"}, Positions: PositionsTrailing, Extension: "CAN"},
+	"GTOBD": {Header: []string{"ReportType"}, Positions: PositionsTrailing, Trailer: []string{"Mileage"}, Extension: "OBD"},
+	"GTMPN": {Positions: PositionsSingle},
+	"GTMPF": {Positions: PositionsSingle},
+	"GTBPL": {Header: []string{"BackupBatteryVoltage"}, Positions: PositionsSingle, Tails: [][]string{mileageTail}},
+	"GTEPS": {Header: []string{"ExternalPower", "ReportIDType"}, Positions: PositionsNumbered, Tails: [][]string{mileageTail}},
+	"GTPNA": {Positions: PositionsNone},
+	"GTPFA": {Positions: PositionsNone},
+	"GTSOS": numberedAlarm,
+	"GTSPD": numberedAlarm,
+	"GTGEO": numberedAlarm,
+	"GTRTL": numberedAlarm,
+	"GTTOW": numberedAlarm,
+	"GTHBM": numberedAlarm,
+	"GTDOG": numberedAlarm,
+}
+
+// MaskField is a field present in mask-driven data when its bit is set. Fields appear in bit order.
+type MaskField struct {
+	Bit        uint
+	Name       string
+	Conversion func(string) any
+	Text       bool // Sent as text in binary frames, numeric fields are sent as hundredths
+}
+
+// ERI mask bits (GTERI <ERI Mask>)
+const (
+	ERIDigitalFuelSensor = 0 // <Digit Fuel Sensor Data>
+	ERIOneWire           = 1 // <1-Wire Device Number>,{<Device ID>,<Device Type>,<Device Data>}
+	ERICANData           = 2 // <CAN Bus Device State>,<Report Mask>,<CAN fields>
+)
+
+// CANExpansionBit marks an <Expansion Mask> after the CAN fields, selecting CANExpansionFields
+const CANExpansionBit = 29
+
+// CANFields lists the GTCAN/ERI CAN fields selected by <Report Mask>
+var CANFields = []MaskField{
+	{Bit: 0, Name: "VIN", Conversion: helpers.StringValue, Text: true},
+	{Bit: 1, Name: "IgnitionKey", Conversion: helpers.NumericValue},   // 0 off, 1 on, 2 engine on
+	{Bit: 2, Name: "TotalDistance", Conversion: helpers.NumericValue}, // km
+	{Bit: 3, Name: "FuelUsed", Conversion: helpers.NumericValue},      // L
+	{Bit: 4, Name: "EngineRPM", Conversion: helpers.NumericValue},
+	{Bit: 5, Name: "VehicleSpeed", Conversion: helpers.NumericValue},       // km/h
+	{Bit: 6, Name: "CoolantTemperature", Conversion: helpers.NumericValue}, // °C
+	{Bit: 7, Name: "FuelConsumption", Conversion: helpers.NumericValue},    // L/100km
+	{Bit: 8, Name: "FuelLevel", Conversion: helpers.NumericValue},          // % ("P" prefix) or L ("L" prefix)
+	{Bit: 9, Name: "Range", Conversion: helpers.NumericValue},              // km
+	{Bit: 10, Name: "AcceleratorPedal", Conversion: helpers.NumericValue},  // %
+	{Bit: 11, Name: "EngineHours", Conversion: helpers.NumericValue},
+	{Bit: 12, Name: "DrivingTime", Conversion: helpers.NumericValue},
+	{Bit: 13, Name: "IdleTime", Conversion: helpers.NumericValue},
+	{Bit: 14, Name: "IdleFuelUsed", Conversion: helpers.NumericValue},
+	{Bit: 15, Name: "AxleWeight", Conversion: helpers.NumericValue},
+	{Bit: 16, Name: "TachographInformation", Conversion: helpers.StringValue, Text: true},
+	{Bit: 17, Name: "Indicators", Conversion: helpers.StringValue, Text: true},
+	{Bit: 18, Name: "Lights", Conversion: helpers.StringValue, Text: true},
+	{Bit: 19, Name: "Doors", Conversion: helpers.StringValue, Text: true},
+	{Bit: 20, Name: "OverspeedTime", Conversion: helpers.NumericValue},
+	{Bit: 21, Name: "EngineOverspeedTime", Conversion: helpers.NumericValue},
+}
+
+// CANExpansionFields lists the GTCAN/ERI CAN fields selected by <Expansion Mask>
+var CANExpansionFields = []MaskField{
+	{Bit: 0, Name: "AdBlueLevel", Conversion: helpers.NumericValue}, // % ("P" prefix) or L ("L" prefix)
+	{Bit: 1, Name: "AxleWeight1", Conversion: helpers.NumericValue}, // kg
+	{Bit: 2, Name: "AxleWeight3", Conversion: helpers.NumericValue},
+	{Bit: 3, Name: "AxleWeight4", Conversion: helpers.NumericValue},
+	{Bit: 4, Name: "TachographOverspeed", Conversion: helpers.NumericValue},
+	{Bit: 5, Name: "TachographMotion", Conversion: helpers.NumericValue},
+	{Bit: 6, Name: "TachographDirection", Conversion: helpers.NumericValue},
+	{Bit: 7, Name: "AnalogInput", Conversion: helpers.NumericValue},
+	{Bit: 8, Name: "EngineBrakingFactor", Conversion: helpers.NumericValue},
+	{Bit: 9, Name: "PedalBrakingFactor", Conversion: helpers.NumericValue},
+	{Bit: 10, Name: "AcceleratorKickDowns", Conversion: helpers.NumericValue},
+	{Bit: 11, Name: "EffectiveEngineSpeedTime", Conversion: helpers.NumericValue},
+	{Bit: 12, Name: "CruiseControlTime", Conversion: helpers.NumericValue},
+	{Bit: 13, Name: "AcceleratorKickDownTime", Conversion: helpers.NumericValue},
+	{Bit: 14, Name: "BrakeApplications", Conversion: helpers.NumericValue},
+	{Bit: 15, Name: "Driver1CardNumber", Conversion: helpers.StringValue, Text: true},
+	{Bit: 16, Name: "Driver2CardNumber", Conversion: helpers.StringValue, Text: true},
+	{Bit: 17, Name: "Driver1Name", Conversion: helpers.StringValue, Text: true},
+	{Bit: 18, Name: "Driver2Name", Conversion: helpers.StringValue, Text: true},
+	{Bit: 19, Name: "RegistrationNumber", Conversion: helpers.StringValue, Text: true},
+	{Bit: 20, Name: "ExpansionInformation", Conversion: helpers.StringValue, Text: true},
+	{Bit: 21, Name: "RapidBrakings", Conversion: helpers.NumericValue},
+	{Bit: 22, Name: "RapidAccelerations", Conversion: helpers.NumericValue},
+	{Bit: 23, Name: "EngineTorque", Conversion: helpers.NumericValue},
+}
+
+// OBDFields lists the GTOBD fields selected by <Report Mask>
+var OBDFields = []MaskField{
+	{Bit: 0, Name: "VIN", Conversion: helpers.StringValue, Text: true},
+	{Bit: 1, Name: "OBDConnect", Conversion: helpers.NumericValue},
+	{Bit: 2, Name: "PowerVoltage", Conversion: helpers.MilliVolts},
+	{Bit: 3, Name: "SupportedPIDs", Conversion: helpers.StringValue, Text: true},
+	{Bit: 4, Name: "EngineRPM", Conversion: helpers.NumericValue},
+	{Bit: 5, Name: "VehicleSpeed", Conversion: helpers.NumericValue},
+	{Bit: 6, Name: "CoolantTemperature", Conversion: helpers.NumericValue},
+	{Bit: 7, Name: "FuelConsumption", Conversion: helpers.NumericValue},
+	{Bit: 8, Name: "DTCClearedDistance", Conversion: helpers.NumericValue},
+	{Bit: 9, Name: "MILActivatedDistance", Conversion: helpers.NumericValue},
+	{Bit: 10, Name: "MILStatus", Conversion: helpers.NumericValue},
+	{Bit: 11, Name: "DTCCount", Conversion: helpers.NumericValue},
+	{Bit: 12, Name: "DTCs", Conversion: helpers.StringValue, Text: true},
+	{Bit: 13, Name: "ThrottlePosition", Conversion: helpers.NumericValue},
+	{Bit: 14, Name: "EngineLoad", Conversion: helpers.NumericValue},
+	{Bit: 15, Name: "FuelLevel", Conversion: helpers.NumericValue},
+	{Bit: 16, Name: "OBDProtocol", Conversion: helpers.StringValue, Text: true},
+	{Bit: 17, Name: "TotalDistance", Conversion: helpers.NumericValue},
+}
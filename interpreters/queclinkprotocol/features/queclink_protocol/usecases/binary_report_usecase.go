@@ -0,0 +1,333 @@
+package usecases
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"queclinkprotocol/features/queclink_protocol/helpers"
+	"queclinkprotocol/features/queclink_protocol/models"
+)
+
+// DecodeBinaryReport converts a binary (HEX) report into the ASCII report it stands for,
+// so both formats go through ParseReport and produce the same output.
+//
+// The fields follow the ASCII layout of the report (models.ReportLayouts), each encoded as
+// described by models.BinaryReportFields and models.BinaryPositionFields. The report mask
+// decides which optional fields are present (models.BinaryOptionalFields).
+func DecodeBinaryReport(data []byte) (string, error) {
+	frame := string(data)
+	if !helpers.IsBinaryFrame(frame) {
+		return "", fmt.Errorf("invalid binary report: unknown header")
+	}
+
+	length := helpers.BinaryFrameLength(frame)
+	if length < helpers.BinaryFixedLength+len(helpers.BinaryTail) || length > len(data) {
+		return "", fmt.Errorf("invalid binary report: length %d, got %d bytes", length, len(data))
+	}
+	frame = frame[:length]
+	if !strings.HasSuffix(frame, helpers.BinaryTail) {
+		return "", fmt.Errorf("invalid binary report: missing tail")
+	}
+
+	reportName, exists := models.BinaryReports[data[4]]
+	if !exists {
+		return "", fmt.Errorf("unsupported binary report: message id 0x%02X", data[4])
+	}
+	layout := models.ReportLayouts[reportName]
+	mask := helpers.BinaryReportMask(frame)
+
+	reader := &binaryReader{data: data[:length-len(helpers.BinaryTail)], index: helpers.BinaryFixedLength}
+
+	var deviceType, protocolVersion string
+	var err error
+	if mask&(1<<models.BinaryMaskDeviceType) != 0 {
+		if deviceType, err = reader.field("DeviceType", models.BinaryField{Size: 1, Format: models.BinaryHex}); err != nil {
+			return "", err
+		}
+	}
+	if mask&(1<<models.BinaryMaskProtocolVersion) != 0 {
+		if protocolVersion, err = reader.field("ProtocolVersion", models.BinaryField{Size: 2, Format: models.BinaryHex}); err != nil {
+			return "", err
+		}
+	}
+	if mask&(1<<models.BinaryMaskFirmwareVersion) != 0 {
+		if _, err = reader.read(2); err != nil {
+			return "", fmt.Errorf("invalid binary report: firmware version truncated")
+		}
+	}
+	if deviceType == "" {
+		return "", fmt.Errorf("invalid binary report: report mask without device type")
+	}
+
+	imei, err := reader.read(helpers.BinaryIMEILength)
+	if err != nil {
+		return "", fmt.Errorf("invalid binary report: IMEI truncated")
+	}
+
+	family := models.DeviceTypes[deviceType].Family
+	if family == "" {
+		family = models.FamilyVehicle
+	}
+
+	decoder := &binaryReportDecoder{reader: reader, mask: mask, values: make(map[string]string)}
+	decoder.append(models.BinaryMessageTypes[frame[:4]]+":"+reportName, deviceType+protocolVersion, hex.EncodeToString(imei)[1:], "")
+
+	if err := decoder.named(layout.HeaderFor(family)); err != nil {
+		return "", err
+	}
+
+	switch layout.Positions {
+	case models.PositionsNumbered:
+		number, err := reader.field("Number", models.BinaryField{Size: 1, Format: models.BinaryDecimal})
+		if err != nil {
+			return "", err
+		}
+		count, _ := strconv.Atoi(number)
+		if count > models.MaxPositions {
+			return "", fmt.Errorf("invalid binary report: <Number> %d", count)
+		}
+		decoder.append(number)
+		for i := 0; i < count; i++ {
+			if err := decoder.position(); err != nil {
+				return "", err
+			}
+		}
+	case models.PositionsSingle:
+		if err := decoder.position(); err != nil {
+			return "", err
+		}
+	case models.PositionsTrailing:
+		if err := decoder.extension(layout.Extension); err != nil {
+			return "", err
+		}
+		if err := decoder.position(); err != nil {
+			return "", err
+		}
+		if err := decoder.named(layout.Trailer); err != nil {
+			return "", err
+		}
+	}
+
+	if layout.Positions != models.PositionsTrailing {
+		if err := decoder.named(layout.TailFor(family)); err != nil {
+			return "", err
+		}
+		if err := decoder.extension(layout.Extension); err != nil {
+			return "", err
+		}
+	}
+
+	if err := decoder.named([]string{"SendTime", "CountNumber"}); err != nil {
+		return "", err
+	}
+	if reader.index != len(reader.data) {
+		return "", fmt.Errorf("invalid binary report: %d unexpected bytes", len(reader.data)-reader.index)
+	}
+
+	return strings.Join(decoder.fields, ",") + "$", nil
+}
+
+// binaryReportDecoder collects the ASCII fields of a binary report
+type binaryReportDecoder struct {
+	reader *binaryReader
+	mask   uint32
+	fields []string
+	values map[string]string
+}
+
+func (d *binaryReportDecoder) append(values ...string) {
+	d.fields = append(d.fields, values...)
+}
+
+// named reads layout fields by name, leaving reserved and masked out fields empty
+func (d *binaryReportDecoder) named(names []string) error {
+	for _, name := range names {
+		if name == "Reserved" {
+			d.append("")
+			continue
+		}
+		if bit, optional := models.BinaryOptionalFields[name]; optional && d.mask&(1<<bit) == 0 {
+			d.append("")
+			continue
+		}
+		encoding, exists := models.BinaryReportFields[name]
+		if !exists {
+			return fmt.Errorf("invalid binary report: no binary encoding for %s", name)
+		}
+		value, err := d.reader.field(name, encoding)
+		if err != nil {
+			return err
+		}
+		d.values[name] = value
+		d.append(value)
+	}
+	return nil
+}
+
+// position reads one position block
+func (d *binaryReportDecoder) position() error {
+	for _, name := range models.PositionFields {
+		switch name {
+		case "Reserved":
+			d.append("")
+			continue
+		case "MCC", "MNC", "LAC", "CellID":
+			if d.mask&(1<<models.BinaryMaskCellInfo) == 0 {
+				d.append("")
+				continue
+			}
+		}
+		value, err := d.reader.field(name, models.BinaryPositionFields[name])
+		if err != nil {
+			return err
+		}
+		d.append(value)
+	}
+	return nil
+}
+
+// extension reads the mask-driven data of GTERI, GTCAN and GTOBD
+func (d *binaryReportDecoder) extension(kind string) error {
+	switch kind {
+	case "ERI":
+		eriMask, err := strconv.ParseUint(d.values["ERIMask"], 16, 32)
+		if err != nil {
+			return fmt.Errorf("invalid binary report: ERI mask %q", d.values["ERIMask"])
+		}
+		if eriMask&(1<<models.ERIDigitalFuelSensor) != 0 {
+			if err := d.read("FuelSensor", models.BinaryFuelSensor); err != nil {
+				return err
+			}
+		}
+		if eriMask&(1<<models.ERIOneWire) != 0 {
+			count, err := d.reader.field("OneWireCount", models.BinaryOneWireCount)
+			if err != nil {
+				return err
+			}
+			d.append(count)
+			devices, _ := strconv.Atoi(count)
+			for i := 0; i < devices; i++ {
+				for _, field := range []models.BinaryField{models.BinaryOneWireID, models.BinaryOneWireType, models.BinaryOneWireData} {
+					if err := d.read("OneWire", field); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if eriMask&(1<<models.ERICANData) != 0 {
+			return d.extension("CAN")
+		}
+	case "CAN":
+		if err := d.read("CANBusDeviceState", models.BinaryCANDeviceState); err != nil {
+			return err
+		}
+		mask, err := d.vehicleBus("ReportMask", models.CANFields)
+		if err != nil || mask&(1<<models.CANExpansionBit) == 0 {
+			return err
+		}
+		_, err = d.vehicleBus("ExpansionMask", models.CANExpansionFields)
+		return err
+	case "OBD":
+		_, err := d.vehicleBus("ReportMask", models.OBDFields)
+		return err
+	}
+	return nil
+}
+
+// vehicleBus reads a <Report Mask> and the CAN/OBD fields it selects, returning the mask
+func (d *binaryReportDecoder) vehicleBus(name string, table []models.MaskField) (uint64, error) {
+	maskValue, err := d.reader.field(name, models.BinaryVehicleBusMask)
+	if err != nil {
+		return 0, err
+	}
+	d.append(maskValue)
+	mask, _ := strconv.ParseUint(maskValue, 16, 32)
+
+	for _, field := range table {
+		if mask&(1<<field.Bit) == 0 {
+			continue
+		}
+		encoding := models.BinaryVehicleBusValue
+		if field.Text {
+			encoding = models.BinaryVehicleBusText
+		}
+		if err := d.read(field.Name, encoding); err != nil {
+			return 0, err
+		}
+	}
+	return mask, nil
+}
+
+func (d *binaryReportDecoder) read(name string, encoding models.BinaryField) error {
+	value, err := d.reader.field(name, encoding)
+	if err != nil {
+		return err
+	}
+	d.append(value)
+	return nil
+}
+
+// binaryReader reads fields of a binary frame in order
+type binaryReader struct {
+	data  []byte
+	index int
+}
+
+func (r *binaryReader) read(size int) ([]byte, error) {
+	if r.index+size > len(r.data) {
+		return nil, fmt.Errorf("out of range data %d", size)
+	}
+	value := r.data[r.index : r.index+size]
+	r.index += size
+	return value, nil
+}
+
+// field reads one field and formats it the way the ASCII report does
+func (r *binaryReader) field(name string, encoding models.BinaryField) (string, error) {
+	size := encoding.Size
+	if encoding.Format == models.BinaryText || encoding.Format == models.BinaryHexText {
+		prefix, err := r.read(1)
+		if err != nil {
+			return "", fmt.Errorf("invalid binary report: field %s truncated", name)
+		}
+		size = int(prefix[0])
+	}
+	value, err := r.read(size)
+	if err != nil {
+		return "", fmt.Errorf("invalid binary report: field %s truncated", name)
+	}
+
+	switch encoding.Format {
+	case models.BinaryText:
+		return string(value), nil
+	case models.BinaryHex, models.BinaryHexText:
+		return strings.ToUpper(hex.EncodeToString(value)), nil
+	case models.BinaryTime:
+		year := int(value[0])<<8 | int(value[1])
+		return fmt.Sprintf("%04d%02d%02d%02d%02d%02d", year, value[2], value[3], value[4], value[5], value[6]), nil
+	case models.BinaryHourMeter:
+		seconds := bigEndian(value)
+		return fmt.Sprintf("%05d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60), nil
+	case models.BinaryDecimal:
+		number := int64(bigEndian(value))
+		if encoding.Signed && size > 0 && size < 8 && number&(1<<(size*8-1)) != 0 {
+			number -= 1 << (size * 8)
+		}
+		if encoding.Scale == 0 {
+			return fmt.Sprintf("%0*d", encoding.Width, number), nil
+		}
+		return strconv.FormatFloat(float64(number)/math.Pow10(encoding.Scale), 'f', encoding.Scale, 64), nil
+	}
+	return "", fmt.Errorf("invalid binary report: unknown format %s for %s", encoding.Format, name)
+}
+
+func bigEndian(value []byte) uint64 {
+	var number uint64
+	for _, b := range value {
+		number = number<<8 | uint64(b)
+	}
+	return number
+}
@@ -0,0 +1,141 @@
+package usecases
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// binaryFrame builds a binary report, filling in its <Length>
+func binaryFrame(header string, messageID byte, mask uint32, body ...[]byte) []byte {
+	frame := append([]byte(header), messageID)
+	frame = binary.BigEndian.AppendUint32(frame, mask)
+	frame = append(frame, 0, 0)
+	for _, part := range body {
+		frame = append(frame, part...)
+	}
+	frame = append(frame, '\r', '\n')
+	binary.BigEndian.PutUint16(frame[9:11], uint16(len(frame)))
+	return frame
+}
+
+func u16(value uint16) []byte { return binary.BigEndian.AppendUint16(nil, value) }
+func u32(value uint32) []byte { return binary.BigEndian.AppendUint32(nil, value) }
+func i32(value int32) []byte  { return u32(uint32(value)) }
+
+func binaryTime(year uint16, month, day, hour, minute, second byte) []byte {
+	return append(u16(year), month, day, hour, minute, second)
+}
+
+func binaryPosition(speed, azimuth uint16, altitude, longitude, latitude int32, gpsTime []byte) []byte {
+	block := append([]byte{1}, u16(speed)...)
+	block = append(block, u16(azimuth)...)
+	block = append(block, i32(altitude)...)
+	block = append(block, i32(longitude)...)
+	block = append(block, i32(latitude)...)
+	block = append(block, gpsTime...)
+	block = append(block, u16(334)...)
+	block = append(block, u16(20)...)
+	block = append(block, 0x02, 0x5A)
+	return append(block, 0x00, 0xAB, 0xCD, 0xEF)
+}
+
+var (
+	binaryDevice = []byte{0x30, 0x04, 0x00}
+	binaryIMEI   = []byte{0x08, 0x60, 0x20, 0x10, 0x61, 0x23, 0x45, 0x67}
+	binarySend   = append(binaryTime(2024, 1, 1, 12, 0, 1), 0x00, 0x01)
+
+	binaryPositions = [][]byte{
+		binaryPosition(105, 90, 22405, -99211608, 19521010, binaryTime(2024, 1, 1, 11, 59, 0)),
+		binaryPosition(200, 180, 22410, -99211000, 19522000, binaryTime(2024, 1, 1, 12, 0, 0)),
+	}
+	asciiPositions = []string{
+		"1,10.5,90,2240.5,-99.211608,19.521010,20240101115900,0334,0020,025A,00ABCDEF,",
+		"1,20.0,180,2241.0,-99.211000,19.522000,20240101120000,0334,0020,025A,00ABCDEF,",
+	}
+)
+
+func TestDecodeBinaryReportFRI(t *testing.T) {
+	// Device type, protocol version, cell info, mileage, hour meter, backup battery and device status
+	frame := binaryFrame("+BSP", 0x01, 0x000001BB,
+		binaryDevice, binaryIMEI,
+		u16(12500), []byte{0x10}, // external power, report id/type
+		[]byte{2}, binaryPositions[0], binaryPositions[1],
+		u32(12345), u32(37800), []byte{100}, []byte{0x22, 0x01, 0x00},
+		binarySend)
+
+	decoded, err := DecodeBinaryReport(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, report("+BUFF:GTFRI,300400", testIMEI, "", "12500", "10", "2",
+		asciiPositions[0], asciiPositions[1], vehicleTail, sendTimeTail), decoded)
+
+	parsed, err := ParseReport(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, parsed.DataPackets)
+	assert.Equal(t, true, packet(t, parsed.ListPackets, "packet_2")["Historical"])
+}
+
+func TestDecodeBinaryReportCAN(t *testing.T) {
+	vin := "1HGCM82633A004352"
+	frame := binaryFrame("+RSP", 0x03, 0x0000000B,
+		binaryDevice, binaryIMEI,
+		[]byte{0},            // report type
+		[]byte{1}, u32(0x31), // CAN device state, report mask
+		append([]byte{byte(len(vin))}, vin...), // VIN
+		i32(150000), i32(6000),                 // RPM, speed
+		binaryPositions[1], binarySend)
+
+	decoded, err := DecodeBinaryReport(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, report("+RESP:GTCAN,300400", testIMEI, "", "0", "1", "00000031", vin, "1500.00", "60.00",
+		asciiPositions[1], sendTimeTail), decoded)
+
+	parsed, err := ParseReport(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"VIN": vin, "EngineRPM": 1500.0, "VehicleSpeed": 60.0},
+		packet(t, parsed.ListPackets, "packet_1")["VehicleBus"])
+
+	// Expansion Mask with AdBlue level and registration number
+	frame = binaryFrame("+RSP", 0x03, 0x0000000B,
+		binaryDevice, binaryIMEI,
+		[]byte{0},
+		[]byte{1}, u32(0x20000031),
+		append([]byte{byte(len(vin))}, vin...),
+		i32(150000), i32(6000),
+		u32(0x00080001), i32(4500), append([]byte{6}, "ABC123"...), // expansion mask, AdBlue, registration
+		binaryPositions[1], binarySend)
+
+	decoded, err = DecodeBinaryReport(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, report("+RESP:GTCAN,300400", testIMEI, "", "0", "1", "20000031", vin, "1500.00", "60.00",
+		"00080001", "45.00", "ABC123", asciiPositions[1], sendTimeTail), decoded)
+
+	parsed, err = ParseReport(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"VIN": vin, "EngineRPM": 1500.0, "VehicleSpeed": 60.0, "AdBlueLevel": 45.0,
+		"RegistrationNumber": "ABC123"}, packet(t, parsed.ListPackets, "packet_1")["VehicleBus"])
+}
+
+func TestDecodeBinaryReportInvalid(t *testing.T) {
+	frame := binaryFrame("+RSP", 0x07, 0x0000000B, binaryDevice, binaryIMEI, []byte{0x22}, binaryPositions[0], binarySend)
+	_, err := DecodeBinaryReport(frame)
+	assert.NoError(t, err)
+
+	// Shorter than its <Length>
+	_, err = DecodeBinaryReport(frame[:len(frame)-5])
+	assert.Error(t, err)
+
+	// Fields missing although <Length> matches
+	truncated := binaryFrame("+RSP", 0x07, 0x0000000B, binaryDevice, binaryIMEI, []byte{0x22}, binarySend)
+	_, err = DecodeBinaryReport(truncated)
+	assert.Error(t, err)
+
+	// Unknown message id
+	_, err = DecodeBinaryReport(binaryFrame("+RSP", 0x7F, 0x00000003, binaryDevice, binaryIMEI, binarySend))
+	assert.Error(t, err)
+
+	// No device type to pick the layout
+	_, err = DecodeBinaryReport(binaryFrame("+RSP", 0x07, 0x0000000A, binaryDevice[1:], binaryIMEI, []byte{0x22}, binaryPositions[0], binarySend))
+	assert.Error(t, err)
+}
@@ -0,0 +1,462 @@
+package usecases
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"queclinkprotocol/features/queclink_protocol/config"
+	"queclinkprotocol/features/queclink_protocol/helpers"
+	"queclinkprotocol/features/queclink_protocol/models"
+)
+
+// ParseReport parses a +RESP/+BUFF report using models.ReportLayouts.
+//
+// Report layout: <Header>,<IMEI>,<DeviceName>,<layout fields...>,<SendTime>,<CountNumber>$
+// Every position block becomes one packet; report level data (mileage, IO, sensors,
+// vehicle bus) is shared by all the packets of the report.
+func ParseReport(data string) (models.QueclinkReportModel, error) {
+	frame := strings.TrimSuffix(strings.TrimSpace(data), "$")
+	parts := strings.Split(frame, ",")
+	if len(parts) < 6 {
+		return models.QueclinkReportModel{}, fmt.Errorf("invalid queclink report: too few fields (%d)", len(parts))
+	}
+
+	head := strings.SplitN(parts[0], ":", 2)
+	if len(head) != 2 || (head[0] != "+RESP" && head[0] != "+BUFF") {
+		return models.QueclinkReportModel{}, fmt.Errorf("invalid queclink report: header %s", parts[0])
+	}
+	layout, exists := models.ReportLayouts[head[1]]
+	if !exists {
+		return models.QueclinkReportModel{}, fmt.Errorf("unsupported queclink report %s", head[1])
+	}
+
+	report := models.QueclinkReportModel{
+		IMEI:            parts[2],
+		Message:         data,
+		MessageType:     head[0],
+		ReportName:      head[1],
+		ProtocolVersion: parts[1],
+		DeviceName:      parts[3],
+		SendTime:        parts[len(parts)-2],
+		CountNumber:     parts[len(parts)-1],
+	}
+	if len(parts[1]) >= 2 {
+		deviceType := models.DeviceTypes[strings.ToUpper(parts[1][:2])]
+		report.DeviceModel = deviceType.Model
+		report.DeviceFamily = deviceType.Family
+	}
+
+	// Fields between <DeviceName> and <SendTime>
+	body := parts[4 : len(parts)-2]
+	if len(body) < len(layout.Header) {
+		return report, fmt.Errorf("invalid %s report: missing header fields", report.ReportName)
+	}
+	headerValues := body[:len(layout.Header)]
+	rest := body[len(layout.Header):]
+
+	var positions [][]string
+	var extension []string
+	fields := make(map[string]string)
+
+	switch layout.Positions {
+	case models.PositionsNumbered:
+		if len(rest) == 0 {
+			return report, fmt.Errorf("invalid %s report: missing <Number>", report.ReportName)
+		}
+		number, err := strconv.Atoi(rest[0])
+		if err != nil || number < 0 || number > models.MaxPositions {
+			return report, fmt.Errorf("invalid %s report: <Number> %q", report.ReportName, rest[0])
+		}
+		rest = rest[1:]
+		blockSize := len(models.PositionFields)
+		if len(rest) < number*blockSize {
+			return report, fmt.Errorf("invalid %s report: %d positions announced, %d fields left", report.ReportName, number, len(rest))
+		}
+		for i := 0; i < number; i++ {
+			positions = append(positions, rest[i*blockSize:(i+1)*blockSize])
+		}
+		rest = rest[number*blockSize:]
+
+	case models.PositionsSingle:
+		if len(rest) < len(models.PositionFields) {
+			return report, fmt.Errorf("invalid %s report: missing position fields", report.ReportName)
+		}
+		positions = append(positions, rest[:len(models.PositionFields)])
+		rest = rest[len(models.PositionFields):]
+
+	case models.PositionsTrailing:
+		// Mask-driven data comes first, the position block sits right before the trailer
+		end := len(rest) - len(layout.Trailer)
+		start := end - len(models.PositionFields)
+		if start >= 0 && isPositionBlock(rest[start:end]) {
+			positions = append(positions, rest[start:end])
+			assignFields(fields, layout.Trailer, rest[end:])
+			extension = rest[:start]
+		} else {
+			extension = rest
+		}
+		rest = nil
+	}
+
+	// Tail after the positions: mask-driven reports use a fixed prefix, the rest are picked by length
+	if layout.Extension != "" && layout.Positions != models.PositionsTrailing {
+		tail := layout.Tails[0]
+		if len(rest) < len(tail) {
+			return report, fmt.Errorf("invalid %s report: missing fields after positions", report.ReportName)
+		}
+		assignFields(fields, tail, rest[:len(tail)])
+		extension = rest[len(tail):]
+	} else if tail := pickTail(layout.Tails, len(rest)); tail != nil {
+		assignFields(fields, tail, rest)
+		if report.DeviceFamily == "" && len(layout.PersonalHeader) > 0 {
+			report.DeviceFamily = models.FamilyVehicle
+			if len(tail) == 1 && tail[0] == "BackupBattery" {
+				report.DeviceFamily = models.FamilyPersonal
+			}
+		}
+	}
+
+	assignFields(fields, layout.HeaderFor(report.DeviceFamily), headerValues)
+
+	shared, err := reportValues(report.ReportName, fields)
+	if err != nil {
+		return report, err
+	}
+
+	switch layout.Extension {
+	case "ERI":
+		err = parseERI(fields["ERIMask"], extension, shared)
+	case "CAN":
+		err = parseCAN(extension, shared)
+	case "OBD":
+		err = parseOBD(extension, shared)
+	}
+	if err != nil {
+		return report, fmt.Errorf("invalid %s report: %v", report.ReportName, err)
+	}
+
+	shared["EventCode"] = reportEvent(report.ReportName, fields)
+	shared["EventName"] = shared["EventCode"].(config.CodeModel).Name
+	shared["Historical"] = models.IsBuffered(report.MessageType)
+
+	report.ListPackets = make(map[string]any)
+	for i, position := range positions {
+		report.ListPackets[fmt.Sprintf("packet_%d", i+1)] = positionPacket(position, report.SendTime, shared)
+	}
+	if len(positions) == 0 {
+		// Reports without a position still carry the event
+		report.ListPackets["packet_1"] = positionPacket(nil, report.SendTime, shared)
+	}
+	report.DataPackets = len(report.ListPackets)
+
+	return report, nil
+}
+
+// assignFields names the values of a layout, skipping reserved fields
+func assignFields(fields map[string]string, names []string, values []string) {
+	for i, name := range names {
+		if i >= len(values) {
+			return
+		}
+		if name != "Reserved" {
+			fields[name] = values[i]
+		}
+	}
+}
+
+// pickTail returns the candidate tail with exactly count fields, or else the first candidate
+func pickTail(tails [][]string, count int) []string {
+	for _, tail := range tails {
+		if len(tail) == count {
+			return tail
+		}
+	}
+	if len(tails) > 0 {
+		return tails[0]
+	}
+	return nil
+}
+
+// isPositionBlock checks a candidate position block by its <GPS UTC Time>
+func isPositionBlock(values []string) bool {
+	return helpers.ReportTime(values[6]) != nil
+}
+
+// positionPacket builds the packet for one position block
+func positionPacket(position []string, sendTime string, shared map[string]any) map[string]any {
+	packet := make(map[string]any, len(shared)+12)
+	for key, value := range shared {
+		packet[key] = value
+	}
+
+	values := make(map[string]string)
+	assignFields(values, models.PositionFields, position)
+
+	datetime := helpers.ReportTime(values["GPSUTCTime"])
+	if datetime == nil {
+		datetime = helpers.ReportTime(sendTime)
+	}
+	if datetime != nil {
+		packet["Datetime"] = datetime
+	}
+
+	numeric := map[string]string{
+		"Latitude":  "Latitude",
+		"Longitude": "Longitude",
+		"Speed":     "Speed",
+		"Azimuth":   "Direction",
+		"Altitude":  "Altitude",
+	}
+	for field, key := range numeric {
+		if value := helpers.NumericValue(values[field]); value != nil {
+			packet[key] = value
+		}
+	}
+
+	if accuracy, ok := helpers.NumericValue(values["GPSAccuracy"]).(float64); ok {
+		packet["HDOP"] = accuracy
+		packet["PositioningStatus"] = "V"
+		if accuracy > 0 {
+			packet["PositioningStatus"] = "A"
+		}
+	}
+
+	for _, key := range []string{"MCC", "MNC", "LAC", "CellID"} {
+		if values[key] != "" {
+			packet[key] = values[key]
+		}
+	}
+
+	return packet
+}
+
+// reportValues converts the report level fields into packet keys
+func reportValues(reportName string, fields map[string]string) (map[string]any, error) {
+	values := make(map[string]any)
+
+	if power, ok := helpers.MilliVolts(fields["ExternalPower"]).(float64); ok {
+		values["AD5"] = fmt.Sprintf("%.2f", power) // External power, as Meitrack AD5
+	}
+	if battery, ok := helpers.NumericValue(fields["BackupBatteryVoltage"]).(float64); ok {
+		values["AD4"] = fmt.Sprintf("%.2f", battery) // Backup battery, as Meitrack AD4
+	}
+	for _, key := range []string{"AD1", "AD2", "AD3"} {
+		if voltage, ok := helpers.MilliVolts(fields[key]).(float64); ok {
+			values[key] = fmt.Sprintf("%.2f", voltage)
+		}
+	}
+
+	if mileage, ok := helpers.NumericValue(fields["Mileage"]).(float64); ok {
+		values["Mileage"] = mileage * 1000 // km to meters
+	}
+	if runTime := helpers.HourMeterSeconds(fields["HourMeter"]); runTime != nil {
+		values["RunTime"] = runTime
+	}
+
+	if status := fields["DeviceStatus"]; status != "" {
+		if err := deviceStatusValues(status, values); err != nil {
+			return nil, fmt.Errorf("invalid %s report: %v", reportName, err)
+		}
+	}
+	if state := fields["State"]; len(state) == 2 {
+		setIgnition(state[0], values)
+	}
+	switch reportName {
+	case "GTIGN":
+		values["ACC"] = "1"
+	case "GTIGF":
+		values["ACC"] = "0"
+	}
+
+	if driverID := fields["DriverID"]; driverID != "" {
+		values["DriverID"] = driverID
+	}
+	if temperature := helpers.OneWireTemperature(fields["Temperature"]); temperature != nil {
+		values["OneWireSensors"] = []map[string]any{{
+			"SensorNumber": fields["TemperatureSensorID"],
+			"Value":        temperature,
+		}}
+	}
+
+	return values, nil
+}
+
+// deviceStatusValues decodes <Device Status>: motion state, digital inputs and digital outputs (one hex byte each)
+func deviceStatusValues(status string, values map[string]any) error {
+	if len(status) < 6 {
+		return fmt.Errorf("device status %q too short", status)
+	}
+	inputs, err := strconv.ParseUint(status[2:4], 16, 8)
+	if err != nil {
+		return fmt.Errorf("device status %q: %v", status, err)
+	}
+	outputs, err := strconv.ParseUint(status[4:6], 16, 8)
+	if err != nil {
+		return fmt.Errorf("device status %q: %v", status, err)
+	}
+
+	setIgnition(status[0], values)
+	for i := 0; i < 8; i++ {
+		values[fmt.Sprintf("Input%d", i+1)] = strconv.FormatUint(inputs>>i&1, 10)
+		values[fmt.Sprintf("Output%d", i+1)] = strconv.FormatUint(outputs>>i&1, 10)
+	}
+	return nil
+}
+
+// setIgnition sets ACC from the first digit of a motion state (1x ignition off, 2x ignition on)
+func setIgnition(state byte, values map[string]any) {
+	switch state {
+	case '1':
+		values["ACC"] = "0"
+	case '2':
+		values["ACC"] = "1"
+	}
+}
+
+// reportEvent maps a report to its canonical event, refined by report type or motion state
+func reportEvent(reportName string, fields map[string]string) config.CodeModel {
+	reportType := fields["ReportType"]
+	if idType := fields["ReportIDType"]; len(idType) == 2 {
+		reportType = idType[1:]
+	}
+	if state := fields["State"]; state != "" {
+		reportType = strings.ToUpper(state)
+	}
+
+	if event, exists := config.ReportTypeEvents[reportName][reportType]; exists {
+		return event
+	}
+	return config.ReportEvents[reportName]
+}
+
+// parseERI decodes the GTERI data selected by <ERI Mask>
+func parseERI(maskValue string, data []string, values map[string]any) error {
+	mask, err := strconv.ParseUint(maskValue, 16, 32)
+	if err != nil {
+		return fmt.Errorf("ERI mask %q: %v", maskValue, err)
+	}
+
+	index := 0
+	next := func() (string, error) {
+		if index >= len(data) {
+			return "", fmt.Errorf("ERI data truncated")
+		}
+		index++
+		return data[index-1], nil
+	}
+
+	if mask&(1<<models.ERIDigitalFuelSensor) != 0 {
+		fuel, err := next()
+		if err != nil {
+			return err
+		}
+		if level, err := strconv.ParseUint(fuel, 16, 32); err == nil {
+			values["FuelLevel"] = float64(level)
+		}
+	}
+
+	if mask&(1<<models.ERIOneWire) != 0 {
+		countValue, err := next()
+		if err != nil {
+			return err
+		}
+		count, err := strconv.Atoi(countValue)
+		if err != nil {
+			return fmt.Errorf("1-wire device number %q: %v", countValue, err)
+		}
+		var sensors []map[string]any
+		for i := 0; i < count; i++ {
+			if index+3 > len(data) {
+				return fmt.Errorf("1-wire data truncated")
+			}
+			id, deviceType, reading := data[index], data[index+1], data[index+2]
+			index += 3
+			if deviceType != "1" { // Only temperature sensors are decoded
+				continue
+			}
+			if temperature := helpers.OneWireTemperature(reading); temperature != nil {
+				sensors = append(sensors, map[string]any{"SensorNumber": id, "Value": temperature})
+			}
+		}
+		if len(sensors) > 0 {
+			values["OneWireSensors"] = sensors
+		}
+	}
+
+	if mask&(1<<models.ERICANData) != 0 {
+		if err := parseCAN(data[index:], values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseCAN decodes <CAN Bus Device State>,<Report Mask>,<CAN fields...>
+func parseCAN(data []string, values map[string]any) error {
+	if len(data) < 2 {
+		return fmt.Errorf("CAN data truncated")
+	}
+	bus, used, err := parseMaskFields(data[1], data[2:], models.CANFields)
+	if err != nil {
+		return fmt.Errorf("CAN %v", err)
+	}
+	if mask, _ := strconv.ParseUint(data[1], 16, 32); mask&(1<<models.CANExpansionBit) != 0 {
+		expansion := data[2+used:]
+		if len(expansion) < 1 {
+			return fmt.Errorf("CAN expansion mask truncated")
+		}
+		fields, _, err := parseMaskFields(expansion[0], expansion[1:], models.CANExpansionFields)
+		if err != nil {
+			return fmt.Errorf("CAN expansion %v", err)
+		}
+		for name, value := range fields {
+			bus[name] = value
+		}
+	}
+	if len(bus) > 0 {
+		values["VehicleBus"] = bus
+	}
+	return nil
+}
+
+// parseOBD decodes <Report Mask>,<OBD fields...>
+func parseOBD(data []string, values map[string]any) error {
+	if len(data) < 1 {
+		return fmt.Errorf("OBD data truncated")
+	}
+	bus, _, err := parseMaskFields(data[0], data[1:], models.OBDFields)
+	if err != nil {
+		return fmt.Errorf("OBD %v", err)
+	}
+	if len(bus) > 0 {
+		values["VehicleBus"] = bus
+	}
+	return nil
+}
+
+// parseMaskFields reads the fields selected by a hex report mask, in bit order, and returns how many
+// values it read
+func parseMaskFields(maskValue string, data []string, table []models.MaskField) (map[string]any, int, error) {
+	mask, err := strconv.ParseUint(maskValue, 16, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("report mask %q: %v", maskValue, err)
+	}
+
+	result := make(map[string]any)
+	index := 0
+	for _, field := range table {
+		if mask&(1<<field.Bit) == 0 {
+			continue
+		}
+		if index >= len(data) {
+			return nil, 0, fmt.Errorf("field %s truncated", field.Name)
+		}
+		if value := field.Conversion(data[index]); value != nil {
+			result[field.Name] = value
+		}
+		index++
+	}
+	return result, index, nil
+}
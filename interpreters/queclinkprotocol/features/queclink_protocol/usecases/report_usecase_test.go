@@ -0,0 +1,190 @@
+package usecases
+
+import (
+	"strings"
+	"testing"
+
+	"queclinkprotocol/features/queclink_protocol/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIMEI     = "860201061234567"
+	testPosition = "1,20.0,180,2241.0,-99.211000,19.522000,20240101120000,0334,0020,025A,00ABCDEF,00"
+	vehicleTail  = "1234.5,00010:30:00,,,,100,220100,,,"
+	sendTimeTail = "20240101120001,0001$"
+)
+
+func report(fields ...string) string {
+	return strings.Join(fields, ",")
+}
+
+func packet(t *testing.T, parsed map[string]any, key string) map[string]any {
+	value, ok := parsed[key].(map[string]any)
+	if !ok {
+		t.Fatalf("missing %s", key)
+	}
+	return value
+}
+
+func TestParseReportMultiPositionFRI(t *testing.T) {
+	data := report("+BUFF:GTFRI,300400", testIMEI, "", "12500", "10", "2",
+		"1,10.5,90,2240.5,-99.211608,19.521010,20240101115900,0334,0020,025A,00ABCDEF,00",
+		testPosition, vehicleTail, sendTimeTail)
+
+	parsed, err := ParseReport(data)
+	assert.NoError(t, err)
+	assert.Equal(t, testIMEI, parsed.IMEI)
+	assert.Equal(t, "GV300W", parsed.DeviceModel)
+	assert.Equal(t, 2, parsed.DataPackets)
+
+	first := packet(t, parsed.ListPackets, "packet_1")
+	second := packet(t, parsed.ListPackets, "packet_2")
+	assert.Equal(t, "2024-01-01T11:59:00Z", first["Datetime"])
+	assert.Equal(t, 19.52101, first["Latitude"])
+	assert.Equal(t, -99.211608, first["Longitude"])
+	assert.Equal(t, 10.5, first["Speed"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", second["Datetime"])
+	assert.Equal(t, 180.0, second["Direction"])
+
+	for _, p := range []map[string]any{first, second} {
+		assert.Equal(t, 1234500.0, p["Mileage"])
+		assert.Equal(t, 37800, p["RunTime"])
+		assert.Equal(t, "12.50", p["AD5"])
+		assert.Equal(t, "1", p["ACC"])
+		assert.Equal(t, "1", p["Input1"])
+		assert.Equal(t, "0", p["Output1"])
+		assert.Equal(t, "A", p["PositioningStatus"])
+		assert.Equal(t, true, p["Historical"])
+		assert.Equal(t, config.CodeModel{Code: 35, Name: "Track By Time Interval"}, p["EventCode"])
+	}
+}
+
+func TestParseReportPersonalFRI(t *testing.T) {
+	data := report("+RESP:GTFRI,320400", testIMEI, "", "0", "0", "1", testPosition, "85", sendTimeTail)
+
+	parsed, err := ParseReport(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "GL", parsed.DeviceFamily)
+	p := packet(t, parsed.ListPackets, "packet_1")
+	assert.Nil(t, p["AD5"])
+	assert.Equal(t, false, p["Historical"])
+}
+
+func TestParseReportUnknownDeviceFamily(t *testing.T) {
+	data := report("+RESP:GTFRI,7F0100", testIMEI, "", "0", "0", "1", testPosition, "85", sendTimeTail)
+
+	parsed, err := ParseReport(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "GL", parsed.DeviceFamily)
+}
+
+func TestParseReportTooManyPositions(t *testing.T) {
+	data := report("+RESP:GTFRI,300400", testIMEI, "", "12500", "10", "16", testPosition, vehicleTail, sendTimeTail)
+
+	_, err := ParseReport(data)
+	assert.Error(t, err)
+
+	// Announced positions missing from the frame
+	data = report("+RESP:GTFRI,300400", testIMEI, "", "12500", "10", "3", testPosition, vehicleTail, sendTimeTail)
+	_, err = ParseReport(data)
+	assert.Error(t, err)
+}
+
+func TestParseReportERI(t *testing.T) {
+	// Mask 7: digital fuel sensor, one 1-wire temperature sensor and CAN data (VIN, distance, RPM, speed)
+	data := report("+RESP:GTERI,300400", testIMEI, "", "00000007", "12500", "10", "1", testPosition,
+		"1234.5,00010:30:00,,,,100,220100", "0", "0064", "1,28FF1234,1,0190",
+		"1,00000035,1HGCM82633A004352,H12345.6,1500,60", sendTimeTail)
+
+	parsed, err := ParseReport(data)
+	assert.NoError(t, err)
+	p := packet(t, parsed.ListPackets, "packet_1")
+	assert.Equal(t, 100.0, p["FuelLevel"])
+	assert.Equal(t, []map[string]any{{"SensorNumber": "28FF1234", "Value": 25.0}}, p["OneWireSensors"])
+	assert.Equal(t, map[string]any{
+		"VIN":           "1HGCM82633A004352",
+		"TotalDistance": 12345.6,
+		"EngineRPM":     1500.0,
+		"VehicleSpeed":  60.0,
+	}, p["VehicleBus"])
+
+	// The mask announces CAN data that is not there
+	data = report("+RESP:GTERI,300400", testIMEI, "", "00000004", "12500", "10", "1", testPosition,
+		"1234.5,00010:30:00,,,,100,220100", "0", sendTimeTail)
+	_, err = ParseReport(data)
+	assert.Error(t, err)
+}
+
+func TestParseReportCAN(t *testing.T) {
+	data := report("+RESP:GTCAN,300400", testIMEI, "", "00", "1", "00000031", "1HGCM82633A004352", "1500", "60", testPosition, sendTimeTail)
+
+	parsed, err := ParseReport(data)
+	assert.NoError(t, err)
+	p := packet(t, parsed.ListPackets, "packet_1")
+	assert.Equal(t, 19.522, p["Latitude"])
+	assert.Equal(t, map[string]any{"VIN": "1HGCM82633A004352", "EngineRPM": 1500.0, "VehicleSpeed": 60.0}, p["VehicleBus"])
+
+	// Expansion Mask with AdBlue level and registration number
+	data = report("+RESP:GTCAN,300400", testIMEI, "", "00", "1", "20000031", "1HGCM82633A004352", "1500", "60",
+		"00080001", "P45", "ABC123", testPosition, sendTimeTail)
+	parsed, err = ParseReport(data)
+	assert.NoError(t, err)
+	p = packet(t, parsed.ListPackets, "packet_1")
+	assert.Equal(t, 19.522, p["Latitude"])
+	assert.Equal(t, map[string]any{"VIN": "1HGCM82633A004352", "EngineRPM": 1500.0, "VehicleSpeed": 60.0,
+		"AdBlueLevel": 45.0, "RegistrationNumber": "ABC123"}, p["VehicleBus"])
+
+	data = report("+RESP:GTCAN,300400", testIMEI, "", "00", "1", "20000031", "1HGCM82633A004352", "1500", "60",
+		"00000001", testPosition, sendTimeTail)
+	_, err = ParseReport(data)
+	assert.Error(t, err)
+}
+
+func TestParseReportOBD(t *testing.T) {
+	data := report("+RESP:GTOBD,300400", testIMEI, "", "0", "00001035", "1HGCM82633A004352", "12000", "2000", "60", "P0300", testPosition, "1234.5", sendTimeTail)
+
+	parsed, err := ParseReport(data)
+	assert.NoError(t, err)
+	p := packet(t, parsed.ListPackets, "packet_1")
+	assert.Equal(t, 1234500.0, p["Mileage"])
+	assert.Equal(t, map[string]any{
+		"VIN":          "1HGCM82633A004352",
+		"PowerVoltage": 12.0,
+		"EngineRPM":    2000.0,
+		"VehicleSpeed": 60.0,
+		"DTCs":         "P0300",
+	}, p["VehicleBus"])
+}
+
+func TestParseReportEvents(t *testing.T) {
+	tests := []struct {
+		data  string
+		event int
+	}{
+		{report("+RESP:GTSTT,300400", testIMEI, "", "22", testPosition, sendTimeTail), 42},
+		{report("+RESP:GTSTT,300400", testIMEI, "", "16", testPosition, sendTimeTail), 36},
+		{report("+RESP:GTIDA,300400", testIMEI, "", "", "D2C4FBC5", "1", "1", testPosition, "1234.5", sendTimeTail), 37},
+		{report("+RESP:GTGEO,300400", testIMEI, "", "", "00", "1", testPosition, "1234.5", sendTimeTail), 21},
+		{report("+RESP:GTSOS,300400", testIMEI, "", "", "00", "1", testPosition, "1234.5", sendTimeTail), 1},
+		{report("+RESP:GTIGN,300400", testIMEI, "", "60", testPosition, "00010:30:00,1234.5", sendTimeTail), 2},
+		{report("+RESP:GTPFA,300400", testIMEI, "", sendTimeTail), 40},
+	}
+
+	for _, test := range tests {
+		parsed, err := ParseReport(test.data)
+		if !assert.NoError(t, err, test.data) {
+			continue
+		}
+		p := packet(t, parsed.ListPackets, "packet_1")
+		assert.Equal(t, test.event, p["EventCode"].(config.CodeModel).Code, test.data)
+	}
+
+	parsed, err := ParseReport(report("+RESP:GTIDA,300400", testIMEI, "", "", "D2C4FBC5", "1", "1", testPosition, "1234.5", sendTimeTail))
+	assert.NoError(t, err)
+	assert.Equal(t, "D2C4FBC5", packet(t, parsed.ListPackets, "packet_1")["DriverID"])
+
+	_, err = ParseReport(report("+RESP:GTXYZ,300400", testIMEI, "", sendTimeTail))
+	assert.Error(t, err)
+}
@@ -1,33 +1,415 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"syscall"
+	"time"
 
+	"queclinkprotocol/features/jono"
 	"queclinkprotocol/features/queclink_protocol"
+	"queclinkprotocol/features/queclink_protocol/helpers"
+	"queclinkprotocol/features/queclink_protocol/models"
 
+	"github.com/MaddSystems/jonobridge/common/broker"
 	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+type TrackerData struct {
+	Payload    string `json:"payload"`
+	RemoteAddr string `json:"remoteaddr"`
+}
+
+type TrackerAssign struct {
+	Imei       string `json:"imei"`
+	Protocol   string `json:"protocol"`
+	RemoteAddr string `json:"remoteaddr"`
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// MQTTClient wraps the MQTT client with additional functionality
+type MQTTClient struct {
+	client         mqtt.Client
+	config         *broker.Config
+	clientID       string
+	ctx            context.Context
+	cancel         context.CancelFunc
+	publishTimeout time.Duration
+	workers        *broker.KeyedPool // The frames of a device are processed in order, by one worker
+	sackPolicy     *helpers.SackPolicy
+	archive        *utils.FrameArchive // Inbound frames with their Jono output, nil when FRAME_ARCHIVE_DIR is not set
+}
+
+// NewMQTTClient creates a new MQTT client for the broker of config (see broker.LoadConfig)
+func NewMQTTClient(config *broker.Config, clientID string) (*MQTTClient, error) {
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("broker URL cannot be empty")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Limit concurrent workers to prevent resource exhaustion
+	maxWorkers := runtime.NumCPU() * 2
+	if maxWorkers < 4 {
+		maxWorkers = 4
+	}
+
+	return &MQTTClient{
+		config:         config,
+		clientID:       clientID,
+		ctx:            ctx,
+		cancel:         cancel,
+		publishTimeout: 30 * time.Second,
+		workers:        broker.NewKeyedPool(maxWorkers, 1000),
+		sackPolicy:     helpers.NewSackPolicy(os.Getenv("QUECLINK_SACK_IMEIS")),
+		archive:        utils.DefaultFrameArchive("queclink"),
+	}, nil
+}
+
+// Connect establishes a connection to the MQTT broker
+func (m *MQTTClient) Connect() error {
+	opts, err := m.config.ClientOptions()
+	if err != nil {
+		return err
+	}
+
+	// Generate a unique client ID
+	subscribe_topic := "queclink"
+	clientID := fmt.Sprintf("queclinkprotocol_%s_%s_%d",
+		subscribe_topic,
+		os.Getenv("HOSTNAME"),
+		time.Now().UnixNano()%100000)
+	opts.SetClientID(clientID)
+
+	// Configure settings for multiple listeners, with a persistent session unless the replicas
+	// share the subscriptions
+	opts.SetCleanSession(m.config.Shared())
+	opts.SetAutoReconnect(true) // Auto reconnect on connection loss
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetOrderMatters(true) // Maintain message order
+	opts.SetResumeSubs(true)   // Resume stored subscriptions
+	opts.SetDefaultPublishHandler(m.messageHandler)
+
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		utils.VPrint("MQTT connection lost: %v. Will attempt to reconnect...", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		utils.VPrint("MQTT connection established/re-established")
+	})
+
+	m.client = mqtt.NewClient(opts)
+	utils.VPrint("MQTT client created with ID: %s", clientID)
+
+	// Try to connect with retries
+	maxRetries := 10
+	retryDelay := 5 * time.Second
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		if token := m.client.Connect(); token.WaitTimeout(30*time.Second) && token.Error() != nil {
+			utils.VPrint("Error connecting to MQTT broker at %s (attempt %d/%d): %v. Retrying in %v...",
+				m.config.URL, attempt, maxRetries, token.Error(), retryDelay)
+			if attempt == maxRetries {
+				return fmt.Errorf("failed to connect after %d attempts: %v", maxRetries, token.Error())
+			}
+			time.Sleep(retryDelay)
+			continue
+		}
+		utils.VPrint("Successfully connected to the MQTT broker")
+		break
+	}
+
+	return nil
+}
+
+// Subscribe subscribes to the specified topic
+func (m *MQTTClient) Subscribe(topic string, qos byte) error {
+	if token := m.config.Subscribe(m.client, topic, qos, nil); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("error subscribing to topic %s: %v", topic, token.Error())
+	}
+	utils.VPrint("Subscribed to topic: %s", topic)
+	return nil
+}
+
+// Publish publishes a message to the specified topic with timeout
+func (m *MQTTClient) Publish(topic string, payload interface{}) error {
+	// Jono messages carry the vehicle when VEHICLE_ENRICH is enabled, and the virtual IMEI of the
+	// device when IMEI_VIRTUALIZE is; the vehicle is looked up with the device IMEI
+	payload = utils.PublishPayload(topic, payload)
+	if !m.client.IsConnected() {
+		return fmt.Errorf("MQTT client is not connected")
+	}
+
+	token := m.config.Publish(m.client, topic, payload)
+	if !token.WaitTimeout(m.publishTimeout) {
+		return fmt.Errorf("publish timeout for topic %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		utils.VPrint("Failed to publish to MQTT topic %s: %v", topic, err)
+		return err
+	}
+	utils.VPrint("Successfully published to MQTT topic: %s", topic)
+	return nil
+}
+
+// Shutdown gracefully shuts down the MQTT client
+func (m *MQTTClient) Shutdown() {
+	utils.VPrint("Shutting down MQTT client...")
+	m.cancel()
+
+	// Wait for in-flight messages with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.workers.Close(ctx); err != nil {
+		utils.VPrint("Timeout waiting for workers to finish")
+	} else {
+		utils.VPrint("All workers finished")
+	}
+
+	if m.client.IsConnected() {
+		m.client.Disconnect(1000)
+	}
+	m.archive.Close()
+	utils.VPrint("MQTT client shutdown complete")
+}
+
+// messageHandler queues incoming MQTT messages on the worker of their device: the frames of a
+// device are processed in order, those of different devices in parallel
+func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
+	// Don't wait forever, the acknowledgements of the publishes of the workers arrive after this
+	// message is handled
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+	if !m.workers.Submit(ctx, messageKey(msg), func() { m.processMessage(msg) }) {
+		utils.VPrint("Dropping message on topic %s, the queue of its device is full", msg.Topic())
+	}
+}
+
+// messageKey returns the device of a message, the remote address of its connection
+func messageKey(msg mqtt.Message) string {
+	return broker.RemoteAddr(msg.Payload())
+}
+
+// processMessage decodes a message of tracker/from-tcp and publishes its frames
+func (m *MQTTClient) processMessage(msg mqtt.Message) {
+	select {
+	case <-m.ctx.Done():
+		return
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in message handler: %v", r)
+			debug.PrintStack()
+		}
+	}()
+
+	if len(msg.Payload()) == 0 || len(msg.Payload()) > 100*1024 { // 100KB limit
+		utils.VPrint("Ignoring message of size %d on topic %s", len(msg.Payload()), msg.Topic())
+		return
+	}
+
+	var trackerData TrackerData
+	if err := json.Unmarshal(msg.Payload(), &trackerData); err != nil {
+		log.Printf("Error unmarshaling JSON: %v", err)
+		return
+	}
+	payload := trackerData.Payload
+	remoteAddr := trackerData.RemoteAddr
+
+	record := m.archive.Begin(payload, remoteAddr)
+	defer record.End()
+
+	// Try to decode as hex, if it fails, use the original message
+	data := payload
+	if bytes, err := hex.DecodeString(payload); err == nil {
+		data = string(bytes)
+	}
+	utils.VPrint("Received message on topic %s: %s", msg.Topic(), data[:min(64, len(data))])
+
+	for _, frame := range helpers.SplitFrames(data) {
+		if models.IsHeartbeat(frame) {
+			m.processHeartbeat(frame, remoteAddr, record)
+			continue
+		}
+		m.processFrame(frame, remoteAddr, record)
+	}
+}
+
+// processHeartbeat replies to a +ACK:GTHBD heartbeat so the device keeps its TCP connection open
+func (m *MQTTClient) processHeartbeat(frame string, remoteAddr string, record *utils.FrameRecord) {
+	record.SetIMEI(helpers.FrameIMEI(frame))
+	ack, err := helpers.HeartbeatAck(frame)
+	if err != nil {
+		record.Fail(err)
+		utils.VPrint("Error building heartbeat ack: %v", err)
+		return
+	}
+	utils.VPrint("Heartbeat received from %s, replying %s", helpers.FrameIMEI(frame), ack)
+	m.sendToDevice(ack, remoteAddr)
+	m.assignImei(helpers.FrameIMEI(frame), remoteAddr)
+}
+
+// sendToDevice publishes a reply for the device connected at remoteAddr to tracker/send
+func (m *MQTTClient) sendToDevice(response string, remoteAddr string) {
+	if remoteAddr == "" {
+		utils.VPrint("No remote address for response %s", response)
+		return
+	}
+	responseJson, err := json.Marshal(TrackerData{
+		Payload:    hex.EncodeToString([]byte(response)),
+		RemoteAddr: remoteAddr,
+	})
+	if err != nil {
+		log.Printf("Error marshaling response: %v", err)
+		return
+	}
+	if err := m.Publish("tracker/send", responseJson); err != nil {
+		log.Printf("Error publishing to tracker/send: %v", err)
+	}
+}
+
+// processFrame parses a single Queclink frame, normalizes it and publishes the result
+func (m *MQTTClient) processFrame(frame string, remoteAddr string, record *utils.FrameRecord) {
+	record.SetIMEI(helpers.FrameIMEI(frame))
+	dataQueclink, err := queclink_protocol.Initialize(frame)
+	if err != nil {
+		record.Fail(err)
+		utils.VPrint("Error initializing Queclink protocol: %v", err)
+		return
+	}
+
+	jonoNormalize, err := jono.Initialize(dataQueclink)
+	if err != nil {
+		record.Fail(err)
+		utils.VPrint("Error initializing Jono protocol: %v", err)
+		return
+	}
+	record.Jono(jonoNormalize)
+
+	if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
+		log.Printf("Error publishing to jonoprotocol: %v", err)
+		return
+	}
+	utils.VPrint("Jono Protocol: %s", jonoNormalize)
+
+	imei := helpers.FrameIMEI(frame)
+	if m.sackPolicy.Enabled(imei) {
+		if ack, err := helpers.ReportAck(frame); err == nil {
+			m.sendToDevice(ack, remoteAddr)
+		} else {
+			utils.VPrint("Error building report ack: %v", err)
+		}
+	}
+	m.assignImei(imei, remoteAddr)
+}
+
+// assignImei publishes the IMEI/remote address pair so replies can be routed to the device
+func (m *MQTTClient) assignImei(imei string, remoteAddr string) {
+	if remoteAddr == "" || imei == "" {
+		return
+	}
+	assignImeiJson, err := json.Marshal(TrackerAssign{
+		Imei:       imei,
+		Protocol:   "queclink",
+		RemoteAddr: remoteAddr,
+	})
+	if err != nil {
+		log.Printf("Error marshaling assign-imei data: %v", err)
+		return
+	}
+	if err := m.Publish("tracker/assign-imei2remoteaddr", assignImeiJson); err != nil {
+		log.Printf("Error publishing to assign-imei2remoteaddr: %v", err)
+		return
+	}
+	utils.VPrint("Publishing to tracker/assign-imei2remoteaddr: %s", assignImeiJson)
+}
+
+// runParse keeps the original one-shot CLI: parse the given frame(s) and print the result
+func runParse(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: queclinkprotocol [-v] parse <queclink_data>")
+		os.Exit(1)
+	}
+
+	data := strings.Join(args, " ")
+	// Binary reports can be given as a hex dump
+	if decoded, err := hex.DecodeString(data); err == nil && helpers.IsBinaryFrame(string(decoded)) {
+		data = string(decoded)
+	}
+	for _, frame := range helpers.SplitFrames(data) {
+		result, err := queclink_protocol.Initialize(frame)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing data: %v\n", err)
+			os.Exit(1)
+		}
+		jonoNormalize, err := jono.Initialize(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error normalizing data: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(jonoNormalize)
+	}
+}
+
 func main() {
 	// Parse command line flags
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	// Check if we have at least one argument
-	if len(flag.Args()) < 1 {
-		utils.VPrint("Usage: queclink [-v] <queclink_data>")
-		os.Exit(1)
+	if flag.Arg(0) == "parse" {
+		runParse(flag.Args()[1:])
+		return
 	}
 
-	// Process the data from arguments
-	data := strings.Join(flag.Args(), " ")
-	result, err := queclink_protocol.Initialize(data)
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	utils.VPrint("Starting Queclink Protocol")
+
+	mqttConfig, err := mqttFlags.Load()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error processing data: %v\n", err)
-		os.Exit(1)
+		log.Fatal(err)
 	}
 
-	utils.VPrint(result)
+	mqttClient, err := NewMQTTClient(mqttConfig, "go_mqtt_client")
+	if err != nil {
+		log.Fatal("Failed to create MQTT client:", err)
+	}
+
+	// Set up signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	shutdown := make(chan struct{})
+	go func() {
+		sig := <-sigChan
+		log.Printf("Received signal %v, initiating graceful shutdown...", sig)
+		mqttClient.Shutdown()
+		close(shutdown)
+	}()
+
+	if err := mqttClient.Connect(); err != nil {
+		log.Fatal("Failed to connect to MQTT broker:", err)
+	}
+	if err := mqttClient.Subscribe("tracker/from-tcp", 1); err != nil {
+		log.Fatal("Failed to subscribe to tracker/from-tcp:", err)
+	}
+
+	log.Println("Queclink Protocol service started successfully. Waiting for messages...")
+
+	<-shutdown
+	log.Println("Application shutdown complete")
 }
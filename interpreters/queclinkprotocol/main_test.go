@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testReport    = "+RESP:GTFRI,300400,864696060000015,,12500,10,1,1,42.6,305,2259.0,-99.139013,19.425502,20250407120000,0334,0020,20A2,02B3DE86,00,0.0,00000:00:00,,,,100,220100,,,,20250407120000,0001$"
+	testHeartbeat = "+ACK:GTHBD,300400,864696060000015,,20250407120000,0002$"
+)
+
+// TestFromTCPToJono runs the interpreter against the embedded broker: frames published on
+// tracker/from-tcp come out on tracker/jonoprotocol, and heartbeats are answered on tracker/send
+func TestFromTCPToJono(t *testing.T) {
+	interpreter, err := NewMQTTClient(&broker.Config{URL: broker.MemURL, QoS: broker.DefaultQoS}, "go_mqtt_client")
+	require.NoError(t, err)
+	require.NoError(t, interpreter.Connect())
+	defer interpreter.Shutdown()
+	require.NoError(t, interpreter.Subscribe("tracker/from-tcp", 1))
+
+	opts, err := broker.NewClientOptions(broker.MemURL)
+	require.NoError(t, err)
+	opts.SetClientID("queclinkprotocol_test")
+	listener := mqtt.NewClient(opts)
+	token := listener.Connect()
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+	defer listener.Disconnect(100)
+
+	received := make(chan mqtt.Message, 10)
+	for _, topic := range []string{"tracker/jonoprotocol", "tracker/send"} {
+		token := listener.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) { received <- msg })
+		require.True(t, token.WaitTimeout(5*time.Second))
+		require.NoError(t, token.Error())
+	}
+
+	for _, frame := range []string{testReport, testHeartbeat} {
+		message, _ := json.Marshal(TrackerData{Payload: hex.EncodeToString([]byte(frame)), RemoteAddr: "10.99.0.1:40000"})
+		listener.Publish("tracker/from-tcp", 1, false, message).Wait()
+	}
+
+	got := map[string][]byte{}
+	for len(got) < 2 {
+		select {
+		case msg := <-received:
+			got[msg.Topic()] = msg.Payload()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout, got %v", got)
+		}
+	}
+
+	var jono map[string]interface{}
+	require.NoError(t, json.Unmarshal(got["tracker/jonoprotocol"], &jono))
+	assert.Equal(t, "864696060000015", jono["IMEI"])
+
+	var reply TrackerData
+	require.NoError(t, json.Unmarshal(got["tracker/send"], &reply))
+	assert.Equal(t, "10.99.0.1:40000", reply.RemoteAddr)
+	ack, _ := hex.DecodeString(reply.Payload)
+	assert.Equal(t, "+SACK:GTHBD,300400,0002$", string(ack))
+}
+
+// TestTopicPrefix runs the interpreter in the namespace of a tenant: it only sees the frames of
+// its namespace and publishes in it
+func TestTopicPrefix(t *testing.T) {
+	config := &broker.Config{URL: broker.MemURL, QoS: broker.DefaultQoS, TopicPrefix: "tenant-a"}
+	interpreter, err := NewMQTTClient(config, "go_mqtt_client")
+	require.NoError(t, err)
+	require.NoError(t, interpreter.Connect())
+	defer interpreter.Shutdown()
+	require.NoError(t, interpreter.Subscribe("tracker/from-tcp", 1))
+
+	opts, err := broker.NewClientOptions(broker.MemURL)
+	require.NoError(t, err)
+	opts.SetClientID("queclinkprotocol_prefix_test")
+	listener := mqtt.NewClient(opts)
+	token := listener.Connect()
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+	defer listener.Disconnect(100)
+
+	received := make(chan mqtt.Message, 10)
+	token = listener.Subscribe("+/tracker/jonoprotocol", 1, func(_ mqtt.Client, msg mqtt.Message) { received <- msg })
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+
+	message, _ := json.Marshal(TrackerData{Payload: hex.EncodeToString([]byte(testReport)), RemoteAddr: "10.99.0.1:40000"})
+	listener.Publish("tenant-b/tracker/from-tcp", 1, false, message).Wait()
+	listener.Publish("tenant-a/tracker/from-tcp", 1, false, message).Wait()
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "tenant-a/tracker/jonoprotocol", msg.Topic())
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message on %s", msg.Topic())
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// connectTestClient connects a client to the embedded broker, subscribed to topics
+func connectTestClient(t *testing.T, clientID string, topics ...string) (mqtt.Client, chan mqtt.Message) {
+	t.Helper()
+	opts, err := broker.NewClientOptions(broker.MemURL)
+	require.NoError(t, err)
+	opts.SetClientID(clientID)
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+	t.Cleanup(func() { client.Disconnect(100) })
+
+	received := make(chan mqtt.Message, 1000)
+	for _, topic := range topics {
+		token := client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) { received <- msg })
+		require.True(t, token.WaitTimeout(5*time.Second))
+		require.NoError(t, token.Error())
+	}
+	return client, received
+}
+
+// TestSharedSubscription runs two replicas in a shared group: every frame is processed once
+func TestSharedSubscription(t *testing.T) {
+	config := &broker.Config{URL: broker.MemURL, QoS: broker.DefaultQoS, TopicPrefix: "shared", SharedGroup: "queclink"}
+	for i := 0; i < 2; i++ {
+		replica, err := NewMQTTClient(config, "go_mqtt_client")
+		require.NoError(t, err)
+		require.NoError(t, replica.Connect())
+		defer replica.Shutdown()
+		require.NoError(t, replica.Subscribe("tracker/from-tcp", 1))
+	}
+
+	client, received := connectTestClient(t, "queclinkprotocol_shared_test", "shared/tracker/jonoprotocol")
+	const frames = 40
+	for i := 0; i < frames; i++ {
+		message, _ := json.Marshal(TrackerData{Payload: hex.EncodeToString([]byte(testReport)), RemoteAddr: fmt.Sprintf("10.99.0.%d:40000", i)})
+		client.Publish("shared/tracker/from-tcp", 1, false, message).Wait()
+	}
+
+	for i := 0; i < frames; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout after %d messages", i)
+		}
+	}
+	select {
+	case msg := <-received:
+		t.Fatalf("duplicate message on %s", msg.Topic())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// TestDeviceOrder checks the replies to the heartbeats of each device keep the order of the frames
+func TestDeviceOrder(t *testing.T) {
+	config := &broker.Config{URL: broker.MemURL, QoS: broker.DefaultQoS, TopicPrefix: "order"}
+	interpreter, err := NewMQTTClient(config, "go_mqtt_client")
+	require.NoError(t, err)
+	require.NoError(t, interpreter.Connect())
+	defer interpreter.Shutdown()
+	require.NoError(t, interpreter.Subscribe("tracker/from-tcp", 1))
+
+	client, received := connectTestClient(t, "queclinkprotocol_order_test", "order/tracker/send")
+	const devices, heartbeats = 8, 25
+	for count := 1; count <= heartbeats; count++ {
+		for device := 0; device < devices; device++ {
+			frame := fmt.Sprintf("+ACK:GTHBD,300400,86469606000%04d,,20250407120000,%04X$", device, count)
+			message, _ := json.Marshal(TrackerData{Payload: hex.EncodeToString([]byte(frame)), RemoteAddr: fmt.Sprintf("10.99.1.%d:40000", device)})
+			client.Publish("order/tracker/from-tcp", 1, false, message)
+		}
+	}
+
+	last := map[string]int{}
+	for i := 0; i < devices*heartbeats; i++ {
+		select {
+		case msg := <-received:
+			var reply TrackerData
+			require.NoError(t, json.Unmarshal(msg.Payload(), &reply))
+			ack, _ := hex.DecodeString(reply.Payload)
+			var count int
+			_, err := fmt.Sscanf(string(ack), "+SACK:GTHBD,300400,%04X$", &count)
+			require.NoError(t, err, string(ack))
+			assert.Equal(t, last[reply.RemoteAddr]+1, count, reply.RemoteAddr)
+			last[reply.RemoteAddr] = count
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout after %d replies", i)
+		}
+	}
+}
@@ -7,16 +7,21 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"ruptelaprotocol/features/jono"
 	"ruptelaprotocol/features/ruptela_protocol"
 	"ruptelaprotocol/utils"
+	"syscall"
 	"time"
 
+	"github.com/MaddSystems/jonobridge/common/broker"
+	commonutils "github.com/MaddSystems/jonobridge/common/utils"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 var (
-	verbose = flag.Bool("v", false, "Enable verbose logging") // Verbose flag
+	// verbose is the -v flag, registered by common/utils
+	verbose = &commonutils.Verbose
 )
 
 type TrackerData struct {
@@ -32,30 +37,33 @@ type TrackerAssign struct {
 
 // MQTTClient wraps the MQTT client with additional functionality
 type MQTTClient struct {
-	client    mqtt.Client
-	brokerURL string
-	clientID  string
-	verbose   bool
+	client   mqtt.Client
+	config   *broker.Config
+	clientID string
+	verbose  bool
+	archive  *commonutils.FrameArchive // Inbound frames with their Jono output, nil when FRAME_ARCHIVE_DIR is not set
 }
 
 // NewMQTTClient creates a new MQTT client with the given configuration
-func NewMQTTClient(brokerHost string, clientID string, verbose bool) (*MQTTClient, error) {
-	if brokerHost == "" {
-		return nil, fmt.Errorf("broker host cannot be empty")
+func NewMQTTClient(config *broker.Config, clientID string, verbose bool) (*MQTTClient, error) {
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("broker URL cannot be empty")
 	}
 
-	brokerURL := fmt.Sprintf("tcp://%s:1883", brokerHost)
 	return &MQTTClient{
-		brokerURL: brokerURL,
-		clientID:  clientID,
-		verbose:   verbose,
+		config:   config,
+		clientID: clientID,
+		verbose:  verbose,
+		archive:  commonutils.DefaultFrameArchive("ruptela"),
 	}, nil
 }
 
 // Connect establishes a connection to the MQTT broker
 func (m *MQTTClient) Connect() error {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(m.brokerURL)
+	opts, err := m.config.ClientOptions()
+	if err != nil {
+		return err
+	}
 
 	// Generate a unique client ID
 	subscribe_topic := "meitrack" // You might want to make this configurable
@@ -65,8 +73,9 @@ func (m *MQTTClient) Connect() error {
 		time.Now().UnixNano()%100000)
 	opts.SetClientID(clientID)
 
-	// Configure settings for multiple listeners
-	opts.SetCleanSession(false) // Maintain persistent session
+	// Configure settings for multiple listeners, with a persistent session unless the replicas
+	// share the subscriptions
+	opts.SetCleanSession(m.config.Shared())
 	opts.SetAutoReconnect(true) // Auto reconnect on connection loss
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetOrderMatters(true) // Maintain message order
@@ -79,7 +88,7 @@ func (m *MQTTClient) Connect() error {
 	for {
 		if token := m.client.Connect(); token.Wait() && token.Error() != nil {
 			if m.verbose {
-				utils.VPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.brokerURL, token.Error())
+				utils.VPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.config.URL, token.Error())
 			}
 			time.Sleep(5 * time.Second)
 			continue
@@ -95,7 +104,7 @@ func (m *MQTTClient) Connect() error {
 
 // Subscribe subscribes to the specified topic
 func (m *MQTTClient) Subscribe(topic string, qos byte) error {
-	if token := m.client.Subscribe(topic, qos, nil); token.Wait() && token.Error() != nil {
+	if token := m.config.Subscribe(m.client, topic, qos, nil); token.Wait() && token.Error() != nil {
 		return fmt.Errorf("error subscribing to topic %s: %v", topic, token.Error())
 	}
 	if m.verbose {
@@ -106,7 +115,10 @@ func (m *MQTTClient) Subscribe(topic string, qos byte) error {
 
 // Publish publishes a message to the specified topic
 func (m *MQTTClient) Publish(topic string, payload interface{}) error {
-	token := m.client.Publish(topic, 0, false, payload)
+	// Jono messages carry the vehicle when VEHICLE_ENRICH is enabled, and the virtual IMEI of the
+	// device when IMEI_VIRTUALIZE is; the vehicle is looked up with the device IMEI
+	payload = commonutils.PublishPayload(topic, payload)
+	token := m.config.Publish(m.client, topic, payload)
 	token.Wait()
 	if token.Error() != nil {
 		if m.verbose {
@@ -130,24 +142,29 @@ func min(a, b int) int {
 // messageHandler handles incoming MQTT messages
 func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 
-	if msg.Topic() == "tracker/from-udp" {
+	if m.config.TopicName(msg.Topic()) == "tracker/from-udp" {
 		if m.verbose {
 			utils.VPrint("Received message on topic %s: %s", msg.Topic(), msg.Payload())
 		}
 
 		trackerPayload := string(msg.Payload())
+		record := m.archive.Begin(trackerPayload, "")
+		defer record.End()
 
 		dataRuptela, err := ruptela_protocol.Initialize(trackerPayload)
 		if err != nil {
+			record.Fail(err)
 			fmt.Println(err)
 			return
 		}
 
 		jonoNormalize, err := jono.Initialize(dataRuptela)
 		if err != nil {
+			record.Fail(err)
 			fmt.Println(err)
 			return
 		}
+		record.Jono(jonoNormalize)
 
 		// Publish to jonoprotocol topic
 		if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
@@ -167,6 +184,8 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	}
 	payload := json_data.Payload
 	remote_addr := json_data.RemoteAddr
+	record := m.archive.Begin(payload, remote_addr)
+	defer record.End()
 
 	fmt.Println("remote_addr:", remote_addr)
 
@@ -181,15 +200,19 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 
 	dataRuptela, err := ruptela_protocol.Initialize(payload)
 	if err != nil {
+		record.Fail(err)
 		fmt.Println(err)
 		return
 	}
 
 	jonoNormalize, err := jono.Initialize(dataRuptela)
 	if err != nil {
+		record.Fail(err)
 		fmt.Println(err)
 		return
 	}
+	// The archive keeps the Jono message the decoders replay, not the flattened one published below
+	record.Jono(jonoNormalize)
 
 	// Parse the data to get just the fields we want
 	var data map[string]interface{}
@@ -254,19 +277,20 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 
 func main() {
 	// Parse command-line flags
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	// Set verbose flag in utils package
 	utils.SetVerbose(verbose)
 	utils.VPrint("Rupetela Protocol")
-	// Get MQTT broker host from environment
-	mqttBrokerHost := os.Getenv("MQTT_BROKER_HOST")
-	if mqttBrokerHost == "" {
-		log.Fatal("MQTT_BROKER_HOST environment variable not set")
+	// Get the MQTT broker from the environment
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Create and configure MQTT client
-	mqttClient, err := NewMQTTClient(mqttBrokerHost, "go_mqtt_client", *verbose)
+	mqttClient, err := NewMQTTClient(mqttConfig, "go_mqtt_client", *verbose)
 	if err != nil {
 		log.Fatal("Failed to create MQTT client:", err)
 	}
@@ -286,6 +310,10 @@ func main() {
 		log.Fatal("Failed to subscribe to tracker/from-udp:", err)
 	}
 
-	// Keep the application running
-	select {}
+	// Keep the application running until it is stopped
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	mqttClient.archive.Close()
 }
@@ -168,6 +168,8 @@ type Packet struct {
 	BluetoothBeaconA             *BluetoothBeacon            `json:"BluetoothBeaconA"`
 	BluetoothBeaconB             *BluetoothBeacon            `json:"BluetoothBeaconB"`
 	TemperatureAndHumiditySensor *TemperatureAndHumidity     `json:"TemperatureAndHumiditySensor"`
+	GeofenceID                   *int                        `json:"GeofenceID,omitempty"` // Geofence of the zone messages
+	GpsFixAge                    *int                        `json:"GpsFixAge,omitempty"`  // Seconds since the GPS fix
 }
 
 // 📌 ParsedModel representa el modelo final con paquetes
@@ -176,6 +178,7 @@ type ParsedModel struct {
 	Message     *string           `json:"Message"`
 	DataPackets *int              `json:"DataPackets"`
 	ListPackets map[string]Packet `json:"ListPackets"`
+	RawPayload  *string           `json:"RawPayload,omitempty"` // base64 payload of the messages without a definition
 }
 
 // 📌 Método para convertir `ParsedModel` a JSON normal
@@ -58,8 +58,9 @@ func GetDataJono(data string) (string, error) {
 	// Check for raw AAA data with analog inputs
 	rawAnalogInputs, _ := rawData["RawAnalogInputs"].(string)
 
-	// Check if this is AAA protocol data by examining Message field
-	if message, exists := rawData["Message"].(string); exists && strings.Contains(message, "AAA") {
+	// Check if this is AAA protocol data by examining Message field, the command field and not any
+	// "AAA" as in the base64 raw payloads of the Skywave return messages
+	if message, exists := rawData["Message"].(string); exists && strings.Contains(message, ",AAA,") {
 		parsedModel := models.ParsedModel{
 			IMEI:        getStringPointer(rawData, "IMEI"),
 			Message:     getStringPointer(rawData, "Message"),
@@ -116,6 +117,7 @@ func GetDataJono(data string) (string, error) {
 		Message:     getStringPointer(rawData, "Message"),
 		DataPackets: getIntPointer(rawData, "DataPackets"),
 		ListPackets: make(map[string]models.Packet),
+		RawPayload:  getStringPointer(rawData, "RawPayload"),
 	}
 
 	// 📌 Verificar si "ListPackets" existe
@@ -469,6 +471,8 @@ func createPacket(packetMap map[string]interface{}) models.Packet {
 		BluetoothBeaconA:             extractBluetoothBeacon(packetMap, "BluetoothBeaconA"),
 		BluetoothBeaconB:             extractBluetoothBeacon(packetMap, "BluetoothBeaconB"),
 		TemperatureAndHumiditySensor: extractTemperatureAndHumidity(packetMap),
+		GeofenceID:                   getIntPointer(packetMap, "GeofenceID"),
+		GpsFixAge:                    getIntPointer(packetMap, "GpsFixAge"),
 	}
 }
 
@@ -0,0 +1,49 @@
+package config
+
+// ForwardField is a field of a forward message, either fixed (Value) or taken from a command parameter (Param)
+type ForwardField struct {
+	Name     string
+	Type     string // Gateway field type: "unsignedint", "signedint", "boolean", "enum", "string"
+	Value    string
+	Param    string
+	Required bool
+}
+
+// ForwardCommand describes how a vendor-neutral command is sent as a SIN/MIN forward message
+type ForwardCommand struct {
+	Name   string // Payload name from the message definition file
+	SIN    int
+	MIN    int
+	Fields []ForwardField
+}
+
+// ForwardCommands maps the commands accepted on the command topic to forward messages.
+// poll_position uses the core modem service (SIN 0), the others the AVL application (SIN 126)
+// installed on our terminals; they must match the terminal's message definition file.
+var ForwardCommands = map[string]ForwardCommand{
+	"poll_position": {
+		Name: "getLocation", SIN: 0, MIN: 72,
+		Fields: []ForwardField{{Name: "fields", Type: "unsignedint", Value: "7"}},
+	},
+	"set_report_interval": {
+		Name: "SetReportInterval", SIN: 126, MIN: 1,
+		Fields: []ForwardField{
+			{Name: "MovingInterval", Type: "unsignedint", Param: "minutes", Required: true},
+			{Name: "StationaryInterval", Type: "unsignedint", Param: "stationary_minutes"},
+		},
+	},
+	"immobilize": {
+		Name: "SetDigitalOutput", SIN: 126, MIN: 2,
+		Fields: []ForwardField{
+			{Name: "Output", Type: "unsignedint", Param: "output", Value: "1"},
+			{Name: "State", Type: "boolean", Value: "True"},
+		},
+	},
+	"mobilize": {
+		Name: "SetDigitalOutput", SIN: 126, MIN: 2,
+		Fields: []ForwardField{
+			{Name: "Output", Type: "unsignedint", Param: "output", Value: "1"},
+			{Name: "State", Type: "boolean", Value: "False"},
+		},
+	},
+}
@@ -0,0 +1,8 @@
+package config
+
+import "embed"
+
+// DefaultDefinitions holds the message definition files loaded before the ones given in SKYWAVE_MDF
+//
+//go:embed definitions/*.xml
+var DefaultDefinitions embed.FS
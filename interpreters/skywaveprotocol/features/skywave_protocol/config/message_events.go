@@ -0,0 +1,28 @@
+package config
+
+// MessageEvents maps the name of a return message (from its definition) to its event,
+// messages not listed here are reported as position updates
+var MessageEvents = map[string]CodeModel{
+	"StationaryIntervalSat":  {Code: 35, Name: "Track By Time Interval"},
+	"MovingIntervalSat":      {Code: 35, Name: "Track By Time Interval"},
+	"StationaryIntervalCell": {Code: 35, Name: "Track By Time Interval"},
+	"DistanceCell":           {Code: 33, Name: "Track By Distance"},
+	"MovingStart":            {Code: 42, Name: "Start Moving"},
+	"MovingEnd":              {Code: 41, Name: "Stop Moving"},
+	"SpeedingStart":          {Code: 19, Name: "Speeding"},
+	"SpeedingEnd":            {Code: 35, Name: "Track By Time Interval"},
+	"IgnitionOn":             {Code: 2, Name: "Input 2 Active"},
+	"IgnitionOff":            {Code: 10, Name: "Input 2 Inactive"},
+	"DigInp1Hi":              {Code: 1, Name: "Input 1 Active"},
+	"DigInp1Lo":              {Code: 9, Name: "Input 1 Inactive"},
+	"ZoneEntry":              {Code: 20, Name: "Enter Geo-fence"},
+	"ZoneExit":               {Code: 21, Name: "Exit Geo-fence"},
+	"PowerMainLow":           {Code: 18, Name: "Low External Battery"},
+	"PowerBackup":            {Code: 23, Name: "External Battery Cut"},
+}
+
+// PositionEvent is the event of return messages without their own
+var PositionEvent = CodeModel{Code: 35, Name: "Track By Time Interval"}
+
+// UndefinedEvent is the event of return messages without a definition, passed on as raw payload
+var UndefinedEvent = CodeModel{Code: 9999, Name: "Undefined message"}
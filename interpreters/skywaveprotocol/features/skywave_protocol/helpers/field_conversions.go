@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversions for message fields decoded by the gateway or from a raw payload.
+// They return nil for empty or invalid values so the field is left out of the packet.
+
+// NumericValue parses a decimal field
+func NumericValue(value string) any {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return nil
+	}
+	return number
+}
+
+// MinuteThousandths converts a coordinate in thousandths of a minute to degrees
+func MinuteThousandths(value string) any {
+	number, ok := NumericValue(value).(float64)
+	if !ok {
+		return nil
+	}
+	return number / 60000
+}
+
+// TwoDegreeSteps converts a heading in 2 degree steps to degrees
+func TwoDegreeSteps(value string) any {
+	number, ok := NumericValue(value).(float64)
+	if !ok {
+		return nil
+	}
+	return number * 2
+}
+
+// UnixTime converts seconds since 1970 (UTC) to RFC3339
+func UnixTime(value string) any {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds <= 0 {
+		return nil
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
+
+// MilliVolts converts a voltage in mV to volts, formatted like the analog inputs of other protocols
+func MilliVolts(value string) any {
+	number, ok := NumericValue(value).(float64)
+	if !ok {
+		return nil
+	}
+	return fmt.Sprintf("%.2f", number/1000)
+}
+
+// BooleanFlag converts a boolean field ("True"/"False" or 1/0) to "1"/"0"
+func BooleanFlag(value string) any {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1":
+		return "1"
+	case "false", "0":
+		return "0"
+	}
+	return nil
+}
+
+// DayMinuteTime completes a day of month and minute of day (UTC) with the month of reference,
+// or the month before when the day is still ahead of reference
+func DayMinuteTime(day int, minute int, reference time.Time) string {
+	reference = reference.UTC()
+	moment := time.Date(reference.Year(), reference.Month(), day, 0, minute, 0, 0, time.UTC)
+	if day > reference.Day() {
+		moment = time.Date(reference.Year(), reference.Month()-1, day, 0, minute, 0, 0, time.UTC)
+	}
+	return moment.Format(time.RFC3339)
+}
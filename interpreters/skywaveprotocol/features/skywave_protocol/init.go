@@ -3,21 +3,52 @@ package skywave_protocol
 import (
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"skywaveprotocol/features/skywave_protocol/models"
+	"skywaveprotocol/features/skywave_protocol/usecases"
 )
 
-func Initialize(data string) (string, error) {
+// Initialize converts the messages of a GetReturnMessagesResult, or a single ReturnMessage, into
+// the Jono input of each one. Messages that cannot be converted are skipped and reported in the error.
+func Initialize(data string, definitions *usecases.MessageDefinitions) ([]string, error) {
+	var messages []models.ReturnedMessages
 	var skywaveResult models.GetReturnMessagesResult
-	err := xml.Unmarshal([]byte(data), &skywaveResult)
-	if err != nil {
-		dataJSON, err := json.Marshal(skywaveResult)
+	if err := xml.Unmarshal([]byte(data), &skywaveResult); err == nil {
+		messages = skywaveResult.Messages.ReturnedMessages
+	} else {
+		var message models.ReturnedMessages
+		if xml.Unmarshal([]byte(data), &message) != nil {
+			return nil, fmt.Errorf("no valid model identified from data: %v", err)
+		}
+		messages = append(messages, message)
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no return messages in data, error ID %d", skywaveResult.ErrorId)
+	}
+
+	var results []string
+	var errs []error
+	for _, message := range messages {
+		result, err := InitializeReturnMessage(message, definitions)
 		if err != nil {
-			return "", fmt.Errorf("error marshaling ST300 data: %v", err)
+			errs = append(errs, err)
+			continue
 		}
-		return string(dataJSON), nil
-	} else {
-		fmt.Println("Could not identify model from data")
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+// InitializeReturnMessage converts a return message fetched from the gateway into the Jono input
+func InitializeReturnMessage(message models.ReturnedMessages, definitions *usecases.MessageDefinitions) (string, error) {
+	data, err := usecases.ReturnMessageData(message, definitions)
+	if err != nil {
+		return "", err
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling return message: %v", err)
 	}
-	return "", fmt.Errorf("no valid model identified from data: %s", data)
+	return string(dataJSON), nil
 }
@@ -3,6 +3,11 @@ package skywave_protocol
 import (
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"skywaveprotocol/features/jono"
+	jonomodels "skywaveprotocol/features/jono/models"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"skywaveprotocol/features/skywave_protocol/usecases"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -47,9 +52,13 @@ func TestInitialize(t *testing.T) {
 		"Checksum": "C6"
 	}`
 
-	result, err := Initialize(testData)
+	results, err := Initialize(testData, nil)
 
 	assert.NoError(t, err, "La función devolvió un error inesperado")
+	result := ""
+	if len(results) > 0 {
+		result = results[0]
+	}
 
 	var expectedNormalized, resultNormalized map[string]interface{}
 
@@ -73,8 +82,12 @@ func TestInitializeWithBinaryFile(t *testing.T) {
 
 	dataString := string(data)
 
-	result, err := Initialize(dataString)
+	results, err := Initialize(dataString, nil)
 	assert.NoError(t, err, "La función devolvió un error inesperado")
+	result := ""
+	if len(results) > 0 {
+		result = results[0]
+	}
 
 	expectedData := map[string]interface{}{
 		"StartSignal":           "$$",
@@ -136,3 +149,99 @@ func TestInitializeWithBinaryFile(t *testing.T) {
 
 	assert.Equal(t, expectedData, resultMap, "El resultado no coincide con el esperado")
 }
+
+func TestInitializeReturnMessageJono(t *testing.T) {
+	definitions, err := usecases.LoadMessageDefinitions(nil)
+	assert.NoError(t, err)
+
+	// AVL IgnitionOn (SIN 126 MIN 14), its raw payload is passed along in Message
+	message := models.ReturnedMessages{
+		ID:         10,
+		MessageUTC: "2024-01-01 12:00:05",
+		MobileID:   "01234567SKY1",
+		RawPayload: "fg4AAAAA",
+		Payload: models.Payload{Name: "IgnitionOn", Sin: "126", Min: "14", Fields: models.Fields{Fields: []models.Field{
+			{Name: "Latitude", Value: "1171300"},
+			{Name: "Longitude", Value: "-5952696"},
+			{Name: "GpsFixAge", Value: "20"},
+			{Name: "GeofenceID", Value: "7"},
+			{Name: "Odometer", Value: "1234500"},
+			{Name: "IgnitionOn", Value: "True"},
+		}}},
+	}
+	data, err := InitializeReturnMessage(message, definitions)
+	assert.NoError(t, err)
+	result, err := jono.Initialize(data)
+	assert.NoError(t, err)
+
+	var parsed jonomodels.ParsedModel
+	assert.NoError(t, json.Unmarshal([]byte(result), &parsed))
+	packet := parsed.ListPackets["packet_1"]
+	if assert.NotNil(t, packet.GeofenceID) && assert.NotNil(t, packet.GpsFixAge) && assert.NotNil(t, packet.Mileage) {
+		assert.Equal(t, 7, *packet.GeofenceID)
+		assert.Equal(t, 20, *packet.GpsFixAge)
+		assert.Equal(t, 1234500, *packet.Mileage)
+	}
+	assert.Equal(t, "1", *packet.SystemFlag.ACC)
+	assert.Nil(t, parsed.RawPayload)
+
+	// Without a definition only the raw payload is passed on
+	message.RawPayload = "gAEC" // SIN 128 MIN 1
+	message.Payload = models.Payload{}
+	data, err = InitializeReturnMessage(message, usecases.NewMessageDefinitions())
+	assert.NoError(t, err)
+	result, err = jono.Initialize(data)
+	assert.NoError(t, err)
+
+	parsed = jonomodels.ParsedModel{}
+	assert.NoError(t, json.Unmarshal([]byte(result), &parsed))
+	if assert.NotNil(t, parsed.RawPayload) {
+		assert.Equal(t, "gAEC", *parsed.RawPayload)
+	}
+	assert.Nil(t, parsed.ListPackets["packet_1"].GeofenceID)
+}
+
+func TestInitializeReturnMessages(t *testing.T) {
+	definitions, err := usecases.LoadMessageDefinitions(nil)
+	assert.NoError(t, err)
+
+	// A gateway response with a position, an undefined message and one without MobileID
+	data, err := os.ReadFile("return_messages.xml")
+	assert.NoError(t, err)
+	results, err := Initialize(string(data), definitions)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "48613919")
+	}
+	if !assert.Len(t, results, 2) {
+		return
+	}
+
+	var parsed []jonomodels.ParsedModel
+	for _, data := range results {
+		result, err := jono.Initialize(data)
+		assert.NoError(t, err)
+		var model jonomodels.ParsedModel
+		assert.NoError(t, json.Unmarshal([]byte(result), &model))
+		parsed = append(parsed, model)
+	}
+	if assert.NotNil(t, parsed[0].IMEI) {
+		assert.Equal(t, "01097423SKY3A09", *parsed[0].IMEI)
+	}
+	packet := parsed[0].ListPackets["packet_1"]
+	if assert.NotNil(t, packet.Latitude) && assert.NotNil(t, packet.GpsFixAge) {
+		assert.InDelta(t, 19.521, *packet.Latitude, 0.001)
+		assert.Equal(t, 12, *packet.GpsFixAge)
+	}
+	if assert.NotNil(t, parsed[1].RawPayload) {
+		assert.Equal(t, "gAEC", *parsed[1].RawPayload)
+	}
+
+	// A single ReturnMessage, as archived from the gateway, is accepted too
+	results, err = Initialize(`<ReturnMessage><ID>48613918</ID><MessageUTC>2024-09-19 23:58:40</MessageUTC>`+
+		`<SIN>128</SIN><MobileID>01097423SKY3A09</MobileID><RawPayload>gAEC</RawPayload></ReturnMessage>`, definitions)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	_, err = Initialize(`<GetReturnMessagesResult><ErrorID>21785</ErrorID></GetReturnMessagesResult>`, definitions)
+	assert.EqualError(t, err, "no return messages in data, error ID 21785")
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"skywaveprotocol/features/skywave_protocol/helpers"
+	"strings"
+)
+
+// FieldMapping maps a message field to the Jono packet keys it fills
+type FieldMapping struct {
+	Keys       []string
+	Conversion func(string) any
+}
+
+// FieldMappings is keyed by NormalizeFieldName, so the same entry covers the field names used by
+// the AVL agent ("GpsFixAge") and by the core services ("gps_fix_age"). Fields not listed are ignored.
+var FieldMappings = map[string]FieldMapping{
+	"latitude":       {Keys: []string{"Latitude"}, Conversion: helpers.MinuteThousandths},
+	"longitude":      {Keys: []string{"Longitude"}, Conversion: helpers.MinuteThousandths},
+	"speed":          {Keys: []string{"Speed"}, Conversion: helpers.NumericValue},     // km/h
+	"heading":        {Keys: []string{"Direction"}, Conversion: helpers.NumericValue}, // degrees
+	"altitude":       {Keys: []string{"Altitude"}, Conversion: helpers.NumericValue},  // m
+	"eventtime":      {Keys: []string{"Datetime"}, Conversion: helpers.UnixTime},
+	"fixtime":        {Keys: []string{"Datetime"}, Conversion: helpers.UnixTime},
+	"gpsfixage":      {Keys: []string{"GpsFixAge"}, Conversion: helpers.NumericValue}, // s
+	"fixage":         {Keys: []string{"GpsFixAge"}, Conversion: helpers.NumericValue},
+	"numsats":        {Keys: []string{"NumberOfSatellites"}, Conversion: helpers.NumericValue},
+	"hdop":           {Keys: []string{"HDOP"}, Conversion: helpers.NumericValue},
+	"odometer":       {Keys: []string{"Mileage"}, Conversion: helpers.NumericValue}, // m
+	"mainpower":      {Keys: []string{"AD5"}, Conversion: helpers.MilliVolts},
+	"powervoltage":   {Keys: []string{"AD5"}, Conversion: helpers.MilliVolts},
+	"batteryvoltage": {Keys: []string{"AD4"}, Conversion: helpers.MilliVolts},
+	"ignitionon":     {Keys: []string{"ACC"}, Conversion: helpers.BooleanFlag},
+	"ignition":       {Keys: []string{"ACC"}, Conversion: helpers.BooleanFlag},
+	"diginp1":        {Keys: []string{"Input1"}, Conversion: helpers.BooleanFlag},
+	"diginp2":        {Keys: []string{"Input2"}, Conversion: helpers.BooleanFlag},
+	"diginp3":        {Keys: []string{"Input3"}, Conversion: helpers.BooleanFlag},
+	"diginp4":        {Keys: []string{"Input4"}, Conversion: helpers.BooleanFlag},
+	"digout1":        {Keys: []string{"Output1"}, Conversion: helpers.BooleanFlag},
+	"digout2":        {Keys: []string{"Output2"}, Conversion: helpers.BooleanFlag},
+	"geofenceid":     {Keys: []string{"GeofenceID"}, Conversion: helpers.NumericValue},
+}
+
+// ServiceFieldMappings replace FieldMappings for the services that encode a field differently.
+// The modem position (SIN 0) has its heading in 2 degree steps and its time as day of month and
+// minute of day, completed with the month of the message (see usecases.ReturnMessageData).
+var ServiceFieldMappings = map[int]map[string]FieldMapping{
+	0: {
+		"heading":     {Keys: []string{"Direction"}, Conversion: helpers.TwoDegreeSteps},
+		"dayofmonth":  {Keys: []string{"DayOfMonth"}, Conversion: helpers.NumericValue},
+		"minuteofday": {Keys: []string{"MinuteOfDay"}, Conversion: helpers.NumericValue},
+	},
+}
+
+// NormalizeFieldName lower cases a field name and drops underscores
+func NormalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
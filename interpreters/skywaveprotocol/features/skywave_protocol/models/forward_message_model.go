@@ -0,0 +1,101 @@
+package models
+
+// ForwardCommand is a vendor-neutral command for a terminal, received on the command topic
+type ForwardCommand struct {
+	ID       string         `json:"id"`
+	IMEI     string         `json:"imei"`    // Terminal MobileID
+	Command  string         `json:"command"` // e.g. "poll_position", "set_report_interval", "cancel"
+	Params   map[string]any `json:"params,omitempty"`
+	AccessID uint64         `json:"access_id,omitempty"` // Gateway account, found from the MobileID if empty
+	Timeout  int            `json:"timeout,omitempty"`   // Seconds to wait for delivery
+}
+
+// Command outcomes reported on the result topic
+const (
+	ForwardSubmitted = "submitted"
+	ForwardDelivered = "delivered"
+	ForwardFailed    = "failed"
+	ForwardTimeout   = "timeout"
+	ForwardCancelled = "cancelled"
+	ForwardError     = "error"
+)
+
+// ForwardResult reports the outcome of a ForwardCommand
+type ForwardResult struct {
+	ID               string `json:"id"`
+	IMEI             string `json:"imei"`
+	Command          string `json:"command"`
+	Status           string `json:"status"`
+	ForwardMessageID uint64 `json:"forward_message_id,omitempty"`
+	State            int    `json:"state"`
+	ErrorID          uint64 `json:"error_id,omitempty"`
+	Error            string `json:"error,omitempty"`
+	StateUTC         string `json:"state_utc,omitempty"`
+}
+
+// Forward message states of get_forward_statuses
+const (
+	ForwardStateSubmitted      = 0
+	ForwardStateReceived       = 1
+	ForwardStateError          = 2
+	ForwardStateDeliveryFailed = 3
+	ForwardStateTimedOut       = 4
+	ForwardStateCancelled      = 5
+	ForwardStateWaiting        = 6
+)
+
+// ForwardMessage is a to-mobile message for submit_messages
+type ForwardMessage struct {
+	DestinationID string         `json:"DestinationID"`
+	UserMessageID uint64         `json:"UserMessageID"`
+	Payload       ForwardPayload `json:"Payload"`
+}
+
+type ForwardPayload struct {
+	Name      string         `json:"Name"`
+	SIN       int            `json:"SIN"`
+	MIN       int            `json:"MIN"`
+	IsForward bool           `json:"IsForward"`
+	Fields    []ForwardField `json:"Fields"`
+}
+
+type ForwardField struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+	Type  string `json:"Type,omitempty"`
+}
+
+// ForwardSubmission is the gateway answer for a submitted or cancelled message
+type ForwardSubmission struct {
+	ForwardMessageID uint64 `json:"ForwardMessageID"`
+	DestinationID    string `json:"DestinationID"`
+	UserMessageID    uint64 `json:"UserMessageID"`
+	ErrorID          uint64 `json:"ErrorID"`
+	StateUTC         string `json:"StateUTC"`
+}
+
+type SubmitForwardMessagesResult struct {
+	Result struct {
+		ErrorID     uint64              `json:"ErrorID"`
+		Submissions []ForwardSubmission `json:"Submissions"`
+	} `json:"SubmitForwardMessages_JResult"`
+}
+
+// ForwardStatus is the delivery state of a forward message
+type ForwardStatus struct {
+	ForwardMessageID uint64 `json:"ForwardMessageID"`
+	State            int    `json:"State"`
+	ErrorID          uint64 `json:"ErrorID"`
+	StateUTC         string `json:"StateUTC"`
+	IsClosed         bool   `json:"IsClosed"`
+}
+
+type GetForwardStatusesResult struct {
+	ErrorID  uint64          `json:"ErrorID"`
+	Statuses []ForwardStatus `json:"Statuses"`
+}
+
+type CancelForwardMessagesResult struct {
+	ErrorID     uint64              `json:"ErrorID"`
+	Submissions []ForwardSubmission `json:"Submissions"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "encoding/xml"
+
+// MessageDefinition is a terminal message definition file (MDF): the services installed on the
+// terminal and the fields of their messages, as exported for the gateway
+type MessageDefinition struct {
+	XMLName  xml.Name            `xml:"MessageDefinition"`
+	Services []ServiceDefinition `xml:"Services>Service"`
+}
+
+// ServiceDefinition is a service (core service or Lua agent) identified by its SIN
+type ServiceDefinition struct {
+	Name            string          `xml:"Name"`
+	SIN             int             `xml:"SIN"`
+	ForwardMessages []MessageFields `xml:"ForwardMessages>Message"`
+	ReturnMessages  []MessageFields `xml:"ReturnMessages>Message"`
+}
+
+// MessageFields describes a message of a service, identified by its MIN
+type MessageFields struct {
+	Name   string            `xml:"Name"`
+	MIN    int               `xml:"MIN"`
+	Fields []FieldDefinition `xml:"Fields>Field"`
+}
+
+// Field types of a message definition (xsi:type)
+const (
+	BooleanField     = "BooleanField"
+	EnumField        = "EnumField"
+	UnsignedIntField = "UnsignedIntField"
+	SignedIntField   = "SignedIntField"
+	StringField      = "StringField"
+	DataField        = "DataField"
+	ArrayField       = "ArrayField"
+)
+
+// FieldDefinition is a field of a message, Size is in bits for integers and enums,
+// in characters/bytes/elements for strings, data and arrays
+type FieldDefinition struct {
+	Type     string            `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Name     string            `xml:"Name"`
+	Size     int               `xml:"Size"`
+	Fixed    bool              `xml:"Fixed"`
+	Optional bool              `xml:"Optional"`
+	Items    []string          `xml:"Items>string"`
+	Fields   []FieldDefinition `xml:"Fields>Field"`
+}
+
+// DefinedMessage is a return message found in the loaded definitions
+type DefinedMessage struct {
+	Service string
+	SIN     int
+	MessageFields
+}
@@ -25,9 +25,10 @@ type ReturnedMessages struct {
 	ID             uint64   `json:"id" xml:"ID"`
 	MessageUTC     string   `json:"messageUTC" xml:"MessageUTC"`
 	ReceiveUTC     string   `json:"receiveUTC" xml:"ReceiveUTC"`
-	SIN            int64    `json:"sin" xml:"ReturnMessage"`
+	SIN            int64    `json:"sin" xml:"SIN"`
 	MobileID       string   `json:"mobileid" xml:"MobileID"`
 	Payload        Payload  `json:"payload" xml:"Payload,omitempty"`
+	RawPayload     string   `json:"rawpayload" xml:"RawPayload,omitempty"` // base64, SIN and MIN in the first two bytes
 	RegionName     string   `json:"regionmame" xml:"RegionName"`
 	OtaMessageSize string   `json:"otamessagesize" xml:"OTAMessageSize"`
 }
@@ -50,21 +51,3 @@ type Field struct {
 	Name    string   `json:"name" xml:"Name,attr"`
 	Value   string   `json:"value" xml:"Value,attr"`
 }
-
-type PayloadBridge struct {
-	ID             uint64 `json:"id"`
-	MessageUTC     string `json:"messageUTC"`
-	ReceiveUTC     string `json:"receiveUTC"`
-	SIN            int64  `json:"sin"`
-	MobileID       string `json:"mobileid"`
-	RegionName     string `json:"regionname"`
-	OtaMessageSize string `json:"otamessagesize"`
-	Type           string `json:"type"`
-	Min            string `json:"min"`
-	Latitude       string `json:"latitude"`
-	Longitude      string `json:"longitude"`
-	Speed          string `json:"speed"`
-	Heading        string `json:"heading"`
-	EventTime      string `json:"eventtime"`
-	GpsFixAge      string `json:"gpsfixage"`
-}
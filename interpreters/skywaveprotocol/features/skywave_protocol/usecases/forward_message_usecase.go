@@ -0,0 +1,170 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"skywaveprotocol/features/skywave_protocol/config"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"strconv"
+	"strings"
+)
+
+// EncodeForwardMessage encodes a vendor-neutral command as the SIN/MIN forward message listed in config.ForwardCommands
+func EncodeForwardMessage(command models.ForwardCommand, userMessageID uint64) (models.ForwardMessage, error) {
+	definition, exists := config.ForwardCommands[command.Command]
+	if !exists {
+		return models.ForwardMessage{}, fmt.Errorf("unsupported command %q", command.Command)
+	}
+	if command.IMEI == "" {
+		return models.ForwardMessage{}, fmt.Errorf("command %q without imei", command.Command)
+	}
+
+	payload := models.ForwardPayload{Name: definition.Name, SIN: definition.SIN, MIN: definition.MIN, IsForward: true}
+	for _, field := range definition.Fields {
+		value := field.Value
+		if param, exists := command.Params[field.Param]; field.Param != "" && exists {
+			value = paramValue(param)
+		}
+		if value == "" {
+			if field.Required {
+				return models.ForwardMessage{}, fmt.Errorf("command %q requires param %q", command.Command, field.Param)
+			}
+			continue
+		}
+		payload.Fields = append(payload.Fields, models.ForwardField{Name: field.Name, Value: value, Type: field.Type})
+	}
+
+	return models.ForwardMessage{DestinationID: command.IMEI, UserMessageID: userMessageID, Payload: payload}, nil
+}
+
+// paramValue formats a JSON command parameter as a gateway field value
+func paramValue(param any) string {
+	switch value := param.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		if value {
+			return "True"
+		}
+		return "False"
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", param)
+}
+
+// ForwardGateway submits, tracks and cancels forward messages on the IsatData Pro gateway
+type ForwardGateway struct {
+	URL    string // Gateway service URL, DefaultGatewayURL if empty
+	Client *http.Client
+}
+
+func (g *ForwardGateway) endpoint(operation string, query url.Values) string {
+	gatewayURL := g.URL
+	if gatewayURL == "" {
+		gatewayURL = DefaultGatewayURL
+	}
+	endpoint := strings.TrimSuffix(gatewayURL, "/") + "/" + operation + "/"
+	if query != nil {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+func (g *ForwardGateway) do(request *http.Request, result any) error {
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response with status code %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("error parsing gateway response: %v", err)
+	}
+	return nil
+}
+
+// Submit sends forward messages, the submissions come back in the same order
+func (g *ForwardGateway) Submit(account GatewayAccount, messages []models.ForwardMessage) ([]models.ForwardSubmission, error) {
+	body, err := json.Marshal(map[string]any{
+		"accessID": strconv.FormatUint(account.AccessID, 10),
+		"password": account.Password,
+		"messages": messages,
+	})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodPost, g.endpoint("submit_messages.json", nil), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	var result models.SubmitForwardMessagesResult
+	if err := g.do(request, &result); err != nil {
+		return nil, err
+	}
+	if result.Result.ErrorID != 0 {
+		return nil, fmt.Errorf("gateway error %d", result.Result.ErrorID)
+	}
+	return result.Result.Submissions, nil
+}
+
+// Statuses returns the delivery state of forward messages
+func (g *ForwardGateway) Statuses(account GatewayAccount, ids []uint64) ([]models.ForwardStatus, error) {
+	request, err := http.NewRequest(http.MethodGet, g.endpoint("get_forward_statuses.json", forwardQuery(account, ids)), nil)
+	if err != nil {
+		return nil, err
+	}
+	var result models.GetForwardStatusesResult
+	if err := g.do(request, &result); err != nil {
+		return nil, err
+	}
+	if result.ErrorID != 0 {
+		return nil, fmt.Errorf("gateway error %d", result.ErrorID)
+	}
+	return result.Statuses, nil
+}
+
+// Cancel cancels forward messages that were not delivered yet
+func (g *ForwardGateway) Cancel(account GatewayAccount, ids []uint64) ([]models.ForwardSubmission, error) {
+	request, err := http.NewRequest(http.MethodGet, g.endpoint("cancel_messages.json", forwardQuery(account, ids)), nil)
+	if err != nil {
+		return nil, err
+	}
+	var result models.CancelForwardMessagesResult
+	if err := g.do(request, &result); err != nil {
+		return nil, err
+	}
+	if result.ErrorID != 0 {
+		return nil, fmt.Errorf("gateway error %d", result.ErrorID)
+	}
+	return result.Submissions, nil
+}
+
+func forwardQuery(account GatewayAccount, ids []uint64) url.Values {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.FormatUint(id, 10)
+	}
+	query := url.Values{}
+	query.Set("access_id", strconv.FormatUint(account.AccessID, 10))
+	query.Set("password", account.Password)
+	query.Set("fwIDs", strings.Join(values, ","))
+	return query
+}
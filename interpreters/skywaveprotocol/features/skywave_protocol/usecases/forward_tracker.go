@@ -0,0 +1,282 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"sync"
+	"time"
+)
+
+// CancelCommand cancels a pending command, its params carry the "id" of the command to cancel
+const CancelCommand = "cancel"
+
+type pendingForward struct {
+	command   models.ForwardCommand
+	account   GatewayAccount
+	messageID uint64
+	deadline  time.Time
+}
+
+// ForwardTracker submits commands as forward messages and follows them until they are delivered,
+// fail or time out. Every outcome is passed to Report.
+type ForwardTracker struct {
+	Gateway  *ForwardGateway
+	Accounts []GatewayAccount
+	Timeout  time.Duration // Default delivery timeout, commands may ask for another one
+	Report   func(models.ForwardResult)
+
+	now        func() time.Time
+	mutex      sync.Mutex
+	terminals  map[string]uint64 // MobileID to access ID, learned from return messages
+	pending    map[uint64]*pendingForward
+	nextUserID uint64
+}
+
+// ForwardTrackerOption configures a ForwardTracker
+type ForwardTrackerOption func(*ForwardTracker)
+
+// WithClock sets the clock the delivery timeouts are measured with
+func WithClock(now func() time.Time) ForwardTrackerOption {
+	return func(t *ForwardTracker) { t.now = now }
+}
+
+// NewForwardTracker creates a tracker for the given gateway accounts
+func NewForwardTracker(gateway *ForwardGateway, accounts []GatewayAccount, timeout time.Duration, report func(models.ForwardResult), options ...ForwardTrackerOption) *ForwardTracker {
+	tracker := &ForwardTracker{
+		Gateway:    gateway,
+		Accounts:   accounts,
+		Timeout:    timeout,
+		Report:     report,
+		now:        time.Now,
+		terminals:  make(map[string]uint64),
+		pending:    make(map[uint64]*pendingForward),
+		nextUserID: uint64(time.Now().Unix()),
+	}
+	for _, option := range options {
+		option(tracker)
+	}
+	return tracker
+}
+
+// LearnTerminal records the account a terminal reports through
+func (t *ForwardTracker) LearnTerminal(mobileID string, accessID uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.terminals[mobileID] = accessID
+}
+
+// account picks the gateway account of a command: the one requested, the one the terminal
+// reports through, or the only configured account
+func (t *ForwardTracker) account(command models.ForwardCommand) (GatewayAccount, error) {
+	t.mutex.Lock()
+	accessID := command.AccessID
+	if accessID == 0 {
+		accessID = t.terminals[command.IMEI]
+	}
+	t.mutex.Unlock()
+
+	if accessID == 0 && len(t.Accounts) == 1 {
+		return t.Accounts[0], nil
+	}
+	for _, account := range t.Accounts {
+		if account.AccessID == accessID {
+			return account, nil
+		}
+	}
+	return GatewayAccount{}, fmt.Errorf("no gateway account for terminal %s", command.IMEI)
+}
+
+func result(command models.ForwardCommand, status string) models.ForwardResult {
+	return models.ForwardResult{ID: command.ID, IMEI: command.IMEI, Command: command.Command, Status: status}
+}
+
+func (t *ForwardTracker) fail(command models.ForwardCommand, err error) error {
+	failed := result(command, models.ForwardError)
+	failed.Error = err.Error()
+	t.Report(failed)
+	return err
+}
+
+// Submit sends a command to its terminal and starts tracking it
+func (t *ForwardTracker) Submit(command models.ForwardCommand) error {
+	if command.Command == CancelCommand {
+		id, _ := command.Params["id"].(string)
+		if err := t.Cancel(id); err != nil {
+			return t.fail(command, err)
+		}
+		return nil
+	}
+
+	account, err := t.account(command)
+	if err != nil {
+		return t.fail(command, err)
+	}
+
+	t.mutex.Lock()
+	t.nextUserID++
+	userID := t.nextUserID
+	t.mutex.Unlock()
+
+	message, err := EncodeForwardMessage(command, userID)
+	if err != nil {
+		return t.fail(command, err)
+	}
+	submissions, err := t.Gateway.Submit(account, []models.ForwardMessage{message})
+	if err != nil {
+		return t.fail(command, err)
+	}
+	if len(submissions) != 1 || submissions[0].ErrorID != 0 || submissions[0].ForwardMessageID == 0 {
+		failed := result(command, models.ForwardError)
+		if len(submissions) == 1 {
+			failed.ErrorID = submissions[0].ErrorID
+		}
+		failed.Error = "submission rejected by the gateway"
+		t.Report(failed)
+		return errors.New(failed.Error)
+	}
+
+	timeout := t.Timeout
+	if command.Timeout > 0 {
+		timeout = time.Duration(command.Timeout) * time.Second
+	}
+	submission := submissions[0]
+	t.mutex.Lock()
+	t.pending[submission.ForwardMessageID] = &pendingForward{
+		command:   command,
+		account:   account,
+		messageID: submission.ForwardMessageID,
+		deadline:  t.now().Add(timeout),
+	}
+	t.mutex.Unlock()
+
+	submitted := result(command, models.ForwardSubmitted)
+	submitted.ForwardMessageID = submission.ForwardMessageID
+	submitted.StateUTC = submission.StateUTC
+	t.Report(submitted)
+	return nil
+}
+
+// Cancel cancels a pending command by its id, the outcome is reported by the next Poll.
+// A cancel command that fails is reported as an error by Submit.
+func (t *ForwardTracker) Cancel(id string) error {
+	t.mutex.Lock()
+	var found *pendingForward
+	for _, pending := range t.pending {
+		if pending.command.ID == id {
+			found = pending
+			break
+		}
+	}
+	t.mutex.Unlock()
+
+	if found == nil {
+		return fmt.Errorf("no pending command %q", id)
+	}
+	submissions, err := t.Gateway.Cancel(found.account, []uint64{found.messageID})
+	if err != nil {
+		return err
+	}
+	if len(submissions) == 1 && submissions[0].ErrorID != 0 {
+		return fmt.Errorf("cancel rejected by the gateway, error %d", submissions[0].ErrorID)
+	}
+	return nil
+}
+
+// Pending returns the number of commands waiting for delivery
+func (t *ForwardTracker) Pending() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.pending)
+}
+
+// Poll fetches the state of every pending command, reporting and forgetting the finished ones.
+// Commands past their deadline are cancelled and reported as timed out.
+func (t *ForwardTracker) Poll() error {
+	t.mutex.Lock()
+	byAccount := make(map[uint64][]*pendingForward)
+	for _, pending := range t.pending {
+		byAccount[pending.account.AccessID] = append(byAccount[pending.account.AccessID], pending)
+	}
+	t.mutex.Unlock()
+
+	var errs []error
+	for _, pendings := range byAccount {
+		account := pendings[0].account
+		ids := make([]uint64, len(pendings))
+		for i, pending := range pendings {
+			ids[i] = pending.messageID
+		}
+
+		statuses, err := t.Gateway.Statuses(account, ids)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("account %d: %w", account.AccessID, err))
+			continue
+		}
+		states := make(map[uint64]models.ForwardStatus, len(statuses))
+		for _, status := range statuses {
+			states[status.ForwardMessageID] = status
+		}
+
+		for _, pending := range pendings {
+			status := states[pending.messageID]
+			outcome := forwardOutcome(status.State)
+			if outcome == "" && t.now().After(pending.deadline) {
+				if _, err := t.Gateway.Cancel(account, []uint64{pending.messageID}); err != nil {
+					errs = append(errs, fmt.Errorf("cancel %d: %w", pending.messageID, err))
+				}
+				outcome = models.ForwardTimeout
+			}
+			if outcome == "" {
+				continue
+			}
+
+			t.mutex.Lock()
+			delete(t.pending, pending.messageID)
+			t.mutex.Unlock()
+
+			finished := result(pending.command, outcome)
+			finished.ForwardMessageID = pending.messageID
+			finished.State = status.State
+			finished.ErrorID = status.ErrorID
+			finished.StateUTC = status.StateUTC
+			t.Report(finished)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forwardOutcome maps a final forward state to its result status, "" while the message is still open
+func forwardOutcome(state int) string {
+	switch state {
+	case models.ForwardStateReceived:
+		return models.ForwardDelivered
+	case models.ForwardStateError, models.ForwardStateDeliveryFailed:
+		return models.ForwardFailed
+	case models.ForwardStateTimedOut:
+		return models.ForwardTimeout
+	case models.ForwardStateCancelled:
+		return models.ForwardCancelled
+	}
+	return ""
+}
+
+// Run polls the pending commands each interval until ctx is done
+func (t *ForwardTracker) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if t.Pending() == 0 {
+			continue
+		}
+		if err := t.Poll(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package usecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeForwardGateway accepts forward messages and reports the states set by the test
+type fakeForwardGateway struct {
+	mutex     sync.Mutex
+	submitted []models.ForwardMessage
+	states    map[uint64]int
+	cancelled []string
+	nextID    uint64
+}
+
+func (g *fakeForwardGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/submit_messages.json/"):
+		var request struct {
+			AccessID string                  `json:"accessID"`
+			Messages []models.ForwardMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.AccessID != "100" {
+			fmt.Fprint(w, `{"SubmitForwardMessages_JResult":{"ErrorID":21785}}`)
+			return
+		}
+		var submissions []string
+		for _, message := range request.Messages {
+			g.nextID++
+			g.submitted = append(g.submitted, message)
+			g.states[g.nextID] = models.ForwardStateSubmitted
+			submissions = append(submissions, fmt.Sprintf(`{"ForwardMessageID":%d,"DestinationID":%q,"UserMessageID":%d,"ErrorID":0,"StateUTC":"2024-01-01 12:00:00"}`,
+				g.nextID, message.DestinationID, message.UserMessageID))
+		}
+		fmt.Fprintf(w, `{"SubmitForwardMessages_JResult":{"ErrorID":0,"Submissions":[%s]}}`, strings.Join(submissions, ","))
+	case strings.HasSuffix(r.URL.Path, "/get_forward_statuses.json/"):
+		var statuses []string
+		for _, id := range strings.Split(r.URL.Query().Get("fwIDs"), ",") {
+			number, _ := strconv.ParseUint(id, 10, 64)
+			statuses = append(statuses, fmt.Sprintf(`{"ForwardMessageID":%d,"State":%d,"ErrorID":0,"StateUTC":"2024-01-01 12:01:00"}`, number, g.states[number]))
+		}
+		fmt.Fprintf(w, `{"ErrorID":0,"Statuses":[%s]}`, strings.Join(statuses, ","))
+	case strings.HasSuffix(r.URL.Path, "/cancel_messages.json/"):
+		ids := r.URL.Query().Get("fwIDs")
+		g.cancelled = append(g.cancelled, ids)
+		number, _ := strconv.ParseUint(ids, 10, 64)
+		g.states[number] = models.ForwardStateCancelled
+		fmt.Fprintf(w, `{"ErrorID":0,"Submissions":[{"ForwardMessageID":%s,"ErrorID":0}]}`, ids)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// forwardAccounts are the gateway accounts of the tracker tests, the fake gateway only accepts 100
+var forwardAccounts = []GatewayAccount{{AccessID: 100, Password: "secret"}, {AccessID: 200, Password: "secret"}}
+
+func TestEncodeForwardMessage(t *testing.T) {
+	message, err := EncodeForwardMessage(models.ForwardCommand{
+		IMEI: "01234567SKY1", Command: "set_report_interval", Params: map[string]any{"minutes": float64(15)},
+	}, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ForwardMessage{
+		DestinationID: "01234567SKY1",
+		UserMessageID: 7,
+		Payload: models.ForwardPayload{Name: "SetReportInterval", SIN: 126, MIN: 1, IsForward: true, Fields: []models.ForwardField{
+			{Name: "MovingInterval", Value: "15", Type: "unsignedint"},
+		}},
+	}, message)
+
+	_, err = EncodeForwardMessage(models.ForwardCommand{IMEI: "01234567SKY1", Command: "set_report_interval"}, 8)
+	assert.ErrorContains(t, err, "requires param")
+
+	_, err = EncodeForwardMessage(models.ForwardCommand{IMEI: "01234567SKY1", Command: "self_destruct"}, 9)
+	assert.Error(t, err)
+}
+
+func TestForwardTrackerDelivered(t *testing.T) {
+	gateway := &fakeForwardGateway{states: make(map[uint64]int)}
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+
+	var results []models.ForwardResult
+	tracker := NewForwardTracker(&ForwardGateway{URL: server.URL}, forwardAccounts, time.Minute, func(result models.ForwardResult) {
+		results = append(results, result)
+	})
+	tracker.LearnTerminal("01234567SKY1", 100)
+
+	assert.NoError(t, tracker.Submit(models.ForwardCommand{ID: "cmd-1", IMEI: "01234567SKY1", Command: "immobilize"}))
+	assert.Len(t, gateway.submitted, 1)
+	assert.Equal(t, 126, gateway.submitted[0].Payload.SIN)
+	assert.Equal(t, models.ForwardSubmitted, results[0].Status)
+
+	// Still on its way
+	assert.NoError(t, tracker.Poll())
+	assert.Len(t, results, 1)
+	assert.Equal(t, 1, tracker.Pending())
+
+	gateway.states[1] = models.ForwardStateReceived
+	assert.NoError(t, tracker.Poll())
+	assert.Equal(t, models.ForwardResult{
+		ID: "cmd-1", IMEI: "01234567SKY1", Command: "immobilize", Status: models.ForwardDelivered,
+		ForwardMessageID: 1, State: models.ForwardStateReceived, StateUTC: "2024-01-01 12:01:00",
+	}, results[1])
+	assert.Equal(t, 0, tracker.Pending())
+}
+
+func TestForwardTrackerTimeoutAndCancel(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	gateway := &fakeForwardGateway{states: make(map[uint64]int)}
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+
+	var results []models.ForwardResult
+	tracker := NewForwardTracker(&ForwardGateway{URL: server.URL}, forwardAccounts, time.Minute, func(result models.ForwardResult) {
+		results = append(results, result)
+	}, WithClock(func() time.Time { return now }))
+	tracker.LearnTerminal("01234567SKY1", 100)
+
+	assert.NoError(t, tracker.Submit(models.ForwardCommand{ID: "cmd-1", IMEI: "01234567SKY1", Command: "poll_position", Timeout: 30}))
+	assert.NoError(t, tracker.Submit(models.ForwardCommand{ID: "cmd-2", IMEI: "01234567SKY1", Command: "poll_position"}))
+
+	// cmd-1 times out and is cancelled on the gateway
+	now = now.Add(45 * time.Second)
+	assert.NoError(t, tracker.Poll())
+	assert.Equal(t, []string{"1"}, gateway.cancelled)
+	assert.Equal(t, "cmd-1", results[2].ID)
+	assert.Equal(t, models.ForwardTimeout, results[2].Status)
+
+	// cmd-2 is cancelled on request
+	assert.NoError(t, tracker.Submit(models.ForwardCommand{Command: CancelCommand, Params: map[string]any{"id": "cmd-2"}}))
+	assert.NoError(t, tracker.Poll())
+	assert.Equal(t, "cmd-2", results[3].ID)
+	assert.Equal(t, models.ForwardCancelled, results[3].Status)
+	assert.Equal(t, 0, tracker.Pending())
+}
+
+func TestForwardTrackerErrors(t *testing.T) {
+	server := httptest.NewServer(&fakeForwardGateway{states: make(map[uint64]int)})
+	t.Cleanup(server.Close)
+
+	var results []models.ForwardResult
+	tracker := NewForwardTracker(&ForwardGateway{URL: server.URL}, forwardAccounts, time.Minute, func(result models.ForwardResult) {
+		results = append(results, result)
+	})
+	tracker.LearnTerminal("01234567SKY1", 100)
+
+	// Unknown terminal with several accounts configured
+	assert.Error(t, tracker.Submit(models.ForwardCommand{ID: "cmd-1", IMEI: "99999999SKY9", Command: "poll_position"}))
+	// Rejected by the gateway
+	assert.Error(t, tracker.Submit(models.ForwardCommand{ID: "cmd-2", IMEI: "99999999SKY9", Command: "poll_position", AccessID: 200}))
+
+	// Cancel of a command that is not pending
+	assert.Error(t, tracker.Submit(models.ForwardCommand{ID: "cmd-3", IMEI: "01234567SKY1", Command: CancelCommand, Params: map[string]any{"id": "cmd-404"}}))
+
+	assert.Len(t, results, 3)
+	for _, result := range results {
+		assert.Equal(t, models.ForwardError, result.Status)
+		assert.NotEmpty(t, result.Error)
+	}
+	assert.Equal(t, CancelCommand, results[2].Command)
+	assert.Error(t, tracker.Cancel("cmd-404"))
+}
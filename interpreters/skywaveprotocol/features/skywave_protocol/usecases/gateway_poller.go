@@ -0,0 +1,227 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// GatewayAccount is an IsatData Pro gateway account polled for return messages
+type GatewayAccount struct {
+	AccessID uint64
+	Password string
+}
+
+// ParseGatewayAccounts parses "access_id:password[,access_id:password...]"
+func ParseGatewayAccounts(value string) ([]GatewayAccount, error) {
+	var accounts []GatewayAccount
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, password, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid gateway account %q, expected access_id:password", entry)
+		}
+		accessID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway access_id %q: %v", id, err)
+		}
+		accounts = append(accounts, GatewayAccount{AccessID: accessID, Password: password})
+	}
+	return accounts, nil
+}
+
+// GatewayCursor is where the polling of an account resumes
+type GatewayCursor struct {
+	NextID uint64 `json:"next_id"` // From_id of the next request, the NextStartID of the last page
+	LastID uint64 `json:"last_id"` // Last message handled, the ones up to it are not handled again
+}
+
+// NextIDStore persists the cursor of every account in a JSON file,
+// so a restarted poller neither handles messages again nor skips any
+type NextIDStore struct {
+	path    string
+	mutex   sync.Mutex
+	cursors map[string]GatewayCursor
+}
+
+// NewNextIDStore loads the stored cursors from path, a missing file starts every account from 0
+func NewNextIDStore(path string) (*NextIDStore, error) {
+	store := &NextIDStore{path: path, cursors: make(map[string]GatewayCursor)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &store.cursors); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return store, nil
+}
+
+// NextID returns the ID to poll an account from
+func (s *NextIDStore) NextID(accessID uint64) uint64 {
+	return s.Cursor(accessID).NextID
+}
+
+// Cursor returns the cursor of an account
+func (s *NextIDStore) Cursor(accessID uint64) GatewayCursor {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cursors[strconv.FormatUint(accessID, 10)]
+}
+
+// SetCursor stores the cursor of an account, replacing the file atomically
+func (s *NextIDStore) SetCursor(accessID uint64, cursor GatewayCursor) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cursors[strconv.FormatUint(accessID, 10)] = cursor
+	data, err := json.MarshalIndent(s.cursors, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("error saving next IDs: %v", err)
+	}
+	return nil
+}
+
+// GatewayPoller fetches the return messages of every account on a schedule
+type GatewayPoller struct {
+	URL      string // Gateway service URL, DefaultGatewayURL if empty
+	Accounts []GatewayAccount
+	Store    *NextIDStore
+	Interval time.Duration
+	Client   *http.Client
+
+	// Handle is called for every return message, in order. The cursor is stored after every
+	// message: when it fails the page is polled again on the next run, from the failed message on.
+	Handle func(account GatewayAccount, message models.ReturnedMessages) error
+}
+
+// DefaultPollInterval is the time between the polls of a GatewayPoller
+const DefaultPollInterval = time.Minute
+
+// GatewayPollerOption configures a GatewayPoller
+type GatewayPollerOption func(*GatewayPoller)
+
+// WithPollInterval sets the time between the polls of the accounts
+func WithPollInterval(interval time.Duration) GatewayPollerOption {
+	return func(p *GatewayPoller) { p.Interval = interval }
+}
+
+// WithPollClient sets the HTTP client of the gateway requests
+func WithPollClient(client *http.Client) GatewayPollerOption {
+	return func(p *GatewayPoller) { p.Client = client }
+}
+
+// NewGatewayPoller creates a poller of the accounts on the gateway at url, DefaultGatewayURL if
+// empty, that passes every return message to handle
+func NewGatewayPoller(url string, accounts []GatewayAccount, store *NextIDStore, handle func(GatewayAccount, models.ReturnedMessages) error, options ...GatewayPollerOption) *GatewayPoller {
+	poller := &GatewayPoller{
+		URL:      url,
+		Accounts: accounts,
+		Store:    store,
+		Interval: DefaultPollInterval,
+		Handle:   handle,
+	}
+	for _, option := range options {
+		option(poller)
+	}
+	return poller
+}
+
+// Run polls every account each Interval until ctx is done
+func (p *GatewayPoller) Run(ctx context.Context, onError func(error)) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Poll(); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the pending messages of every account
+func (p *GatewayPoller) Poll() error {
+	var errs []error
+	for _, account := range p.Accounts {
+		if err := p.PollAccount(account); err != nil {
+			errs = append(errs, fmt.Errorf("account %d: %w", account.AccessID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PollAccount fetches the pending messages of an account, following More/NextStartID
+// until the gateway has nothing left. The cursor is stored after every message and every page.
+func (p *GatewayPoller) PollAccount(account GatewayAccount) error {
+	for {
+		cursor := p.Store.Cursor(account.AccessID)
+		doc := SkywaveDoc{
+			Access_id: account.AccessID,
+			Password:  account.Password,
+			From_id:   cursor.NextID,
+			URL:       p.URL,
+			Client:    p.Client,
+		}
+		data, err := doc.GetDoc()
+		if err != nil {
+			return err
+		}
+
+		var result models.GetReturnMessagesResult
+		if err := ParseXML(&result, data); err != nil {
+			return fmt.Errorf("error parsing return messages: %v", err)
+		}
+		if result.ErrorId != 0 {
+			return fmt.Errorf("gateway error %d", result.ErrorId)
+		}
+
+		for _, message := range result.Messages.ReturnedMessages {
+			// The gateway IDs grow, the page of a failure or a restart starts with handled messages
+			if message.ID <= cursor.LastID {
+				continue
+			}
+			if err := p.Handle(account, message); err != nil {
+				return fmt.Errorf("message %d: %w", message.ID, err)
+			}
+			cursor.LastID = message.ID
+			if err := p.Store.SetCursor(account.AccessID, cursor); err != nil {
+				return err
+			}
+		}
+
+		// An empty page leaves NextStartID unset
+		if result.NextStartID == 0 || result.NextStartID == cursor.NextID {
+			return nil
+		}
+		cursor.NextID = result.NextStartID
+		if err := p.Store.SetCursor(account.AccessID, cursor); err != nil {
+			return err
+		}
+		if !result.More {
+			return nil
+		}
+	}
+}
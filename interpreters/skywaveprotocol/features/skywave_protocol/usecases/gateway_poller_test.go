@@ -0,0 +1,189 @@
+package usecases
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGateway serves get_return_messages.xml from a list of message IDs per account, pageSize at a time
+type fakeGateway struct {
+	mutex    sync.Mutex
+	messages map[string][]uint64
+	pageSize int
+	requests []string
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !strings.HasSuffix(r.URL.Path, "/get_return_messages.xml/") {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	accessID := query.Get("access_id")
+	fromID, _ := strconv.ParseUint(query.Get("from_id"), 10, 64)
+	g.requests = append(g.requests, accessID+"@"+query.Get("from_id"))
+
+	if query.Get("password") != "secret&"+accessID {
+		fmt.Fprint(w, `<GetReturnMessagesResult><ErrorID>21785</ErrorID></GetReturnMessagesResult>`)
+		return
+	}
+
+	var page []uint64
+	more := false
+	for _, id := range g.messages[accessID] {
+		if id < fromID {
+			continue
+		}
+		if len(page) == g.pageSize {
+			more = true
+			break
+		}
+		page = append(page, id)
+	}
+
+	var body strings.Builder
+	body.WriteString(`<GetReturnMessagesResult><ErrorID>0</ErrorID>`)
+	fmt.Fprintf(&body, `<More>%t</More>`, more)
+	if len(page) > 0 {
+		fmt.Fprintf(&body, `<NextStartID>%d</NextStartID>`, page[len(page)-1]+1)
+	}
+	body.WriteString(`<Messages>`)
+	for _, id := range page {
+		fmt.Fprintf(&body, `<ReturnMessage><ID>%d</ID><MessageUTC>2024-01-01 12:00:00</MessageUTC>`+
+			`<SIN>19</SIN><MobileID>01234567SKY%s</MobileID>`+
+			`<Payload Name="StationaryIntervalSat" SIN="19" MIN="1"><Fields>`+
+			`<Field Name="Latitude" Value="1171300"/><Field Name="Longitude" Value="-5952696"/>`+
+			`<Field Name="Speed" Value="0"/><Field Name="Heading" Value="90"/>`+
+			`<Field Name="EventTime" Value="1704110400"/></Fields></Payload></ReturnMessage>`, id, accessID)
+	}
+	body.WriteString(`</Messages></GetReturnMessagesResult>`)
+	fmt.Fprint(w, body.String())
+}
+
+// recordIDs is a Handle that appends the ID of every message to handled
+func recordIDs(handled *[]uint64) func(GatewayAccount, models.ReturnedMessages) error {
+	return func(account GatewayAccount, message models.ReturnedMessages) error {
+		*handled = append(*handled, message.ID)
+		return nil
+	}
+}
+
+func TestGatewayPollerPaging(t *testing.T) {
+	gateway := &fakeGateway{
+		messages: map[string][]uint64{"100": {10, 11, 12, 13, 14}, "200": {50}},
+		pageSize: 2,
+	}
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	statePath := filepath.Join(t.TempDir(), "next_id.json")
+	accounts := []GatewayAccount{{AccessID: 100, Password: "secret&100"}, {AccessID: 200, Password: "secret&200"}}
+
+	store, err := NewNextIDStore(statePath)
+	assert.NoError(t, err)
+	var handled []uint64
+	poller := NewGatewayPoller(server.URL, accounts, store, recordIDs(&handled))
+	assert.NoError(t, poller.Poll())
+	assert.Equal(t, []uint64{10, 11, 12, 13, 14, 50}, handled)
+	assert.Equal(t, []string{"100@0", "100@12", "100@14", "200@0"}, gateway.requests)
+	assert.Equal(t, uint64(15), store.NextID(100))
+	assert.Equal(t, uint64(51), store.NextID(200))
+
+	// A restarted poller continues from the stored IDs
+	gateway.messages["100"] = append(gateway.messages["100"], 15)
+	gateway.requests = nil
+	store, err = NewNextIDStore(statePath)
+	assert.NoError(t, err)
+	handled = nil
+	restarted := NewGatewayPoller(server.URL, accounts, store, recordIDs(&handled))
+	assert.NoError(t, restarted.Poll())
+	assert.Equal(t, []uint64{15}, handled)
+	assert.Equal(t, []string{"100@15", "200@51"}, gateway.requests)
+}
+
+func TestGatewayPollerErrors(t *testing.T) {
+	server := httptest.NewServer(&fakeGateway{messages: map[string][]uint64{"100": {10, 11}, "200": {50}}, pageSize: 10})
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name     string
+		accounts []GatewayAccount
+		fail     bool
+		err      string
+		handled  []uint64
+	}{
+		// A failing account does not stop the others
+		{"wrong password", []GatewayAccount{{AccessID: 100, Password: "wrong"}, {AccessID: 200, Password: "secret&200"}}, false, "account 100: gateway error 21785", []uint64{50}},
+		// Messages are not skipped when they cannot be handled
+		{"handle failure", []GatewayAccount{{AccessID: 100, Password: "secret&100"}}, true, "message 10: broker down", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewNextIDStore(filepath.Join(t.TempDir(), "next_id.json"))
+			assert.NoError(t, err)
+			var handled []uint64
+			handle := recordIDs(&handled)
+			if tt.fail {
+				handle = func(account GatewayAccount, message models.ReturnedMessages) error {
+					return fmt.Errorf("broker down")
+				}
+			}
+			poller := NewGatewayPoller(server.URL, tt.accounts, store, handle)
+			assert.ErrorContains(t, poller.Poll(), tt.err)
+			assert.Equal(t, tt.handled, handled)
+			assert.Equal(t, uint64(0), store.NextID(100))
+		})
+	}
+}
+
+func TestGatewayPollerFailureMidPage(t *testing.T) {
+	gateway := &fakeGateway{messages: map[string][]uint64{"100": {10, 11, 12, 13}}, pageSize: 10}
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	statePath := filepath.Join(t.TempDir(), "next_id.json")
+	accounts := []GatewayAccount{{AccessID: 100, Password: "secret&100"}}
+
+	store, err := NewNextIDStore(statePath)
+	assert.NoError(t, err)
+	var handled []uint64
+	record := recordIDs(&handled)
+	poller := NewGatewayPoller(server.URL, accounts, store, func(account GatewayAccount, message models.ReturnedMessages) error {
+		if message.ID == 12 {
+			return fmt.Errorf("broker down")
+		}
+		return record(account, message)
+	})
+	assert.ErrorContains(t, poller.Poll(), "message 12: broker down")
+	assert.Equal(t, []uint64{10, 11}, handled)
+	assert.Equal(t, GatewayCursor{NextID: 0, LastID: 11}, store.Cursor(100))
+
+	// The page is fetched again after a restart, the messages handled before the failure are skipped
+	store, err = NewNextIDStore(statePath)
+	assert.NoError(t, err)
+	handled = nil
+	restarted := NewGatewayPoller(server.URL, accounts, store, recordIDs(&handled))
+	assert.NoError(t, restarted.Poll())
+	assert.Equal(t, []uint64{12, 13}, handled)
+	assert.Equal(t, GatewayCursor{NextID: 14, LastID: 13}, store.Cursor(100))
+	assert.Equal(t, []string{"100@0", "100@0"}, gateway.requests)
+}
+
+func TestParseGatewayAccounts(t *testing.T) {
+	accounts, err := ParseGatewayAccounts("100:secret, 200:pass:word")
+	assert.NoError(t, err)
+	assert.Equal(t, []GatewayAccount{{AccessID: 100, Password: "secret"}, {AccessID: 200, Password: "pass:word"}}, accounts)
+
+	_, err = ParseGatewayAccounts("100")
+	assert.Error(t, err)
+}
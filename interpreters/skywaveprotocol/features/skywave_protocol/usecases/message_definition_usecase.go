@@ -0,0 +1,92 @@
+package usecases
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"skywaveprotocol/features/skywave_protocol/config"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"strings"
+)
+
+// MessageDefinitions indexes the return messages of the loaded message definition files by SIN/MIN
+type MessageDefinitions struct {
+	messages map[[2]int]models.DefinedMessage
+}
+
+// NewMessageDefinitions creates an empty index
+func NewMessageDefinitions() *MessageDefinitions {
+	return &MessageDefinitions{messages: make(map[[2]int]models.DefinedMessage)}
+}
+
+// LoadMessageDefinitions loads the default definitions (config.DefaultDefinitions) followed by the
+// given files, or *.xml files of the given directories. Later definitions replace earlier ones.
+func LoadMessageDefinitions(paths []string) (*MessageDefinitions, error) {
+	definitions := NewMessageDefinitions()
+
+	defaults, err := fs.Glob(config.DefaultDefinitions, "definitions/*.xml")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range defaults {
+		data, err := config.DefaultDefinitions.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := definitions.Load(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		files := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(path, "*.xml")); err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("error reading message definition: %v", err)
+			}
+			if err := definitions.Load(data); err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+		}
+	}
+	return definitions, nil
+}
+
+// Load adds the return messages of a message definition file
+func (d *MessageDefinitions) Load(data []byte) error {
+	var definition models.MessageDefinition
+	if err := xml.Unmarshal(data, &definition); err != nil {
+		return fmt.Errorf("invalid message definition: %v", err)
+	}
+	for _, service := range definition.Services {
+		for _, message := range service.ReturnMessages {
+			d.messages[[2]int{service.SIN, message.MIN}] = models.DefinedMessage{
+				Service:       service.Name,
+				SIN:           service.SIN,
+				MessageFields: message,
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the definition of a return message
+func (d *MessageDefinitions) Lookup(sin int, min int) (models.DefinedMessage, bool) {
+	if d == nil {
+		return models.DefinedMessage{}, false
+	}
+	message, exists := d.messages[[2]int{sin, min}]
+	return message, exists
+}
@@ -0,0 +1,172 @@
+package usecases
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"strconv"
+)
+
+var errShortPayload = errors.New("raw payload shorter than its definition")
+
+// bitReader reads the bit-packed fields of a raw payload, most significant bit first
+type bitReader struct {
+	data     []byte
+	position int // in bits
+}
+
+func (r *bitReader) bits(count int) (uint64, error) {
+	if count < 0 || count > 64 || r.position+count > len(r.data)*8 {
+		return 0, errShortPayload
+	}
+	var value uint64
+	for i := 0; i < count; i++ {
+		bit := r.data[(r.position+i)/8] >> (7 - uint((r.position+i)%8)) & 1
+		value = value<<1 | uint64(bit)
+	}
+	r.position += count
+	return value, nil
+}
+
+func (r *bitReader) signed(count int) (int64, error) {
+	value, err := r.bits(count)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+	if value&(1<<uint(count-1)) != 0 {
+		return int64(value) - int64(1)<<uint(count), nil
+	}
+	return int64(value), nil
+}
+
+func (r *bitReader) bytes(count int) ([]byte, error) {
+	data := make([]byte, count)
+	for i := range data {
+		value, err := r.bits(8)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = byte(value)
+	}
+	return data, nil
+}
+
+// length reads the length of a string, data or array field. Fixed fields always have their Size,
+// the others are prefixed with a flag bit followed by a 7 bit (flag 0) or 15 bit (flag 1) length.
+func (r *bitReader) length(field models.FieldDefinition) (int, error) {
+	if field.Fixed {
+		return field.Size, nil
+	}
+	long, err := r.bits(1)
+	if err != nil {
+		return 0, err
+	}
+	size := 7
+	if long == 1 {
+		size = 15
+	}
+	length, err := r.bits(size)
+	return int(length), err
+}
+
+// DecodeRawPayload decodes the base64 raw payload of a return message (SIN and MIN bytes followed by
+// the bit-packed fields) with its definition. The fields come out as the gateway would have parsed
+// them: decimal integers, "True"/"False" booleans, enum item names, text strings and base64 data.
+// Arrays are read past but not reported.
+func DecodeRawPayload(rawPayload string, definition models.DefinedMessage) ([]models.Field, error) {
+	payload, err := base64.StdEncoding.DecodeString(rawPayload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw payload: %v", err)
+	}
+	if len(payload) < 2 {
+		return nil, errShortPayload
+	}
+	if int(payload[0]) != definition.SIN || int(payload[1]) != definition.MIN {
+		return nil, fmt.Errorf("raw payload SIN %d MIN %d does not match %s", payload[0], payload[1], definition.Name)
+	}
+
+	reader := &bitReader{data: payload[2:]}
+	var fields []models.Field
+	if err := decodeFields(reader, definition.Fields, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %v", definition.Name, err)
+	}
+	return fields, nil
+}
+
+func decodeFields(reader *bitReader, definitions []models.FieldDefinition, fields *[]models.Field) error {
+	for _, definition := range definitions {
+		if definition.Optional {
+			present, err := reader.bits(1)
+			if err != nil {
+				return err
+			}
+			if present == 0 {
+				continue
+			}
+		}
+		value, err := decodeField(reader, definition)
+		if err != nil {
+			return fmt.Errorf("field %s: %v", definition.Name, err)
+		}
+		if definition.Type != models.ArrayField {
+			*fields = append(*fields, models.Field{Name: definition.Name, Value: value})
+		}
+	}
+	return nil
+}
+
+func decodeField(reader *bitReader, definition models.FieldDefinition) (string, error) {
+	switch definition.Type {
+	case models.BooleanField:
+		value, err := reader.bits(1)
+		if err != nil {
+			return "", err
+		}
+		if value == 1 {
+			return "True", nil
+		}
+		return "False", nil
+	case models.UnsignedIntField:
+		value, err := reader.bits(definition.Size)
+		return strconv.FormatUint(value, 10), err
+	case models.SignedIntField:
+		value, err := reader.signed(definition.Size)
+		return strconv.FormatInt(value, 10), err
+	case models.EnumField:
+		value, err := reader.bits(definition.Size)
+		if err != nil {
+			return "", err
+		}
+		if int(value) < len(definition.Items) {
+			return definition.Items[value], nil
+		}
+		return strconv.FormatUint(value, 10), nil
+	case models.StringField, models.DataField:
+		length, err := reader.length(definition)
+		if err != nil {
+			return "", err
+		}
+		data, err := reader.bytes(length)
+		if err != nil {
+			return "", err
+		}
+		if definition.Type == models.DataField {
+			return base64.StdEncoding.EncodeToString(data), nil
+		}
+		return string(data), nil
+	case models.ArrayField:
+		length, err := reader.length(definition)
+		if err != nil {
+			return "", err
+		}
+		var elements []models.Field
+		for i := 0; i < length; i++ {
+			if err := decodeFields(reader, definition.Fields, &elements); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported field type %q", definition.Type)
+}
@@ -0,0 +1,160 @@
+package usecases
+
+import (
+	"encoding/base64"
+	"skywaveprotocol/features/skywave_protocol/config"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bitWriter packs test payloads the way the terminals do, most significant bit first
+type bitWriter struct {
+	data  []byte
+	count int
+}
+
+func (w *bitWriter) write(value int64, bits int) *bitWriter {
+	for i := bits - 1; i >= 0; i-- {
+		if w.count%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if value>>uint(i)&1 == 1 {
+			w.data[len(w.data)-1] |= 1 << uint(7-w.count%8)
+		}
+		w.count++
+	}
+	return w
+}
+
+func rawPayload(sin int, min int, fields func(*bitWriter)) string {
+	writer := &bitWriter{}
+	writer.write(int64(sin), 8).write(int64(min), 8)
+	fields(writer)
+	return base64.StdEncoding.EncodeToString(writer.data)
+}
+
+// assertSamePacket checks that the raw payload decodes to the fields parsed by the gateway and to the same Jono packet
+func assertSamePacket(t *testing.T, definitions *MessageDefinitions, parsed models.ReturnedMessages, raw string) map[string]any {
+	unparsed := parsed
+	unparsed.SIN = 0
+	unparsed.Payload = models.Payload{}
+	unparsed.RawPayload = raw
+
+	sin, min := ReturnMessageSINMIN(unparsed)
+	definition, exists := definitions.Lookup(sin, min)
+	assert.True(t, exists)
+	fields, err := DecodeRawPayload(raw, definition)
+	assert.NoError(t, err)
+	assert.Equal(t, parsed.Payload.Fields.Fields, fields)
+
+	fromParsed, err := ReturnMessageData(parsed, definitions)
+	assert.NoError(t, err)
+	fromRaw, err := ReturnMessageData(unparsed, definitions)
+	assert.NoError(t, err)
+	assert.Equal(t, returnPacket(t, fromParsed), returnPacket(t, fromRaw))
+	return returnPacket(t, fromRaw)
+}
+
+func TestDecodeRawPayloadModemPosition(t *testing.T) {
+	definitions, err := LoadMessageDefinitions(nil)
+	assert.NoError(t, err)
+
+	raw := rawPayload(0, 72, func(w *bitWriter) {
+		w.write(1, 8).write(1171300, 24).write(-5952696, 25).write(2240, 15).write(35, 8).write(45, 8).write(1, 5).write(719, 11)
+	})
+	parsed := returnMessage("0", "72",
+		models.Field{Name: "fixStatus", Value: "1"},
+		models.Field{Name: "latitude", Value: "1171300"},
+		models.Field{Name: "longitude", Value: "-5952696"},
+		models.Field{Name: "altitude", Value: "2240"},
+		models.Field{Name: "speed", Value: "35"},
+		models.Field{Name: "heading", Value: "45"},
+		models.Field{Name: "dayOfMonth", Value: "1"},
+		models.Field{Name: "minuteOfDay", Value: "719"},
+	)
+
+	packet := assertSamePacket(t, definitions, parsed, raw)
+	assert.InDelta(t, 19.521667, packet["Latitude"], 0.000001)
+	assert.InDelta(t, -99.2116, packet["Longitude"], 0.000001)
+	assert.Equal(t, 2240.0, packet["Altitude"])
+	assert.Equal(t, 90.0, packet["Direction"])
+	assert.Equal(t, "2024-01-01T11:59:00Z", packet["Datetime"])
+	assert.Equal(t, "A", packet["PositioningStatus"])
+	assert.NotContains(t, packet, "DayOfMonth")
+}
+
+func TestDecodeRawPayloadTerminalReports(t *testing.T) {
+	definitions, err := LoadMessageDefinitions(nil)
+	assert.NoError(t, err)
+
+	// SIN 19 IgnitionOn
+	raw := rawPayload(19, 3, func(w *bitWriter) {
+		w.write(-1171300, 24).write(5952696, 25).write(12, 8).write(270, 9).write(1704110400, 31).write(20, 12).write(1234500, 32)
+	})
+	packet := assertSamePacket(t, definitions, returnMessage("19", "3",
+		models.Field{Name: "latitude", Value: "-1171300"},
+		models.Field{Name: "longitude", Value: "5952696"},
+		models.Field{Name: "speed", Value: "12"},
+		models.Field{Name: "heading", Value: "270"},
+		models.Field{Name: "eventTime", Value: "1704110400"},
+		models.Field{Name: "gpsFixAge", Value: "20"},
+		models.Field{Name: "odometer", Value: "1234500"},
+	), raw)
+	assert.InDelta(t, -19.521667, packet["Latitude"], 0.000001)
+	assert.Equal(t, 270.0, packet["Direction"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", packet["Datetime"])
+	assert.Equal(t, config.CodeModel{Code: 2, Name: "Input 2 Active"}, packet["EventCode"])
+
+	// SIN 20 ZoneExit
+	raw = rawPayload(20, 2, func(w *bitWriter) {
+		w.write(7, 16).write(1171300, 24).write(-5952696, 25).write(0, 8).write(0, 9).write(1704110400, 31)
+	})
+	packet = assertSamePacket(t, definitions, returnMessage("20", "2",
+		models.Field{Name: "geofenceId", Value: "7"},
+		models.Field{Name: "latitude", Value: "1171300"},
+		models.Field{Name: "longitude", Value: "-5952696"},
+		models.Field{Name: "speed", Value: "0"},
+		models.Field{Name: "heading", Value: "0"},
+		models.Field{Name: "eventTime", Value: "1704110400"},
+	), raw)
+	assert.Equal(t, 7.0, packet["GeofenceID"])
+	assert.Equal(t, config.CodeModel{Code: 21, Name: "Exit Geo-fence"}, packet["EventCode"])
+}
+
+func TestDecodeRawPayloadFieldTypes(t *testing.T) {
+	definition := models.DefinedMessage{SIN: 128, MessageFields: models.MessageFields{Name: "Status", MIN: 5, Fields: []models.FieldDefinition{
+		{Type: models.EnumField, Name: "State", Size: 2, Items: []string{"idle", "moving", "parked"}},
+		{Type: models.BooleanField, Name: "Alarm", Optional: true},
+		{Type: models.UnsignedIntField, Name: "Skipped", Size: 8, Optional: true},
+		{Type: models.StringField, Name: "Driver", Size: 16},
+		{Type: models.ArrayField, Name: "Cells", Size: 4, Fields: []models.FieldDefinition{
+			{Type: models.UnsignedIntField, Name: "CellID", Size: 4},
+		}},
+		{Type: models.DataField, Name: "Extra", Size: 2, Fixed: true},
+	}}}
+
+	raw := rawPayload(128, 5, func(w *bitWriter) {
+		w.write(2, 2).write(1, 1).write(1, 1).write(0, 1)
+		w.write(0, 1).write(2, 7).write('J', 8).write('D', 8)
+		w.write(0, 1).write(2, 7).write(3, 4).write(9, 4)
+		w.write(0xCA, 8).write(0xFE, 8)
+	})
+	fields, err := DecodeRawPayload(raw, definition)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Field{
+		{Name: "State", Value: "parked"},
+		{Name: "Alarm", Value: "True"},
+		{Name: "Driver", Value: "JD"},
+		{Name: "Extra", Value: "yv4="},
+	}, fields)
+
+	// Truncated, for another message or not base64
+	_, err = DecodeRawPayload(raw[:8], definition)
+	assert.Error(t, err)
+	_, err = DecodeRawPayload(rawPayload(128, 6, func(*bitWriter) {}), definition)
+	assert.Error(t, err)
+	_, err = DecodeRawPayload("not base64!", definition)
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package usecases
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"skywaveprotocol/features/skywave_protocol/config"
+	"skywaveprotocol/features/skywave_protocol/helpers"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"strconv"
+	"time"
+)
+
+// StaleFixAge is the GPS fix age (seconds) above which a position is no longer reported as valid
+const StaleFixAge = 600
+
+// ReturnMessageData converts a gateway return message into the fields read by the Jono model.
+//
+// The message is named after its definition (SIN/MIN), which gives its event (config.MessageEvents).
+// Its fields are mapped by name (models.FieldMappings). When the gateway did not parse the payload
+// it is decoded from the raw payload with the definition, messages without one are passed on with
+// their raw base64 payload.
+func ReturnMessageData(message models.ReturnedMessages, definitions *MessageDefinitions) (map[string]any, error) {
+	if message.MobileID == "" {
+		return nil, fmt.Errorf("return message %d without MobileID", message.ID)
+	}
+
+	raw, err := xml.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling return message %d: %v", message.ID, err)
+	}
+
+	sin, min := ReturnMessageSINMIN(message)
+	packet := map[string]any{"Datetime": receivedTime(message)}
+	data := map[string]any{
+		"IMEI":        message.MobileID,
+		"Message":     string(raw),
+		"DataPackets": 1,
+		"ListPackets": map[string]any{"packet_1": packet},
+	}
+
+	// Without the gateway's parsing the fields are decoded from the raw payload
+	fields := message.Payload.Fields.Fields
+	definition, defined := definitions.Lookup(sin, min)
+	if len(fields) == 0 && defined && message.RawPayload != "" {
+		if decoded, err := DecodeRawPayload(message.RawPayload, definition); err == nil {
+			fields = decoded
+		}
+	}
+
+	if len(fields) == 0 {
+		packet["PositioningStatus"] = "V"
+		packet["EventCode"] = config.UndefinedEvent
+		packet["EventName"] = fmt.Sprintf("%s SIN %d MIN %d", config.UndefinedEvent.Name, sin, min)
+		data["RawPayload"] = message.RawPayload
+		return data, nil
+	}
+
+	name := message.Payload.Name
+	if defined {
+		name = definition.Name
+	}
+	event, exists := config.MessageEvents[name]
+	if !exists {
+		event = config.PositionEvent
+	}
+	packet["EventCode"] = event
+	packet["EventName"] = event.Name
+
+	for _, field := range fields {
+		normalized := models.NormalizeFieldName(field.Name)
+		mapping, exists := models.ServiceFieldMappings[sin][normalized]
+		if !exists {
+			mapping, exists = models.FieldMappings[normalized]
+		}
+		if !exists {
+			continue
+		}
+		value := mapping.Conversion(field.Value)
+		if value == nil {
+			continue
+		}
+		for _, key := range mapping.Keys {
+			packet[key] = value
+		}
+	}
+
+	day, hasDay := packet["DayOfMonth"].(float64)
+	minute, hasMinute := packet["MinuteOfDay"].(float64)
+	if received, ok := receivedAt(message); hasDay && hasMinute && ok {
+		packet["Datetime"] = helpers.DayMinuteTime(int(day), int(minute), received)
+	}
+	delete(packet, "DayOfMonth")
+	delete(packet, "MinuteOfDay")
+
+	packet["PositioningStatus"] = "V"
+	_, hasLatitude := packet["Latitude"]
+	_, hasLongitude := packet["Longitude"]
+	if fixAge, ok := packet["GpsFixAge"].(float64); hasLatitude && hasLongitude && (!ok || fixAge <= StaleFixAge) {
+		packet["PositioningStatus"] = "A"
+	}
+
+	return data, nil
+}
+
+// ReturnMessageSINMIN returns the service and message numbers of a return message, taken from the
+// decoded payload or from the first two bytes of the raw payload
+func ReturnMessageSINMIN(message models.ReturnedMessages) (int, int) {
+	sin := int(message.SIN)
+	if sin == 0 {
+		sin, _ = strconv.Atoi(message.Payload.Sin)
+	}
+	min, err := strconv.Atoi(message.Payload.Min)
+	if err != nil {
+		if payload, err := base64.StdEncoding.DecodeString(message.RawPayload); err == nil && len(payload) >= 2 {
+			sin, min = int(payload[0]), int(payload[1])
+		}
+	}
+	return sin, min
+}
+
+// receivedTime is the time the message was sent or received by the gateway, used when the payload
+// has no time of its own
+func receivedTime(message models.ReturnedMessages) string {
+	if received, ok := receivedAt(message); ok {
+		return received.Format(time.RFC3339)
+	}
+	return ""
+}
+
+func receivedAt(message models.ReturnedMessages) (time.Time, bool) {
+	for _, value := range []string{message.MessageUTC, message.ReceiveUTC} {
+		if received, err := time.Parse("2006-01-02 15:04:05", value); err == nil {
+			return received, true
+		}
+	}
+	return time.Time{}, false
+}
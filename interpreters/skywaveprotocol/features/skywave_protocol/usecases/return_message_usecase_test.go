@@ -0,0 +1,118 @@
+package usecases
+
+import (
+	"os"
+	"path/filepath"
+	"skywaveprotocol/features/skywave_protocol/config"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func returnMessage(sin string, min string, fields ...models.Field) models.ReturnedMessages {
+	return models.ReturnedMessages{
+		ID:         10,
+		MessageUTC: "2024-01-01 12:00:05",
+		MobileID:   "01234567SKY1",
+		Payload:    models.Payload{Name: "gatewayName", Sin: sin, Min: min, Fields: models.Fields{Fields: fields}},
+	}
+}
+
+func returnPacket(t *testing.T, data map[string]any) map[string]any {
+	return data["ListPackets"].(map[string]any)["packet_1"].(map[string]any)
+}
+
+func TestReturnMessageDataDefinitions(t *testing.T) {
+	definitions, err := LoadMessageDefinitions(nil)
+	assert.NoError(t, err)
+
+	// AVL IgnitionOn (SIN 126 MIN 14)
+	data, err := ReturnMessageData(returnMessage("126", "14",
+		models.Field{Name: "Latitude", Value: "1171300"},
+		models.Field{Name: "Longitude", Value: "-5952696"},
+		models.Field{Name: "Speed", Value: "12"},
+		models.Field{Name: "Heading", Value: "90"},
+		models.Field{Name: "EventTime", Value: "1704110400"},
+		models.Field{Name: "GpsFixAge", Value: "20"},
+		models.Field{Name: "Odometer", Value: "1234500"},
+		models.Field{Name: "MainPower", Value: "12500"},
+		models.Field{Name: "IgnitionOn", Value: "True"},
+		models.Field{Name: "DigInp1", Value: "False"},
+	), definitions)
+	assert.NoError(t, err)
+	assert.Equal(t, "01234567SKY1", data["IMEI"])
+
+	packet := returnPacket(t, data)
+	assert.InDelta(t, 19.521667, packet["Latitude"], 0.000001)
+	assert.InDelta(t, -99.2116, packet["Longitude"], 0.000001)
+	assert.Equal(t, 12.0, packet["Speed"])
+	assert.Equal(t, 90.0, packet["Direction"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", packet["Datetime"])
+	assert.Equal(t, 1234500.0, packet["Mileage"])
+	assert.Equal(t, "12.50", packet["AD5"])
+	assert.Equal(t, "1", packet["ACC"])
+	assert.Equal(t, "0", packet["Input1"])
+	assert.Equal(t, "A", packet["PositioningStatus"])
+	assert.Equal(t, config.CodeModel{Code: 2, Name: "Input 2 Active"}, packet["EventCode"])
+
+	// Old fix and a message without an event of its own
+	data, err = ReturnMessageData(returnMessage("126", "1",
+		models.Field{Name: "latitude", Value: "1171300"},
+		models.Field{Name: "longitude", Value: "-5952696"},
+		models.Field{Name: "gps_fix_age", Value: "3600"},
+	), definitions)
+	assert.NoError(t, err)
+	packet = returnPacket(t, data)
+	assert.Equal(t, "V", packet["PositioningStatus"])
+	assert.Equal(t, "2024-01-01T12:00:05Z", packet["Datetime"])
+	assert.Equal(t, config.PositionEvent, packet["EventCode"])
+}
+
+func TestReturnMessageDataRawPayload(t *testing.T) {
+	message := returnMessage("", "")
+	message.RawPayload = "gAEC" // SIN 128 MIN 1
+
+	data, err := ReturnMessageData(message, NewMessageDefinitions())
+	assert.NoError(t, err)
+	assert.Equal(t, "gAEC", data["RawPayload"])
+	packet := returnPacket(t, data)
+	assert.Equal(t, config.UndefinedEvent, packet["EventCode"])
+	assert.Equal(t, "Undefined message SIN 128 MIN 1", packet["EventName"])
+	assert.Equal(t, "V", packet["PositioningStatus"])
+
+	message.MobileID = ""
+	_, err = ReturnMessageData(message, NewMessageDefinitions())
+	assert.Error(t, err)
+}
+
+func TestLoadMessageDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	mdf := `<MessageDefinition xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><Services><Service>
+		<Name>Fleet</Name><SIN>128</SIN><ReturnMessages><Message><Name>ZoneEntry</Name><MIN>3</MIN><Fields>
+		<Field xsi:type="UnsignedIntField"><Name>GeofenceID</Name><Size>16</Size></Field>
+		<Field xsi:type="EnumField"><Name>Kind</Name><Size>2</Size><Items><string>a</string><string>b</string></Items></Field>
+		</Fields></Message></ReturnMessages></Service></Services></MessageDefinition>`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "fleet.xml"), []byte(mdf), 0o644))
+
+	definitions, err := LoadMessageDefinitions([]string{dir})
+	assert.NoError(t, err)
+
+	message, exists := definitions.Lookup(128, 3)
+	assert.True(t, exists)
+	assert.Equal(t, "Fleet", message.Service)
+	assert.Equal(t, "ZoneEntry", message.Name)
+	assert.Equal(t, []string{"a", "b"}, message.Fields[1].Items)
+	assert.Equal(t, models.EnumField, message.Fields[1].Type)
+
+	// The defaults are still there
+	_, exists = definitions.Lookup(126, 14)
+	assert.True(t, exists)
+
+	data, err := ReturnMessageData(returnMessage("128", "3", models.Field{Name: "GeofenceID", Value: "7"}), definitions)
+	assert.NoError(t, err)
+	assert.Equal(t, config.CodeModel{Code: 20, Name: "Enter Geo-fence"}, returnPacket(t, data)["EventCode"])
+
+	_, err = LoadMessageDefinitions([]string{filepath.Join(dir, "missing.xml")})
+	assert.Error(t, err)
+}
@@ -6,10 +6,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"skywaveprotocol/features/skywave_protocol/models"
 	"strconv"
 	"strings"
-	"time"
 )
 
 func ParseXML(s *models.GetReturnMessagesResult, data []byte) error {
@@ -32,182 +32,33 @@ func ReturnedMessagesJson(s *models.GetReturnMessagesResult) ([]byte, error) {
 	}
 }
 
-func ReturnedMessagesBridge(s *models.GetReturnMessagesResult) ([]models.PayloadBridge, error) {
-	if len(s.Messages.ReturnedMessages) != 0 {
-		messages := make([]models.PayloadBridge, 0)
-		for _, mess := range s.Messages.ReturnedMessages {
-			switch mess.Payload.Name {
-			case "DistanceCell", "StationaryIntervalSat", "MovingIntervalSat", "MovingEnd", "MovingStart", "IgnitionOn", "StationaryIntervalCell":
-				payload := models.PayloadBridge{}
-				for _, field := range mess.Payload.Fields.Fields {
-					switch field.Name {
-					case "Latitude":
-						payload.Latitude = field.Value
-					case "Longitude":
-						payload.Longitude = field.Value
-					case "Speed":
-						payload.Speed = field.Value
-					case "Heading":
-						payload.Heading = field.Value
-					case "EventTime":
-						payload.EventTime = field.Value
-					default:
-						continue
-					}
-				}
-				payload.ID = mess.ID
-				payload.MessageUTC = mess.MessageUTC
-				payload.ReceiveUTC = mess.ReceiveUTC
-				payload.Type = mess.Payload.Name
-				payload.SIN = mess.SIN
-				payload.MobileID = mess.MobileID
-				payload.Min = mess.Payload.Min
-				payload.RegionName = mess.RegionName
-				payload.OtaMessageSize = mess.OtaMessageSize
-				messages = append(messages, payload)
-			default:
-				continue
-			}
-		}
-		return messages, nil
-	} else {
-		return nil, fmt.Errorf("messages is empty")
-	}
-}
+// DefaultGatewayURL is the IsatData Pro gateway REST service
+const DefaultGatewayURL = "https://isatdatapro.skywave.com/GLGW/GWServices_v1/RestMessages.svc"
 
 type SkywaveDoc struct {
 	Access_id uint64
 	Password  string
 	From_id   uint64
-}
-
-func FromBridgePayload(sky models.PayloadBridge) (map[string]string, error) {
-	Output_Map := map[string]string{}
-	if len(sky.Latitude) >= 7 && len(sky.Longitude) >= 7 {
-		// Divide latitude and longitude
-		var latdegrees string
-		var latdecimal string
-		var londegrees string
-		var londecimal string
-		if len(sky.Latitude) == 7 {
-			latdegrees = sky.Latitude[:4]
-			latdecimal = sky.Latitude[4:]
-		} else {
-			latdegrees = sky.Latitude[:5]
-			latdecimal = sky.Latitude[5:]
-		}
-		if len(sky.Longitude) == 7 {
-			londegrees = sky.Longitude[:4]
-			londecimal = sky.Longitude[4:]
-		} else {
-			londegrees = sky.Longitude[:5]
-			londecimal = sky.Longitude[5:]
-		}
-
-		// Processing steps:
-		// 1) Get number with two digits
-		// 2) Get decimal remainder
-		// 3) Apply sign
-		// 4) Divide by 60000
-		// 5) Add decimal remainder to the two decimal places in float type
-		// 6) Set the result as string
-
-		// Step 1
-		latdegreesfloat, err := strconv.ParseFloat(latdegrees, 64)
-		if err != nil {
-			return Output_Map, err
-		}
-		latdegreesres := latdegreesfloat / 60
-		latpartone := fmt.Sprintf("%0.2f", latdegreesres)
-		latdetwodec, err := strconv.ParseFloat(latpartone, 64)
-		if err != nil {
-			return Output_Map, err
-		}
-
-		// Step 2,3,4
-		latdecimalfloat, err := strconv.ParseFloat(latdecimal, 64)
-		if err != nil {
-			return Output_Map, err
-		}
-		latdecimalres := latdecimalfloat / 60000
-
-		// Step 3
-		if strings.Contains(latdegrees, "-") {
-			latdecimalres *= -1
-		}
-
-		// Step 5
-		lat := latdetwodec + latdecimalres
-		lat -= 0.003333
-
-		// Process longitude similarly
-		londegreesfloat, err := strconv.ParseFloat(londegrees, 64)
-		if err != nil {
-			return Output_Map, err
-		}
-		londegreesres := londegreesfloat / 60
-		lonpartone := fmt.Sprintf("%0.2f", londegreesres)
-		londetwodec, err := strconv.ParseFloat(lonpartone, 64)
-		if err != nil {
-			return Output_Map, err
-		}
-
-		londecimalfloat, err := strconv.ParseFloat(londecimal, 64)
-		if err != nil {
-			return Output_Map, err
-		}
-		londecimalres := londecimalfloat / 60000
-
-		if strings.Contains(londegrees, "-") {
-			londecimalres *= -1
-		}
-
-		lon := londetwodec + londecimalres
-
-		// Date parsing
-		datepartial := strings.Replace(sky.ReceiveUTC, " ", "T", 1) + "Z"
-		d, err := time.Parse(time.RFC3339, datepartial)
-		d2 := fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02d", d.Year(), d.Month(), d.Day(),
-			d.Hour(), d.Minute(), d.Second())
-
-		if err != nil {
-			return Output_Map, err
-		}
-
-		// Parse Speed
-		speed, err := strconv.ParseFloat(sky.Speed, 64)
-		if err != nil {
-			return Output_Map, err
-		}
-
-		// Parse Heading
-		dir, err := strconv.ParseUint(sky.Heading, 10, 16)
-		if err != nil {
-			return Output_Map, err
-		}
-
-		Output_Map["Imei"] = sky.MobileID
-		Output_Map["Latitude"] = fmt.Sprintf("%v", lat)
-		Output_Map["Longitude"] = fmt.Sprintf("%v", lon)
-		Output_Map["Speed"] = fmt.Sprintf("%v", speed)
-		Output_Map["Driving direction"] = fmt.Sprintf("%v", uint16(dir))
-		Output_Map["Date Time"] = d2
-		Output_Map["GPS position status"] = "A"
-		Output_Map["Protocol Version"] = "3"
-		Output_Map["Event code"] = "35"
-		Output_Map["Command Type"] = "AAA"
-		Output_Map["Altitude"] = "21.232345"
-
-		return Output_Map, nil
-	} else {
-		return Output_Map, fmt.Errorf("invalid length of latitude or longitude: %d %d", len(sky.Latitude), len(sky.Longitude))
-	}
+	URL       string       // Gateway service URL, DefaultGatewayURL if empty
+	Client    *http.Client // http.DefaultClient if nil
 }
 
 func (d *SkywaveDoc) GetDoc() ([]byte, error) {
-	url := fmt.Sprintf("https://isatdatapro.skywave.com/GLGW/GWServices_v1/RestMessages.svc/get_return_messages.xml/?access_id=%d&password=%s&from_id=%d", d.Access_id, d.Password, d.From_id)
-
-	resp, err := http.Get(url)
+	gatewayURL := d.URL
+	if gatewayURL == "" {
+		gatewayURL = DefaultGatewayURL
+	}
+	query := url.Values{}
+	query.Set("access_id", strconv.FormatUint(d.Access_id, 10))
+	query.Set("password", d.Password)
+	query.Set("from_id", strconv.FormatUint(d.From_id, 10))
+	query.Set("include_raw_payload", "true")
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(strings.TrimSuffix(gatewayURL, "/") + "/get_return_messages.xml/?" + query.Encode())
 	if err != nil {
 		return nil, err
 	}
@@ -1,21 +1,32 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"skywaveprotocol/features/jono"
 	"skywaveprotocol/features/skywave_protocol"
+	"skywaveprotocol/features/skywave_protocol/models"
+	"skywaveprotocol/features/skywave_protocol/usecases"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
 var (
-	verbose = flag.Bool("v", false, "Enable verbose logging")
+	// verbose is the -v flag, registered by common/utils
+	verbose = &utils.Verbose
 )
 
 func vPrint(format string, v ...interface{}) {
@@ -43,28 +54,36 @@ func min(a, b int) int {
 }
 
 type MQTTClient struct {
-	client    mqtt.Client
-	brokerURL string
-	clientID  string
-	verbose   bool
+	client   mqtt.Client
+	config   *broker.Config
+	clientID string
+	verbose  bool
+	archive  *utils.FrameArchive // Inbound frames with their Jono output, nil when FRAME_ARCHIVE_DIR is not set
+
+	forwarder    *usecases.ForwardTracker
+	definitions  *usecases.MessageDefinitions
+	commandTopic string
+	resultTopic  string
 }
 
-func NewMQTTClient(brokerHost string, clientID string, verbose bool) (*MQTTClient, error) {
-	if brokerHost == "" {
-		return nil, fmt.Errorf("broker host cannot be empty")
+func NewMQTTClient(config *broker.Config, clientID string, verbose bool) (*MQTTClient, error) {
+	if config == nil || config.URL == "" {
+		return nil, fmt.Errorf("broker URL cannot be empty")
 	}
 
-	brokerURL := fmt.Sprintf("tcp://%s:1883", brokerHost)
 	return &MQTTClient{
-		brokerURL: brokerURL,
-		clientID:  clientID,
-		verbose:   verbose,
+		config:   config,
+		clientID: clientID,
+		verbose:  verbose,
+		archive:  utils.DefaultFrameArchive("skywave"),
 	}, nil
 }
 
 func (m *MQTTClient) Connect() error {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(m.brokerURL)
+	opts, err := m.config.ClientOptions()
+	if err != nil {
+		return err
+	}
 
 	subscribe_topic := "skywave"
 	clientID := fmt.Sprintf("skywaveprotocol_%s_%s_%d",
@@ -73,7 +92,8 @@ func (m *MQTTClient) Connect() error {
 		time.Now().UnixNano()%100000)
 	opts.SetClientID(clientID)
 
-	opts.SetCleanSession(false)
+	// Persistent session, unless the replicas share the subscriptions
+	opts.SetCleanSession(m.config.Shared())
 	opts.SetAutoReconnect(true)
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetOrderMatters(true)
@@ -85,7 +105,7 @@ func (m *MQTTClient) Connect() error {
 	for {
 		if token := m.client.Connect(); token.Wait() && token.Error() != nil {
 			if m.verbose {
-				vPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.brokerURL, token.Error())
+				vPrint("Error connecting to MQTT broker at %s: %v. Retrying in 5 seconds...", m.config.URL, token.Error())
 			}
 			time.Sleep(5 * time.Second)
 			continue
@@ -100,7 +120,7 @@ func (m *MQTTClient) Connect() error {
 }
 
 func (m *MQTTClient) Subscribe(topic string, qos byte) error {
-	if token := m.client.Subscribe(topic, qos, nil); token.Wait() && token.Error() != nil {
+	if token := m.config.Subscribe(m.client, topic, qos, nil); token.Wait() && token.Error() != nil {
 		return fmt.Errorf("error subscribing to topic %s: %v", topic, token.Error())
 	}
 	if m.verbose {
@@ -110,7 +130,13 @@ func (m *MQTTClient) Subscribe(topic string, qos byte) error {
 }
 
 func (m *MQTTClient) Publish(topic string, payload interface{}) error {
-	token := m.client.Publish(topic, 0, false, payload)
+	// Jono messages carry the vehicle when VEHICLE_ENRICH is enabled, and the virtual IMEI of the
+	// device when IMEI_VIRTUALIZE is; the vehicle is looked up with the device IMEI
+	payload = utils.PublishPayload(topic, payload)
+	if topic == m.resultTopic { // The command results name the terminal by its virtual IMEI too
+		payload = utils.VirtualizePayload(payload, "imei")
+	}
+	token := m.config.Publish(m.client, topic, payload)
 	token.Wait()
 	if token.Error() != nil {
 		if m.verbose {
@@ -125,12 +151,19 @@ func (m *MQTTClient) Publish(topic string, payload interface{}) error {
 }
 
 func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
-	if msg.Topic() == "tracker/from-udp" {
+	if m.forwarder != nil && m.config.TopicName(msg.Topic()) == m.commandTopic {
+		m.handleCommand(msg.Payload())
+		return
+	}
+
+	if m.config.TopicName(msg.Topic()) == "tracker/from-udp" {
 		if m.verbose {
 			tracker_bytes := []byte(msg.Payload())
 			vPrint("Received message on topic :\n%v", hex.Dump(tracker_bytes[:min(32, len(tracker_bytes))]))
 		}
 		trackerPayload := string(msg.Payload())
+		record := m.archive.Begin(trackerPayload, "")
+		defer record.End()
 
 		var trackerData string
 		bytes, err := hex.DecodeString(trackerPayload)
@@ -143,32 +176,36 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 			trackerData = string(bytes)
 		}
 
-		dataskywave, err := skywave_protocol.Initialize(trackerData)
+		messages, err := skywave_protocol.Initialize(trackerData, m.definitions)
 		if err != nil {
+			record.Fail(err)
 			fmt.Println(err)
-			return
 		}
 
-		jonoNormalize, err := jono.Initialize(dataskywave)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+		for _, dataskywave := range messages {
+			jonoNormalize, err := jono.Initialize(dataskywave)
+			if err != nil {
+				record.Fail(err)
+				fmt.Println(err)
+				continue
+			}
+			record.Jono(jonoNormalize)
 
-		if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
-			fmt.Println("Error publishing to jonoprotocol:", err)
-			return
-		}
-		if m.verbose {
-			var jsonObj map[string]interface{}
-			if err := json.Unmarshal([]byte(jonoNormalize), &jsonObj); err == nil {
-				if compactJSON, err := json.Marshal(jsonObj); err == nil {
-					vPrint("Jono Protocol: %s", string(compactJSON))
+			if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
+				fmt.Println("Error publishing to jonoprotocol:", err)
+				return
+			}
+			if m.verbose {
+				var jsonObj map[string]interface{}
+				if err := json.Unmarshal([]byte(jonoNormalize), &jsonObj); err == nil {
+					if compactJSON, err := json.Marshal(jsonObj); err == nil {
+						vPrint("Jono Protocol: %s", string(compactJSON))
+					} else {
+						vPrint("Jono Protocol: %s", jonoNormalize)
+					}
 				} else {
 					vPrint("Jono Protocol: %s", jonoNormalize)
 				}
-			} else {
-				vPrint("Jono Protocol: %s", jonoNormalize)
 			}
 		}
 		return
@@ -183,6 +220,8 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	remote_addr := json_data.RemoteAddr
 
 	trackerPayload := payload
+	record := m.archive.Begin(payload, remote_addr)
+	defer record.End()
 
 	var trackerData string
 	bytes, err := hex.DecodeString(trackerPayload)
@@ -201,33 +240,40 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		vPrint("Received message on topic :\n%v", hex.Dump(tracker_bytes[:min(32, len(tracker_bytes))]))
 	}
 
-	dataskywave, err := skywave_protocol.Initialize(trackerData)
+	messages, err := skywave_protocol.Initialize(trackerData, m.definitions)
 	if err != nil {
+		record.Fail(err)
 		fmt.Println(err)
-		return
+		if len(messages) == 0 {
+			return
+		}
 	}
 
 	imei := ""
-	jonoNormalize, err := jono.Initialize(dataskywave)
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+	for _, dataskywave := range messages {
+		jonoNormalize, err := jono.Initialize(dataskywave)
+		if err != nil {
+			record.Fail(err)
+			fmt.Println(err)
+			continue
+		}
+		record.Jono(jonoNormalize)
 
-	if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
-		fmt.Println("Error publishing to jonoprotocol:", err)
-		return
-	}
-	if m.verbose {
-		var jsonObj map[string]interface{}
-		if err := json.Unmarshal([]byte(jonoNormalize), &jsonObj); err == nil {
-			if compactJSON, err := json.Marshal(jsonObj); err == nil {
-				vPrint("Jono Protocol: %s", string(compactJSON))
+		if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
+			fmt.Println("Error publishing to jonoprotocol:", err)
+			return
+		}
+		if m.verbose {
+			var jsonObj map[string]interface{}
+			if err := json.Unmarshal([]byte(jonoNormalize), &jsonObj); err == nil {
+				if compactJSON, err := json.Marshal(jsonObj); err == nil {
+					vPrint("Jono Protocol: %s", string(compactJSON))
+				} else {
+					vPrint("Jono Protocol: %s", jonoNormalize)
+				}
 			} else {
 				vPrint("Jono Protocol: %s", jonoNormalize)
 			}
-		} else {
-			vPrint("Jono Protocol: %s", jonoNormalize)
 		}
 	}
 	tracker_data_json := TrackerAssign{
@@ -250,23 +296,148 @@ func (m *MQTTClient) messageHandler(client mqtt.Client, msg mqtt.Message) {
 	}
 }
 
+// publishReturnMessage sends a gateway return message through the Jono path. Messages that cannot
+// be converted are logged and skipped, a failed publish is returned so the poller retries it.
+func (m *MQTTClient) publishReturnMessage(account usecases.GatewayAccount, message models.ReturnedMessages) error {
+	// The archive keeps the message as the gateway returned it, the decoder replays it from the XML
+	raw, err := xml.Marshal(message)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	record := m.archive.Begin(string(raw), "")
+	defer record.End()
+	record.SetIMEI(message.MobileID)
+
+	dataskywave, err := skywave_protocol.InitializeReturnMessage(message, m.definitions)
+	if err != nil {
+		record.Fail(err)
+		fmt.Println(err)
+		return nil
+	}
+
+	jonoNormalize, err := jono.Initialize(dataskywave)
+	if err != nil {
+		record.Fail(err)
+		fmt.Println(err)
+		return nil
+	}
+	record.Jono(jonoNormalize)
+
+	if err := m.Publish("tracker/jonoprotocol", jonoNormalize); err != nil {
+		return fmt.Errorf("error publishing to jonoprotocol: %v", err)
+	}
+	vPrint("Account %d message %d: %s", account.AccessID, message.ID, jonoNormalize)
+	return nil
+}
+
+// handleCommand submits a command received on the command topic as a forward message
+func (m *MQTTClient) handleCommand(payload []byte) {
+	var command models.ForwardCommand
+	if err := json.Unmarshal(payload, &command); err != nil {
+		fmt.Println("Error unmarshaling command:", err)
+		return
+	}
+	// Customers address the virtual IMEIs they see, the gateway knows the terminal MobileID
+	if original := utils.OriginalImei(command.IMEI); original != command.IMEI {
+		vPrint("Command %s for virtual IMEI %s sent to %s", command.ID, command.IMEI, original)
+		command.IMEI = original
+	}
+	if err := m.forwarder.Submit(command); err != nil {
+		fmt.Printf("Command %s for %s failed: %v\n", command.ID, command.IMEI, err)
+	}
+}
+
+// publishResult reports the outcome of a command on the result topic
+func (m *MQTTClient) publishResult(result models.ForwardResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Println("Error marshaling command result:", err)
+		return
+	}
+	if err := m.Publish(m.resultTopic, data); err != nil {
+		fmt.Println("Error publishing command result:", err)
+	}
+}
+
+// startGateway polls the IsatData Pro gateway and accepts commands for the terminals when SKYWAVE_ACCOUNTS is set
+func (m *MQTTClient) startGateway(ctx context.Context) error {
+	accounts, err := usecases.ParseGatewayAccounts(os.Getenv("SKYWAVE_ACCOUNTS"))
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	interval, err := utils.EnvDuration("SKYWAVE_POLL_INTERVAL", usecases.DefaultPollInterval)
+	if err != nil {
+		return err
+	}
+	statusInterval, err := utils.EnvDuration("SKYWAVE_FORWARD_POLL_INTERVAL", 30*time.Second)
+	if err != nil {
+		return err
+	}
+	forwardTimeout, err := utils.EnvDuration("SKYWAVE_FORWARD_TIMEOUT", 10*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	store, err := usecases.NewNextIDStore(utils.EnvString("SKYWAVE_STATE_FILE", "skywave_next_id.json"))
+	if err != nil {
+		return err
+	}
+
+	gatewayURL := os.Getenv("SKYWAVE_GATEWAY_URL")
+	client := &http.Client{Timeout: 60 * time.Second}
+
+	m.resultTopic = utils.EnvString("SKYWAVE_RESULT_TOPIC", "skywave/command-results")
+	m.commandTopic = utils.EnvString("SKYWAVE_COMMAND_TOPIC", "skywave/commands")
+	m.forwarder = usecases.NewForwardTracker(&usecases.ForwardGateway{URL: gatewayURL, Client: client}, accounts, forwardTimeout, m.publishResult)
+
+	poller := usecases.NewGatewayPoller(gatewayURL, accounts, store, func(account usecases.GatewayAccount, message models.ReturnedMessages) error {
+		m.forwarder.LearnTerminal(message.MobileID, account.AccessID)
+		return m.publishReturnMessage(account, message)
+	}, usecases.WithPollInterval(interval), usecases.WithPollClient(client))
+	log.Printf("Polling %d gateway account(s) every %v", len(accounts), interval)
+	go poller.Run(ctx, func(err error) {
+		log.Printf("Gateway poll failed: %v", err)
+	})
+	go m.forwarder.Run(ctx, statusInterval, func(err error) {
+		log.Printf("Forward status poll failed: %v", err)
+	})
+
+	return m.Subscribe(m.commandTopic, 1)
+}
+
 func main() {
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	mqttBrokerHost := os.Getenv("MQTT_BROKER_HOST")
-	if mqttBrokerHost == "" {
-		log.Fatal("MQTT_BROKER_HOST environment variable not set")
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	mqttClient, err := NewMQTTClient(mqttBrokerHost, "go_mqtt_client", *verbose)
+	mqttClient, err := NewMQTTClient(mqttConfig, "go_mqtt_client", *verbose)
 	if err != nil {
 		log.Fatal("Failed to create MQTT client:", err)
 	}
 
+	// Message definition files of the terminals, comma separated files or directories
+	mqttClient.definitions, err = usecases.LoadMessageDefinitions(strings.Split(os.Getenv("SKYWAVE_MDF"), ","))
+	if err != nil {
+		log.Fatal("Failed to load message definitions:", err)
+	}
+
 	if err := mqttClient.Connect(); err != nil {
 		log.Fatal("Failed to connect to MQTT broker:", err)
 	}
 
+	if err := mqttClient.startGateway(context.Background()); err != nil {
+		log.Fatal("Failed to start gateway:", err)
+	}
+
 	if err := mqttClient.Subscribe("tracker/from-tcp", 1); err != nil {
 		log.Fatal("Failed to subscribe:", err)
 	}
@@ -275,5 +446,10 @@ func main() {
 		log.Fatal("Failed to subscribe:", err)
 	}
 
-	select {}
+	// Keep the application running until it is stopped
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	mqttClient.archive.Close()
 }
@@ -36,8 +36,8 @@ func Initialize(data string) (string, error) {
 			}
 			return string(dataJSON), nil
 		}
-		if model == "ST4300" {
-			// Handle ST4300 model
+		if model == "ST4300" || model == "ST600" {
+			// Handle ST4300 model, ASCII ST600 reports share the same layout
 			dataParsed, err := usecases.ParseST4300Fields(data)
 			fmt.Printf("Parsed ST4300 Data:\n")
 			fmt.Printf("  Header: %s\n", dataParsed.Header)
@@ -65,6 +65,28 @@ func Initialize(data string) (string, error) {
 			}
 			return string(dataJSON), nil
 		}
+		if model == "UNIVERSAL" {
+			// Handle binary (Universal protocol) reports
+			dataParsed, err := usecases.ParseUniversalFields([]byte(data))
+			if err != nil {
+				return "", fmt.Errorf("error: universal - %v - data %X", err, data)
+			}
+			fmt.Printf("Parsed Universal Data:\n")
+			fmt.Printf("  Header: %s\n", dataParsed.Header)
+			fmt.Printf("  Device ID: %s\n", dataParsed.IMEI)
+			fmt.Printf("  Message Type: %s\n", dataParsed.MessageType)
+			fmt.Printf("  Timestamp: %s\n", dataParsed.Timestamp.Format(time.RFC3339))
+			fmt.Printf("  Latitude: %.6f\n", dataParsed.Latitude)
+			fmt.Printf("  Longitude: %.6f\n", dataParsed.Longitude)
+			fmt.Printf("  Speed: %.2f km/h\n", dataParsed.Speed)
+			fmt.Printf("  Satellites: %d\n", dataParsed.Satellites)
+			fmt.Printf("  Ignition: %v\n", dataParsed.Ignition)
+			dataJSON, err := json.Marshal(dataParsed)
+			if err != nil {
+				return "", fmt.Errorf("error marshaling universal data: %v", err)
+			}
+			return string(dataJSON), nil
+		}
 	} else {
 		fmt.Println("Could not identify model from data")
 	}
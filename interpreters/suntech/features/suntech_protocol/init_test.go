@@ -1,8 +1,10 @@
 package suntech_protocol
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
+	"suntechprotocol/features/jono"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -136,3 +138,29 @@ func TestInitializeWithBinaryFile(t *testing.T) {
 
 	assert.Equal(t, expectedData, resultMap, "El resultado no coincide con el esperado")
 }
+
+func TestInitializeUniversalMatchesASCII(t *testing.T) {
+	asciiData := "ST600STT;907100099;18;20250407120000;+37.123456;-122.123456;60.5;180;10;0.9;2240.5;1;4.2;1234.5;1;2"
+
+	// Same report sent by the device in binary (Universal protocol) form
+	binaryData, err := hex.DecodeString("81002c0907100099cd7c181904070c000002367580f8b88b4017a246500a0012d64401a40201005a00036b32")
+	assert.NoError(t, err)
+
+	asciiResult, err := Initialize(asciiData)
+	assert.NoError(t, err, "ASCII report could not be parsed")
+
+	binaryResult, err := Initialize(string(binaryData))
+	assert.NoError(t, err, "Binary report could not be parsed")
+
+	asciiJono, err := jono.Initialize(asciiResult)
+	assert.NoError(t, err)
+
+	binaryJono, err := jono.Initialize(binaryResult)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, asciiJono, binaryJono, "ASCII and binary reports should produce the same Jono output")
+
+	var jonoMap map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(binaryJono), &jonoMap))
+	assert.Equal(t, "907100099", jonoMap["IMEI"])
+}
@@ -8,6 +8,11 @@ func IdentifyModel(data string) string {
 		return ""
 	}
 
+	// Binary (Universal protocol) frames start with a header byte instead of ASCII
+	if len(data) >= UniversalMinLength && IsUniversalHeader(data[0]) {
+		return "UNIVERSAL"
+	}
+
 	// Split data by the delimiter
 	parts := strings.Split(data, ";")
 	if len(parts) == 0 {
@@ -21,6 +26,8 @@ func IdentifyModel(data string) string {
 		return "ST300"
 	} else if strings.HasPrefix(header, "ST4300") {
 		return "ST4300"
+	} else if strings.HasPrefix(header, "ST600") {
+		return "ST600"
 	}
 
 	return ""
@@ -0,0 +1,76 @@
+package models
+
+// Universal (binary) report headers sent by ST600-series and newer devices
+// instead of the ASCII "ST300STT;..." style header
+const (
+	UniversalSTT byte = 0x81
+	UniversalEMG byte = 0x82
+	UniversalEVT byte = 0x83
+	UniversalALT byte = 0x84
+	UniversalALV byte = 0x85
+)
+
+// UniversalMinLength is the smallest valid binary frame:
+// header(1) + length(2) + device id(5) + mask(3)
+const UniversalMinLength = 11
+
+// UniversalHeaders maps a binary header byte to its report name
+var UniversalHeaders = map[byte]string{
+	UniversalSTT: "STT",
+	UniversalEMG: "EMG",
+	UniversalEVT: "EVT",
+	UniversalALT: "ALT",
+	UniversalALV: "ALV",
+}
+
+// UniversalMessageCodes maps a binary header byte to its MessageType_suntech code,
+// so binary reports end up with the same MessageType as their ASCII counterpart
+var UniversalMessageCodes = map[byte]string{
+	UniversalSTT: "18",
+	UniversalEMG: "19",
+	UniversalEVT: "20",
+	UniversalALT: "21",
+	UniversalALV: "22",
+}
+
+// UniversalField describes a field that is present in a binary report when
+// its bit is set in the 3-byte field mask. Fields appear in bit order.
+type UniversalField struct {
+	Bit  uint   // Bit position in the field mask (0 = LSB)
+	Name string // Field name
+	Size int    // Field size in bytes
+}
+
+// UniversalFields lists every field of a binary report in wire order
+var UniversalFields = []UniversalField{
+	{Bit: 0, Name: "Model", Size: 1},
+	{Bit: 1, Name: "Firmware", Size: 3},
+	{Bit: 2, Name: "MessageType", Size: 1},
+	{Bit: 3, Name: "Date", Size: 3},            // YY MM DD
+	{Bit: 4, Name: "Time", Size: 3},            // HH MM SS
+	{Bit: 5, Name: "CellID", Size: 4},          // uint32
+	{Bit: 6, Name: "MCC", Size: 2},             // uint16
+	{Bit: 7, Name: "MNC", Size: 2},             // uint16
+	{Bit: 8, Name: "LAC", Size: 2},             // uint16
+	{Bit: 9, Name: "RxLevel", Size: 1},         // dBm, signed
+	{Bit: 10, Name: "Latitude", Size: 4},       // int32, degrees * 1e6
+	{Bit: 11, Name: "Longitude", Size: 4},      // int32, degrees * 1e6
+	{Bit: 12, Name: "Speed", Size: 2},          // uint16, km/h * 100
+	{Bit: 13, Name: "Heading", Size: 2},        // uint16, degrees * 100
+	{Bit: 14, Name: "Satellites", Size: 1},     // uint8
+	{Bit: 15, Name: "Fix", Size: 1},            // 1 = valid fix
+	{Bit: 16, Name: "Odometer", Size: 4},       // uint32, meters
+	{Bit: 17, Name: "PowerVoltage", Size: 2},   // uint16, volts * 100
+	{Bit: 18, Name: "BatteryVoltage", Size: 2}, // uint16, volts * 100
+	{Bit: 19, Name: "IO", Size: 2},             // low byte inputs (bit 0 = ignition), high byte outputs
+	{Bit: 20, Name: "Mode", Size: 1},
+	{Bit: 21, Name: "MessageNumber", Size: 2}, // uint16
+	{Bit: 22, Name: "HDOP", Size: 2},          // uint16, hdop * 100
+	{Bit: 23, Name: "Altitude", Size: 4},      // int32, meters * 100
+}
+
+// IsUniversalHeader reports whether b is a known binary report header
+func IsUniversalHeader(b byte) bool {
+	_, exists := UniversalHeaders[b]
+	return exists
+}
@@ -0,0 +1,99 @@
+package usecases
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"suntechprotocol/features/suntech_protocol/models"
+	"time"
+)
+
+// ParseUniversalFields parses a binary (Universal protocol) report into the same
+// ST4300Model the ASCII ST4300/ST600 parser produces.
+//
+// Frame layout: header(1) length(2) device id(5, BCD) mask(3) fields...
+// Each field is present only when its bit is set in the mask, see models.UniversalFields.
+func ParseUniversalFields(data []byte) (models.ST4300Model, error) {
+	if len(data) < models.UniversalMinLength {
+		return models.ST4300Model{}, fmt.Errorf("invalid universal data: too short (%d bytes)", len(data))
+	}
+
+	header := data[0]
+	reportName, exists := models.UniversalHeaders[header]
+	if !exists {
+		return models.ST4300Model{}, fmt.Errorf("invalid universal data: unknown header 0x%02X", header)
+	}
+
+	length := int(binary.BigEndian.Uint16(data[1:3]))
+	if length < models.UniversalMinLength || length > len(data) {
+		return models.ST4300Model{}, fmt.Errorf("invalid universal data: length %d, got %d bytes", length, len(data))
+	}
+	data = data[:length]
+
+	st := models.ST4300Model{RawData: hex.EncodeToString(data)}
+	st.Header = "ST600" + reportName
+	st.IMEI = parseBCDDeviceID(data[3:8])
+	st.MessageType = models.MessageType_suntech[models.UniversalMessageCodes[header]]
+
+	mask := uint32(data[8])<<16 | uint32(data[9])<<8 | uint32(data[10])
+	offset := models.UniversalMinLength
+
+	var date, clock []byte
+	for _, field := range models.UniversalFields {
+		if mask&(1<<field.Bit) == 0 {
+			continue
+		}
+		if offset+field.Size > len(data) {
+			return models.ST4300Model{}, fmt.Errorf("invalid universal data: field %s truncated", field.Name)
+		}
+		value := data[offset : offset+field.Size]
+		offset += field.Size
+
+		switch field.Name {
+		case "Date":
+			date = value
+		case "Time":
+			clock = value
+		case "Latitude":
+			st.Latitude = float64(int32(binary.BigEndian.Uint32(value))) / 1e6
+		case "Longitude":
+			st.Longitude = float64(int32(binary.BigEndian.Uint32(value))) / 1e6
+		case "Speed":
+			st.Speed = float64(binary.BigEndian.Uint16(value)) / 100
+		case "Heading":
+			st.Heading = float64(binary.BigEndian.Uint16(value)) / 100
+		case "Satellites":
+			st.Satellites = int(value[0])
+		case "Odometer":
+			st.Odometer = float64(binary.BigEndian.Uint32(value)) / 1000
+		case "BatteryVoltage":
+			st.BatteryLevel = float64(binary.BigEndian.Uint16(value)) / 100
+		case "IO":
+			st.InputStatus = uint32(value[1])
+			st.OutputStatus = uint32(value[0])
+			st.Ignition = value[1]&0x01 == 1
+		case "HDOP":
+			st.HDOP = float64(binary.BigEndian.Uint16(value)) / 100
+		case "Altitude":
+			st.Altitude = float64(int32(binary.BigEndian.Uint32(value))) / 100
+		}
+	}
+
+	if date != nil && clock != nil {
+		st.Timestamp = time.Date(2000+int(date[0]), time.Month(date[1]), int(date[2]),
+			int(clock[0]), int(clock[1]), int(clock[2]), 0, time.UTC)
+	}
+
+	return st, nil
+}
+
+// parseBCDDeviceID decodes a packed BCD device id, dropping the left padding
+// so it matches the id reported by the ASCII protocol
+func parseBCDDeviceID(data []byte) string {
+	id := strings.TrimLeft(hex.EncodeToString(data), "0")
+	if id == "" {
+		return "0"
+	}
+	return id
+}
@@ -0,0 +1,74 @@
+package usecases
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildUniversalFrame encodes a binary STT report carrying the same values as
+// "ST600STT;907100099;18;20250407120000;+37.123456;-122.123456;60.5;180;10;0.9;2240.5;1;4.2;1234.5;1;2"
+func buildUniversalFrame() []byte {
+	frame := []byte{0x81, 0x00, 0x00}
+	deviceID, _ := hex.DecodeString("0907100099")
+	frame = append(frame, deviceID...)
+
+	mask := uint32(1<<3 | 1<<4 | 1<<10 | 1<<11 | 1<<12 | 1<<13 | 1<<14 | 1<<16 | 1<<18 | 1<<19 | 1<<22 | 1<<23)
+	frame = append(frame, byte(mask>>16), byte(mask>>8), byte(mask))
+
+	frame = append(frame, 25, 4, 7) // Date
+	frame = append(frame, 12, 0, 0) // Time
+	latitude, longitude := int32(37123456), int32(-122123456)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(latitude))
+	frame = binary.BigEndian.AppendUint32(frame, uint32(longitude))
+	frame = binary.BigEndian.AppendUint16(frame, 6050)    // Speed
+	frame = binary.BigEndian.AppendUint16(frame, 18000)   // Heading
+	frame = append(frame, 10)                             // Satellites
+	frame = binary.BigEndian.AppendUint32(frame, 1234500) // Odometer
+	frame = binary.BigEndian.AppendUint16(frame, 420)     // Battery
+	frame = append(frame, 0x02, 0x01)                     // IO: outputs, inputs
+	frame = binary.BigEndian.AppendUint16(frame, 90)      // HDOP
+	frame = binary.BigEndian.AppendUint32(frame, 224050)  // Altitude
+
+	binary.BigEndian.PutUint16(frame[1:3], uint16(len(frame)))
+	return frame
+}
+
+func TestParseUniversalFields(t *testing.T) {
+	st, err := ParseUniversalFields(buildUniversalFrame())
+	assert.NoError(t, err)
+
+	assert.Equal(t, "ST600STT", st.Header)
+	assert.Equal(t, "907100099", st.IMEI)
+	assert.Equal(t, "STTReport", st.MessageType)
+	assert.Equal(t, time.Date(2025, 4, 7, 12, 0, 0, 0, time.UTC), st.Timestamp)
+	assert.Equal(t, 37.123456, st.Latitude)
+	assert.Equal(t, -122.123456, st.Longitude)
+	assert.Equal(t, 60.5, st.Speed)
+	assert.Equal(t, 180.0, st.Heading)
+	assert.Equal(t, 10, st.Satellites)
+	assert.Equal(t, 0.9, st.HDOP)
+	assert.Equal(t, 2240.5, st.Altitude)
+	assert.True(t, st.Ignition)
+	assert.Equal(t, 4.2, st.BatteryLevel)
+	assert.Equal(t, 1234.5, st.Odometer)
+	assert.Equal(t, uint32(1), st.InputStatus)
+	assert.Equal(t, uint32(2), st.OutputStatus)
+}
+
+func TestParseUniversalFieldsTruncated(t *testing.T) {
+	frame := buildUniversalFrame()
+
+	// Length field claims more bytes than were received
+	_, err := ParseUniversalFields(frame[:len(frame)-4])
+	assert.Error(t, err)
+
+	// Length field matches, but the mask selects fields that are missing
+	short := append([]byte{}, frame[:20]...)
+	binary.BigEndian.PutUint16(short[1:3], uint16(len(short)))
+	_, err = ParseUniversalFields(short)
+	assert.Error(t, err)
+}
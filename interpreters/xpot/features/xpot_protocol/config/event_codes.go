@@ -0,0 +1,30 @@
+package config
+
+type CodeModel struct {
+	Code int
+	Name string
+}
+
+// EventCodes maps the SPOT message types to the Meitrack event codes used by the Jono protocol.
+// The SPOT buttons are reported as inputs: SOS on input 1, HELP on 2, OK on 3 and CUSTOM on 4.
+var EventCodes = map[string]CodeModel{
+	"TRACK":           {Code: 35, Name: "Track By Time Interval"},
+	"EXTREME-TRACK":   {Code: 35, Name: "Track By Time Interval"},
+	"UNLIMITED-TRACK": {Code: 35, Name: "Track By Time Interval"},
+	"SOS":             {Code: 1, Name: "Input 1 Active"},
+	"HELP":            {Code: 2, Name: "Input 2 Active"},
+	"OK":              {Code: 3, Name: "Input 3 Active"},
+	"CUSTOM":          {Code: 4, Name: "Input 4 Active"},
+	"NEWMOVEMENT":     {Code: 42, Name: "Start Moving"},
+	"STOP":            {Code: 41, Name: "Stop Moving"},
+	"POWER-OFF":       {Code: 40, Name: "Power Off"},
+}
+
+// ButtonInputs is the input reported active by each button message
+var ButtonInputs = map[string]int{"SOS": 1, "HELP": 2, "OK": 3, "CUSTOM": 4}
+
+// TrackEvent is the event of message types not listed in EventCodes
+var TrackEvent = CodeModel{Code: 35, Name: "Track By Time Interval"}
+
+// LowBatteryEvent replaces the track event of messages sent with a LOW battery state
+var LowBatteryEvent = CodeModel{Code: 17, Name: "Low Battery"}
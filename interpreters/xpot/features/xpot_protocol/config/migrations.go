@@ -0,0 +1,9 @@
+package config
+
+import "embed"
+
+// Migrations holds the schema migrations of the Xpot store, one directory per SQL dialect
+// (mysql, sqlite3). They are applied in file name order and recorded in schema_migrations.
+//
+//go:embed migrations/*/*.sql
+var Migrations embed.FS
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS devices (
+	imei varchar(255) DEFAULT NULL,
+	plates varchar(255) DEFAULT NULL,
+	vin varchar(255) DEFAULT NULL,
+	protocol int(11) DEFAULT NULL,
+	password varchar(255) DEFAULT NULL,
+	log text DEFAULT NULL,
+	ff0 int(11) DEFAULT NULL,
+	INDEX idx_protocol (protocol),
+	INDEX idx_password (password),
+	INDEX idx_ff0 (ff0)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1
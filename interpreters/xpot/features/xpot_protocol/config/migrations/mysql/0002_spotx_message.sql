@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS spotx_message (
+	id varchar(255) DEFAULT NULL,
+	messengerId varchar(255) DEFAULT NULL,
+	messengerName varchar(255) DEFAULT NULL,
+	unixTime varchar(255) DEFAULT NULL,
+	messageType varchar(255) DEFAULT NULL,
+	latitude varchar(255) DEFAULT NULL,
+	longitude varchar(255) DEFAULT NULL,
+	modelId varchar(255) DEFAULT NULL,
+	showCustomMsg varchar(255) DEFAULT NULL,
+	dateTime varchar(255) DEFAULT NULL,
+	batteryState varchar(255) DEFAULT NULL,
+	hidden int(11) DEFAULT NULL,
+	altitude int(11) DEFAULT NULL,
+	INDEX idx_id_messenger (id, messengerId)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1
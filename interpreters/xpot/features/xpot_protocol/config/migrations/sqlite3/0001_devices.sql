@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS devices (
+	imei TEXT DEFAULT NULL,
+	plates TEXT DEFAULT NULL,
+	vin TEXT DEFAULT NULL,
+	protocol INTEGER DEFAULT NULL,
+	password TEXT DEFAULT NULL,
+	log TEXT DEFAULT NULL,
+	ff0 INTEGER DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_protocol ON devices (protocol);
+CREATE INDEX IF NOT EXISTS idx_password ON devices (password);
+CREATE INDEX IF NOT EXISTS idx_ff0 ON devices (ff0);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS spotx_message (
+	id TEXT DEFAULT NULL,
+	messengerId TEXT DEFAULT NULL,
+	messengerName TEXT DEFAULT NULL,
+	unixTime TEXT DEFAULT NULL,
+	messageType TEXT DEFAULT NULL,
+	latitude TEXT DEFAULT NULL,
+	longitude TEXT DEFAULT NULL,
+	modelId TEXT DEFAULT NULL,
+	showCustomMsg TEXT DEFAULT NULL,
+	dateTime TEXT DEFAULT NULL,
+	batteryState TEXT DEFAULT NULL,
+	hidden INTEGER DEFAULT NULL,
+	altitude INTEGER DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_id_messenger ON spotx_message (id, messengerId);
@@ -0,0 +1,62 @@
+package models
+
+import "encoding/xml"
+
+// Response is the XML of a SPOT shared page feed (message.xml)
+type Response struct {
+	XMLName             xml.Name            `xml:"response"`
+	FeedMessageResponse FeedMessageResponse `xml:"feedMessageResponse"`
+	Errors              []FeedError         `xml:"errors>error"`
+}
+
+// FeedError is returned instead of the messages, E-0195 when there are none to show
+type FeedError struct {
+	Code        string `xml:"code"`
+	Text        string `xml:"text"`
+	Description string `xml:"description"`
+}
+
+// NoMessagesError is the code of a feed without messages in the requested range
+const NoMessagesError = "E-0195"
+
+type FeedMessageResponse struct {
+	Count         int       `xml:"count"`
+	Feed          Feed      `xml:"feed"`
+	TotalCount    int       `xml:"totalCount"`
+	ActivityCount int       `xml:"activityCount"`
+	Messages      []Message `xml:"messages>message"`
+}
+
+type Feed struct {
+	ID                   string `xml:"id"`
+	Name                 string `xml:"name"`
+	Description          string `xml:"description"`
+	Status               string `xml:"status"`
+	Usage                int    `xml:"usage"`
+	DaysRange            int    `xml:"daysRange"`
+	DetailedMessageShown bool   `xml:"detailedMessageShown"`
+	Type                 string `xml:"type"`
+}
+
+// Message is a SPOT message, MessageType is TRACK, OK, CUSTOM, HELP, SOS, NEWMOVEMENT, POWER-OFF...
+// and BatteryState GOOD or LOW
+type Message struct {
+	XMLName        xml.Name `xml:"message"`
+	ID             int      `xml:"id"`
+	MessengerID    string   `xml:"messengerId"`
+	MessengerName  string   `xml:"messengerName"`
+	UnixTime       int64    `xml:"unixTime"`
+	MessageType    string   `xml:"messageType"`
+	Latitude       float64  `xml:"latitude"`
+	Longitude      float64  `xml:"longitude"`
+	ModelID        string   `xml:"modelId"`
+	ShowCustomMsg  string   `xml:"showCustomMsg"`
+	DateTime       string   `xml:"dateTime"`
+	BatteryState   string   `xml:"batteryState"`
+	Hidden         int      `xml:"hidden"`
+	Altitude       int      `xml:"altitude"`
+	MessageContent string   `xml:"messageContent,omitempty"`
+}
+
+// SpotTimeLayout is the layout of Message.DateTime
+const SpotTimeLayout = "2006-01-02T15:04:05-0700"
@@ -0,0 +1,317 @@
+package usecases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xpot/features/xpot_protocol/models"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// DefaultFeedURL is the SPOT public feed API, feeds are at DefaultFeedURL/<feed id>/message.xml
+const DefaultFeedURL = "https://api.findmespot.com/spot-main-web/consumer/rest-api/2.0/public/feed"
+
+// SPOT asks for at least 2.5 minutes between calls to the same feed and 2 seconds between
+// consecutive calls, and returns at most 50 messages per page
+const (
+	MinFeedInterval    = 150 * time.Second
+	FeedRequestSpacing = 2 * time.Second
+	FeedPageSize       = 50
+)
+
+// feedTimeLayout is the layout of the startDate/endDate parameters
+const feedTimeLayout = "2006-01-02T15:04:05-0000"
+
+// SpotFeed is a SPOT Shared Page feed, Password is only set for private feeds
+type SpotFeed struct {
+	ID       string
+	Password string
+}
+
+// ParseSpotFeeds parses "feed_id[:password][,feed_id[:password]...]". Full message.xml URLs
+// (with an optional feedPassword) are accepted too.
+func ParseSpotFeeds(value string) ([]SpotFeed, error) {
+	var feeds []SpotFeed
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, "http://") || strings.HasPrefix(entry, "https://") {
+			feedURL, err := url.Parse(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid feed URL %q: %v", entry, err)
+			}
+			parts := strings.Split(strings.Trim(feedURL.Path, "/"), "/")
+			id := ""
+			for i := 0; i+1 < len(parts); i++ {
+				if parts[i] == "feed" {
+					id = parts[i+1]
+				}
+			}
+			if id == "" {
+				return nil, fmt.Errorf("no feed id in URL %q", entry)
+			}
+			feeds = append(feeds, SpotFeed{ID: id, Password: feedURL.Query().Get("feedPassword")})
+			continue
+		}
+		id, password, _ := strings.Cut(entry, ":")
+		feeds = append(feeds, SpotFeed{ID: id, Password: password})
+	}
+	return feeds, nil
+}
+
+// FeedCursor is the newest message handled of a feed. Messages are ordered by time and ID.
+type FeedCursor struct {
+	UnixTime  int64 `json:"unixTime"`
+	MessageID int   `json:"messageId"`
+}
+
+// After tells whether a message is newer than the cursor
+func (c FeedCursor) After(message models.Message) bool {
+	return message.UnixTime > c.UnixTime || (message.UnixTime == c.UnixTime && message.ID > c.MessageID)
+}
+
+// FeedCursorStore persists the cursor of every feed in a JSON file, so a restarted
+// poller does not handle the same messages again
+type FeedCursorStore struct {
+	path    string
+	mutex   sync.Mutex
+	cursors map[string]FeedCursor
+}
+
+// NewFeedCursorStore loads the stored cursors from path, a missing file starts every feed from scratch
+func NewFeedCursorStore(path string) (*FeedCursorStore, error) {
+	store := &FeedCursorStore{path: path, cursors: make(map[string]FeedCursor)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &store.cursors); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return store, nil
+}
+
+// Cursor returns the cursor of a feed
+func (s *FeedCursorStore) Cursor(feedID string) FeedCursor {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.cursors[feedID]
+}
+
+// SetCursor stores the cursor of a feed, replacing the file atomically
+func (s *FeedCursorStore) SetCursor(feedID string, cursor FeedCursor) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cursors[feedID] = cursor
+	data, err := json.MarshalIndent(s.cursors, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileAtomic(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("error saving feed cursors: %v", err)
+	}
+	return nil
+}
+
+// FeedPoller fetches the new messages of every feed on a schedule
+type FeedPoller struct {
+	URL      string // Feed API URL, DefaultFeedURL if empty
+	Feeds    []SpotFeed
+	Store    *FeedCursorStore
+	Interval time.Duration // Raised to MinFeedInterval
+	Spacing  time.Duration // Between consecutive requests, FeedRequestSpacing if 0
+	Client   *http.Client
+
+	// Handle is called for every new message, oldest first. When it fails the cursor stays on
+	// the previous message, so the message is handled again on the next run.
+	Handle func(feed SpotFeed, message models.Message) error
+
+	lastRequest time.Time
+}
+
+// FeedPollerOption configures a FeedPoller
+type FeedPollerOption func(*FeedPoller)
+
+// WithPollInterval sets the time between the polls of the feeds, raised to MinFeedInterval
+func WithPollInterval(interval time.Duration) FeedPollerOption {
+	return func(p *FeedPoller) { p.Interval = interval }
+}
+
+// WithSpacing sets the time between consecutive requests
+func WithSpacing(spacing time.Duration) FeedPollerOption {
+	return func(p *FeedPoller) { p.Spacing = spacing }
+}
+
+// WithPollClient sets the HTTP client of the feed requests
+func WithPollClient(client *http.Client) FeedPollerOption {
+	return func(p *FeedPoller) { p.Client = client }
+}
+
+// NewFeedPoller creates a poller of the feeds on the feed API at url, DefaultFeedURL if empty,
+// that passes every new message to handle
+func NewFeedPoller(url string, feeds []SpotFeed, store *FeedCursorStore, handle func(SpotFeed, models.Message) error, options ...FeedPollerOption) *FeedPoller {
+	poller := &FeedPoller{
+		URL:      url,
+		Feeds:    feeds,
+		Store:    store,
+		Interval: MinFeedInterval,
+		Handle:   handle,
+	}
+	for _, option := range options {
+		option(poller)
+	}
+	return poller
+}
+
+// Run polls every feed each Interval until ctx is done
+func (p *FeedPoller) Run(ctx context.Context, onError func(error)) {
+	interval := p.Interval
+	if interval < MinFeedInterval {
+		interval = MinFeedInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Poll(); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the new messages of every feed
+func (p *FeedPoller) Poll() error {
+	var errs []error
+	for _, feed := range p.Feeds {
+		if err := p.PollFeed(feed); err != nil {
+			errs = append(errs, fmt.Errorf("feed %s: %w", feed.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PollFeed fetches the messages of a feed newer than its cursor, page by page, and hands them
+// over oldest first. The cursor is stored after every message.
+func (p *FeedPoller) PollFeed(feed SpotFeed) error {
+	cursor := p.Store.Cursor(feed.ID)
+
+	seen := make(map[int]bool)
+	var pending []models.Message
+	for start := 0; ; start += FeedPageSize {
+		messages, err := p.fetch(feed, cursor, start)
+		if err != nil {
+			return err
+		}
+		for _, message := range messages {
+			if cursor.After(message) && !seen[message.ID] {
+				seen[message.ID] = true
+				pending = append(pending, message)
+			}
+		}
+		// Pages come newest first, a short page or one reaching the cursor is the last one
+		if len(messages) < FeedPageSize || !cursor.After(messages[len(messages)-1]) {
+			break
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return FeedCursor{UnixTime: pending[i].UnixTime, MessageID: pending[i].ID}.After(pending[j])
+	})
+	for _, message := range pending {
+		if err := p.Handle(feed, message); err != nil {
+			return fmt.Errorf("message %d: %w", message.ID, err)
+		}
+		if err := p.Store.SetCursor(feed.ID, FeedCursor{UnixTime: message.UnixTime, MessageID: message.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait keeps the requests Spacing apart
+func (p *FeedPoller) wait() {
+	spacing := p.Spacing
+	if spacing == 0 {
+		spacing = FeedRequestSpacing
+	}
+	if elapsed := time.Since(p.lastRequest); elapsed < spacing {
+		time.Sleep(spacing - elapsed)
+	}
+	p.lastRequest = time.Now()
+}
+
+// fetch gets a page of a feed, starting at the cursor time when there is one
+func (p *FeedPoller) fetch(feed SpotFeed, cursor FeedCursor, start int) ([]models.Message, error) {
+	feedURL := p.URL
+	if feedURL == "" {
+		feedURL = DefaultFeedURL
+	}
+	query := url.Values{}
+	if feed.Password != "" {
+		query.Set("feedPassword", feed.Password)
+	}
+	if start > 0 {
+		query.Set("start", strconv.Itoa(start))
+	}
+	if cursor.UnixTime > 0 {
+		query.Set("startDate", time.Unix(cursor.UnixTime, 0).UTC().Format(feedTimeLayout))
+		query.Set("endDate", time.Now().UTC().Add(time.Hour).Format(feedTimeLayout))
+	}
+	endpoint := strings.TrimSuffix(feedURL, "/") + "/" + url.PathEscape(feed.ID) + "/message.xml"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	p.wait()
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Errors come in the body, sometimes with an error status
+	response, err := ParseFeed(string(body))
+	if err == nil && len(response.Errors) > 0 {
+		if response.Errors[0].Code == models.NoMessagesError {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("feed error %s: %s", response.Errors[0].Code, response.Errors[0].Text)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("response with status code %d", resp.StatusCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return response.FeedMessageResponse.Messages, nil
+}
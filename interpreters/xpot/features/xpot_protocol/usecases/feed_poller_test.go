@@ -0,0 +1,194 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"xpot/features/xpot_protocol/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFeed serves message.xml like SPOT: newest first, FeedPageSize per page, from startDate on
+type fakeFeed struct {
+	mutex     sync.Mutex
+	messages  map[string][]models.Message // Oldest first
+	passwords map[string]string
+	requests  []string
+}
+
+func (f *fakeFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-1] != "message.xml" {
+		http.NotFound(w, r)
+		return
+	}
+	feedID := parts[len(parts)-2]
+	query := r.URL.Query()
+	f.requests = append(f.requests, feedID+"@"+query.Get("start"))
+
+	if query.Get("feedPassword") != f.passwords[feedID] {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `<response><errors><error><code>E-0160</code><text>Invalid feed password</text></error></errors></response>`)
+		return
+	}
+
+	var from int64
+	if startDate := query.Get("startDate"); startDate != "" {
+		parsed, err := time.Parse(feedTimeLayout, startDate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = parsed.Unix()
+	}
+	var matching []models.Message
+	for i := len(f.messages[feedID]) - 1; i >= 0; i-- {
+		if message := f.messages[feedID][i]; message.UnixTime >= from {
+			matching = append(matching, message)
+		}
+	}
+	start, _ := strconv.Atoi(query.Get("start"))
+	if start >= len(matching) {
+		fmt.Fprint(w, `<response><errors><error><code>E-0195</code><text>No displayable messages found</text></error></errors></response>`)
+		return
+	}
+	page := matching[start:min(start+FeedPageSize, len(matching))]
+
+	var body strings.Builder
+	fmt.Fprintf(&body, `<response><feedMessageResponse><count>%d</count><feed><id>%s</id></feed><messages>`, len(page), feedID)
+	for _, message := range page {
+		fmt.Fprintf(&body, `<message><id>%d</id><messengerId>%s</messengerId><unixTime>%d</unixTime><messageType>TRACK</messageType>`+
+			`<latitude>19.4326</latitude><longitude>-99.1332</longitude><dateTime>%s</dateTime><batteryState>GOOD</batteryState></message>`,
+			message.ID, message.MessengerID, message.UnixTime, time.Unix(message.UnixTime, 0).UTC().Format(models.SpotTimeLayout))
+	}
+	body.WriteString(`</messages></feedMessageResponse></response>`)
+	fmt.Fprint(w, body.String())
+}
+
+// add appends count messages to a feed, one per minute after the last one
+func (f *fakeFeed) add(feedID string, count int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	id, unixTime := 1000, int64(1704110400)
+	if messages := f.messages[feedID]; len(messages) > 0 {
+		id, unixTime = messages[len(messages)-1].ID, messages[len(messages)-1].UnixTime
+	}
+	for i := 1; i <= count; i++ {
+		f.messages[feedID] = append(f.messages[feedID], models.Message{
+			ID: id + i, MessengerID: "0-" + feedID, UnixTime: unixTime + int64(60*i),
+		})
+	}
+}
+
+// recordIDs is a Handle that appends the ID of every message to handled
+func recordIDs(handled *[]int) func(SpotFeed, models.Message) error {
+	return func(feed SpotFeed, message models.Message) error {
+		*handled = append(*handled, message.ID)
+		return nil
+	}
+}
+
+func TestFeedPollerPaging(t *testing.T) {
+	feed := &fakeFeed{messages: make(map[string][]models.Message), passwords: map[string]string{"B": "secret"}}
+	feed.add("A", 120)
+	feed.add("B", 3)
+	server := httptest.NewServer(feed)
+	t.Cleanup(server.Close)
+	statePath := filepath.Join(t.TempDir(), "cursors.json")
+	feeds := []SpotFeed{{ID: "A"}, {ID: "B", Password: "secret"}}
+
+	store, err := NewFeedCursorStore(statePath)
+	assert.NoError(t, err)
+	var handled []int
+	poller := NewFeedPoller(server.URL+"/feed", feeds, store, recordIDs(&handled), WithSpacing(time.Nanosecond))
+	assert.NoError(t, poller.Poll())
+	assert.Len(t, handled, 123)
+	// Oldest first, across the three pages of A
+	assert.Equal(t, 1001, handled[0])
+	assert.Equal(t, 1120, handled[119])
+	assert.Equal(t, []string{"A@", "A@50", "A@100", "B@"}, feed.requests)
+
+	// Nothing new
+	handled = nil
+	assert.NoError(t, poller.Poll())
+	assert.Empty(t, handled)
+
+	// A restarted poller continues from the stored cursors
+	feed.add("A", 2)
+	store, err = NewFeedCursorStore(statePath)
+	assert.NoError(t, err)
+	restarted := NewFeedPoller(server.URL+"/feed", feeds, store, recordIDs(&handled), WithSpacing(time.Nanosecond))
+	assert.NoError(t, restarted.Poll())
+	assert.Equal(t, []int{1121, 1122}, handled)
+	assert.Equal(t, FeedCursor{UnixTime: 1704110400 + 122*60, MessageID: 1122}, store.Cursor("A"))
+}
+
+func TestFeedPollerErrors(t *testing.T) {
+	feed := &fakeFeed{messages: make(map[string][]models.Message), passwords: map[string]string{"B": "secret"}}
+	feed.add("A", 3)
+	feed.add("B", 1)
+	server := httptest.NewServer(feed)
+	t.Cleanup(server.Close)
+	store, err := NewFeedCursorStore(filepath.Join(t.TempDir(), "cursors.json"))
+	assert.NoError(t, err)
+
+	// A failed message is handled again on the next run
+	var handled []int
+	fail := 1002
+	record := recordIDs(&handled)
+	handle := func(feed SpotFeed, message models.Message) error {
+		if message.ID == fail {
+			return errors.New("broker down")
+		}
+		return record(feed, message)
+	}
+
+	tests := []struct {
+		name    string
+		feeds   []SpotFeed
+		fail    int
+		err     []string
+		handled []int
+	}{
+		{"failed message and password", []SpotFeed{{ID: "A"}, {ID: "B", Password: "wrong"}}, 1002, []string{"broker down", "E-0160"}, []int{1001}},
+		{"retried message", []SpotFeed{{ID: "A"}}, 0, nil, []int{1001, 1002, 1003}},
+		// An empty feed is not an error
+		{"empty feed", []SpotFeed{{ID: "C"}}, 0, nil, []int{1001, 1002, 1003}},
+	}
+	for _, tt := range tests {
+		fail = tt.fail
+		err := NewFeedPoller(server.URL+"/feed", tt.feeds, store, handle, WithSpacing(time.Nanosecond)).Poll()
+		if tt.err == nil {
+			assert.NoError(t, err, tt.name)
+		}
+		for _, message := range tt.err {
+			assert.ErrorContains(t, err, message, tt.name)
+		}
+		assert.Equal(t, tt.handled, handled, tt.name)
+	}
+}
+
+func TestParseSpotFeeds(t *testing.T) {
+	feeds, err := ParseSpotFeeds("0BkM9B2i01vF8eigoq3T1XO5HgMfQmfQa, 1abc:secret,," +
+		"https://api.findmespot.com/spot-main-web/consumer/rest-api/2.0/public/feed/2xyz/message.xml?feedPassword=pw")
+	assert.NoError(t, err)
+	assert.Equal(t, []SpotFeed{
+		{ID: "0BkM9B2i01vF8eigoq3T1XO5HgMfQmfQa"},
+		{ID: "1abc", Password: "secret"},
+		{ID: "2xyz", Password: "pw"},
+	}, feeds)
+
+	_, err = ParseSpotFeeds("https://example.com/message.xml")
+	assert.Error(t, err)
+}
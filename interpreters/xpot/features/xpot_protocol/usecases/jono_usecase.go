@@ -0,0 +1,136 @@
+package usecases
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+	jonoModels "xpot/features/jono/models"
+	"xpot/features/xpot_protocol/config"
+	"xpot/features/xpot_protocol/models"
+)
+
+// DefaultIMEIPrefix is prepended to the messenger ID (without dashes) to give SPOT devices the
+// numeric IMEI they have always been registered with on the platforms
+const DefaultIMEIPrefix = "2024000"
+
+// DeviceIMEI returns the IMEI a SPOT messenger is reported with
+func DeviceIMEI(messengerID string, prefix string) string {
+	return prefix + strings.ReplaceAll(messengerID, "-", "")
+}
+
+// MessageEvent returns the event of a SPOT message. Track messages sent with a LOW battery are
+// reported as Low Battery.
+func MessageEvent(message models.Message) config.CodeModel {
+	messageType := strings.ToUpper(strings.TrimSpace(message.MessageType))
+	event, exists := config.EventCodes[messageType]
+	if !exists {
+		event = config.TrackEvent
+	}
+	if event.Code == config.TrackEvent.Code && strings.EqualFold(message.BatteryState, "LOW") {
+		event = config.LowBatteryEvent
+	}
+	return event
+}
+
+// MessageTime returns the UTC time of a SPOT message, from its dateTime or its unixTime
+func MessageTime(message models.Message) (time.Time, error) {
+	if parsed, err := time.Parse(models.SpotTimeLayout, message.DateTime); err == nil {
+		return parsed.UTC(), nil
+	}
+	if message.UnixTime > 0 {
+		return time.Unix(message.UnixTime, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("message %d without a valid date: %q", message.ID, message.DateTime)
+}
+
+// MessageToJono converts a SPOT message into a Jono message with a single packet
+func MessageToJono(message models.Message, imeiPrefix string) (*jonoModels.ParsedModel, error) {
+	if message.MessengerID == "" {
+		return nil, fmt.Errorf("message %d without messengerId", message.ID)
+	}
+	moment, err := MessageTime(message)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := xml.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling message %d: %v", message.ID, err)
+	}
+
+	event := MessageEvent(message)
+	datetime := moment.Format(time.RFC3339)
+	latitude, longitude := message.Latitude, message.Longitude
+	speed, direction := 0, 0
+	status := "A"
+
+	inputs := make([]*string, 8)
+	ports := jonoModels.IoPortsStatus{}
+	for i := range inputs {
+		inputs[i] = stringPointer("0")
+	}
+	if input, pressed := config.ButtonInputs[strings.ToUpper(strings.TrimSpace(message.MessageType))]; pressed {
+		inputs[input-1] = stringPointer("1")
+		setPort(&ports, input)
+	}
+
+	packet := jonoModels.Packet{
+		Altitude:          message.Altitude,
+		Datetime:          &datetime,
+		EventCode:         jonoModels.EventCode{Code: event.Code, Name: event.Name},
+		Latitude:          &latitude,
+		Longitude:         &longitude,
+		Speed:             &speed,
+		Direction:         &direction,
+		PositioningStatus: &status,
+		IoPortStatus:      &ports,
+		InputPortStatus: &jonoModels.InputPortStatus{
+			Input1: inputs[0], Input2: inputs[1], Input3: inputs[2], Input4: inputs[3],
+			Input5: inputs[4], Input6: inputs[5], Input7: inputs[6], Input8: inputs[7],
+		},
+		SystemFlag: &jonoModels.SystemFlag{
+			SystemFlagExtras: stringPointer("battery:" + strings.ToUpper(message.BatteryState)),
+		},
+	}
+
+	imei := DeviceIMEI(message.MessengerID, imeiPrefix)
+	text := string(raw)
+	packets := 1
+	return &jonoModels.ParsedModel{
+		IMEI:        &imei,
+		Message:     &text,
+		DataPackets: &packets,
+		ListPackets: map[string]jonoModels.Packet{"packet_1": packet},
+	}, nil
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func setPort(ports *jonoModels.IoPortsStatus, port int) {
+	switch port {
+	case 1:
+		ports.Port1 = 1
+	case 2:
+		ports.Port2 = 1
+	case 3:
+		ports.Port3 = 1
+	case 4:
+		ports.Port4 = 1
+	}
+}
+
+// ParseFeed decodes a SPOT feed, hex encoded or as is
+func ParseFeed(payload string) (models.Response, error) {
+	data := []byte(payload)
+	if decoded, err := hex.DecodeString(strings.TrimSpace(payload)); err == nil {
+		data = decoded
+	}
+	var response models.Response
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return response, fmt.Errorf("error deserializing XML: %v", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,101 @@
+package usecases
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+	"xpot/features/xpot_protocol/config"
+	"xpot/features/xpot_protocol/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<response><feedMessageResponse><count>2</count><feed><id>0BkM9B2i01vF8eigoq3T1XO5HgMfQmfQa</id><name>Flota</name></feed>
+<messages>
+<message><id>1834200123</id><messengerId>0-2502211</messengerId><messengerName>Unidad 7</messengerName><unixTime>1704110400</unixTime>
+<messageType>SOS</messageType><latitude>19.43260</latitude><longitude>-99.13320</longitude><modelId>SPOT3</modelId><showCustomMsg>Y</showCustomMsg>
+<dateTime>2024-01-01T06:00:00-0600</dateTime><batteryState>GOOD</batteryState><hidden>0</hidden><altitude>2240</altitude></message>
+<message><id>1834200100</id><messengerId>0-2502211</messengerId><unixTime>1704110100</unixTime><messageType>TRACK</messageType>
+<latitude>19.43</latitude><longitude>-99.13</longitude><dateTime>2024-01-01T05:55:00-0600</dateTime><batteryState>LOW</batteryState></message>
+</messages></feedMessageResponse></response>`
+
+func TestParseFeed(t *testing.T) {
+	for _, payload := range []string{testFeed, hex.EncodeToString([]byte(testFeed))} {
+		response, err := ParseFeed(payload)
+		assert.NoError(t, err)
+		assert.Len(t, response.FeedMessageResponse.Messages, 2)
+		assert.Equal(t, "SOS", response.FeedMessageResponse.Messages[0].MessageType)
+	}
+
+	_, err := ParseFeed("not a feed")
+	assert.Error(t, err)
+}
+
+func TestMessageToJono(t *testing.T) {
+	response, err := ParseFeed(testFeed)
+	assert.NoError(t, err)
+
+	parsed, err := MessageToJono(response.FeedMessageResponse.Messages[0], DefaultIMEIPrefix)
+	assert.NoError(t, err)
+	assert.Equal(t, "202400002502211", *parsed.IMEI)
+	assert.Contains(t, *parsed.Message, "<messageType>SOS</messageType>")
+
+	packet := parsed.ListPackets["packet_1"]
+	assert.Equal(t, "2024-01-01T12:00:00Z", *packet.Datetime)
+	assert.Equal(t, 1, packet.EventCode.Code)
+	assert.Equal(t, 19.4326, *packet.Latitude)
+	assert.Equal(t, -99.1332, *packet.Longitude)
+	assert.Equal(t, 2240, packet.Altitude)
+	assert.Equal(t, "A", *packet.PositioningStatus)
+	assert.Equal(t, "1", *packet.InputPortStatus.Input1)
+	assert.Equal(t, "0", *packet.InputPortStatus.Input2)
+	assert.Equal(t, 1, packet.IoPortStatus.Port1)
+
+	json, err := parsed.ToJSON()
+	assert.NoError(t, err)
+	assert.Contains(t, json, `"EventCode":{"Code":1,"Name":"Input 1 Active"}`)
+
+	_, err = MessageToJono(models.Message{ID: 1, DateTime: "2024-01-01T06:00:00-0600"}, DefaultIMEIPrefix)
+	assert.Error(t, err)
+	_, err = MessageToJono(models.Message{ID: 1, MessengerID: "0-1"}, DefaultIMEIPrefix)
+	assert.Error(t, err)
+}
+
+func TestMessageEvent(t *testing.T) {
+	cases := map[string]config.CodeModel{
+		"TRACK":           config.TrackEvent,
+		"UNLIMITED-TRACK": config.TrackEvent,
+		"OK":              {Code: 3, Name: "Input 3 Active"},
+		"CUSTOM":          {Code: 4, Name: "Input 4 Active"},
+		"HELP":            {Code: 2, Name: "Input 2 Active"},
+		"NEWMOVEMENT":     {Code: 42, Name: "Start Moving"},
+		"POWER-OFF":       {Code: 40, Name: "Power Off"},
+		"STATUS":          config.TrackEvent,
+	}
+	for messageType, event := range cases {
+		assert.Equal(t, event, MessageEvent(models.Message{MessageType: messageType, BatteryState: "GOOD"}), messageType)
+	}
+
+	// A low battery only replaces the track events
+	assert.Equal(t, config.LowBatteryEvent, MessageEvent(models.Message{MessageType: "TRACK", BatteryState: "LOW"}))
+	assert.Equal(t, 1, MessageEvent(models.Message{MessageType: "SOS", BatteryState: "LOW"}).Code)
+}
+
+func TestMeitrackFrame(t *testing.T) {
+	response, err := ParseFeed(testFeed)
+	assert.NoError(t, err)
+
+	frame, err := MeitrackFrame(response.FeedMessageResponse.Messages[1], "202400002502211")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(frame, "$$A"))
+	assert.True(t, strings.HasSuffix(frame, "\r\n"))
+	assert.Contains(t, frame, ",202400002502211,AAA,17,19.430000,-99.130000,240101115500,A,")
+
+	// Length from the first comma to \r\n, checksum over everything before it
+	comma := strings.Index(frame, ",")
+	assert.Equal(t, frame[3:comma], strconv.Itoa(len(frame)-comma))
+	star := strings.LastIndex(frame, "*")
+	assert.Equal(t, meitrackChecksum(frame[:star+1]), frame[star+1:star+3])
+}
@@ -0,0 +1,116 @@
+package usecases
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"xpot/features/xpot_protocol/models"
+	"xpot/utils"
+)
+
+// Sink receives every new SPOT message besides the Jono publication
+type Sink interface {
+	Name() string
+	Send(message models.Message) error
+}
+
+// StoreSink keeps the bridge tables up to date: the last position in devices.log and every
+// message in spotx_message
+type StoreSink struct {
+	Driver string
+	Store  Store
+}
+
+func (s *StoreSink) Name() string {
+	return s.Driver
+}
+
+// Send saves the message and its device log, messages already saved are skipped
+func (s *StoreSink) Send(message models.Message) error {
+	saved, err := s.Store.SaveMessage(message, DeviceLog(message))
+	if err != nil {
+		return err
+	}
+	if !saved {
+		utils.VPrint("Message %d already exists in database, skipping", message.ID)
+	}
+	return nil
+}
+
+// DeviceLog is the last position line kept in devices.log
+func DeviceLog(message models.Message) string {
+	logTime := message.DateTime
+	if moment, err := MessageTime(message); err == nil {
+		logTime = moment.Format("2006/01/02 15:04:05")
+	}
+	return "*" + logTime + " IMEI:" + message.MessengerID +
+		" fecha:" + message.DateTime +
+		" EC:" + message.MessageType +
+		" lat:" + strconv.FormatFloat(message.Latitude, 'f', 6, 64) +
+		" lon:" + strconv.FormatFloat(message.Longitude, 'f', 6, 64) +
+		" alt:" + strconv.Itoa(message.Altitude) +
+		" vel:0 az:0"
+}
+
+// MeitrackSink forwards every message as a Meitrack AAA frame over TCP, for servers that
+// still expect SPOT devices in that format
+type MeitrackSink struct {
+	Address    string
+	IMEIPrefix string
+	Timeout    time.Duration
+}
+
+func (s *MeitrackSink) Name() string {
+	return "meitrack"
+}
+
+// Send dials the server, writes the frame and closes the connection
+func (s *MeitrackSink) Send(message models.Message) error {
+	frame, err := MeitrackFrame(message, DeviceIMEI(message.MessengerID, s.IMEIPrefix))
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", s.Address, timeout)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %v", s.Address, err)
+	}
+	defer conn.Close()
+
+	utils.VPrint("Sending data to %s: %s", s.Address, frame)
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte(frame)); err != nil {
+		return fmt.Errorf("error sending data to %s: %v", s.Address, err)
+	}
+	return nil
+}
+
+// MeitrackFrame builds the Meitrack AAA frame of a SPOT message, with its event code and fixed
+// values for what SPOT does not report
+func MeitrackFrame(message models.Message, imei string) (string, error) {
+	moment, err := MessageTime(message)
+	if err != nil {
+		return "", err
+	}
+	trama := "," + imei + ",AAA," + strconv.Itoa(MessageEvent(message).Code) + "," +
+		strconv.FormatFloat(message.Latitude, 'f', 6, 64) + "," + strconv.FormatFloat(message.Longitude, 'f', 6, 64) + "," +
+		moment.Format("060102150405") + ",A,1,14,0,0,1.0," + strconv.Itoa(message.Altitude) +
+		",0,0,334|3|2349|A37D,0000,0002|0000|0000|0A27|0000,00000001,*"
+	// The length counts from the first comma to the final \r\n, checksum included
+	header := "$$A" + strconv.Itoa(len(trama)+4)
+	return header + trama + meitrackChecksum(header+trama) + "\r\n", nil
+}
+
+// meitrackChecksum is the sum of the bytes modulo 256, in upper case hex
+func meitrackChecksum(source string) string {
+	sum := 0
+	for i := 0; i < len(source); i++ {
+		sum += int(source[i])
+	}
+	return strings.ToUpper(fmt.Sprintf("%02x", sum%256))
+}
@@ -0,0 +1,205 @@
+package usecases
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"xpot/features/xpot_protocol/config"
+	"xpot/features/xpot_protocol/models"
+)
+
+// Store keeps the SPOT messages and the last position of every device
+type Store interface {
+	// MessageExists tells whether a message of a messenger was saved
+	MessageExists(messengerID string, id int) (bool, error)
+	// LastMessageIDs returns the newest message saved for each messenger
+	LastMessageIDs() (map[string]int, error)
+	// SaveMessage saves a message and updates the log of its device in one transaction.
+	// It returns false when the message was already saved.
+	SaveMessage(message models.Message, deviceLog string) (bool, error)
+	Close() error
+}
+
+// Store drivers, also the names of their migration directories
+const (
+	MySQLDriver  = "mysql"
+	SQLiteDriver = "sqlite3"
+)
+
+// SQLStore is the Store of the MySQL and SQLite databases, with prepared statements
+type SQLStore struct {
+	db     *sql.DB
+	driver string
+
+	exists     *sql.Stmt
+	lastIDs    *sql.Stmt
+	updateLog  *sql.Stmt
+	insertSpot *sql.Stmt
+}
+
+// OpenStore opens a database (MySQLDriver or SQLiteDriver), migrates its schema and prepares the statements
+func OpenStore(driver string, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s store: %v", driver, err)
+	}
+	if driver == SQLiteDriver {
+		// A single connection, SQLite locks the whole database on writes
+		db.SetMaxOpenConns(1)
+	}
+	store, err := NewSQLStore(db, driver)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewSQLStore migrates an open database and prepares the statements
+func NewSQLStore(db *sql.DB, driver string) (*SQLStore, error) {
+	if err := Migrate(db, driver); err != nil {
+		return nil, err
+	}
+
+	// The message id column is text
+	idType := "UNSIGNED"
+	if driver == SQLiteDriver {
+		idType = "INTEGER"
+	}
+	store := &SQLStore{db: db, driver: driver}
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&store.exists, "SELECT EXISTS(SELECT 1 FROM spotx_message WHERE id = ? AND messengerId = ?)"},
+		{&store.lastIDs, "SELECT messengerId, MAX(CAST(id AS " + idType + ")) FROM spotx_message GROUP BY messengerId"},
+		{&store.updateLog, "UPDATE devices SET log = ? WHERE protocol = 100 AND password = ? AND ff0 = ?"},
+		{&store.insertSpot, "INSERT INTO spotx_message (id, messengerId, messengerName, unixTime, messageType, latitude, longitude, " +
+			"modelId, showCustomMsg, dateTime, batteryState, hidden, altitude) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"},
+	}
+	for _, statement := range statements {
+		stmt, err := db.Prepare(statement.query)
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("error preparing %q: %v", statement.query, err)
+		}
+		*statement.stmt = stmt
+	}
+	return store, nil
+}
+
+func (s *SQLStore) MessageExists(messengerID string, id int) (bool, error) {
+	var exists bool
+	if err := s.exists.QueryRow(strconv.Itoa(id), messengerID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking message existence: %v", err)
+	}
+	return exists, nil
+}
+
+func (s *SQLStore) LastMessageIDs() (map[string]int, error) {
+	rows, err := s.lastIDs.Query()
+	if err != nil {
+		return nil, fmt.Errorf("error reading last messages: %v", err)
+	}
+	defer rows.Close()
+
+	lastIDs := make(map[string]int)
+	for rows.Next() {
+		var messengerID string
+		var id int
+		if err := rows.Scan(&messengerID, &id); err != nil {
+			return nil, fmt.Errorf("error reading last messages: %v", err)
+		}
+		lastIDs[messengerID] = id
+	}
+	return lastIDs, rows.Err()
+}
+
+func (s *SQLStore) SaveMessage(message models.Message, deviceLog string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.Stmt(s.exists).QueryRow(strconv.Itoa(message.ID), message.MessengerID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking message existence: %v", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := tx.Stmt(s.updateLog).Exec(deviceLog, message.MessengerID, message.ID); err != nil {
+		return false, fmt.Errorf("error updating device log: %v", err)
+	}
+	_, err = tx.Stmt(s.insertSpot).Exec(
+		strconv.Itoa(message.ID), message.MessengerID, message.MessengerName, strconv.FormatInt(message.UnixTime, 10), message.MessageType,
+		strconv.FormatFloat(message.Latitude, 'f', 6, 64), strconv.FormatFloat(message.Longitude, 'f', 6, 64),
+		message.ModelID, message.ShowCustomMsg, message.DateTime, message.BatteryState, message.Hidden, message.Altitude)
+	if err != nil {
+		return false, fmt.Errorf("error saving message to database: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error saving message to database: %v", err)
+	}
+	return true, nil
+}
+
+func (s *SQLStore) Close() error {
+	for _, stmt := range []*sql.Stmt{s.exists, s.lastIDs, s.updateLog, s.insertSpot} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	return s.db.Close()
+}
+
+// Migrate applies the migrations of config.Migrations not applied yet, recording each
+// version (its file name) in schema_migrations
+func Migrate(db *sql.DB, driver string) error {
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version varchar(255) NOT NULL PRIMARY KEY)"); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %v", err)
+	}
+	files, err := fs.Glob(config.Migrations, path.Join("migrations", driver, "*.sql"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no migrations for driver %q", driver)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		version := strings.TrimSuffix(path.Base(file), ".sql")
+		var applied bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = ?)", version).Scan(&applied); err != nil {
+			return fmt.Errorf("error reading schema_migrations: %v", err)
+		}
+		if applied {
+			continue
+		}
+
+		data, err := config.Migrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		// One statement at a time, the MySQL driver does not run several in one Exec
+		for _, statement := range strings.Split(string(data), ";") {
+			if strings.TrimSpace(statement) == "" {
+				continue
+			}
+			if _, err := db.Exec(statement); err != nil {
+				return fmt.Errorf("migration %s: %v", version, err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+			return fmt.Errorf("migration %s: %v", version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package usecases
+
+import (
+	"path/filepath"
+	"testing"
+	"xpot/features/xpot_protocol/models"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreSaveMessage(t *testing.T) {
+	store, err := OpenStore(SQLiteDriver, filepath.Join(t.TempDir(), "xpot.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer store.Close()
+	_, err = store.db.Exec("INSERT INTO devices (imei, protocol, password, ff0) VALUES ('202400002502211', 100, '0-2502211', 1834200123)")
+	assert.NoError(t, err)
+
+	message := models.Message{
+		ID: 1834200123, MessengerID: "0-2502211", MessengerName: "Unidad 7", UnixTime: 1704110400, MessageType: "TRACK",
+		Latitude: 19.4326, Longitude: -99.1332, DateTime: "2024-01-01T06:00:00-0600", BatteryState: "GOOD", Altitude: 2240,
+	}
+	sink := &StoreSink{Driver: SQLiteDriver, Store: store}
+	assert.NoError(t, sink.Send(message))
+
+	exists, err := store.MessageExists("0-2502211", 1834200123)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	var deviceLog string
+	assert.NoError(t, store.db.QueryRow("SELECT log FROM devices WHERE imei = '202400002502211'").Scan(&deviceLog))
+	assert.Equal(t, "*2024/01/01 12:00:00 IMEI:0-2502211 fecha:2024-01-01T06:00:00-0600 EC:TRACK lat:19.432600 lon:-99.133200 alt:2240 vel:0 az:0", deviceLog)
+
+	// Saved once
+	saved, err := store.SaveMessage(message, "ignored")
+	assert.NoError(t, err)
+	assert.False(t, saved)
+	var count int
+	assert.NoError(t, store.db.QueryRow("SELECT COUNT(*) FROM spotx_message").Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// Quotes are data, not SQL
+	hostile := models.Message{ID: 9, MessengerID: "0-1'; DROP TABLE devices; --", MessengerName: "O'Brien", UnixTime: 1704110400}
+	saved, err = store.SaveMessage(hostile, DeviceLog(hostile))
+	assert.NoError(t, err)
+	assert.True(t, saved)
+	var name string
+	assert.NoError(t, store.db.QueryRow("SELECT messengerName FROM spotx_message WHERE id = '9'").Scan(&name))
+	assert.Equal(t, "O'Brien", name)
+	assert.NoError(t, store.db.QueryRow("SELECT COUNT(*) FROM devices").Scan(&count))
+	assert.Equal(t, 1, count)
+
+	lastIDs, err := store.LastMessageIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"0-2502211": 1834200123, "0-1'; DROP TABLE devices; --": 9}, lastIDs)
+}
+
+func TestStoreMigrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xpot.db")
+	store, err := OpenStore(SQLiteDriver, path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var versions []string
+	rows, err := store.db.Query("SELECT version FROM schema_migrations ORDER BY version")
+	assert.NoError(t, err)
+	for rows.Next() {
+		var version string
+		assert.NoError(t, rows.Scan(&version))
+		versions = append(versions, version)
+	}
+	rows.Close()
+	assert.Equal(t, []string{"0001_devices", "0002_spotx_message"}, versions)
+
+	// Reopening applies nothing twice and keeps the data
+	_, err = store.SaveMessage(models.Message{ID: 1, MessengerID: "0-1"}, "")
+	assert.NoError(t, err)
+	store.Close()
+
+	reopened, err := OpenStore(SQLiteDriver, path)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	exists, err := reopened.MessageExists("0-1", 1)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	_, err = OpenStore("postgres", "")
+	assert.Error(t, err)
+}
@@ -1,21 +1,26 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/hex"
-	"encoding/xml"
+	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"xpot/features/xpot_protocol/models"
+	"xpot/features/xpot_protocol/usecases"
 	"xpot/utils"
 
+	"github.com/MaddSystems/jonobridge/common/broker"
+	commonutils "github.com/MaddSystems/jonobridge/common/utils"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 // Codigo de la vieja escuela
@@ -38,66 +43,8 @@ func getMySQLDSN() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", user, pass, host, port, dbname)
 }
 
-func crc(source string) string {
-	sum := 0
-	for i := 0; i < len(source); i++ {
-		newString := source[i : i+1]
-		nv := []rune(newString)[0]
-		sum = sum + int(nv)
-	}
-
-	module := sum % 256
-
-	hv := fmt.Sprintf("%x", module)
-
-	res1 := strings.ToUpper(hv)
-	return res1
-}
-
 // FIN del codigo de la vieja escuela
 
-// Definición de las estructuras para deserializar el XML
-type Response struct {
-	XMLName             xml.Name            `xml:"response"`
-	FeedMessageResponse FeedMessageResponse `xml:"feedMessageResponse"`
-}
-
-type FeedMessageResponse struct {
-	Count         int       `xml:"count"`
-	Feed          Feed      `xml:"feed"`
-	TotalCount    int       `xml:"totalCount"`
-	ActivityCount int       `xml:"activityCount"`
-	Messages      []Message `xml:"messages>message"`
-}
-
-type Feed struct {
-	ID                   string `xml:"id"`
-	Name                 string `xml:"name"`
-	Description          string `xml:"description"`
-	Status               string `xml:"status"`
-	Usage                int    `xml:"usage"`
-	DaysRange            int    `xml:"daysRange"`
-	DetailedMessageShown bool   `xml:"detailedMessageShown"`
-	Type                 string `xml:"type"`
-}
-
-type Message struct {
-	ID             int     `xml:"id"`
-	MessengerID    string  `xml:"messengerId"`
-	MessengerName  string  `xml:"messengerName"`
-	UnixTime       int64   `xml:"unixTime"`
-	MessageType    string  `xml:"messageType"`
-	Latitude       float64 `xml:"latitude"`
-	Longitude      float64 `xml:"longitude"`
-	ModelID        string  `xml:"modelId"`
-	ShowCustomMsg  string  `xml:"showCustomMsg"`
-	DateTime       string  `xml:"dateTime"`
-	BatteryState   string  `xml:"batteryState"`
-	Hidden         int     `xml:"hidden"`
-	Altitude       int     `xml:"altitude"`
-	MessageContent string  `xml:"messageContent,omitempty"`
-}
-
 type Device struct {
 	ID     int
 	Imei   string
@@ -105,15 +52,25 @@ type Device struct {
 	VIN    string
 }
 
-func processSpotXData(db *sql.DB) error {
+// bridge publishes every new SPOT message as Jono and hands it to the configured sinks
+type bridge struct {
+	client     mqtt.Client
+	config     *broker.Config
+	sinks      []usecases.Sink
+	imeiPrefix string
+	poller     *usecases.FeedPoller
+	archive    *commonutils.FrameArchive // Inbound feeds with their Jono output, nil when FRAME_ARCHIVE_DIR is not set
+
+	mutex   sync.Mutex
+	lastIDs map[string]int // Newest message sent per messenger
+}
+
+func processSpotXData(b *bridge) error {
 	// Set up MQTT client options
-	opts := mqtt.NewClientOptions()
-	mqttBrokerHost := os.Getenv("MQTT_BROKER_HOST")
-	if mqttBrokerHost == "" {
-		log.Fatal("MQTT_BROKER_HOST environment variable not set")
+	opts, err := b.config.ClientOptions()
+	if err != nil {
+		return err
 	}
-	brokerURL := fmt.Sprintf("tcp://%s:1883", mqttBrokerHost)
-	opts.AddBroker(brokerURL)
 	subscribe_topic := "http/get"
 	clientID := fmt.Sprintf("xpot_%s_%s_%d",
 		subscribe_topic,
@@ -122,7 +79,7 @@ func processSpotXData(db *sql.DB) error {
 	opts.SetClientID(clientID)
 
 	// Configure MQTT client settings
-	opts.SetCleanSession(false)
+	opts.SetCleanSession(b.config.Shared()) // Persistent session, unless the replicas share the subscriptions
 	opts.SetAutoReconnect(true)
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetOrderMatters(true)
@@ -135,83 +92,89 @@ func processSpotXData(db *sql.DB) error {
 	})
 
 	// Create and connect MQTT client
-	mqttClient := mqtt.NewClient(opts)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
+	b.client = mqtt.NewClient(opts)
+	if token := b.client.Connect(); token.Wait() && token.Error() != nil {
 		return fmt.Errorf("error connecting to MQTT broker: %v", token.Error())
 	}
-	log.Printf("Connected to MQTT broker at %s", brokerURL)
+	log.Printf("Connected to MQTT broker at %s", b.config.URL)
 
 	// Subscribe to the topic
-	if token := mqttClient.Subscribe(subscribe_topic, 0, func(client mqtt.Client, msg mqtt.Message) {
-		trackerPayload := string(msg.Payload())
-		var trackerData string
-
-		// Try to decode as hex, if it fails, use the original message
-		bytes, err := hex.DecodeString(trackerPayload)
-		if err != nil {
-			trackerData = trackerPayload
-			utils.VPrint("Hex decode error: %s", err)
-		} else {
-			trackerData = string(bytes)
-		}
+	if token := b.config.Subscribe(b.client, subscribe_topic, 0, func(client mqtt.Client, msg mqtt.Message) {
+		b.handleFeed(string(msg.Payload()))
+	}); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("error subscribing to topic: %v", token.Error())
+	}
 
-		var response Response
-		if err := xml.Unmarshal([]byte(trackerData), &response); err != nil {
-			utils.VPrint("Error deserializing XML: %v", err)
-			return
-		}
+	log.Printf("Subscribed to topic: %s", subscribe_topic)
 
-		utils.VPrint("Processing %d messages from SpotX", len(response.FeedMessageResponse.Messages))
-		processedIDs := make(map[string]bool)
+	if b.poller != nil {
+		log.Printf("Polling %d SPOT feeds", len(b.poller.Feeds))
+		go b.poller.Run(context.Background(), func(err error) {
+			log.Printf("Error polling SPOT feeds: %v", err)
+		})
+	}
 
-		for _, message := range response.FeedMessageResponse.Messages {
-			// Skip if we've already processed this messenger in this batch
-			if processedIDs[message.MessengerID] {
-				continue
-			}
-			processedIDs[message.MessengerID] = true
+	// Keep the connection alive until the process is stopped
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down...", sig)
+	b.client.Disconnect(1000)
+	return nil
+}
 
-			utils.VPrint("Processing message for Messenger ID: %s", message.MessengerID)
+// handleFeed processes the newest message of each messenger in a feed, once
+func (b *bridge) handleFeed(payload string) {
+	record := b.archive.Begin(payload, "")
+	defer record.End()
 
-			var exists bool
-			err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM spotx_message WHERE id = ? and messengerId = ?)",
-				message.ID, message.MessengerID).Scan(&exists)
-			if err != nil {
-				log.Printf("Error checking message existence: %v", err)
-				continue
-			}
+	response, err := usecases.ParseFeed(payload)
+	if err != nil {
+		record.Fail(err)
+		utils.VPrint("%v", err)
+		return
+	}
 
-			if !exists {
-				if err := processMessage(db, message); err != nil {
-					log.Printf("Error processing message: %v", err)
-					continue
-				}
-			} else {
-				utils.VPrint("Message already exists in database, skipping")
-			}
+	utils.VPrint("Processing %d messages from SpotX", len(response.FeedMessageResponse.Messages))
+	processedIDs := make(map[string]bool)
+
+	for _, message := range response.FeedMessageResponse.Messages {
+		// Skip if we've already processed this messenger in this batch
+		if processedIDs[message.MessengerID] {
+			continue
+		}
+		processedIDs[message.MessengerID] = true
+
+		if err := b.handleMessage(message, record); err != nil {
+			log.Printf("Error processing message: %v", err)
 		}
-	}); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("error subscribing to topic: %v", token.Error())
 	}
+}
 
-	log.Printf("Subscribed to topic: %s", subscribe_topic)
+// handleMessage processes a message unless it was already sent, the Jono message is added to
+// record when there is one
+func (b *bridge) handleMessage(message models.Message, record *commonutils.FrameRecord) error {
+	b.mutex.Lock()
+	lastID, seen := b.lastIDs[message.MessengerID]
+	b.mutex.Unlock()
+	if seen && message.ID <= lastID {
+		utils.VPrint("Message %d of %s already sent, skipping", message.ID, message.MessengerID)
+		return nil
+	}
+
+	utils.VPrint("Processing message for Messenger ID: %s", message.MessengerID)
+	if err := b.processMessage(message, record); err != nil {
+		return err
+	}
 
-	// Keep the connection alive
-	select {}
+	b.mutex.Lock()
+	b.lastIDs[message.MessengerID] = message.ID
+	b.mutex.Unlock()
+	return nil
 }
 
-func processMessage(db *sql.DB, message Message) error {
+func (b *bridge) processMessage(message models.Message, record *commonutils.FrameRecord) error {
 	utils.VPrint("New message found, processing...")
-	// --------- CODIGO PARA ACTUALIZAR EL HORARIO EN LA VISTA DEL BRIDGE
-	input := message.DateTime
-	parsedTime, err := time.Parse("2006-01-02T15:04:05-0700", input)
-	if err != nil {
-		return fmt.Errorf("error parsing date: %v", err)
-	}
-
-	// Convertir a UTC
-	utcTime := parsedTime.UTC()
-	output := utcTime.Format("2006/01/02 15:04:05")
 	utils.VPrint("Message Values:")
 	utils.VPrint("  MessengerID: %s", message.MessengerID)
 	utils.VPrint("  DateTime: %s", message.DateTime)
@@ -220,163 +183,126 @@ func processMessage(db *sql.DB, message Message) error {
 	utils.VPrint("  Longitude: %f", message.Longitude)
 	utils.VPrint("  Altitude: %d", message.Altitude)
 
-	// Send to Elasticsearch
-	client_id := os.Getenv("CLIENT_ID")
-
-	logData := utils.ElasticLogData{
-		Client:      client_id,
-		MessengerId: message.MessengerID,
-		DateTime:    message.DateTime,
-		Type:        message.MessageType,
-		Lat:         message.Latitude,
-		Lon:         message.Longitude,
-		Alt:         message.Altitude,
-	}
-
-	if err := utils.SendToElastic(logData); err != nil {
-		utils.VPrint("Error sending to elastic: %v", err)
-		// Don't return the error as we don't want to fail the main operation
-	}
-
-	payloaddata := "*" + output + " IMEI:" + message.MessengerID +
-		" fecha:" + message.DateTime +
-		" EC:" + message.MessageType +
-		" lat:" + strconv.FormatFloat(message.Latitude, 'f', 6, 64) +
-		" lon:" + strconv.FormatFloat(message.Longitude, 'f', 6, 64) +
-		" alt:" + strconv.Itoa(message.Altitude) +
-		" vel:0 az:0"
-	cmd := "UPDATE devices SET log='" + payloaddata + "' WHERE protocol=100 and password='" + message.MessengerID + "' and ff0= " + strconv.Itoa(message.ID)
-	utils.VPrint("Executing update query: %s", cmd)
-	_, err = db.Exec(cmd)
+	// --------- JONO PROTOCOL
+	parsed, err := usecases.MessageToJono(message, b.imeiPrefix)
 	if err != nil {
-		return fmt.Errorf("error updating device log: %v", err)
+		record.Fail(err)
+		return err
 	}
-
-	// --------- ENVIO AL SERVER 1
-	utils.VPrint("Preparing to send data to Server1")
-	input2 := message.DateTime
-	originalTime, err := time.Parse("2006-01-02T15:04:05-0700", input2)
+	jonoNormalize, err := parsed.ToJSON()
 	if err != nil {
-		return fmt.Errorf("error parsing date for Server1: %v", err)
+		record.Fail(err)
+		return err
 	}
-	utcTime = originalTime.In(time.UTC)
-	ano := utcTime.Year() % 100
-	mes := utcTime.Month()
-	dia := utcTime.Day()
-	hora := utcTime.Hour()
-	minuto := utcTime.Minute()
-	segundo := utcTime.Second()
-
-	dateserver := fmt.Sprintf("%02d%02d%02d%02d%02d%02d", ano, mes, dia, hora, minuto, segundo)
-	idlimpio := strings.Replace(message.MessengerID, "-", "", -1)
-	imei := "2024000" + idlimpio
-	trama := "," + imei + ",AAA,35," + strconv.FormatFloat(message.Latitude, 'f', 6, 64) + "," + strconv.FormatFloat(message.Longitude, 'f', 6, 64) + "," + dateserver + ",A,1,14,0,100,1.0,2264,0,0,334|3|2349|A37D,0000,0002|0000|0000|0A27|0000,00000001,*F0"
-	totalchar2 := len(trama) + 5
-	header2 := "$$A" + strconv.Itoa(totalchar2)
-	preoutput2 := header2 + trama
-	payload2 := preoutput2 + crc(preoutput2) + "\r\n"
-	data2 := []byte(payload2)
-
-	utils.VPrint("Connecting to Server1: %s", *server1Address)
-	nDDr2, err := net.ResolveTCPAddr("tcp", *server1Address)
-	if err != nil {
-		return fmt.Errorf("error resolving Server1 address: %v", err)
+	record.Jono(jonoNormalize)
+	utils.VPrint("Publishing to tracker/jonoprotocol: %s", jonoNormalize)
+	// Jono messages carry the vehicle when VEHICLE_ENRICH is enabled, and the virtual IMEI of the
+	// device when IMEI_VIRTUALIZE is
+	payload := commonutils.PublishPayload("tracker/jonoprotocol", jonoNormalize)
+	if token := b.config.Publish(b.client, "tracker/jonoprotocol", payload); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("error publishing to jonoprotocol: %v", token.Error())
 	}
 
-	server1TimeConn, err := net.DialTCP("tcp", nil, nDDr2)
-	if err != nil {
-		return fmt.Errorf("error connecting to Server1: %v", err)
+	// --------- OPTIONAL SINKS
+	for _, sink := range b.sinks {
+		if err := sink.Send(message); err != nil {
+			log.Printf("Error sending message %d to %s: %v", message.ID, sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// newSinks creates the sinks listed in XPOT_SINKS (mysql, sqlite, meitrack)
+func newSinks(names string, imeiPrefix string) ([]usecases.Sink, map[string]int, error) {
+	var sinks []usecases.Sink
+	lastIDs := make(map[string]int)
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "mysql", "sqlite":
+			driver, dsn := usecases.MySQLDriver, getMySQLDSN()
+			if strings.EqualFold(strings.TrimSpace(name), "sqlite") {
+				driver, dsn = usecases.SQLiteDriver, getEnvWithDefault("XPOT_SQLITE_PATH", "xpot.db")
+			}
+			utils.VPrint("Connecting to %s database...", driver)
+			store, err := usecases.OpenStore(driver, dsn)
+			if err != nil {
+				return nil, nil, err
+			}
+			// The messages already saved are not sent again after a restart
+			if lastIDs, err = store.LastMessageIDs(); err != nil {
+				return nil, nil, err
+			}
+			sinks = append(sinks, &usecases.StoreSink{Driver: driver, Store: store})
+		case "meitrack":
+			sinks = append(sinks, &usecases.MeitrackSink{Address: *server1Address, IMEIPrefix: imeiPrefix})
+		default:
+			return nil, nil, fmt.Errorf("unknown sink %q in XPOT_SINKS", name)
+		}
 	}
-	defer server1TimeConn.Close()
+	return sinks, lastIDs, nil
+}
 
-	utils.VPrint("Sending data to Server1: %s", payload2)
-	_, err = server1TimeConn.Write(data2)
+// newFeedPoller polls the feeds of XPOT_FEEDS every XPOT_POLLING_TIME seconds, nil without feeds
+func newFeedPoller(b *bridge) (*usecases.FeedPoller, error) {
+	feeds, err := usecases.ParseSpotFeeds(os.Getenv("XPOT_FEEDS"))
+	if err != nil || len(feeds) == 0 {
+		return nil, err
+	}
+	store, err := usecases.NewFeedCursorStore(getEnvWithDefault("XPOT_CURSOR_FILE", "xpot_cursors.json"))
 	if err != nil {
-		return fmt.Errorf("error sending data to Server1: %v", err)
+		return nil, err
 	}
-
-	// ---------  SAVE THE MESSAGE TO DATABASE
-	cmd = "INSERT INTO spotx_message (id,messengerId,messengerName,unixTime,messageType,latitude,longitude,modelId,showCustomMsg,dateTime,batteryState,hidden,altitude) " +
-		"value (" + strconv.Itoa(message.ID) + ",'" + message.MessengerID + "','" + message.MessengerName + "','" + strconv.FormatInt(message.UnixTime, 10) + "','" +
-		message.MessageType + "','" + strconv.FormatFloat(message.Latitude, 'f', 6, 64) + "','" + strconv.FormatFloat(message.Longitude, 'f', 6, 64) +
-		"','" + message.ModelID + "','" + message.ShowCustomMsg + "','" + message.DateTime + "','" + message.BatteryState + "'," + strconv.Itoa(message.Hidden) + "," + strconv.Itoa(message.Altitude) + ");"
-	utils.VPrint("Saving message to database: %s", cmd)
-	_, err = db.Exec(cmd)
+	seconds, err := strconv.Atoi(getEnvWithDefault("XPOT_POLLING_TIME", "150"))
 	if err != nil {
-		return fmt.Errorf("error saving message to database: %v", err)
+		return nil, fmt.Errorf("invalid XPOT_POLLING_TIME: %v", err)
 	}
-
-	return nil
+	interval := time.Duration(seconds) * time.Second
+	if interval < usecases.MinFeedInterval {
+		log.Printf("XPOT_POLLING_TIME raised to SPOT's minimum of %s", usecases.MinFeedInterval)
+	}
+	return usecases.NewFeedPoller(getEnvWithDefault("XPOT_FEED_URL", usecases.DefaultFeedURL), feeds, store, func(feed usecases.SpotFeed, message models.Message) error {
+		return b.handleMessage(message, nil)
+	}, usecases.WithPollInterval(interval)), nil
 }
 
 func main() {
-	// Add debug flag
-	debugFlag := flag.Bool("v", false, "Enable verbose output")
+	// The -v flag is registered by the common utils
+	mqttFlags := broker.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	utils.SetVerbose(*debugFlag)
+	utils.SetVerbose(commonutils.Verbose)
 
-	// Paso 1. Ir por todos los equipos registrados en la base de datos:
-	var db *sql.DB
-	var err error
-	utils.VPrint("Connecting to database...")
-	dsn := getMySQLDSN()
-	utils.VPrint("Using MySQL DSN: %s", dsn)
-	db, err = sql.Open("mysql", dsn)
+	mqttConfig, err := mqttFlags.Load()
 	if err != nil {
-		log.Printf("Error al cargar el driver mysql: %v", err)
-		return
+		log.Fatal(err)
 	}
-	defer db.Close()
-
-	// Create devices table if it doesn't exist
-	utils.VPrint("Creating devices table if not exists...")
-	createDevicesSQL := `CREATE TABLE IF NOT EXISTS devices (
-		imei varchar(255) DEFAULT NULL,
-		plates varchar(255) DEFAULT NULL,
-		vin varchar(255) DEFAULT NULL,
-		protocol int(11) DEFAULT NULL,
-		password varchar(255) DEFAULT NULL,
-		log text DEFAULT NULL,
-		ff0 int(11) DEFAULT NULL,
-		INDEX idx_protocol (protocol),
-		INDEX idx_password (password),
-		INDEX idx_ff0 (ff0)
-	) ENGINE=InnoDB DEFAULT CHARSET=latin1`
-
-	_, err = db.Exec(createDevicesSQL)
+
+	imeiPrefix := getEnvWithDefault("XPOT_IMEI_PREFIX", usecases.DefaultIMEIPrefix)
+	sinks, lastIDs, err := newSinks(getEnvWithDefault("XPOT_SINKS", ""), imeiPrefix)
 	if err != nil {
-		log.Printf("Error creating devices table: %v", err)
+		log.Printf("Error creating sinks: %v", err)
 		return
 	}
+	for _, sink := range sinks {
+		log.Printf("Sink enabled: %s", sink.Name())
+	}
 
-	// Create spotx_message table if it doesn't exist
-	utils.VPrint("Creating spotx_message table if not exists...")
-	createTableSQL := `CREATE TABLE IF NOT EXISTS spotx_message (
-		id varchar(255) DEFAULT NULL,
-		messengerId varchar(255) DEFAULT NULL,
-		messengerName varchar(255) DEFAULT NULL,
-		unixTime varchar(255) DEFAULT NULL,
-		messageType varchar(255) DEFAULT NULL,
-		latitude varchar(255) DEFAULT NULL,
-		longitude varchar(255) DEFAULT NULL,
-		modelId varchar(255) DEFAULT NULL,
-		showCustomMsg varchar(255) DEFAULT NULL,
-		dateTime varchar(255) DEFAULT NULL,
-		batteryState varchar(255) DEFAULT NULL,
-		hidden int(11) DEFAULT NULL,
-		altitude int(11) DEFAULT NULL,
-		INDEX idx_id_messenger (id, messengerId)
-	) ENGINE=InnoDB DEFAULT CHARSET=latin1`
-
-	_, err = db.Exec(createTableSQL)
-	if err != nil {
-		log.Printf("Error creating spotx_message table: %v", err)
+	b := &bridge{
+		config:     mqttConfig,
+		sinks:      sinks,
+		imeiPrefix: imeiPrefix,
+		lastIDs:    lastIDs,
+		archive:    commonutils.DefaultFrameArchive("xpot"),
+	}
+	if b.poller, err = newFeedPoller(b); err != nil {
+		log.Printf("Error configuring SPOT feeds: %v", err)
 		return
 	}
 
 	log.Println("Starting MQTT listener for SpotX data...")
-	if err := processSpotXData(db); err != nil {
+	if err := processSpotXData(b); err != nil {
 		log.Fatal(err)
 	}
+	b.archive.Close()
 }
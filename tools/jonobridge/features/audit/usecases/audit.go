@@ -0,0 +1,53 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	decoders "jonobridge/features/decoders/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+)
+
+// AuditedFrame is an archived frame with the output of the current code
+type AuditedFrame struct {
+	utils.ArchivedFrame
+	Redecoded     []json.RawMessage `json:"redecoded,omitempty"`
+	RedecodeError string            `json:"redecode_error,omitempty"`
+	Changed       bool              `json:"changed"` // The output differs from the archived one
+}
+
+// Redecode runs an archived frame through its interpreter again
+func Redecode(frame utils.ArchivedFrame) AuditedFrame {
+	audited := AuditedFrame{ArchivedFrame: frame}
+	messages, err := decoders.Decode(frame.Interpreter, frame.Payload, frame.IMEI)
+	if err != nil {
+		audited.RedecodeError = err.Error()
+	}
+	for _, message := range messages {
+		audited.Redecoded = append(audited.Redecoded, decoders.Compact(message))
+	}
+	audited.Changed = !SameJono(frame.Jono, audited.Redecoded) || (frame.Error == "") != (audited.RedecodeError == "")
+	return audited
+}
+
+// SameJono reports whether two lists of Jono messages hold the same values, whatever the formatting
+func SameJono(a []json.RawMessage, b []json.RawMessage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		var left, right interface{}
+		if json.Unmarshal(a[i], &left) != nil || json.Unmarshal(b[i], &right) != nil {
+			if !bytes.Equal(a[i], b[i]) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(left, right) {
+			return false
+		}
+	}
+	return true
+}
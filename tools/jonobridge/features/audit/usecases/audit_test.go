@@ -0,0 +1,139 @@
+package usecases
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	decoders "jonobridge/features/decoders/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIMEI  = "864696060004173"
+	testFrame = "+RESP:GTFRI,8020040200,864696060004173,,0,0,1,1,0.0,0,2240.0,-99.028335,19.611106,20250305225954,0334,0020,20A2,02B3DE86,00,,,,,100,220100,,,,20250305225954,13FA$"
+)
+
+func TestFrameArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := utils.NewFrameArchive(dir, "queclink", utils.WithArchiveFlushInterval(10*time.Millisecond))
+	archive.Start()
+
+	payload := hex.EncodeToString([]byte(testFrame))
+	messages, err := decoders.DecodeQueclink(payload)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	record := archive.Begin(payload, "10.0.0.1:5000")
+	record.Jono(messages[0])
+	record.End()
+	record.End()
+
+	// A frame failing before its IMEI is known takes the last IMEI of its remote address
+	record = archive.Begin("zz", "10.0.0.1:5000")
+	record.Fail(errors.New("invalid hex"))
+	record.End()
+
+	record = archive.Begin("", "10.0.0.2:5000")
+	record.SetIMEI("860201061234567")
+	record.End()
+
+	// Frames are readable while the file is written
+	assert.Eventually(t, func() bool {
+		frames, err := utils.ReadArchive(dir, utils.ArchiveQuery{IMEI: testIMEI})
+		return err == nil && len(frames) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	archive.Close()
+	archived, dropped, failed := archive.Stats()
+	assert.Equal(t, []int64{3, 0, 0}, []int64{archived, dropped, failed})
+
+	frames, err := utils.ReadArchive(dir, utils.ArchiveQuery{IMEI: testIMEI})
+	assert.NoError(t, err)
+	assert.Len(t, frames, 2)
+	assert.Equal(t, "queclink", frames[0].Interpreter)
+	assert.Equal(t, payload, frames[0].Payload)
+	assert.Equal(t, "10.0.0.1:5000", frames[0].RemoteAddr)
+	assert.Len(t, frames[0].Jono, 1)
+	assert.NotContains(t, string(frames[0].Jono[0]), "\n")
+	assert.Equal(t, "invalid hex", frames[1].Error)
+
+	// The partitions and index of the closed file
+	files, _ := filepath.Glob(filepath.Join(dir, "????-??-??", "??", "queclink-*.jsonl.gz"))
+	assert.Len(t, files, 1)
+	index, err := os.ReadFile(strings.TrimSuffix(files[0], ".jsonl.gz") + ".idx")
+	assert.NoError(t, err)
+	assert.Contains(t, string(index), `"864696060004173":2`)
+
+	// Queries by time and interpreter
+	now := time.Now().UTC()
+	frames, err = utils.ReadArchive(dir, utils.ArchiveQuery{From: now.Add(-time.Hour), To: now.Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Len(t, frames, 3)
+	frames, err = utils.ReadArchive(dir, utils.ArchiveQuery{From: now.Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, frames)
+	frames, err = utils.ReadArchive(dir, utils.ArchiveQuery{Interpreter: "pino"})
+	assert.NoError(t, err)
+	assert.Empty(t, frames)
+	frames, err = utils.ReadArchive(dir, utils.ArchiveQuery{IMEI: "1"})
+	assert.NoError(t, err)
+	assert.Empty(t, frames)
+}
+
+func TestReadArchiveTruncated(t *testing.T) {
+	dir := t.TempDir()
+	hourDir := filepath.Join(dir, "2025-03-05", "22")
+	assert.NoError(t, os.MkdirAll(hourDir, 0755))
+
+	// A file cut by a crash, without index
+	file, err := os.Create(filepath.Join(hourDir, "queclink-1.jsonl.gz"))
+	assert.NoError(t, err)
+	writer := gzip.NewWriter(file)
+	line, _ := json.Marshal(utils.ArchivedFrame{Time: time.Date(2025, 3, 5, 22, 59, 54, 0, time.UTC), Interpreter: "queclink", IMEI: testIMEI})
+	writer.Write(append(line, '\n'))
+	writer.Write([]byte(`{"time":"2025-03-05T22:59:55Z","imei":`))
+	writer.Flush()
+	file.Close()
+
+	frames, err := utils.ReadArchive(dir, utils.ArchiveQuery{
+		IMEI: testIMEI,
+		From: time.Date(2025, 3, 5, 22, 30, 0, 0, time.UTC),
+		To:   time.Date(2025, 3, 5, 23, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, frames, 1)
+}
+
+func TestRedecode(t *testing.T) {
+	payload := hex.EncodeToString([]byte(testFrame))
+	messages, err := decoders.DecodeQueclink(payload)
+	assert.NoError(t, err)
+
+	// The archived output was pretty printed, the same values are not a change
+	frame := utils.ArchivedFrame{Interpreter: "queclink", Payload: payload, Jono: []json.RawMessage{json.RawMessage(messages[0])}}
+	audited := Redecode(frame)
+	assert.False(t, audited.Changed)
+	assert.Empty(t, audited.RedecodeError)
+	assert.Len(t, audited.Redecoded, 1)
+
+	frame.Jono = []json.RawMessage{json.RawMessage(strings.Replace(messages[0], `"Altitude": 2240`, `"Altitude": 2241`, 1))}
+	assert.True(t, Redecode(frame).Changed)
+
+	// Heartbeats give no message, plain ASCII payloads are taken too
+	messages, err = decoders.DecodeQueclink("+ACK:GTHBD,8020040200,864696060004173,,20250305225954,13FA$")
+	assert.NoError(t, err)
+	assert.Empty(t, messages)
+
+	audited = Redecode(utils.ArchivedFrame{Interpreter: "teltonika", Payload: payload})
+	assert.Contains(t, audited.RedecodeError, `no decoder for interpreter "teltonika"`)
+	assert.True(t, audited.Changed)
+}
@@ -0,0 +1,343 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	huabao "huabaoprotocol/features/huabao_protocol"
+	huabaojono "huabaoprotocol/features/jono"
+	meitrackjono "meitrackprotocol/features/jono"
+	meitrack "meitrackprotocol/features/meitrack_protocol"
+	pinojono "pinoprotocol/features/jono"
+	pinomodels "pinoprotocol/features/pino_protocol/models"
+	pino "pinoprotocol/features/pino_protocol/usecases"
+	queclinkjono "queclinkprotocol/features/jono"
+	queclink "queclinkprotocol/features/queclink_protocol"
+	queclinkhelpers "queclinkprotocol/features/queclink_protocol/helpers"
+	queclinkmodels "queclinkprotocol/features/queclink_protocol/models"
+	ruptelajono "ruptelaprotocol/features/jono"
+	ruptela "ruptelaprotocol/features/ruptela_protocol"
+	skywavejono "skywaveprotocol/features/jono"
+	skywave "skywaveprotocol/features/skywave_protocol"
+	skywaveusecases "skywaveprotocol/features/skywave_protocol/usecases"
+	suntechjono "suntechprotocol/features/jono"
+	suntech "suntechprotocol/features/suntech_protocol"
+	xpot "xpot/features/xpot_protocol/usecases"
+)
+
+// Decoder runs an inbound payload, as in TrackerData, through the decode and normalize path of
+// an interpreter and returns the Jono messages it publishes. Frames the interpreter only answers,
+// like heartbeats, give no message. The IMEI is the one the interpreter knew the connection by,
+// for protocols like GT06 whose frames only carry it at login, empty when it is unknown.
+type Decoder func(payload string, imei string) ([]string, error)
+
+// Decoders are the interpreters by the name they archive their frames with
+var Decoders = map[string]Decoder{
+	"huabao":   stateless(DecodeHuabao),
+	"meitrack": stateless(DecodeMeitrack),
+	"pino":     DecodePino,
+	"queclink": stateless(DecodeQueclink),
+	"ruptela":  stateless(DecodeRuptela),
+	"skywave":  stateless(DecodeSkywave),
+	"suntech":  stateless(DecodeSuntech),
+	"xpot":     stateless(DecodeXpot),
+}
+
+// stateless is a Decoder for the protocols whose frames carry the IMEI
+func stateless(decode func(payload string) ([]string, error)) Decoder {
+	return func(payload string, imei string) ([]string, error) {
+		return decode(payload)
+	}
+}
+
+// Names returns the interpreters with a decoder, sorted
+func Names() []string {
+	names := make([]string, 0, len(Decoders))
+	for name := range Decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decode runs a payload through the decoder of an interpreter
+func Decode(interpreter string, payload string, imei string) ([]string, error) {
+	decoder, ok := Decoders[interpreter]
+	if !ok {
+		return nil, fmt.Errorf("no decoder for interpreter %q", interpreter)
+	}
+	return decoder(payload, imei)
+}
+
+// Compact returns a decoded message as one JSON line, as a JSON string when it is not JSON
+func Compact(message string) json.RawMessage {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, []byte(message)); err != nil {
+		quoted, _ := json.Marshal(message)
+		return quoted
+	}
+	return buffer.Bytes()
+}
+
+// DecodeQueclink decodes the frames of a Queclink payload, hex or ASCII, as queclinkprotocol does
+func DecodeQueclink(payload string) ([]string, error) {
+	data := payload
+	if decoded, err := hex.DecodeString(payload); err == nil {
+		data = string(decoded)
+	}
+	var messages []string
+	var errs []error
+	for _, frame := range queclinkhelpers.SplitFrames(data) {
+		if queclinkmodels.IsHeartbeat(frame) {
+			continue
+		}
+		parsed, err := queclink.Initialize(frame)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		message, err := queclinkjono.Initialize(parsed)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, errors.Join(errs...)
+}
+
+// DecodeMeitrack decodes a Meitrack payload, hex or ASCII, as meitrackprotocol does
+func DecodeMeitrack(payload string) ([]string, error) {
+	data := payload
+	if decoded, err := hex.DecodeString(payload); err == nil {
+		data = string(decoded)
+	}
+	if !strings.HasPrefix(data, "$$") && !strings.HasPrefix(data, "@@") {
+		return nil, fmt.Errorf("invalid protocol format")
+	}
+	fields := strings.Split(data, ",")
+	if len(fields) <= 2 {
+		return nil, fmt.Errorf("not enough fields: %d", len(fields))
+	}
+	parsed, err := meitrack.Initialize(data)
+	if err != nil {
+		return nil, err
+	}
+	if imei := fields[1]; len(imei) < 10 || len(imei) > 20 {
+		return nil, fmt.Errorf("invalid IMEI format: %s", imei)
+	}
+	message, err := meitrackjono.Initialize(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return []string{message}, nil
+}
+
+// DecodeRuptela decodes a hex Ruptela payload as ruptelaprotocol does
+func DecodeRuptela(payload string) ([]string, error) {
+	parsed, err := ruptela.Initialize(payload)
+	if err != nil {
+		return nil, err
+	}
+	message, err := ruptelajono.Initialize(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return []string{message}, nil
+}
+
+// DecodeSuntech decodes a Suntech payload, hex or ASCII, as suntechprotocol does
+func DecodeSuntech(payload string) ([]string, error) {
+	data := payload
+	if decoded, err := hex.DecodeString(payload); err == nil {
+		data = string(decoded)
+	}
+	parsed, err := suntech.Initialize(data)
+	if err != nil {
+		return nil, err
+	}
+	message, err := suntechjono.Initialize(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return []string{message}, nil
+}
+
+// DecodeHuabao decodes a Huabao payload as huabaoprotocol does, payloads starting with $$ are
+// never taken as hex
+func DecodeHuabao(payload string) ([]string, error) {
+	data := payload
+	if !strings.HasPrefix(payload, "$$") {
+		if decoded, err := hex.DecodeString(payload); err == nil {
+			data = string(decoded)
+		}
+	}
+	parsed, err := huabao.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	message, err := huabaojono.Initialize(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return []string{message}, nil
+}
+
+// skywaveDefinitions loads the Skywave message definitions once, for every payload replayed
+var skywaveDefinitions = sync.OnceValues(func() (*skywaveusecases.MessageDefinitions, error) {
+	return skywaveusecases.LoadMessageDefinitions(strings.Split(os.Getenv("SKYWAVE_MDF"), ","))
+})
+
+// DecodeSkywave decodes a Skywave payload, hex or ASCII XML, as skywaveprotocol does with the
+// messages of tracker/from-tcp and tracker/from-udp and the return messages it archives from the
+// gateway: each ReturnMessage with the built-in message definitions and those of SKYWAVE_MDF
+func DecodeSkywave(payload string) ([]string, error) {
+	data := payload
+	if decoded, err := hex.DecodeString(payload); err == nil {
+		data = string(decoded)
+	}
+	definitions, err := skywaveDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := skywave.Initialize(data, definitions)
+	var messages []string
+	errs := []error{err}
+	for _, dataskywave := range parsed {
+		message, err := skywavejono.Initialize(dataskywave)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, errors.Join(errs...)
+}
+
+// DecodeXpot decodes the newest message of each messenger in a SPOT feed as xpot does, with the
+// IMEI prefix of XPOT_IMEI_PREFIX. The messages xpot skipped as already sent are decoded too.
+func DecodeXpot(payload string) ([]string, error) {
+	response, err := xpot.ParseFeed(payload)
+	if err != nil {
+		return nil, err
+	}
+	prefix := os.Getenv("XPOT_IMEI_PREFIX")
+	if prefix == "" {
+		prefix = xpot.DefaultIMEIPrefix
+	}
+	var messages []string
+	var errs []error
+	processed := make(map[string]bool)
+	for _, message := range response.FeedMessageResponse.Messages {
+		if processed[message.MessengerID] {
+			continue
+		}
+		processed[message.MessengerID] = true
+
+		parsed, err := xpot.MessageToJono(message, prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		jono, err := parsed.ToJSON()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		messages = append(messages, jono)
+	}
+	return messages, errors.Join(errs...)
+}
+
+// DecodePino decodes a hex BSJ or GT06 payload as pinoprotocol does. GT06 frames after the login
+// need the IMEI of the connection. The battery and signal cached from the heartbeats are not
+// added to the locations.
+func DecodePino(payload string, imei string) ([]string, error) {
+	data, err := hex.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 {
+		return nil, fmt.Errorf("packet too short, length: %d", len(data))
+	}
+	if data[0] != 0x7E && data[0] != 0x78 {
+		return nil, fmt.Errorf("invalid frame header, first byte: 0x%02X", data[0])
+	}
+
+	var decoded string
+	if data[0] == 0x7E {
+		if len(data) < 12 {
+			return nil, fmt.Errorf("BSJ packet too short, length: %d", len(data))
+		}
+		frame := data[1 : len(data)-1]
+		if !bytes.Equal(frame[:2], []byte{0x02, 0x00}) { // Only the location packets are published
+			return nil, nil
+		}
+		location := frame[12:]
+		imei = pino.DecodeTerminalMobileNumber(frame[4:10])
+		if extendedIMEI, ok := pino.ParseExtendedDataForIMEI(location)["IMEI"].(string); ok && extendedIMEI != "" {
+			imei = extendedIMEI
+		}
+		decoded = pino.ParseLocationData(location, imei, frame)
+	} else {
+		if !pino.IsStandardLocationPacket(data) && !pino.IsStandardAlarmPacket(data) && !pino.IsStringInformationPacket(data) {
+			return nil, nil
+		}
+		if imei == "" {
+			return nil, fmt.Errorf("IMEI unknown, GT06 devices send it at login")
+		}
+		if decoded, err = decodeGT06(data, imei); err != nil {
+			return nil, err
+		}
+	}
+
+	message, err := pinojono.Initialize(decoded)
+	if err != nil {
+		return nil, err
+	}
+	// pinoprotocol adds the IMEI when Jono leaves it out
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &fields); err == nil {
+		if _, ok := fields["IMEI"]; !ok {
+			fields["IMEI"] = imei
+			if encoded, err := json.Marshal(fields); err == nil {
+				message = string(encoded)
+			}
+		}
+	}
+	return []string{message}, nil
+}
+
+// decodeGT06 returns the JSON pinoprotocol normalizes for a GT06 location, alarm or string
+// information packet
+func decodeGT06(data []byte, imei string) (string, error) {
+	var location *pinomodels.LocationPacketModel
+	var err error
+	switch {
+	case pino.IsStandardAlarmPacket(data):
+		alarm, err := pino.DecodeAlarmFrame(data, imei)
+		if err != nil {
+			return "", err
+		}
+		return pino.AlarmToJSON(alarm, data)
+	case pino.IsStandardLocationPacket(data):
+		location, err = pino.DecodeStandardLocationData(data, imei, false)
+	default:
+		location, err = pino.DecodeStringInformationPacket(data, imei)
+	}
+	if err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal(location)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,125 @@
+package usecases
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Capture is a payload to replay, hex encoded as the listeners publish it in TrackerData
+type Capture struct {
+	Source     string `json:"source"` // file:line the payload was read from
+	Payload    string `json:"payload"`
+	RemoteAddr string `json:"remoteaddr,omitempty"`
+}
+
+// dumpOffset starts a line of `hexdump -C`, `xxd` or hex.Dump
+var dumpOffset = regexp.MustCompile(`^([0-9a-fA-F]{8}):?(?:\s|$)`)
+var hexGroup = regexp.MustCompile(`^(?:[0-9a-fA-F]{2}|[0-9a-fA-F]{4})$`)
+
+// dumpBytes returns the offset and the hex bytes of a hex dump line. The bytes end at the first
+// gap of two spaces or more before the text column, but for the gap after the 8th byte of
+// `hexdump -C`.
+func dumpBytes(line string) (offset string, data string, ok bool) {
+	match := dumpOffset.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", false
+	}
+	rest := line[len(match[0]):]
+	for rest != "" {
+		field := strings.TrimLeft(rest, " ")
+		gap := len(rest) - len(field)
+		if gap > 1 && data != "" && !(gap == 2 && len(data) == 16) {
+			break
+		}
+		field, rest, _ = strings.Cut(field, " ")
+		rest = " " + rest
+		if !hexGroup.MatchString(field) || len(data)+len(field) > 32 {
+			break
+		}
+		data += field
+	}
+	return match[1], strings.ToLower(data), true
+}
+
+// ReadCaptures reads the payloads of a file. Files ending in .bin, like the interpreters' data.bin
+// fixtures, are one raw frame; any other file is read line by line with ParseCaptures.
+func ReadCaptures(path string) ([]Capture, error) {
+	if strings.EqualFold(filepath.Ext(path), ".bin") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []Capture{{Source: path, Payload: hex.EncodeToString(data)}}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseCaptures(path, file)
+}
+
+// ParseCaptures reads payloads line by line:
+//   - JSON lines are TrackerData, as published on tracker/from-tcp or archived by FrameArchive
+//   - hex dump lines are one frame, until the next dump starting at offset 0
+//   - any other line is a frame, in hex or as text
+//
+// Empty lines and lines starting with # are skipped.
+func ParseCaptures(name string, reader io.Reader) ([]Capture, error) {
+	var captures []Capture
+	var dump *Capture
+	flushDump := func() {
+		if dump != nil && dump.Payload != "" {
+			captures = append(captures, *dump)
+		}
+		dump = nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		source := fmt.Sprintf("%s:%d", name, line)
+
+		if offset, data, ok := dumpBytes(text); ok {
+			if dump == nil || strings.Trim(offset, "0") == "" {
+				flushDump()
+				dump = &Capture{Source: source}
+			}
+			dump.Payload += data
+			continue
+		}
+		flushDump()
+
+		switch {
+		case text == "" || strings.HasPrefix(text, "#"):
+		case strings.HasPrefix(text, "{"):
+			var capture Capture
+			if err := json.Unmarshal([]byte(text), &capture); err != nil {
+				return nil, fmt.Errorf("%s: %w", source, err)
+			}
+			if capture.Payload == "" {
+				return nil, fmt.Errorf("%s: no payload", source)
+			}
+			capture.Source = source
+			captures = append(captures, capture)
+		default:
+			payload := strings.Join(strings.Fields(text), "")
+			if _, err := hex.DecodeString(payload); err != nil {
+				payload = hex.EncodeToString([]byte(text))
+			}
+			captures = append(captures, Capture{Source: source, Payload: strings.ToLower(payload)})
+		}
+	}
+	flushDump()
+	return captures, scanner.Err()
+}
@@ -0,0 +1,343 @@
+package usecases
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	decoders "jonobridge/features/decoders/usecases"
+)
+
+// Result is the Jono output of a capture. A replay writes one per line, and reads them back as
+// the golden set of the next one.
+type Result struct {
+	Capture
+	Jono  []json.RawMessage `json:"jono"`
+	Error string            `json:"error,omitempty"`
+}
+
+// FieldDiff is a field of a Jono message with another value than in the golden set
+type FieldDiff struct {
+	Message int             `json:"message"` // Index of the message in the output of the capture
+	Path    string          `json:"path"`
+	Golden  json.RawMessage `json:"golden,omitempty"` // Missing when the golden message has no such field
+	Got     json.RawMessage `json:"got,omitempty"`    // Missing when the field is gone
+}
+
+// Regression is a capture whose output differs from the golden one
+type Regression struct {
+	Capture
+	MessageType string      `json:"message_type"`
+	Fields      []FieldDiff `json:"fields,omitempty"`
+	GoldenError string      `json:"golden_error,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// Report is the outcome of comparing a replay with the golden set
+type Report struct {
+	Captures    int
+	Unchanged   int
+	New         int // Captures without golden output
+	Regressions []Regression
+}
+
+// TypeSummary counts the regressions of a message type and the fields they changed
+type TypeSummary struct {
+	MessageType string
+	Regressions int
+	Fields      map[string]int // Packet keys are replaced by *, as in ListPackets.*.Speed
+}
+
+// Replay runs captures through the decoder of an interpreter
+func Replay(interpreter string, captures []Capture) ([]Result, error) {
+	if _, ok := decoders.Decoders[interpreter]; !ok {
+		return nil, fmt.Errorf("no decoder for interpreter %q, interpreters: %s", interpreter, strings.Join(decoders.Names(), ", "))
+	}
+	results := make([]Result, 0, len(captures))
+	for _, capture := range captures {
+		result := Result{Capture: capture, Jono: []json.RawMessage{}}
+		messages, err := decoders.Decode(interpreter, capture.Payload, "")
+		if err != nil {
+			result.Error = err.Error()
+		}
+		for _, message := range messages {
+			result.Jono = append(result.Jono, decoders.Compact(message))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ReadResults reads the JSONL written by a replay
+func ReadResults(path string) ([]Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var results []Result
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var result Result
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+// WriteResults writes results as JSONL
+func WriteResults(writer io.Writer, results []Result) error {
+	encoder := json.NewEncoder(writer)
+	for _, result := range results {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compare matches every result with the golden result of the same payload, in order when a
+// payload was captured more than once, and diffs their Jono messages field by field. Fields
+// matching an ignore pattern, like ListPackets.*.Datetime, are left out, with their children.
+func Compare(golden []Result, results []Result, ignore []string) Report {
+	byPayload := make(map[string][]Result)
+	for _, result := range golden {
+		byPayload[result.Payload] = append(byPayload[result.Payload], result)
+	}
+
+	report := Report{Captures: len(results)}
+	for _, result := range results {
+		expected, ok := byPayload[result.Payload]
+		if !ok || len(expected) == 0 {
+			report.New++
+			continue
+		}
+		byPayload[result.Payload] = expected[1:]
+
+		fields := DiffJono(expected[0].Jono, result.Jono, ignore)
+		if len(fields) == 0 && expected[0].Error == result.Error {
+			report.Unchanged++
+			continue
+		}
+		messages := expected[0].Jono
+		if len(messages) == 0 {
+			messages = result.Jono
+		}
+		messageType := "no message"
+		if len(messages) > 0 {
+			messageType = MessageType(messages[0])
+		}
+		report.Regressions = append(report.Regressions, Regression{
+			Capture:     result.Capture,
+			MessageType: messageType,
+			Fields:      fields,
+			GoldenError: expected[0].Error,
+			Error:       result.Error,
+		})
+	}
+	return report
+}
+
+// ByType summarizes the regressions by message type, the most regressed first
+func (r Report) ByType() []TypeSummary {
+	summaries := make(map[string]*TypeSummary)
+	for _, regression := range r.Regressions {
+		summary, ok := summaries[regression.MessageType]
+		if !ok {
+			summary = &TypeSummary{MessageType: regression.MessageType, Fields: make(map[string]int)}
+			summaries[regression.MessageType] = summary
+		}
+		summary.Regressions++
+		seen := make(map[string]bool)
+		for _, field := range regression.Fields {
+			name := packetPattern(field.Path)
+			if !seen[name] {
+				seen[name] = true
+				summary.Fields[name]++
+			}
+		}
+		if regression.GoldenError != regression.Error {
+			summary.Fields["error"]++
+		}
+	}
+
+	list := make([]TypeSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		list = append(list, *summary)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Regressions != list[j].Regressions {
+			return list[i].Regressions > list[j].Regressions
+		}
+		return list[i].MessageType < list[j].MessageType
+	})
+	return list
+}
+
+// DiffJono diffs two lists of Jono messages field by field
+func DiffJono(golden []json.RawMessage, got []json.RawMessage, ignore []string) []FieldDiff {
+	var diffs []FieldDiff
+	for i := 0; i < len(golden) || i < len(got); i++ {
+		left, right := map[string]string{}, map[string]string{}
+		if i < len(golden) {
+			flatten("", decodeJSON(golden[i]), left)
+		}
+		if i < len(got) {
+			flatten("", decodeJSON(got[i]), right)
+		}
+
+		paths := make(map[string]bool)
+		for field := range left {
+			paths[field] = true
+		}
+		for field := range right {
+			paths[field] = true
+		}
+		sorted := make([]string, 0, len(paths))
+		for field := range paths {
+			if left[field] != right[field] && !ignored(field, ignore) {
+				sorted = append(sorted, field)
+			}
+		}
+		sort.Strings(sorted)
+
+		for _, field := range sorted {
+			diff := FieldDiff{Message: i, Path: field}
+			if value, ok := left[field]; ok {
+				diff.Golden = json.RawMessage(value)
+			}
+			if value, ok := right[field]; ok {
+				diff.Got = json.RawMessage(value)
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// MessageType names the kind of a Jono message by the event of its first packet, or by the
+// header of the device message when it has no event
+func MessageType(message json.RawMessage) string {
+	var jono struct {
+		Message     *string                    `json:"Message"`
+		ListPackets map[string]json.RawMessage `json:"ListPackets"`
+	}
+	if json.Unmarshal(message, &jono) != nil {
+		return "invalid"
+	}
+
+	keys := make([]string, 0, len(jono.ListPackets))
+	for key := range jono.ListPackets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		var packet struct {
+			EventCode interface{} `json:"EventCode"`
+		}
+		json.Unmarshal(jono.ListPackets[keys[0]], &packet)
+		switch event := packet.EventCode.(type) {
+		case map[string]interface{}:
+			if name, _ := event["Name"].(string); name != "" {
+				return name
+			}
+			if code, ok := event["Code"]; ok && code != nil {
+				return fmt.Sprintf("event %v", code)
+			}
+		case string:
+			if event != "" {
+				return "event " + event
+			}
+		case float64:
+			return "event " + strconv.FormatFloat(event, 'f', -1, 64)
+		}
+	}
+
+	if jono.Message != nil && *jono.Message != "" {
+		header, _, _ := strings.Cut(*jono.Message, ",")
+		return header
+	}
+	return "unknown"
+}
+
+// decodeJSON decodes a message keeping its numbers as written, a message that is not JSON is
+// compared as a string
+func decodeJSON(message json.RawMessage) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return string(message)
+	}
+	return value
+}
+
+// flatten stores the leaves of a JSON value by their path, as ListPackets.packet_1.Speed or
+// Extras[0]; empty objects and arrays are leaves
+func flatten(prefix string, value interface{}, fields map[string]string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if len(value) > 0 {
+			for key, child := range value {
+				if prefix == "" {
+					flatten(key, child, fields)
+				} else {
+					flatten(prefix+"."+key, child, fields)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if len(value) > 0 {
+			for i, child := range value {
+				flatten(fmt.Sprintf("%s[%d]", prefix, i), child, fields)
+			}
+			return
+		}
+	}
+	encoded, _ := json.Marshal(value)
+	fields[prefix] = string(encoded)
+}
+
+// ignored reports whether a field, or one of its parents, matches an ignore pattern. Patterns
+// are dotted paths where * is any one key.
+func ignored(field string, ignore []string) bool {
+	segments := strings.Split(field, ".")
+	for _, pattern := range ignore {
+		depth := strings.Count(pattern, ".") + 1
+		if depth > len(segments) {
+			continue
+		}
+		parent := strings.Join(segments[:depth], "/")
+		if matched, _ := path.Match(strings.ReplaceAll(pattern, ".", "/"), parent); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// packetPattern replaces the packet key of a path, ListPackets.packet_1.Speed gives
+// ListPackets.*.Speed
+func packetPattern(field string) string {
+	segments := strings.Split(field, ".")
+	if len(segments) > 1 && segments[0] == "ListPackets" {
+		segments[1] = "*"
+	}
+	return strings.Join(segments, ".")
+}
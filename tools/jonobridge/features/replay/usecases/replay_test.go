@@ -0,0 +1,189 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testFrame = "$$f167,864507035846483,AAA,1,18.950273,-97.922888,241205120405,V,0,13,0,69,0.0,2217,358868041,192062311,334|3|7663|00AA7FAB,0000,0001|0000|0000|01A5|0514,,,3,,,108,106*C6"
+
+func TestParseCaptures(t *testing.T) {
+	payload := hex.EncodeToString([]byte(testFrame))
+	input := strings.Join([]string{
+		"# captured on tracker/from-tcp",
+		`{"payload":"` + payload + `","remoteaddr":"10.0.0.1:5000"}`,
+		"",
+		strings.ToUpper(payload),
+		testFrame,
+		"78 78 0d 01",
+		strings.TrimRight(hex.Dump([]byte(testFrame)), "\n"),
+		"00000000: 2424 5b31 3339 2c38 3636 3831 3130 3632  $$[139,866811062",
+		"00000010: 3534 3636                                5466",
+	}, "\n")
+	hexdump := strings.Join([]string{
+		"00000000  7e 02 00 00 71 09 90 74  47 75 95 00 0c 00 00 00  |~...q..tGu......|",
+		"00000010  00 0b                                             |..|",
+		"00000012",
+	}, "\n")
+
+	captures, err := ParseCaptures("captures.txt", strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Len(t, captures, 6)
+	for _, capture := range captures[:3] {
+		assert.Equal(t, payload, capture.Payload, capture.Source)
+	}
+	assert.Equal(t, "captures.txt:2", captures[0].Source)
+	assert.Equal(t, "10.0.0.1:5000", captures[0].RemoteAddr)
+	assert.Equal(t, "78780d01", captures[3].Payload)
+	assert.Equal(t, payload, captures[4].Payload)
+	assert.Equal(t, "captures.txt:7", captures[4].Source)
+	assert.Equal(t, "24245b3133392c38363638313130363235343636", captures[5].Payload)
+
+	// A hexdump -C dump ends with the offset of its end
+	captures, err = ParseCaptures("dump.txt", strings.NewReader(hexdump))
+	assert.NoError(t, err)
+	assert.Len(t, captures, 1)
+	assert.Equal(t, "7e02000071099074477595000c000000000b", captures[0].Payload)
+
+	_, err = ParseCaptures("bad.jsonl", strings.NewReader(`{"remoteaddr":"10.0.0.1:5000"}`))
+	assert.EqualError(t, err, "bad.jsonl:1: no payload")
+
+	// .bin files are one raw frame
+	path := filepath.Join(t.TempDir(), "data.bin")
+	assert.NoError(t, os.WriteFile(path, []byte(testFrame), 0644))
+	captures, err = ReadCaptures(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Capture{{Source: path, Payload: payload}}, captures)
+}
+
+func TestReplayCompare(t *testing.T) {
+	payload := hex.EncodeToString([]byte(testFrame))
+	captures := []Capture{{Source: "a:1", Payload: payload}, {Source: "a:2", Payload: "zz"}, {Source: "a:3", Payload: payload}}
+
+	_, err := Replay("teltonika", captures)
+	assert.ErrorContains(t, err, `no decoder for interpreter "teltonika"`)
+
+	results, err := Replay("meitrack", captures)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.Len(t, results[0].Jono, 1)
+	assert.NotContains(t, string(results[0].Jono[0]), "\n")
+	assert.NotEmpty(t, results[1].Error)
+	assert.Equal(t, "Input 1 Active", MessageType(results[0].Jono[0]))
+
+	// The golden set goes through a file
+	var buffer bytes.Buffer
+	assert.NoError(t, WriteResults(&buffer, results))
+	path := filepath.Join(t.TempDir(), "golden.jsonl")
+	assert.NoError(t, os.WriteFile(path, buffer.Bytes(), 0644))
+	golden, err := ReadResults(path)
+	assert.NoError(t, err)
+	report := Compare(golden, results, nil)
+	assert.Equal(t, 3, report.Unchanged)
+	assert.Empty(t, report.Regressions)
+
+	// A changed speed, a removed field and a decode error that went away
+	var message map[string]interface{}
+	assert.NoError(t, json.Unmarshal(golden[2].Jono[0], &message))
+	packets := message["ListPackets"].(map[string]interface{})
+	for _, packet := range packets {
+		packet.(map[string]interface{})["Speed"] = 12
+		packet.(map[string]interface{})["Removed"] = true
+	}
+	golden[2].Jono[0], _ = json.Marshal(message)
+	golden[1].Error = ""
+	golden = append(golden, Result{Capture: Capture{Payload: "ab"}})
+
+	report = Compare(golden, append(results, Result{Capture: Capture{Payload: "cd"}}), nil)
+	assert.Equal(t, 4, report.Captures)
+	assert.Equal(t, 1, report.Unchanged)
+	assert.Equal(t, 1, report.New)
+	assert.Len(t, report.Regressions, 2)
+
+	assert.Equal(t, "no message", report.Regressions[0].MessageType)
+	assert.Empty(t, report.Regressions[0].GoldenError)
+	assert.NotEmpty(t, report.Regressions[0].Error)
+
+	regression := report.Regressions[1]
+	assert.Equal(t, "a:3", regression.Source)
+	assert.Equal(t, "Input 1 Active", regression.MessageType)
+	assert.Len(t, regression.Fields, 2)
+	assert.Contains(t, regression.Fields[0].Path, ".Removed")
+	assert.Equal(t, "true", string(regression.Fields[0].Golden))
+	assert.Nil(t, regression.Fields[0].Got)
+	assert.Contains(t, regression.Fields[1].Path, ".Speed")
+	assert.Equal(t, "12", string(regression.Fields[1].Golden))
+	assert.Equal(t, "0", string(regression.Fields[1].Got))
+
+	summaries := report.ByType()
+	assert.Len(t, summaries, 2)
+	assert.Equal(t, "Input 1 Active", summaries[0].MessageType)
+	assert.Equal(t, map[string]int{"ListPackets.*.Removed": 1, "ListPackets.*.Speed": 1}, summaries[0].Fields)
+	assert.Equal(t, map[string]int{"error": 1}, summaries[1].Fields)
+
+	// Ignored fields and their children are left out
+	report = Compare(golden[:3], results, []string{"ListPackets.*.Speed", "ListPackets.*.Removed"})
+	assert.Len(t, report.Regressions, 1)
+	report = Compare(golden[:3], results, []string{"ListPackets"})
+	assert.Len(t, report.Regressions, 1)
+}
+
+func TestMessageType(t *testing.T) {
+	assert.Equal(t, "event 53515", MessageType(json.RawMessage(`{"ListPackets":{"packet_1":{"EventCode":"53515"}}}`)))
+	assert.Equal(t, "event 35", MessageType(json.RawMessage(`{"ListPackets":{"packet_1":{"EventCode":{"Code":35,"Name":""}}}}`)))
+	assert.Equal(t, "+RESP:GTFRI", MessageType(json.RawMessage(`{"Message":"+RESP:GTFRI,8020040200","ListPackets":{}}`)))
+	assert.Equal(t, "unknown", MessageType(json.RawMessage(`{}`)))
+	assert.Equal(t, "invalid", MessageType(json.RawMessage(`"not json"`)))
+}
+
+func TestReplaySkywave(t *testing.T) {
+	// A get_return_messages response of the IsatData Pro gateway, its last message has no MobileID
+	captures, err := ReadCaptures(filepath.Join("testdata", "skywave.bin"))
+	assert.NoError(t, err)
+	results, err := Replay("skywave", captures)
+	assert.NoError(t, err)
+	if !assert.Len(t, results, 1) {
+		return
+	}
+	assert.Contains(t, results[0].Error, "return message 48613919 without MobileID")
+	if !assert.Len(t, results[0].Jono, 2) {
+		return
+	}
+	var message struct {
+		IMEI        string
+		RawPayload  string
+		ListPackets map[string]struct {
+			Latitude  float64
+			Longitude float64
+			GpsFixAge int
+		}
+	}
+	assert.NoError(t, json.Unmarshal(results[0].Jono[0], &message))
+	assert.Equal(t, "01097423SKY3A09", message.IMEI)
+	assert.InDelta(t, 19.521, message.ListPackets["packet_1"].Latitude, 0.001)
+	assert.InDelta(t, -99.2116, message.ListPackets["packet_1"].Longitude, 0.001)
+	assert.Equal(t, 12, message.ListPackets["packet_1"].GpsFixAge)
+	assert.Equal(t, "Track By Time Interval", MessageType(results[0].Jono[0]))
+
+	// SIN 128 has no definition, its payload is passed along
+	message.RawPayload = ""
+	assert.NoError(t, json.Unmarshal(results[0].Jono[1], &message))
+	assert.Equal(t, "gAEC", message.RawPayload)
+
+	// The return messages polled from the gateway are archived one by one, as XML
+	data, err := os.ReadFile(filepath.Join("testdata", "skywave.bin"))
+	assert.NoError(t, err)
+	start := bytes.Index(data, []byte("<ReturnMessage>"))
+	end := bytes.Index(data, []byte("</ReturnMessage>")) + len("</ReturnMessage>")
+	results, err = Replay("skywave", []Capture{{Source: "archive:1", Payload: string(data[start:end])}})
+	assert.NoError(t, err)
+	assert.Empty(t, results[0].Error)
+	assert.Len(t, results[0].Jono, 1)
+}
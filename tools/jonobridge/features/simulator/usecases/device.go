@@ -0,0 +1,114 @@
+package usecases
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Fix is a position of a virtual device
+type Fix struct {
+	Point
+	Time       time.Time
+	Speed      float64 // km/h
+	Heading    float64 // degrees, 0 is north
+	Altitude   float64 // meters
+	Satellites int
+	Mileage    float64       // meters driven since the device started
+	RunTime    time.Duration // since the device started
+}
+
+// Device is a virtual tracker driving around a route
+type Device struct {
+	IMEI       string
+	RemoteAddr string // The address the listener would see, replies on tracker/send are routed by it
+	Protocol   Protocol
+	Route      Route
+	Speed      float64 // Average speed in km/h
+
+	rand     *rand.Rand
+	distance float64
+	mileage  float64
+	started  time.Time
+	last     time.Time
+	sequence int
+	fix      Fix
+}
+
+// NewDevice places a device on a route, at a distance from its start so the devices of a fleet
+// do not drive on top of each other
+func NewDevice(protocol Protocol, imei string, remoteAddr string, route Route, speed float64, seed int64) *Device {
+	device := &Device{
+		IMEI:       imei,
+		RemoteAddr: remoteAddr,
+		Protocol:   protocol,
+		Route:      route,
+		Speed:      speed,
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+	device.distance = device.rand.Float64() * route.Length()
+	return device
+}
+
+// Advance moves the device along its route for the time since its last fix
+func (d *Device) Advance(now time.Time) Fix {
+	if d.started.IsZero() {
+		d.started, d.last = now, now
+	}
+	speed := 0.0
+	if d.Speed > 0 {
+		// Traffic: stops now and then, otherwise around the average speed
+		if d.rand.Float64() >= 0.1 {
+			speed = math.Max(0, d.Speed*(0.8+0.4*d.rand.Float64()))
+		}
+	}
+	meters := speed / 3.6 * now.Sub(d.last).Seconds()
+	d.distance += meters
+	d.mileage += meters
+	d.last = now
+
+	point, heading := d.Route.At(d.distance)
+	d.fix = Fix{
+		Point:      point,
+		Time:       now.UTC().Truncate(time.Second),
+		Speed:      math.Round(speed*10) / 10,
+		Heading:    math.Round(heading),
+		Altitude:   math.Round(2240 + 20*math.Sin(d.distance/500)),
+		Satellites: 7 + d.rand.Intn(6),
+		Mileage:    d.mileage,
+		RunTime:    now.Sub(d.started),
+	}
+	return d.fix
+}
+
+// LastFix returns the last position of the device, it takes the first one when there is none
+func (d *Device) LastFix() Fix {
+	if d.fix.Time.IsZero() {
+		return d.Advance(time.Now())
+	}
+	return d.fix
+}
+
+// Sequence returns the next message serial of the device, from 1 to 0xFFFF
+func (d *Device) Sequence() int {
+	d.sequence = d.sequence%0xFFFF + 1
+	return d.sequence
+}
+
+// IMEI returns the IMEI of the nth device of a type allocation code, with its Luhn check digit
+func IMEI(tac string, n int) string {
+	body := fmt.Sprintf("%s%06d", tac, n%1000000)
+	sum := 0
+	for i := len(body) - 1; i >= 0; i-- {
+		digit := int(body[i] - '0')
+		if (len(body)-1-i)%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return fmt.Sprintf("%s%d", body, (10-sum%10)%10)
+}
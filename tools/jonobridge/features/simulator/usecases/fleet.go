@@ -0,0 +1,310 @@
+package usecases
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TrackerData is the message the listeners publish on tracker/from-tcp and the interpreters reply
+// with on tracker/send
+type TrackerData struct {
+	Payload    string `json:"payload"`
+	RemoteAddr string `json:"remoteaddr"`
+}
+
+// Config is the behaviour of the devices of a fleet. Rates are the chance of a report, at every
+// interval, to be of that kind.
+type Config struct {
+	Interval          time.Duration // Between position reports
+	HeartbeatInterval time.Duration // 0 sends no heartbeats
+	AckTimeout        time.Duration // How long a device waits for a reply
+	AlarmRate         float64
+	BatchRate         float64 // The device goes offline and sends BatchSize positions at once
+	MalformedRate     float64 // Truncated, corrupted or garbage frames
+	BatchSize         int
+	Speed             float64 // Average speed in km/h
+	Seed              int64
+}
+
+// DefaultConfig is a device reporting every 30 seconds in city traffic
+var DefaultConfig = Config{
+	Interval:          30 * time.Second,
+	HeartbeatInterval: 3 * time.Minute,
+	AckTimeout:        10 * time.Second,
+	AlarmRate:         0.01,
+	BatchRate:         0.01,
+	MalformedRate:     0.005,
+	BatchSize:         10,
+	Speed:             35,
+	Seed:              1,
+}
+
+// Stats counts what a fleet sent and the replies it got
+type Stats struct {
+	Sent        map[string]int // By kind of frame
+	Acked       int            // Replies a device waited for
+	Timeouts    int            // Replies that did not come within AckTimeout
+	Unsolicited int            // Replies no device waited for
+	Errors      int            // Failed publishes
+}
+
+// Fleet is a set of virtual devices publishing their frames as a listener would. Replies to the
+// devices go to Deliver.
+type Fleet struct {
+	Config  Config
+	Topic   string
+	Publish func(topic string, payload []byte) error
+
+	devices []*fleetDevice
+	byAddr  map[string]*fleetDevice
+
+	mutex sync.Mutex
+	stats Stats
+}
+
+// fleetDevice is a device and the replies on their way to it
+type fleetDevice struct {
+	*Device
+	replies chan []byte
+}
+
+// pendingAck is a frame waiting for its reply
+type pendingAck struct {
+	ack      func(reply []byte) bool
+	deadline time.Time
+}
+
+// NewFleet returns an empty fleet publishing on tracker/from-tcp
+func NewFleet(config Config, publish func(topic string, payload []byte) error) *Fleet {
+	return &Fleet{
+		Config:  config,
+		Topic:   "tracker/from-tcp",
+		Publish: publish,
+		byAddr:  make(map[string]*fleetDevice),
+		stats:   Stats{Sent: make(map[string]int)},
+	}
+}
+
+// Add adds count devices of a protocol driving around a route, before Run
+func (f *Fleet) Add(protocol Protocol, count int, route Route) []*Device {
+	added := make([]*Device, 0, count)
+	for i := 0; i < count; i++ {
+		n := len(f.devices)
+		remoteAddr := fmt.Sprintf("10.99.%d.%d:%d", n/250, n%250+1, 40000+n%20000)
+		device := NewDevice(protocol, IMEI(protocol.TAC(), i+1), remoteAddr, route, f.Config.Speed, f.Config.Seed+int64(n))
+		fleetDevice := &fleetDevice{Device: device, replies: make(chan []byte, 16)}
+		f.devices = append(f.devices, fleetDevice)
+		f.byAddr[remoteAddr] = fleetDevice
+		added = append(added, device)
+	}
+	return added
+}
+
+// Devices returns the number of devices of the fleet
+func (f *Fleet) Devices() int {
+	return len(f.devices)
+}
+
+// Run drives the devices until ctx is done
+func (f *Fleet) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, device := range f.devices {
+		wg.Add(1)
+		go func(device *fleetDevice) {
+			defer wg.Done()
+			f.drive(ctx, device)
+		}(device)
+	}
+	wg.Wait()
+}
+
+// Deliver routes a reply published on tracker/send to its device by remote address
+func (f *Fleet) Deliver(message []byte) {
+	var data TrackerData
+	if err := json.Unmarshal(message, &data); err != nil {
+		f.count(func(stats *Stats) { stats.Unsolicited++ })
+		return
+	}
+	device, ok := f.byAddr[data.RemoteAddr]
+	if !ok {
+		f.count(func(stats *Stats) { stats.Unsolicited++ })
+		return
+	}
+	reply, err := hex.DecodeString(data.Payload)
+	if err != nil {
+		reply = []byte(data.Payload)
+	}
+	select {
+	case device.replies <- reply:
+	default:
+		f.count(func(stats *Stats) { stats.Unsolicited++ })
+	}
+}
+
+// Stats returns a copy of the counters
+func (f *Fleet) Stats() Stats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	stats := f.stats
+	stats.Sent = make(map[string]int, len(f.stats.Sent))
+	for kind, count := range f.stats.Sent {
+		stats.Sent[kind] = count
+	}
+	return stats
+}
+
+func (f *Fleet) count(update func(stats *Stats)) {
+	f.mutex.Lock()
+	update(&f.stats)
+	f.mutex.Unlock()
+}
+
+// drive is the life of a device: it logs in, when its protocol has a login, then reports at
+// every interval and sends heartbeats, keeping track of the replies it waits for
+func (f *Fleet) drive(ctx context.Context, device *fleetDevice) {
+	random := rand.New(rand.NewSource(device.rand.Int63()))
+	protocol := device.Protocol
+	if !f.login(ctx, device) {
+		return
+	}
+
+	interval := time.NewTicker(f.Config.Interval)
+	defer interval.Stop()
+	var heartbeat <-chan time.Time
+	if f.Config.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(f.Config.HeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	var pending []pendingAck
+	var buffered []Fix
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reply := <-device.replies:
+			pending = f.acknowledge(pending, reply)
+		case <-heartbeat:
+			if frame := protocol.Heartbeat(device.Device); frame != nil {
+				pending = f.send(device, *frame, pending)
+			}
+		case now := <-interval.C:
+			pending = f.expire(pending, now)
+			fix := device.Advance(now)
+			if buffered != nil {
+				buffered = append(buffered, fix)
+				if len(buffered) >= f.Config.BatchSize {
+					pending = f.send(device, protocol.Batch(device.Device, buffered), pending)
+					buffered = nil
+				}
+				continue
+			}
+			switch chance := random.Float64(); {
+			case chance < f.Config.MalformedRate:
+				pending = f.send(device, Malformed(random, protocol.Position(device.Device, fix)), pending)
+			case chance < f.Config.MalformedRate+f.Config.AlarmRate:
+				pending = f.send(device, protocol.Alarm(device.Device, fix), pending)
+			case chance < f.Config.MalformedRate+f.Config.AlarmRate+f.Config.BatchRate && f.Config.BatchSize > 1:
+				buffered = []Fix{fix}
+			default:
+				pending = f.send(device, protocol.Position(device.Device, fix), pending)
+			}
+		}
+	}
+}
+
+// login sends the login of the device until it is acknowledged, it returns false when ctx is done
+// first
+func (f *Fleet) login(ctx context.Context, device *fleetDevice) bool {
+	for {
+		frame := device.Protocol.Login(device.Device)
+		if frame == nil {
+			return true
+		}
+		f.send(device, *frame, nil)
+		if frame.Ack == nil {
+			return true
+		}
+		timeout := time.NewTimer(f.Config.AckTimeout)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timeout.Stop()
+				return false
+			case reply := <-device.replies:
+				if frame.Ack(reply) {
+					timeout.Stop()
+					f.count(func(stats *Stats) { stats.Acked++ })
+					return true
+				}
+				f.count(func(stats *Stats) { stats.Unsolicited++ })
+			case <-timeout.C:
+				f.count(func(stats *Stats) { stats.Timeouts++ })
+				break wait
+			}
+		}
+	}
+}
+
+// send publishes a frame as the listener would and adds it to the pending replies when the
+// device waits for one
+func (f *Fleet) send(device *fleetDevice, frame Frame, pending []pendingAck) []pendingAck {
+	message, _ := json.Marshal(TrackerData{Payload: hex.EncodeToString(frame.Data), RemoteAddr: device.RemoteAddr})
+	if err := f.Publish(f.Topic, message); err != nil {
+		f.count(func(stats *Stats) { stats.Errors++ })
+		return pending
+	}
+	f.count(func(stats *Stats) { stats.Sent[frame.Kind]++ })
+	if frame.Ack != nil {
+		pending = append(pending, pendingAck{ack: frame.Ack, deadline: time.Now().Add(f.Config.AckTimeout)})
+	}
+	return pending
+}
+
+// acknowledge removes the oldest pending frame the reply is for
+func (f *Fleet) acknowledge(pending []pendingAck, reply []byte) []pendingAck {
+	for i, p := range pending {
+		if p.ack(reply) {
+			f.count(func(stats *Stats) { stats.Acked++ })
+			return append(pending[:i], pending[i+1:]...)
+		}
+	}
+	f.count(func(stats *Stats) { stats.Unsolicited++ })
+	return pending
+}
+
+// expire drops the pending frames past their deadline
+func (f *Fleet) expire(pending []pendingAck, now time.Time) []pendingAck {
+	kept := pending[:0]
+	for _, p := range pending {
+		if now.After(p.deadline) {
+			f.count(func(stats *Stats) { stats.Timeouts++ })
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// Malformed damages a frame the way a bad link or a faulty device would: cut short, with a
+// flipped byte or replaced by garbage. Nobody replies to it.
+func Malformed(random *rand.Rand, frame Frame) Frame {
+	data := append([]byte(nil), frame.Data...)
+	switch random.Intn(3) {
+	case 0:
+		data = data[:random.Intn(len(data))]
+	case 1:
+		data[random.Intn(len(data))] ^= byte(1 + random.Intn(255))
+	default:
+		data = make([]byte, 1+random.Intn(32))
+		random.Read(data)
+	}
+	return Frame{Kind: KindMalformed, Data: data}
+}
@@ -0,0 +1,98 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+)
+
+// GT06 protocol numbers
+const (
+	gt06Login     = 0x01
+	gt06Location  = 0x12
+	gt06Heartbeat = 0x13
+	gt06Alarm     = 0x16
+)
+
+// GT06 simulates Concox GT06 trackers, the protocol of the pino interpreter. Devices log in and
+// wait for the login reply before they report, and wait for the reply of every heartbeat.
+type GT06 struct{}
+
+func (GT06) Name() string { return "pino" }
+
+func (GT06) TAC() string { return "35867205" }
+
+func (GT06) Login(d *Device) *Frame {
+	imei, _ := hex.DecodeString("0" + d.IMEI)
+	serial := uint16(d.Sequence())
+	return &Frame{Kind: KindLogin, Data: gt06Packet(gt06Login, imei, serial), Ack: func(reply []byte) bool {
+		return len(reply) >= 6 && reply[0] == 0x78 && reply[1] == 0x78 && reply[3] == gt06Login &&
+			binary.BigEndian.Uint16(reply[4:6]) == serial
+	}}
+}
+
+func (GT06) Heartbeat(d *Device) *Frame {
+	// Terminal info (oil connected, GPS tracking, charging, ACC on), voltage, GSM signal, language
+	content := []byte{0x46, 0x04, 0x04, 0x00, 0x02}
+	return &Frame{Kind: KindHeartbeat, Data: gt06Packet(gt06Heartbeat, content, uint16(d.Sequence())), Ack: func(reply []byte) bool {
+		return len(reply) >= 4 && reply[0] == 0x78 && reply[1] == 0x78 && reply[3] == gt06Heartbeat
+	}}
+}
+
+func (GT06) Position(d *Device, fix Fix) Frame {
+	return Frame{Kind: KindPosition, Data: gt06Packet(gt06Location, gt06GPS(fix, false), uint16(d.Sequence()))}
+}
+
+// Alarm sends an SOS alarm packet
+func (GT06) Alarm(d *Device, fix Fix) Frame {
+	content := gt06GPS(fix, true)
+	content = append(content, 0x20|0x40|0x02|0x01, 0x04, 0x04, 0x01, 0x02) // SOS, voltage, GSM, alarm and language
+	return Frame{Kind: KindAlarm, Data: gt06Packet(gt06Alarm, content, uint16(d.Sequence()))}
+}
+
+// Batch sends the location packets back to back in one write
+func (GT06) Batch(d *Device, fixes []Fix) Frame {
+	var data []byte
+	for _, fix := range fixes {
+		data = append(data, gt06Packet(gt06Location, gt06GPS(fix, false), uint16(d.Sequence()))...)
+	}
+	return Frame{Kind: KindBatch, Data: data}
+}
+
+// gt06Packet builds 78 78, length, protocol number, content, serial, CRC-ITU of the length to the
+// serial and 0D 0A
+func gt06Packet(protocol byte, content []byte, serial uint16) []byte {
+	var packet bytes.Buffer
+	packet.Write([]byte{0x78, 0x78, byte(1 + len(content) + 2 + 2), protocol})
+	packet.Write(content)
+	binary.Write(&packet, binary.BigEndian, serial)
+	binary.Write(&packet, binary.BigEndian, crc16(packet.Bytes()[2:], 0xFFFF, 0xFFFF))
+	packet.Write([]byte{0x0D, 0x0A})
+	return packet.Bytes()
+}
+
+// gt06GPS builds the GPS and LBS information of location and alarm packets, alarms have the
+// length of the LBS information before it
+func gt06GPS(fix Fix, alarm bool) []byte {
+	var content bytes.Buffer
+	t := fix.Time.UTC()
+	content.Write([]byte{byte(t.Year() % 100), byte(t.Month()), byte(t.Day()), byte(t.Hour()), byte(t.Minute()), byte(t.Second())})
+	content.WriteByte(0xC0 | byte(min(fix.Satellites, 15)))
+	binary.Write(&content, binary.BigEndian, uint32(math.Abs(fix.Latitude)*1800000))
+	binary.Write(&content, binary.BigEndian, uint32(math.Abs(fix.Longitude)*1800000))
+	content.WriteByte(byte(min(fix.Speed, 255)))
+	status := uint16(0x1000) | uint16(fix.Heading)&0x3FF // Positioned
+	if fix.Longitude < 0 {
+		status |= 0x0800
+	}
+	if fix.Latitude >= 0 {
+		status |= 0x0400
+	}
+	binary.Write(&content, binary.BigEndian, status)
+	if alarm {
+		content.WriteByte(9)
+	}
+	content.Write([]byte{0x01, 0x4E, 0x14, 0x20, 0xA2, 0xB3, 0xDE, 0x86}) // MCC 334, MNC 20, LAC, cell ID
+	return content.Bytes()
+}
@@ -0,0 +1,123 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Events of the AAA reports
+const (
+	meitrackSOS       = 1
+	meitrackHeartbeat = 31
+	meitrackTrack     = 35
+)
+
+// meitrackEpoch is the origin of the CCE timestamps
+var meitrackEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Meitrack simulates T366 trackers: AAA ASCII reports for positions, alarms and heartbeats and
+// CCE binary reports for the buffered positions. Meitrack devices do not wait for replies.
+type Meitrack struct{}
+
+func (Meitrack) Name() string { return "meitrack" }
+
+func (Meitrack) TAC() string { return "86450703" }
+
+func (Meitrack) Login(d *Device) *Frame { return nil }
+
+func (Meitrack) Heartbeat(d *Device) *Frame {
+	return &Frame{Kind: KindHeartbeat, Data: meitrackAAA(d, meitrackHeartbeat, d.LastFix())}
+}
+
+func (Meitrack) Position(d *Device, fix Fix) Frame {
+	return Frame{Kind: KindPosition, Data: meitrackAAA(d, meitrackTrack, fix)}
+}
+
+func (Meitrack) Alarm(d *Device, fix Fix) Frame {
+	return Frame{Kind: KindAlarm, Data: meitrackAAA(d, meitrackSOS, fix)}
+}
+
+// Batch sends the positions as the packets of one CCE report
+func (Meitrack) Batch(d *Device, fixes []Fix) Frame {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(0)) // Remaining cache records
+	binary.Write(&body, binary.LittleEndian, uint16(len(fixes)))
+	for _, fix := range fixes {
+		body.Write(meitrackCCEPacket(fix))
+	}
+	return Frame{Kind: KindBatch, Data: meitrackFrame(d, "CCE", body.Bytes())}
+}
+
+// meitrackAAA builds an AAA report: event, latitude, longitude, time, fix status, satellites,
+// GSM signal, speed, direction, HDOP, altitude, mileage, run time, base station, I/O status,
+// analog inputs and the assisted event info
+func meitrackAAA(d *Device, event int, fix Fix) []byte {
+	body := fmt.Sprintf("%d,%.6f,%.6f,%s,A,%d,24,%.0f,%.0f,0.9,%.0f,%.0f,%.0f,334|20|20A2|02B3DE86,0000,0001|0000|0000|01A5|0514,,,3,,,108,106",
+		event, fix.Latitude, fix.Longitude, fix.Time.UTC().Format("060102150405"), fix.Satellites,
+		fix.Speed, fix.Heading, fix.Altitude, fix.Mileage, fix.RunTime.Seconds())
+	return meitrackFrame(d, "AAA", []byte(body))
+}
+
+// meitrackFrame wraps a command body as $$<flag><length>,<IMEI>,<command>,<body>*<checksum>\r\n.
+// The length counts from the comma before the IMEI to the trailing \r\n and the checksum is the
+// sum of the bytes up to the *.
+func meitrackFrame(d *Device, command string, body []byte) []byte {
+	var rest bytes.Buffer
+	rest.WriteString("," + d.IMEI + "," + command + ",")
+	rest.Write(body)
+	rest.WriteString("*")
+	length := rest.Len() + 4 // Checksum and \r\n
+
+	var frame bytes.Buffer
+	fmt.Fprintf(&frame, "$$%c%d", 'A'+byte(d.Sequence()%26), length)
+	frame.Write(rest.Bytes())
+	sum := byte(0)
+	for _, b := range frame.Bytes() {
+		sum += b
+	}
+	fmt.Fprintf(&frame, "%02X\r\n", sum)
+	return frame.Bytes()
+}
+
+// meitrackCCEPacket builds a CCE data packet: its length, the number of IDs and the IDs grouped by
+// value size. Every group has IDs, the parser reads a second count when one is 0.
+func meitrackCCEPacket(fix Fix) []byte {
+	var ids bytes.Buffer
+	ids.WriteByte(6)
+	ids.Write([]byte{0x01, meitrackTrack, 0x05, 1, 0x06, byte(fix.Satellites), 0x07, 24, 0x14, 0, 0x15, 0})
+	ids.WriteByte(6)
+	for _, id := range []struct {
+		id    byte
+		value uint16
+	}{
+		{0x08, uint16(fix.Speed)}, {0x09, uint16(fix.Heading)}, {0x0a, 9}, {0x0b, uint16(fix.Altitude)},
+		{0x16, 1250}, {0x17, 0},
+	} {
+		ids.WriteByte(id.id)
+		binary.Write(&ids, binary.LittleEndian, id.value)
+	}
+	ids.WriteByte(5)
+	for _, id := range []struct {
+		id    byte
+		value uint32
+	}{
+		{0x02, uint32(int32(math.Round(fix.Latitude * 1e6)))},
+		{0x03, uint32(int32(math.Round(fix.Longitude * 1e6)))},
+		{0x04, uint32(fix.Time.Sub(meitrackEpoch).Seconds())},
+		{0x0c, uint32(fix.Mileage)},
+		{0x0d, uint32(fix.RunTime.Seconds())},
+	} {
+		ids.WriteByte(id.id)
+		binary.Write(&ids, binary.LittleEndian, id.value)
+	}
+	ids.WriteByte(0) // Undefined IDs
+
+	var packet bytes.Buffer
+	binary.Write(&packet, binary.LittleEndian, uint16(ids.Len()+4))
+	binary.Write(&packet, binary.LittleEndian, uint16(6+6+5))
+	packet.Write(ids.Bytes())
+	return packet.Bytes()
+}
@@ -0,0 +1,70 @@
+package usecases
+
+import (
+	"sort"
+)
+
+// Kinds of frames
+const (
+	KindLogin     = "login"
+	KindHeartbeat = "heartbeat"
+	KindPosition  = "position"
+	KindAlarm     = "alarm"
+	KindBatch     = "batch"
+	KindMalformed = "malformed"
+)
+
+// Frame is what a virtual device writes to its TCP connection
+type Frame struct {
+	Kind string
+	Data []byte
+	Ack  func(reply []byte) bool // Recognizes the reply the device waits for, nil when it waits for none
+}
+
+// Protocol builds the frames of a device model. Login and Heartbeat return nil when the
+// protocol has none.
+type Protocol interface {
+	Name() string // The interpreter the frames are for
+	TAC() string  // Type allocation code of the IMEIs
+	Login(d *Device) *Frame
+	Heartbeat(d *Device) *Frame
+	Position(d *Device, fix Fix) Frame
+	Alarm(d *Device, fix Fix) Frame
+	Batch(d *Device, fixes []Fix) Frame
+}
+
+// Protocols are the simulated device models by name
+var Protocols = map[string]Protocol{
+	"gt06":     GT06{},
+	"meitrack": Meitrack{},
+	"queclink": Queclink{},
+	"ruptela":  Ruptela{},
+	"suntech":  Suntech{},
+}
+
+// ProtocolNames returns the names of the simulated protocols, sorted
+func ProtocolNames() []string {
+	names := make([]string, 0, len(Protocols))
+	for name := range Protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// crc16 computes the reflected CCITT CRC (polynomial 0x8408) of GT06 (CRC-ITU: init and final
+// xor 0xFFFF) and Ruptela (Kermit: init and final xor 0)
+func crc16(data []byte, init uint16, xor uint16) uint16 {
+	crc := init
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc ^ xor
+}
@@ -0,0 +1,75 @@
+package usecases
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// queclinkVersion is the <Protocol Version> of a GV300W
+const queclinkVersion = "300400"
+
+// Queclink simulates GV300W trackers speaking the @Track ASCII protocol: +RESP:GTFRI positions,
+// +RESP:GTSOS alarms, +BUFF:GTFRI batches and +ACK:GTHBD heartbeats, answered with +SACK:GTHBD
+type Queclink struct{}
+
+func (Queclink) Name() string { return "queclink" }
+
+func (Queclink) TAC() string { return "86469606" }
+
+func (Queclink) Login(d *Device) *Frame { return nil }
+
+func (Queclink) Heartbeat(d *Device) *Frame {
+	count := fmt.Sprintf("%04X", d.Sequence())
+	frame := fmt.Sprintf("+ACK:GTHBD,%s,%s,,%s,%s$", queclinkVersion, d.IMEI, queclinkTime(time.Now()), count)
+	ack := fmt.Sprintf("+SACK:GTHBD,%s,%s$", queclinkVersion, count)
+	return &Frame{Kind: KindHeartbeat, Data: []byte(frame), Ack: func(reply []byte) bool {
+		return string(reply) == ack
+	}}
+}
+
+func (Queclink) Position(d *Device, fix Fix) Frame {
+	return Frame{Kind: KindPosition, Data: []byte(queclinkFRI(d, "+RESP", []Fix{fix}))}
+}
+
+func (Queclink) Alarm(d *Device, fix Fix) Frame {
+	frame := fmt.Sprintf("+RESP:GTSOS,%s,%s,,,0,1,%s,%.1f,%s,%04X$",
+		queclinkVersion, d.IMEI, queclinkPosition(fix), fix.Mileage/1000, queclinkTime(fix.Time), d.Sequence())
+	return Frame{Kind: KindAlarm, Data: []byte(frame)}
+}
+
+// Batch sends the positions in +BUFF:GTFRI reports of up to 15 positions each, in one payload
+func (Queclink) Batch(d *Device, fixes []Fix) Frame {
+	var frames []string
+	for len(fixes) > 0 {
+		n := min(len(fixes), 15)
+		frames = append(frames, queclinkFRI(d, "+BUFF", fixes[:n]))
+		fixes = fixes[n:]
+	}
+	return Frame{Kind: KindBatch, Data: []byte(strings.Join(frames, ""))}
+}
+
+// queclinkFRI builds a GTFRI report of a vehicle tracker with the positions of fixes
+func queclinkFRI(d *Device, header string, fixes []Fix) string {
+	positions := make([]string, 0, len(fixes))
+	for _, fix := range fixes {
+		positions = append(positions, queclinkPosition(fix))
+	}
+	last := fixes[len(fixes)-1]
+	hours := int(last.RunTime.Hours())
+	hourMeter := fmt.Sprintf("%05d:%02d:%02d", hours, int(last.RunTime.Minutes())%60, int(last.RunTime.Seconds())%60)
+	return fmt.Sprintf("%s:GTFRI,%s,%s,,12500,10,%d,%s,%.1f,%s,,,,100,220100,,,,%s,%04X$",
+		header, queclinkVersion, d.IMEI, len(fixes), strings.Join(positions, ","),
+		last.Mileage/1000, hourMeter, queclinkTime(last.Time), d.Sequence())
+}
+
+// queclinkPosition builds a position block: accuracy, speed, azimuth, altitude, longitude,
+// latitude, GPS time, MCC, MNC, LAC, cell ID and a reserved field
+func queclinkPosition(fix Fix) string {
+	return fmt.Sprintf("1,%.1f,%.0f,%.1f,%.6f,%.6f,%s,0334,0020,20A2,02B3DE86,00",
+		fix.Speed, fix.Heading, fix.Altitude, fix.Longitude, fix.Latitude, queclinkTime(fix.Time))
+}
+
+func queclinkTime(t time.Time) string {
+	return t.UTC().Format("20060102150405")
+}
@@ -0,0 +1,151 @@
+package usecases
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const earthRadius = 6371000.0 // meters
+
+// Point is a WGS84 position
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Route is a closed path the virtual devices drive around, the last point joins the first
+type Route []Point
+
+// LoopRoute returns a circle of points around a center, radius in meters
+func LoopRoute(center Point, radius float64, points int) Route {
+	if points < 3 {
+		points = 3
+	}
+	route := make(Route, 0, points)
+	for i := 0; i < points; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(points)
+		route = append(route, Point{
+			Latitude:  center.Latitude + radius*math.Cos(angle)/earthRadius*180/math.Pi,
+			Longitude: center.Longitude + radius*math.Sin(angle)/(earthRadius*math.Cos(center.Latitude*math.Pi/180))*180/math.Pi,
+		})
+	}
+	return route
+}
+
+// LoadRoute reads a route from a file with one "latitude,longitude" point per line. Empty lines,
+// comments (#) and lines that are not two numbers, like a CSV header, are skipped.
+func LoadRoute(path string) (Route, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var route Route
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+		if len(fields) < 2 {
+			continue
+		}
+		latitude, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if err != nil {
+			continue
+		}
+		longitude, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			continue
+		}
+		if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			return nil, fmt.Errorf("%s: invalid point %v,%v", path, latitude, longitude)
+		}
+		route = append(route, Point{Latitude: latitude, Longitude: longitude})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(route) < 2 {
+		return nil, fmt.Errorf("%s: a route needs at least 2 points", path)
+	}
+	return route, nil
+}
+
+// ParsePoint parses "latitude,longitude"
+func ParsePoint(value string) (Point, error) {
+	latitude, longitude, ok := strings.Cut(value, ",")
+	if !ok {
+		return Point{}, fmt.Errorf("invalid point %q, expected latitude,longitude", value)
+	}
+	var point Point
+	var err error
+	if point.Latitude, err = strconv.ParseFloat(strings.TrimSpace(latitude), 64); err != nil {
+		return Point{}, fmt.Errorf("invalid latitude %q", latitude)
+	}
+	if point.Longitude, err = strconv.ParseFloat(strings.TrimSpace(longitude), 64); err != nil {
+		return Point{}, fmt.Errorf("invalid longitude %q", longitude)
+	}
+	return point, nil
+}
+
+// Length returns the length of the route in meters
+func (r Route) Length() float64 {
+	length := 0.0
+	for i := range r {
+		length += Distance(r[i], r[(i+1)%len(r)])
+	}
+	return length
+}
+
+// At returns the position and heading, in degrees, at a distance in meters from the start of
+// the route, going around as many times as needed
+func (r Route) At(distance float64) (Point, float64) {
+	if len(r) == 0 {
+		return Point{}, 0
+	}
+	if len(r) == 1 {
+		return r[0], 0
+	}
+	length := r.Length()
+	if length == 0 {
+		return r[0], 0
+	}
+	distance = math.Mod(distance, length)
+	if distance < 0 {
+		distance += length
+	}
+	for i := range r {
+		from, to := r[i], r[(i+1)%len(r)]
+		segment := Distance(from, to)
+		if distance <= segment && segment > 0 {
+			fraction := distance / segment
+			return Point{
+				Latitude:  from.Latitude + (to.Latitude-from.Latitude)*fraction,
+				Longitude: from.Longitude + (to.Longitude-from.Longitude)*fraction,
+			}, Bearing(from, to)
+		}
+		distance -= segment
+	}
+	return r[0], Bearing(r[0], r[1])
+}
+
+// Distance returns the great circle distance between two points in meters
+func Distance(a Point, b Point) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Bearing returns the initial heading from a to b in degrees, 0 is north
+func Bearing(a Point, b Point) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
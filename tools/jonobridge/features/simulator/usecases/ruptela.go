@@ -0,0 +1,85 @@
+package usecases
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// Events of the records
+const (
+	ruptelaDin1  = 2 // Digital input 1, wired to the panic button
+	ruptelaTrack = 7 // Periodic record
+)
+
+// Ruptela simulates FM-Eco4 trackers sending records (command 1). The devices wait for the
+// 64 01 acknowledgement of every packet, which the ruptela interpreter does not send today.
+type Ruptela struct{}
+
+func (Ruptela) Name() string { return "ruptela" }
+
+func (Ruptela) TAC() string { return "86358104" }
+
+func (Ruptela) Login(d *Device) *Frame { return nil }
+
+func (Ruptela) Heartbeat(d *Device) *Frame { return nil }
+
+func (Ruptela) Position(d *Device, fix Fix) Frame {
+	return ruptelaPacket(d, KindPosition, ruptelaTrack, []Fix{fix})
+}
+
+func (Ruptela) Alarm(d *Device, fix Fix) Frame {
+	return ruptelaPacket(d, KindAlarm, ruptelaDin1, []Fix{fix})
+}
+
+func (Ruptela) Batch(d *Device, fixes []Fix) Frame {
+	return ruptelaPacket(d, KindBatch, ruptelaTrack, fixes)
+}
+
+// ruptelaPacket builds a records packet: length, IMEI, command, records left, number of records,
+// the records and the CRC16 (Kermit) of everything after the length
+func ruptelaPacket(d *Device, kind string, event byte, fixes []Fix) Frame {
+	imei, _ := strconv.ParseUint(d.IMEI, 10, 64)
+	var body bytes.Buffer
+	binary.Write(&body, binary.BigEndian, imei)
+	body.Write([]byte{0x01, 0x00, byte(len(fixes))})
+	for _, fix := range fixes {
+		ruptelaRecord(&body, event, fix)
+	}
+
+	var packet bytes.Buffer
+	binary.Write(&packet, binary.BigEndian, uint16(body.Len()))
+	packet.Write(body.Bytes())
+	binary.Write(&packet, binary.BigEndian, crc16(body.Bytes(), 0, 0))
+	return Frame{Kind: kind, Data: packet.Bytes(), Ack: ruptelaAck}
+}
+
+// ruptelaRecord writes a record: time, priority, GPS element, event and the IO elements
+// grouped by size, here only the ignition (ID 5)
+func ruptelaRecord(body *bytes.Buffer, event byte, fix Fix) {
+	ignition := byte(0)
+	if fix.Speed > 0 {
+		ignition = 1
+	}
+	binary.Write(body, binary.BigEndian, uint32(fix.Time.Unix()))
+	body.Write([]byte{0x00, 0x00}) // Timestamp extension and priority
+	binary.Write(body, binary.BigEndian, int32(math.Round(fix.Longitude*1e7)))
+	binary.Write(body, binary.BigEndian, int32(math.Round(fix.Latitude*1e7)))
+	binary.Write(body, binary.BigEndian, uint16(fix.Altitude*10))
+	binary.Write(body, binary.BigEndian, uint16(fix.Heading*100))
+	body.WriteByte(byte(fix.Satellites))
+	binary.Write(body, binary.BigEndian, uint16(fix.Speed))
+	body.WriteByte(9) // HDOP x10
+	body.WriteByte(event)
+	body.Write([]byte{1, 5, ignition}) // 1 byte IO elements
+	body.Write([]byte{0, 0, 0})        // 2, 4 and 8 byte IO elements
+}
+
+// ruptelaAck recognizes the acknowledgement 64 01 and its CRC, with or without its length
+func ruptelaAck(reply []byte) bool {
+	if len(reply) == 6 && reply[0] == 0x00 && reply[1] == 0x02 {
+		reply = reply[2:]
+	}
+	return len(reply) == 4 && reply[0] == 0x64 && reply[1] == 0x01
+}
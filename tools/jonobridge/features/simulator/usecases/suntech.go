@@ -0,0 +1,49 @@
+package usecases
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Suntech simulates ST4300 trackers: STT status reports, EMG emergency reports and ALV keep
+// alives. Suntech devices do not wait for replies.
+type Suntech struct{}
+
+func (Suntech) Name() string { return "suntech" }
+
+func (Suntech) TAC() string { return "90710025" }
+
+func (Suntech) Login(d *Device) *Frame { return nil }
+
+func (Suntech) Heartbeat(d *Device) *Frame {
+	return &Frame{Kind: KindHeartbeat, Data: []byte("ST4300ALV;" + d.IMEI)}
+}
+
+func (Suntech) Position(d *Device, fix Fix) Frame {
+	return Frame{Kind: KindPosition, Data: []byte(suntechReport("STT", "18", d, fix))}
+}
+
+func (Suntech) Alarm(d *Device, fix Fix) Frame {
+	return Frame{Kind: KindAlarm, Data: []byte(suntechReport("EMG", "19", d, fix))}
+}
+
+// Batch sends the stored reports back to back, separated by CR as the device flushes them
+func (Suntech) Batch(d *Device, fixes []Fix) Frame {
+	reports := make([]string, 0, len(fixes))
+	for _, fix := range fixes {
+		reports = append(reports, suntechReport("STT", "18", d, fix))
+	}
+	return Frame{Kind: KindBatch, Data: []byte(strings.Join(reports, "\r"))}
+}
+
+// suntechReport builds a report: header, IMEI, message type, time, latitude, longitude, speed,
+// course, satellites, HDOP, altitude, ignition, battery, odometer, inputs and outputs
+func suntechReport(command string, messageType string, d *Device, fix Fix) string {
+	ignition := 0
+	if fix.Speed > 0 {
+		ignition = 1
+	}
+	return fmt.Sprintf("ST4300%s;%s;%s;%s;%+.6f;%+.6f;%.1f;%.0f;%d;0.9;%.0f;%d;12.6;%.1f;%d;0",
+		command, d.IMEI, messageType, fix.Time.UTC().Format("20060102150405"), fix.Latitude, fix.Longitude,
+		fix.Speed, fix.Heading, fix.Satellites, fix.Altitude, ignition, fix.Mileage/1000, ignition)
+}
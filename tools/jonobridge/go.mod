@@ -0,0 +1,48 @@
+module jonobridge
+
+go 1.23.2
+
+require (
+	github.com/MaddSystems/jonobridge/common v0.0.0-00010101000000-000000000000
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/stretchr/testify v1.10.0
+	huabaoprotocol v0.0.0-00010101000000-000000000000
+	meitrackprotocol v0.0.0-00010101000000-000000000000
+	pinoprotocol v0.0.0-00010101000000-000000000000
+	queclinkprotocol v0.0.0-00010101000000-000000000000
+	ruptelaprotocol v0.0.0-00010101000000-000000000000
+	skywaveprotocol v0.0.0-00010101000000-000000000000
+	suntechprotocol v0.0.0-00010101000000-000000000000
+	xpot v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/mochi-mqtt/server/v2 v2.7.9 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	golang.org/x/exp v0.0.0-20241210194714-1829a127f884 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// Replace directives pointing to the local modules
+replace github.com/MaddSystems/jonobridge/common => ../../common
+
+replace huabaoprotocol => ../../interpreters/huabao
+
+replace meitrackprotocol => ../../interpreters/meitrackprotocol
+
+replace pinoprotocol => ../../interpreters/pinoprotocol
+
+replace queclinkprotocol => ../../interpreters/queclinkprotocol
+
+replace ruptelaprotocol => ../../interpreters/ruptelaprotocol
+
+replace skywaveprotocol => ../../interpreters/skywaveprotocol
+
+replace suntechprotocol => ../../interpreters/suntech
+
+replace xpot => ../../interpreters/xpot
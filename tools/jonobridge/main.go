@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	audit "jonobridge/features/audit/usecases"
+	decoders "jonobridge/features/decoders/usecases"
+	replay "jonobridge/features/replay/usecases"
+	simulator "jonobridge/features/simulator/usecases"
+
+	"github.com/MaddSystems/jonobridge/common/broker"
+	"github.com/MaddSystems/jonobridge/common/utils"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const usage = `Usage: jonobridge [-v] <command> [flags]
+
+Commands:
+  audit     Print the archived frames of a device, re-decoded with the current code
+  replay    Run captured payloads through an interpreter and diff the Jono output with a golden set
+  simulate  Publish the traffic of virtual devices on tracker/from-tcp and check the replies
+`
+
+// stdout is where the commands write their output. The decoders print debug lines with fmt, so
+// os.Stdout is pointed to stderr to keep them out of it.
+var stdout = os.Stdout
+
+// parseTime parses an RFC 3339 time or a date, in UTC
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+}
+
+// runAudit prints the frames of an IMEI between two times as JSONL, with the Jono output of the
+// current code when -redecode is set
+func runAudit(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	dir := flags.String("dir", os.Getenv("FRAME_ARCHIVE_DIR"), "frame archive directory (FRAME_ARCHIVE_DIR)")
+	imei := flags.String("imei", "", "device IMEI")
+	from := flags.String("from", "", "first time, RFC 3339 or YYYY-MM-DD")
+	to := flags.String("to", "", "end time (exclusive), RFC 3339 or YYYY-MM-DD")
+	interpreter := flags.String("interpreter", "", "only frames of this interpreter")
+	redecode := flags.Bool("redecode", false, "decode the frames again, interpreters: "+strings.Join(decoders.Names(), ", "))
+	flags.Parse(args)
+
+	if *dir == "" {
+		return fmt.Errorf("no archive directory, set -dir or FRAME_ARCHIVE_DIR")
+	}
+	query := utils.ArchiveQuery{IMEI: *imei, Interpreter: *interpreter}
+	var err error
+	if query.From, err = parseTime(*from); err != nil {
+		return err
+	}
+	if query.To, err = parseTime(*to); err != nil {
+		return err
+	}
+
+	frames, err := utils.ReadArchive(*dir, query)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(stdout)
+	changed := 0
+	for _, frame := range frames {
+		if !*redecode {
+			if err := encoder.Encode(frame); err != nil {
+				return err
+			}
+			continue
+		}
+		audited := audit.Redecode(frame)
+		if audited.Changed {
+			changed++
+		}
+		if err := encoder.Encode(audited); err != nil {
+			return err
+		}
+	}
+	if *redecode {
+		fmt.Fprintf(os.Stderr, "%d frames, %d with a different output\n", len(frames), changed)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d frames\n", len(frames))
+	}
+	return nil
+}
+
+// runReplay decodes the payloads of capture files with an interpreter, writes the output with
+// -out and prints the regressions against -golden as JSONL, with a summary by message type
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	interpreter := flags.String("interpreter", "", "interpreter to decode with: "+strings.Join(decoders.Names(), ", "))
+	golden := flags.String("golden", "", "output of a previous replay to diff with")
+	out := flags.String("out", "", "write the output of this replay, to use as golden set")
+	ignore := flags.String("ignore", "", "comma separated fields left out of the diff, as ListPackets.*.Datetime")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jonobridge replay -interpreter <name> [-golden file] [-out file] <captures>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *interpreter == "" || flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	var captures []replay.Capture
+	for _, path := range flags.Args() {
+		read, err := replay.ReadCaptures(path)
+		if err != nil {
+			return err
+		}
+		captures = append(captures, read...)
+	}
+	results, err := replay.Replay(*interpreter, captures)
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		if err := replay.WriteResults(file, results); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d captures, %d with a decode error\n", len(results), failed)
+	if *golden == "" {
+		return nil
+	}
+
+	expected, err := replay.ReadResults(*golden)
+	if err != nil {
+		return err
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(*ignore, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	report := replay.Compare(expected, results, patterns)
+	encoder := json.NewEncoder(stdout)
+	for _, regression := range report.Regressions {
+		if err := encoder.Encode(regression); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d unchanged, %d regressions, %d without golden output\n", report.Unchanged, len(report.Regressions), report.New)
+	for _, summary := range report.ByType() {
+		fields := make([]string, 0, len(summary.Fields))
+		for field := range summary.Fields {
+			fields = append(fields, field)
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			if summary.Fields[fields[i]] != summary.Fields[fields[j]] {
+				return summary.Fields[fields[i]] > summary.Fields[fields[j]]
+			}
+			return fields[i] < fields[j]
+		})
+		for i, field := range fields {
+			fields[i] = fmt.Sprintf("%s (%d)", field, summary.Fields[field])
+		}
+		fmt.Fprintf(os.Stderr, "  %-30s %5d  %s\n", summary.MessageType, summary.Regressions, strings.Join(fields, ", "))
+	}
+	if len(report.Regressions) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// runSimulate drives a fleet of virtual devices through the broker until -duration or a signal,
+// printing the stats every -stats
+func runSimulate(args []string) error {
+	config := simulator.DefaultConfig
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	mqttFlags := broker.RegisterFlags(flags)
+	topic := flags.String("topic", "tracker/from-tcp", "topic the frames are published on")
+	replies := flags.String("replies", "tracker/send", "topic the replies to the devices come on")
+	protocols := flags.String("protocols", strings.Join(simulator.ProtocolNames(), ","), "comma separated protocols to simulate")
+	devices := flags.Int("devices", 10, "devices per protocol")
+	routeFile := flags.String("route", "", `file with one "latitude,longitude" point per line, the devices loop around it`)
+	center := flags.String("center", "19.4326,-99.1332", "center of the circular route when there is no -route")
+	radius := flags.Float64("radius", 2000, "radius of the circular route in meters")
+	duration := flags.Duration("duration", 0, "stop after this long (default run until interrupted)")
+	statsEvery := flags.Duration("stats", 10*time.Second, "print the stats this often")
+	flags.DurationVar(&config.Interval, "interval", config.Interval, "time between position reports of a device")
+	flags.DurationVar(&config.HeartbeatInterval, "heartbeat", config.HeartbeatInterval, "time between heartbeats, 0 for none")
+	flags.DurationVar(&config.AckTimeout, "ack-timeout", config.AckTimeout, "how long a device waits for a reply")
+	flags.Float64Var(&config.AlarmRate, "alarm-rate", config.AlarmRate, "chance of a report to be an alarm")
+	flags.Float64Var(&config.BatchRate, "batch-rate", config.BatchRate, "chance of a device to go offline and send its positions in one batch")
+	flags.IntVar(&config.BatchSize, "batch-size", config.BatchSize, "positions of a batch")
+	flags.Float64Var(&config.MalformedRate, "malformed-rate", config.MalformedRate, "chance of a report to be truncated, corrupted or garbage")
+	flags.Float64Var(&config.Speed, "speed", config.Speed, "average speed in km/h")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "seed of the routes and events, runs with the same seed send the same traffic")
+	flags.Parse(args)
+
+	mqttConfig, err := mqttFlags.Load()
+	if err != nil {
+		return err
+	}
+	// With mem:// the simulator hosts the broker, the interpreters reach it on MQTT_EMBEDDED_LISTEN
+	if broker.IsMem(mqttConfig.URL) && os.Getenv("MQTT_EMBEDDED_LISTEN") == "" {
+		return fmt.Errorf("mem:// needs MQTT_EMBEDDED_LISTEN, the address the interpreters connect to")
+	}
+	var route simulator.Route
+	if *routeFile != "" {
+		if route, err = simulator.LoadRoute(*routeFile); err != nil {
+			return err
+		}
+	} else {
+		point, err := simulator.ParsePoint(*center)
+		if err != nil {
+			return err
+		}
+		route = simulator.LoopRoute(point, *radius, 36)
+	}
+
+	var client mqtt.Client
+	fleet := simulator.NewFleet(config, func(topic string, payload []byte) error {
+		token := mqttConfig.Publish(client, topic, payload)
+		token.Wait()
+		return token.Error()
+	})
+	fleet.Topic = *topic
+	for _, name := range strings.Split(*protocols, ",") {
+		protocol, ok := simulator.Protocols[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown protocol %q, expected: %s", name, strings.Join(simulator.ProtocolNames(), ", "))
+		}
+		fleet.Add(protocol, *devices, route)
+	}
+
+	opts, err := mqttConfig.ClientOptions()
+	if err != nil {
+		return err
+	}
+	opts.SetClientID(fmt.Sprintf("jonobridge_simulate_%d", time.Now().UnixNano()%100000))
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		token := mqttConfig.Subscribe(c, *replies, 1, func(_ mqtt.Client, msg mqtt.Message) {
+			fleet.Deliver(msg.Payload())
+		})
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Error subscribing to %s: %v", *replies, token.Error())
+		}
+	})
+	client = mqtt.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("connecting to %s: %v", mqttConfig.URL, token.Error())
+	}
+	defer client.Disconnect(250)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	fmt.Fprintf(os.Stderr, "Simulating %d devices on %s, publishing to %s\n", fleet.Devices(), mqttConfig.URL, *topic)
+
+	done := make(chan struct{})
+	go func() {
+		fleet.Run(ctx)
+		close(done)
+	}()
+	ticker := time.NewTicker(*statsEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			printStats(fleet.Stats())
+		case <-done:
+			printStats(fleet.Stats())
+			return nil
+		}
+	}
+}
+
+// printStats prints a line with the counters of a fleet
+func printStats(stats simulator.Stats) {
+	kinds := make([]string, 0, len(stats.Sent))
+	for kind := range stats.Sent {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	sent := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		sent = append(sent, fmt.Sprintf("%s %d", kind, stats.Sent[kind]))
+	}
+	fmt.Fprintf(os.Stderr, "sent: %s | acked %d, timeouts %d, unsolicited %d, errors %d\n",
+		strings.Join(sent, ", "), stats.Acked, stats.Timeouts, stats.Unsolicited, stats.Errors)
+}
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	log.SetFlags(0)
+	os.Stdout = os.Stderr
+
+	var err error
+	switch flag.Arg(0) {
+	case "audit":
+		err = runAudit(flag.Args()[1:])
+	case "replay":
+		err = runReplay(flag.Args()[1:])
+	case "simulate":
+		err = runSimulate(flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}